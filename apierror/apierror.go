@@ -0,0 +1,135 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Code is a stable, machine readable name for what went wrong. Clients are
+// meant to switch on it, so a code is never renamed once released.
+type Code string
+
+// Generic codes, used when nothing more specific applies.
+const (
+	CodeInternal         Code = "internal"
+	CodeInvalidRequest   Code = "invalid_request"
+	CodeValidationFailed Code = "validation_failed"
+	CodeUnauthenticated  Code = "unauthenticated"
+	CodePermissionDenied Code = "permission_denied"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeRateLimited      Code = "rate_limited"
+	CodeUnavailable      Code = "unavailable"
+)
+
+// FieldError is one problem with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the body of every error response of every service.
+type Error struct {
+	Code      Code         `json:"code"`
+	Status    int          `json:"status"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"request_id,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+func New(status int, code Code, message string) *Error {
+	return &Error{
+		Code:    code,
+		Status:  status,
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Write sends the error as JSON. The request ID is taken from the response
+// header set by WithRequestID unless the error already carries one.
+func Write(w http.ResponseWriter, e *Error) {
+	response := *e
+	if response.RequestID == "" {
+		response.RequestID = w.Header().Get(RequestIDHeader)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.Status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Mapping ties an error to how it is reported.
+type Mapping struct {
+	Err    error
+	Status int
+	Code   Code
+}
+
+// Mapper reports errors by the first mapping they match with errors.Is.
+type Mapper []Mapping
+
+// Map turns any error into an Error. Errors that already are one, directly
+// or as a gRPC status, are kept as they are. Everything unknown is
+// reported as internal.
+func (m Mapper) Map(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if apiErr, ok := FromGRPC(err); ok {
+		return apiErr
+	}
+
+	for _, mapping := range m {
+		if errors.Is(err, mapping.Err) {
+			return New(mapping.Status, mapping.Code, err.Error())
+		}
+	}
+
+	return New(http.StatusInternalServerError, CodeInternal, err.Error())
+}
+
+// MapStatus is Map with the status decided by the caller, for endpoints
+// that report an error differently from the rest. The code is kept, except
+// that unknown errors get the generic code of the status.
+func (m Mapper) MapStatus(err error, status int) *Error {
+	apiErr := *m.Map(err)
+	if apiErr.Code == CodeInternal {
+		apiErr.Code = CodeForStatus(status)
+	}
+	apiErr.Status = status
+
+	return &apiErr
+}
+
+// CodeForStatus is the generic code of an HTTP status.
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodePermissionDenied
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
@@ -0,0 +1,139 @@
+package apierror_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errDummy = errors.New("dummy error")
+
+const codeDummy apierror.Code = "dummy"
+
+var dummyMapper = apierror.Mapper{
+	{Err: errDummy, Status: http.StatusConflict, Code: codeDummy},
+}
+
+func TestMapper(t *testing.T) {
+	t.Run("maps wrapped error by mapping", func(t *testing.T) {
+		got := dummyMapper.Map(fmt.Errorf("context: %w", errDummy))
+
+		assert.Equal(t, *got, apierror.Error{
+			Code:    codeDummy,
+			Status:  http.StatusConflict,
+			Message: "context: dummy error",
+		})
+	})
+
+	t.Run("reports unknown error as internal", func(t *testing.T) {
+		got := dummyMapper.Map(errors.New("unknown"))
+
+		assert.Equal(t, got.Code, apierror.CodeInternal)
+		assert.Equal(t, got.Status, http.StatusInternalServerError)
+	})
+
+	t.Run("keeps wrapped Error as is", func(t *testing.T) {
+		want := apierror.New(http.StatusForbidden, "custom", "custom error")
+
+		got := dummyMapper.Map(fmt.Errorf("context: %w", want))
+		assert.Equal(t, got, want)
+	})
+
+	t.Run("overrides status but keeps code", func(t *testing.T) {
+		got := dummyMapper.MapStatus(errDummy, http.StatusNotFound)
+
+		assert.Equal(t, got.Code, codeDummy)
+		assert.Equal(t, got.Status, http.StatusNotFound)
+	})
+
+	t.Run("gives unknown error generic code of overridden status", func(t *testing.T) {
+		got := dummyMapper.MapStatus(errors.New("unknown"), http.StatusUnauthorized)
+
+		assert.Equal(t, got.Code, apierror.CodeUnauthenticated)
+		assert.Equal(t, got.Status, http.StatusUnauthorized)
+	})
+}
+
+func TestGRPC(t *testing.T) {
+	t.Run("round trips Error through gRPC status", func(t *testing.T) {
+		want := &apierror.Error{
+			Code:      apierror.CodeValidationFailed,
+			Status:    http.StatusUnprocessableEntity,
+			Message:   "request is invalid",
+			RequestID: "dummy-request-id",
+			Fields:    []apierror.FieldError{{Field: "email", Message: "is required"}},
+		}
+
+		st := status.Convert(want)
+		assert.Equal(t, st.Code(), codes.InvalidArgument)
+
+		got, ok := apierror.FromGRPC(st.Err())
+		assert.Equal(t, ok, true)
+		assert.Equal(t, got, want)
+	})
+
+	t.Run("derives Error from plain gRPC status", func(t *testing.T) {
+		got, ok := apierror.FromGRPC(status.Error(codes.Unavailable, "connection refused"))
+		assert.Equal(t, ok, true)
+
+		assert.Equal(t, *got, apierror.Error{
+			Code:    apierror.CodeUnavailable,
+			Status:  http.StatusServiceUnavailable,
+			Message: "connection refused",
+		})
+	})
+
+	t.Run("ignores non gRPC error", func(t *testing.T) {
+		_, ok := apierror.FromGRPC(errDummy)
+		assert.Equal(t, ok, false)
+	})
+}
+
+func TestWrite(t *testing.T) {
+	handler := apierror.WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, dummyMapper.Map(errDummy))
+	}))
+
+	t.Run("keeps request ID sent by client", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(apierror.RequestIDHeader, "dummy-request-id")
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusConflict)
+		assert.Equal(t, response.Header().Get(apierror.RequestIDHeader), "dummy-request-id")
+
+		var got apierror.Error
+		json.NewDecoder(response.Body).Decode(&got)
+
+		assert.Equal(t, got, apierror.Error{
+			Code:      codeDummy,
+			Status:    http.StatusConflict,
+			Message:   errDummy.Error(),
+			RequestID: "dummy-request-id",
+		})
+	})
+
+	t.Run("generates request ID when missing", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+
+		var got apierror.Error
+		json.NewDecoder(response.Body).Decode(&got)
+
+		if got.RequestID == "" {
+			t.Errorf("got empty request ID")
+		}
+		assert.Equal(t, got.RequestID, response.Header().Get(apierror.RequestIDHeader))
+	})
+}
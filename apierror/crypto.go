@@ -0,0 +1,26 @@
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+)
+
+const CodeInvalidToken Code = "invalid_token"
+
+// CryptoErrors reports the errors of the crypto package. A token that
+// doesn't check out is the client's problem, a broken key, hash or secret
+// on our side is an internal one.
+var CryptoErrors = Mapper{
+	{crypto.ErrMissingSubject, http.StatusUnauthorized, CodeInvalidToken},
+	{crypto.ErrNonintegerSubject, http.StatusUnauthorized, CodeInvalidToken},
+	{crypto.ErrMissingTokenID, http.StatusUnauthorized, CodeInvalidToken},
+	{crypto.ErrWrongPurpose, http.StatusUnauthorized, CodeInvalidToken},
+	{crypto.ErrUnknownKey, http.StatusUnauthorized, CodeInvalidToken},
+	{crypto.ErrAlgorithmMismatch, http.StatusUnauthorized, CodeInvalidToken},
+
+	{crypto.ErrMalformedKey, http.StatusInternalServerError, CodeInternal},
+	{crypto.ErrUnsupportedAlgorithm, http.StatusInternalServerError, CodeInternal},
+	{crypto.ErrMalformedHash, http.StatusInternalServerError, CodeInternal},
+	{crypto.ErrMalformedSecret, http.StatusInternalServerError, CodeInternal},
+}
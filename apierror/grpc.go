@@ -0,0 +1,126 @@
+package apierror
+
+import (
+	"net/http"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// ErrorDomain is the domain of the ErrorInfo an Error travels in over gRPC.
+const ErrorDomain = "elysium"
+
+const (
+	statusMetadataKey    = "status"
+	requestIDMetadataKey = "request_id"
+)
+
+// GRPCStatus lets an Error be returned from a gRPC handler as is. The code,
+// status and request ID go into an ErrorInfo detail and the fields into a
+// BadRequest detail, so that FromGRPC gets back the same Error.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(grpcCode(e.Status), e.Message)
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{
+		Reason: string(e.Code),
+		Domain: ErrorDomain,
+		Metadata: map[string]string{
+			statusMetadataKey:    strconv.Itoa(e.Status),
+			requestIDMetadataKey: e.RequestID,
+		},
+	}}
+	if len(e.Fields) > 0 {
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(e.Fields))
+		for i, field := range e.Fields {
+			violations[i] = &errdetails.BadRequest_FieldViolation{Field: field.Field, Description: field.Message}
+		}
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+// FromGRPC recovers the Error carried by a gRPC status. Statuses without an
+// ErrorInfo of ErrorDomain, such as ones produced by gRPC itself, are
+// reported with the generic code of their gRPC code.
+func FromGRPC(err error) (*Error, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.OK {
+		return nil, false
+	}
+
+	apiErr := &Error{Message: st.Message()}
+	found := false
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if detail.Domain != ErrorDomain {
+				continue
+			}
+			found = true
+			apiErr.Code = Code(detail.Reason)
+			apiErr.Status, _ = strconv.Atoi(detail.Metadata[statusMetadataKey])
+			apiErr.RequestID = detail.Metadata[requestIDMetadataKey]
+		case *errdetails.BadRequest:
+			for _, violation := range detail.FieldViolations {
+				apiErr.Fields = append(apiErr.Fields, FieldError{Field: violation.Field, Message: violation.Description})
+			}
+		}
+	}
+
+	if !found || apiErr.Status == 0 {
+		apiErr.Status = httpStatus(st.Code())
+		apiErr.Code = CodeForStatus(apiErr.Status)
+	}
+
+	return apiErr, true
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
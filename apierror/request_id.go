@@ -0,0 +1,35 @@
+package apierror
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID of a request from the gateway to the
+// services and back to the client.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// WithRequestID gives every request an ID, keeping the one set by the
+// gateway or the client when there is one, and echoes it in the response
+// header where Write picks it up.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = newRequestID()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -22,6 +22,15 @@ func RequireNoError(t testing.TB, err error) {
 	}
 }
 
+func Type[T any](t testing.TB, got any) {
+	t.Helper()
+
+	if _, ok := got.(T); !ok {
+		var want T
+		t.Errorf("got type %v want %v", reflect.TypeOf(got), reflect.TypeOf(want))
+	}
+}
+
 func Equal[T any](t testing.TB, got, want T) {
 	t.Helper()
 
@@ -9,34 +9,109 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	defaultJWTAlgorithm = AlgorithmEdDSA
+	defaultKeyRotation  = 24 * time.Hour
+
+	defaultVerifyEmailExpiresAt   = 24 * time.Hour
+	defaultResetPasswordExpiresAt = time.Hour
+
+	// keyOverlapSkew is added on top of the longest JWT lifetime when
+	// deciding how long a rotated out key is still accepted, to allow for
+	// clock skew.
+	keyOverlapSkew = time.Minute
+)
+
 type JWTConfig struct {
-	Secret    []byte
+	Keys      *KeyRing
 	ExpiresAt time.Duration
+
+	RefreshExpiresAt time.Duration
+	KeyRotation      time.Duration
+
+	VerifyEmailExpiresAt   time.Duration
+	ResetPasswordExpiresAt time.Duration
 }
 
+// InitJWTConfigFromEnv reads the JWT lifetimes and sets up the signing key
+// ring. JWT_ALGORITHM picks between RS256 and EdDSA, JWT_KEYS_FILE is where
+// the keys are persisted (kept in memory when unset) and JWT_KEY_ROTATION is
+// how often a new signing key is rolled. VERIFY_EMAIL_EXPIRES_AT and
+// RESET_PASSWORD_EXPIRES_AT are the lifetimes of the mailed action tokens.
 func InitJWTConfigFromEnv() (JWTConfig, error) {
-	secret, err := requireEnvVariable("SECRET")
+	expiresAtStr, err := requireEnvVariable("EXPIRES_AT")
 	if err != nil {
 		return JWTConfig{}, err
 	}
 
-	expiresAtStr, err := requireEnvVariable("EXPIRES_AT")
+	expiresAt, err := time.ParseDuration(expiresAtStr)
 	if err != nil {
 		return JWTConfig{}, err
 	}
 
-	expiresAt, err := time.ParseDuration(expiresAtStr)
+	refreshExpiresAtStr, err := requireEnvVariable("REFRESH_EXPIRES_AT")
+	if err != nil {
+		return JWTConfig{}, err
+	}
+
+	refreshExpiresAt, err := time.ParseDuration(refreshExpiresAtStr)
+	if err != nil {
+		return JWTConfig{}, err
+	}
+
+	algorithm := defaultJWTAlgorithm
+	if value, ok := os.LookupEnv("JWT_ALGORITHM"); ok && value != "" {
+		algorithm = value
+	}
+
+	keyRotation, err := lookupDurationEnv("JWT_KEY_ROTATION", defaultKeyRotation)
+	if err != nil {
+		return JWTConfig{}, err
+	}
+
+	verifyEmailExpiresAt, err := lookupDurationEnv("VERIFY_EMAIL_EXPIRES_AT", defaultVerifyEmailExpiresAt)
+	if err != nil {
+		return JWTConfig{}, err
+	}
+
+	resetPasswordExpiresAt, err := lookupDurationEnv("RESET_PASSWORD_EXPIRES_AT", defaultResetPasswordExpiresAt)
+	if err != nil {
+		return JWTConfig{}, err
+	}
+
+	var store KeyStore = NewInMemoryKeyStore()
+	if path, ok := os.LookupEnv("JWT_KEYS_FILE"); ok && path != "" {
+		store = NewFileKeyStore(path)
+	}
+
+	// a key has to stay around for as long as any token it signed is valid
+	overlap := max(expiresAt, verifyEmailExpiresAt, resetPasswordExpiresAt) + keyOverlapSkew
+
+	keys, err := NewKeyRing(store, algorithm, overlap)
 	if err != nil {
 		return JWTConfig{}, err
 	}
 
 	jwtConfig := JWTConfig{
-		Secret:    []byte(secret),
-		ExpiresAt: expiresAt,
+		Keys:             keys,
+		ExpiresAt:        expiresAt,
+		RefreshExpiresAt: refreshExpiresAt,
+		KeyRotation:      keyRotation,
+
+		VerifyEmailExpiresAt:   verifyEmailExpiresAt,
+		ResetPasswordExpiresAt: resetPasswordExpiresAt,
 	}
 	return jwtConfig, nil
 }
 
+func lookupDurationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
+
 func requireEnvVariable(name string) (string, error) {
 	var (
 		value string
@@ -48,42 +123,183 @@ func requireEnvVariable(name string) (string, error) {
 	return value, nil
 }
 
-func GenerateJWT(config JWTConfig, subject int) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Subject:   strconv.FormatInt(int64(subject), 10),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.ExpiresAt)),
+// Claims are the parts of a verified JWT the services care about.
+// EmailVerified and Roles are a snapshot taken when the JWT was issued, so
+// they catch up with the user only on the next refresh.
+type Claims struct {
+	Subject       int
+	SessionID     string
+	EmailVerified bool
+	Roles         []string
+	ExpiresAt     time.Time
+}
+
+// jwtClaims is how Claims, ActionClaims and the OpenID Connect tokens are
+// laid out in the JWT. Purpose is only set on action and OpenID Connect
+// tokens, which keeps them from being accepted as access tokens and the
+// other way around.
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	Purpose       string   `json:"purpose,omitempty"`
+
+	Nonce      string           `json:"nonce,omitempty"`
+	AuthTime   *jwt.NumericDate `json:"auth_time,omitempty"`
+	Scope      string           `json:"scope,omitempty"`
+	GivenName  string           `json:"given_name,omitempty"`
+	FamilyName string           `json:"family_name,omitempty"`
+}
+
+// GenerateJWT issues an access token for the subject within the given
+// session, which ends up in the jti claim. It is signed with the current
+// key of the ring, whose ID ends up in the kid header.
+func GenerateJWT(config JWTConfig, claims Claims) (string, error) {
+	return signJWT(config.Keys, jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(int64(claims.Subject), 10),
+			ID:        claims.SessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.ExpiresAt)),
+		},
+		EmailVerified: claims.EmailVerified,
+		Roles:         claims.Roles,
 	})
+}
 
-	tokenString, err := token.SignedString(config.Secret)
+func VerifyJWT(config JWTConfig, jwtString string) (int, error) {
+	claims, err := ParseJWT(config, jwtString)
+	if err != nil {
+		return -1, err
+	}
 
+	return claims.Subject, nil
+}
+
+func ParseJWT(config JWTConfig, jwtString string) (Claims, error) {
+	return ParseJWTWithKeys(config.Keys, jwtString)
+}
+
+// ParseJWTWithKeys verifies the access token against the key its kid header
+// names. Services that only verify tokens pass a KeySet backed by the JWKS
+// instead of the key ring.
+func ParseJWTWithKeys(keys KeySet, jwtString string) (Claims, error) {
+	parsed, subject, err := parseJWT(keys, jwtString)
 	if err != nil {
-		return "", NewCryptoError(err.Error())
+		return Claims{}, err
 	}
 
-	return tokenString, nil
+	if parsed.Purpose != "" {
+		return Claims{}, ErrWrongPurpose
+	}
+
+	claims := Claims{
+		Subject:       subject,
+		SessionID:     parsed.ID,
+		EmailVerified: parsed.EmailVerified,
+		Roles:         parsed.Roles,
+	}
+	if parsed.ExpiresAt != nil {
+		claims.ExpiresAt = parsed.ExpiresAt.Time
+	}
+
+	return claims, nil
 }
 
-func VerifyJWT(config JWTConfig, jwtString string) (int, error) {
-	token, err := jwt.Parse(jwtString, func(token *jwt.Token) (interface{}, error) {
-		return config.Secret, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+// ActionClaims are carried by action tokens, the single-purpose tokens that
+// are mailed to users to verify their email or reset their password. The
+// ID is what makes them single-use, it has to be recorded when the token is
+// issued and consumed when it is redeemed.
+type ActionClaims struct {
+	Purpose   string
+	Subject   int
+	ID        string
+	Email     string
+	ExpiresAt time.Time
+}
 
+func GenerateActionToken(config JWTConfig, claims ActionClaims) (string, error) {
+	return signJWT(config.Keys, jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(int64(claims.Subject), 10),
+			ID:        claims.ID,
+			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
+		},
+		Email:   claims.Email,
+		Purpose: claims.Purpose,
+	})
+}
+
+// ParseActionToken verifies the action token and checks that it was issued
+// for the given purpose.
+func ParseActionToken(config JWTConfig, purpose, tokenString string) (ActionClaims, error) {
+	parsed, subject, err := parseJWT(config.Keys, tokenString)
 	if err != nil {
-		return -1, err
+		return ActionClaims{}, err
 	}
 
-	subjectIDStr, err := token.Claims.GetSubject()
+	if parsed.Purpose != purpose {
+		return ActionClaims{}, ErrWrongPurpose
+	}
+	if parsed.ID == "" {
+		return ActionClaims{}, ErrMissingTokenID
+	}
+
+	claims := ActionClaims{
+		Purpose: parsed.Purpose,
+		Subject: subject,
+		ID:      parsed.ID,
+		Email:   parsed.Email,
+	}
+	if parsed.ExpiresAt != nil {
+		claims.ExpiresAt = parsed.ExpiresAt.Time
+	}
+
+	return claims, nil
+}
+
+func signJWT(keys *KeyRing, claims jwtClaims) (string, error) {
+	key := keys.Current()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	tokenString, err := token.SignedString(key.PrivateKey)
+
 	if err != nil {
-		return -1, NewCryptoError(err.Error())
+		return "", NewCryptoError(err.Error())
+	}
+
+	return tokenString, nil
+}
+
+func parseJWT(keys KeySet, jwtString string) (jwtClaims, int, error) {
+	var claims jwtClaims
+	_, err := jwt.ParseWithClaims(jwtString, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method.Alg() != key.Algorithm {
+			return nil, ErrAlgorithmMismatch
+		}
+		return key.Key, nil
+	}, jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}))
+
+	if err != nil {
+		return jwtClaims{}, -1, err
 	}
-	if subjectIDStr == "" {
-		return -1, ErrMissingSubject
+
+	if claims.Subject == "" {
+		return jwtClaims{}, -1, ErrMissingSubject
 	}
 
-	subjectID, err := strconv.Atoi(subjectIDStr)
+	subject, err := strconv.Atoi(claims.Subject)
 	if err != nil {
-		return -1, ErrNonintegerSubject
+		return jwtClaims{}, -1, ErrNonintegerSubject
 	}
 
-	return subjectID, nil
+	return claims, subject, nil
 }
@@ -11,10 +11,31 @@ import (
 )
 
 var jwtConfig = crypto.JWTConfig{
-	Secret:    []byte("very-secret-key"),
+	Keys:      mustNewKeyRing(crypto.AlgorithmEdDSA, time.Minute),
 	ExpiresAt: time.Second,
 }
 
+func mustNewKeyRing(algorithm string, overlap time.Duration) *crypto.KeyRing {
+	keyRing, err := crypto.NewKeyRing(crypto.NewInMemoryKeyStore(), algorithm, overlap)
+	if err != nil {
+		panic(err)
+	}
+	return keyRing
+}
+
+func signWithCurrentKey(t testing.TB, claims jwt.RegisteredClaims) string {
+	t.Helper()
+
+	key := jwtConfig.Keys.Current()
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	jwtString, err := token.SignedString(key.PrivateKey)
+	assert.RequireNoError(t, err)
+
+	return jwtString
+}
+
 func DummyHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -23,7 +44,7 @@ func TestJWTVerification(t *testing.T) {
 
 	t.Run("returns subject ID on valid JWT ", func(t *testing.T) {
 		wantSubjectID := 10
-		jwtString, _ := crypto.GenerateJWT(jwtConfig, wantSubjectID)
+		jwtString, _ := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: wantSubjectID, SessionID: "sampleSession"})
 
 		gotSubjectID, err := crypto.VerifyJWT(jwtConfig, jwtString)
 		assert.RequireNoError(t, err)
@@ -31,35 +52,60 @@ func TestJWTVerification(t *testing.T) {
 		assert.Equal(t, gotSubjectID, wantSubjectID)
 	})
 
+	t.Run("returns claims on valid JWT", func(t *testing.T) {
+		wantSubjectID := 10
+		wantSessionID := "sampleSession"
+		jwtString, _ := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: wantSubjectID, SessionID: wantSessionID})
+
+		gotClaims, err := crypto.ParseJWT(jwtConfig, jwtString)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, gotClaims.Subject, wantSubjectID)
+		assert.Equal(t, gotClaims.SessionID, wantSessionID)
+	})
+
+	t.Run("returns email verified claim", func(t *testing.T) {
+		jwtString, _ := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "sampleSession", EmailVerified: true})
+
+		gotClaims, err := crypto.ParseJWT(jwtConfig, jwtString)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, gotClaims.EmailVerified, true)
+	})
+
+	t.Run("returns roles claim", func(t *testing.T) {
+		wantRoles := []string{"player", "admin"}
+		jwtString, _ := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "sampleSession", Roles: wantRoles})
+
+		gotClaims, err := crypto.ParseJWT(jwtConfig, jwtString)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, gotClaims.Roles, wantRoles)
+	})
+
 	t.Run("returns ErrMissingSubject on missing subject ", func(t *testing.T) {
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		jwt := signWithCurrentKey(t, jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jwtConfig.ExpiresAt)),
 		})
 
-		jwt, err := token.SignedString(jwtConfig.Secret)
-		assert.RequireNoError(t, err)
-
-		_, err = crypto.VerifyJWT(jwtConfig, jwt)
+		_, err := crypto.VerifyJWT(jwtConfig, jwt)
 		assert.Equal(t, err, (error)(crypto.ErrMissingSubject))
 	})
 
 	t.Run("returns ErrNonintegerSubject on noninteger subject ", func(t *testing.T) {
 		subject := "nonintegerSubject"
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		jwt := signWithCurrentKey(t, jwt.RegisteredClaims{
 			Subject:   subject,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jwtConfig.ExpiresAt)),
 		})
 
-		jwt, err := token.SignedString(jwtConfig.Secret)
-		assert.RequireNoError(t, err)
-
-		_, err = crypto.VerifyJWT(jwtConfig, jwt)
+		_, err := crypto.VerifyJWT(jwtConfig, jwt)
 		assert.Equal(t, err, (error)(crypto.ErrNonintegerSubject))
 	})
 
 	t.Run("returns error on invalid JWT", func(t *testing.T) {
-		jwtString, _ := crypto.GenerateJWT(jwtConfig, 0)
+		jwtString, _ := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 0, SessionID: "sampleSession"})
 
 		jwtByteArr := []byte(jwtString)
 		if jwtByteArr[10] == 'A' {
@@ -74,4 +120,198 @@ func TestJWTVerification(t *testing.T) {
 			t.Errorf("did not get error but expected one")
 		}
 	})
+
+	t.Run("returns error on HMAC signed JWT", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Subject:   "10",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jwtConfig.ExpiresAt)),
+		})
+		token.Header["kid"] = jwtConfig.Keys.Current().ID
+
+		jwtString, err := token.SignedString([]byte("very-secret-key"))
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.VerifyJWT(jwtConfig, jwtString)
+		if err == nil {
+			t.Errorf("did not get error but expected one")
+		}
+	})
+}
+
+func TestActionToken(t *testing.T) {
+	t.Run("returns claims on valid action token", func(t *testing.T) {
+		want := crypto.ActionClaims{
+			Purpose:   "verify_email",
+			Subject:   10,
+			ID:        "sampleToken",
+			Email:     "john@example.com",
+			ExpiresAt: time.Now().Add(time.Minute).Truncate(time.Second),
+		}
+
+		token, err := crypto.GenerateActionToken(jwtConfig, want)
+		assert.RequireNoError(t, err)
+
+		got, err := crypto.ParseActionToken(jwtConfig, "verify_email", token)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, got.Subject, want.Subject)
+		assert.Equal(t, got.ID, want.ID)
+		assert.Equal(t, got.Email, want.Email)
+		assert.Equal(t, got.ExpiresAt.Equal(want.ExpiresAt), true)
+	})
+
+	t.Run("returns ErrWrongPurpose on action token for other purpose", func(t *testing.T) {
+		token, err := crypto.GenerateActionToken(jwtConfig, crypto.ActionClaims{
+			Purpose:   "verify_email",
+			Subject:   10,
+			ID:        "sampleToken",
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.ParseActionToken(jwtConfig, "reset_password", token)
+		assert.Equal(t, err, (error)(crypto.ErrWrongPurpose))
+	})
+
+	t.Run("returns ErrWrongPurpose on action token used as access token", func(t *testing.T) {
+		token, err := crypto.GenerateActionToken(jwtConfig, crypto.ActionClaims{
+			Purpose:   "reset_password",
+			Subject:   10,
+			ID:        "sampleToken",
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.ParseJWT(jwtConfig, token)
+		assert.Equal(t, err, (error)(crypto.ErrWrongPurpose))
+	})
+
+	t.Run("returns ErrWrongPurpose on access token used as action token", func(t *testing.T) {
+		token, err := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.ParseActionToken(jwtConfig, "reset_password", token)
+		assert.Equal(t, err, (error)(crypto.ErrWrongPurpose))
+	})
+
+	t.Run("returns error on expired action token", func(t *testing.T) {
+		token, err := crypto.GenerateActionToken(jwtConfig, crypto.ActionClaims{
+			Purpose:   "reset_password",
+			Subject:   10,
+			ID:        "sampleToken",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.ParseActionToken(jwtConfig, "reset_password", token)
+		if err == nil {
+			t.Errorf("did not get error but expected one")
+		}
+	})
+}
+
+func TestOpaqueToken(t *testing.T) {
+	t.Run("generates distinct tokens", func(t *testing.T) {
+		first, err := crypto.GenerateOpaqueToken()
+		assert.RequireNoError(t, err)
+
+		second, err := crypto.GenerateOpaqueToken()
+		assert.RequireNoError(t, err)
+
+		if first == second {
+			t.Errorf("got the same token twice")
+		}
+	})
+
+	t.Run("hashes token deterministically", func(t *testing.T) {
+		token, err := crypto.GenerateOpaqueToken()
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, crypto.HashOpaqueToken(token), crypto.HashOpaqueToken(token))
+		if crypto.HashOpaqueToken(token) == token {
+			t.Errorf("hash is the token itself")
+		}
+	})
+
+	t.Run("tells API key from JWT", func(t *testing.T) {
+		apiKey, err := crypto.GenerateAPIKey()
+		assert.RequireNoError(t, err)
+
+		jwtString, err := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, crypto.IsAPIKey(apiKey), true)
+		assert.Equal(t, crypto.IsAPIKey(jwtString), false)
+	})
+}
+
+func TestOIDCTokens(t *testing.T) {
+	issuer := "http://localhost:8080"
+
+	t.Run("returns claims on valid ID token", func(t *testing.T) {
+		want := crypto.IDTokenClaims{
+			Issuer:        issuer,
+			Subject:       10,
+			Audience:      "sampleClient",
+			Nonce:         "sampleNonce",
+			AuthTime:      time.Now().Add(-time.Hour).Truncate(time.Second),
+			ExpiresAt:     time.Now().Add(time.Minute).Truncate(time.Second),
+			Email:         "john@example.com",
+			EmailVerified: true,
+		}
+
+		token, err := crypto.GenerateIDToken(jwtConfig, want)
+		assert.RequireNoError(t, err)
+
+		got, err := crypto.ParseIDToken(jwtConfig.Keys.JWKS(), issuer, "sampleClient", token)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, got.Subject, want.Subject)
+		assert.Equal(t, got.Nonce, want.Nonce)
+		assert.Equal(t, got.Email, want.Email)
+		assert.Equal(t, got.EmailVerified, true)
+		assert.Equal(t, got.AuthTime.Equal(want.AuthTime), true)
+	})
+
+	t.Run("returns ErrWrongAudience on ID token for other client", func(t *testing.T) {
+		token, err := crypto.GenerateIDToken(jwtConfig, crypto.IDTokenClaims{
+			Issuer:    issuer,
+			Subject:   10,
+			Audience:  "sampleClient",
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.ParseIDToken(jwtConfig.Keys, issuer, "otherClient", token)
+		assert.Equal(t, err, (error)(crypto.ErrWrongAudience))
+	})
+
+	t.Run("returns ErrWrongPurpose on OAuth access token used as access token", func(t *testing.T) {
+		token, err := crypto.GenerateOAuthAccessToken(jwtConfig, crypto.OAuthAccessClaims{
+			Issuer:    issuer,
+			Subject:   10,
+			ClientID:  "sampleClient",
+			Scope:     "openid email",
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.ParseJWT(jwtConfig, token)
+		assert.Equal(t, err, (error)(crypto.ErrWrongPurpose))
+
+		claims, err := crypto.ParseOAuthAccessToken(jwtConfig, issuer, token)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, claims.Scope, "openid email")
+		assert.Equal(t, claims.ClientID, "sampleClient")
+	})
+
+	t.Run("verifies PKCE code verifier", func(t *testing.T) {
+		verifier, err := crypto.GenerateOpaqueToken()
+		assert.RequireNoError(t, err)
+
+		challenge := crypto.PKCEChallenge(verifier)
+
+		assert.Equal(t, crypto.VerifyPKCE(verifier, challenge), true)
+		assert.Equal(t, crypto.VerifyPKCE("otherVerifier", challenge), false)
+	})
 }
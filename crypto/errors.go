@@ -17,4 +17,16 @@ func (c *CryptoError) Error() string {
 var (
 	ErrMissingSubject    = NewCryptoError("missing subject in JWT")
 	ErrNonintegerSubject = NewCryptoError("cannot convert subject ID to integer")
+	ErrMissingTokenID    = NewCryptoError("missing token ID in JWT")
+	ErrWrongPurpose      = NewCryptoError("JWT was issued for a different purpose")
+	ErrWrongIssuer       = NewCryptoError("JWT was issued by a different issuer")
+	ErrWrongAudience     = NewCryptoError("JWT was issued for a different audience")
+
+	ErrUnknownKey        = NewCryptoError("unknown or retired JWT signing key")
+	ErrAlgorithmMismatch = NewCryptoError("JWT algorithm does not match its signing key")
+	ErrMalformedKey      = NewCryptoError("malformed JWT signing key")
+
+	ErrUnsupportedAlgorithm = NewCryptoError("unsupported algorithm")
+	ErrMalformedHash        = NewCryptoError("malformed password hash")
+	ErrMalformedSecret      = NewCryptoError("malformed or tampered encrypted secret")
 )
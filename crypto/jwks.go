@@ -0,0 +1,113 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JWK is the public half of a signing key as described in RFC 7517. RSA
+// keys carry N and E, Ed25519 keys (RFC 8037) carry Crv and X.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the keys JWTs are currently verified with.
+func (k *KeyRing) JWKS() JWKS {
+	active := k.Active()
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(active))}
+	for _, key := range active {
+		jwk, err := NewJWK(key.ID, key.Algorithm, key.PublicKey())
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+func NewJWK(kid, algorithm string, publicKey any) (JWK, error) {
+	jwk := JWK{
+		KeyID:     kid,
+		Algorithm: algorithm,
+		Use:       "sig",
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	default:
+		return JWK{}, ErrUnsupportedAlgorithm
+	}
+
+	return jwk, nil
+}
+
+// VerificationKey decodes the public key back from the JWK.
+func (j JWK) VerificationKey() (VerificationKey, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return VerificationKey{}, NewCryptoError(err.Error())
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return VerificationKey{}, NewCryptoError(err.Error())
+		}
+
+		publicKey := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return VerificationKey{Algorithm: AlgorithmRS256, Key: publicKey}, nil
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return VerificationKey{}, ErrUnsupportedAlgorithm
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return VerificationKey{}, NewCryptoError(err.Error())
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return VerificationKey{}, ErrMalformedKey
+		}
+
+		return VerificationKey{Algorithm: AlgorithmEdDSA, Key: ed25519.PublicKey(x)}, nil
+	}
+
+	return VerificationKey{}, ErrUnsupportedAlgorithm
+}
+
+// VerificationKey makes a fetched JWKS usable as a KeySet.
+func (j JWKS) VerificationKey(kid string) (VerificationKey, error) {
+	for _, jwk := range j.Keys {
+		if jwk.KeyID == kid {
+			return jwk.VerificationKey()
+		}
+	}
+	return VerificationKey{}, ErrUnknownKey
+}
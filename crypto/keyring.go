@@ -0,0 +1,243 @@
+package crypto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+)
+
+// SigningKey is a private key identified by the kid header of the JWTs it
+// signs. PrivateKey is either an *rsa.PrivateKey or an ed25519.PrivateKey
+// depending on Algorithm.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	CreatedAt  time.Time
+	PrivateKey any
+}
+
+func (s SigningKey) PublicKey() any {
+	switch key := s.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case ed25519.PrivateKey:
+		return key.Public()
+	}
+	return nil
+}
+
+// VerificationKey is what a JWT's signature is checked against.
+type VerificationKey struct {
+	Algorithm string
+	Key       any
+}
+
+// KeySet resolves the key a JWT was signed with from its kid header.
+type KeySet interface {
+	VerificationKey(kid string) (VerificationKey, error)
+}
+
+func GenerateSigningKey(algorithm string) (SigningKey, error) {
+	var (
+		privateKey any
+		err        error
+	)
+
+	switch algorithm {
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return SigningKey{}, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return SigningKey{}, NewCryptoError(err.Error())
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return SigningKey{}, NewCryptoError(err.Error())
+	}
+
+	return SigningKey{
+		ID:         hex.EncodeToString(id),
+		Algorithm:  algorithm,
+		CreatedAt:  time.Now(),
+		PrivateKey: privateKey,
+	}, nil
+}
+
+// KeyRing signs with its newest key and verifies with every key that hasn't
+// retired yet. A key retires overlap after the key that replaced it was
+// created, so overlap has to cover the lifetime of the JWTs it signed.
+//
+// Keys are kept in a KeyStore so that they survive restarts and can be
+// shared between instances of the service.
+type KeyRing struct {
+	store     KeyStore
+	algorithm string
+	overlap   time.Duration
+
+	mu   sync.RWMutex
+	keys []SigningKey
+}
+
+func NewKeyRing(store KeyStore, algorithm string, overlap time.Duration) (*KeyRing, error) {
+	keyRing := &KeyRing{
+		store:     store,
+		algorithm: algorithm,
+		overlap:   overlap,
+	}
+
+	err := keyRing.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyRing.keys) == 0 {
+		err = keyRing.Rotate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keyRing, nil
+}
+
+func (k *KeyRing) Current() SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.keys[len(k.keys)-1]
+}
+
+func (k *KeyRing) VerificationKey(kid string) (VerificationKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	for i, key := range k.keys {
+		if key.ID == kid && !k.isRetired(i, now) {
+			return VerificationKey{Algorithm: key.Algorithm, Key: key.PublicKey()}, nil
+		}
+	}
+
+	return VerificationKey{}, ErrUnknownKey
+}
+
+// Active returns the keys that JWTs are still verified with, oldest first.
+func (k *KeyRing) Active() []SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	active := make([]SigningKey, 0, len(k.keys))
+	for i, key := range k.keys {
+		if !k.isRetired(i, now) {
+			active = append(active, key)
+		}
+	}
+
+	return active
+}
+
+// Reload picks up keys that another instance rotated in.
+func (k *KeyRing) Reload() error {
+	keys, err := k.store.Load()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if len(keys) > 0 {
+		k.keys = keys
+	}
+	return nil
+}
+
+// Rotate makes a new key the signing key and drops keys that retired.
+func (k *KeyRing) Rotate() error {
+	key, err := GenerateSigningKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := append(append([]SigningKey{}, k.keys...), key)
+
+	now := time.Now()
+	kept := keys[:0]
+	for i := range keys {
+		if i == len(keys)-1 || now.Before(keys[i+1].CreatedAt.Add(k.overlap)) {
+			kept = append(kept, keys[i])
+		}
+	}
+
+	err = k.store.Save(kept)
+	if err != nil {
+		return err
+	}
+
+	k.keys = kept
+	return nil
+}
+
+// RunRotation rotates the signing key once it is older than interval,
+// until the context is done. It is meant to be run in its own goroutine.
+func (k *KeyRing) RunRotation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(min(interval, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := k.Reload()
+			if err != nil {
+				log.Printf("Key ring reload error: %v", err)
+				continue
+			}
+
+			if time.Since(k.Current().CreatedAt) < interval {
+				continue
+			}
+
+			err = k.Rotate()
+			if err != nil {
+				log.Printf("Key rotation error: %v", err)
+				continue
+			}
+			log.Printf("Rotated signing key, new kid %v", k.Current().ID)
+		}
+	}
+}
+
+func (k *KeyRing) isRetired(i int, now time.Time) bool {
+	if i == len(k.keys)-1 {
+		return false
+	}
+	return !now.Before(k.keys[i+1].CreatedAt.Add(k.overlap))
+}
@@ -0,0 +1,134 @@
+package crypto_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+)
+
+func TestKeyRing(t *testing.T) {
+	for _, algorithm := range []string{crypto.AlgorithmRS256, crypto.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			t.Run("signs with current key and sets kid", func(t *testing.T) {
+				config := crypto.JWTConfig{
+					Keys:      mustNewKeyRing(algorithm, time.Minute),
+					ExpiresAt: time.Minute,
+				}
+
+				jwtString, err := crypto.GenerateJWT(config, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+				assert.RequireNoError(t, err)
+
+				gotSubjectID, err := crypto.VerifyJWT(config, jwtString)
+				assert.RequireNoError(t, err)
+				assert.Equal(t, gotSubjectID, 10)
+			})
+
+			t.Run("verifies JWT against published JWKS", func(t *testing.T) {
+				config := crypto.JWTConfig{
+					Keys:      mustNewKeyRing(algorithm, time.Minute),
+					ExpiresAt: time.Minute,
+				}
+
+				jwtString, err := crypto.GenerateJWT(config, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+				assert.RequireNoError(t, err)
+
+				claims, err := crypto.ParseJWTWithKeys(config.Keys.JWKS(), jwtString)
+				assert.RequireNoError(t, err)
+				assert.Equal(t, claims.Subject, 10)
+			})
+		})
+	}
+
+	t.Run("accepts previous key during overlap", func(t *testing.T) {
+		config := crypto.JWTConfig{
+			Keys:      mustNewKeyRing(crypto.AlgorithmEdDSA, time.Minute),
+			ExpiresAt: time.Minute,
+		}
+
+		jwtString, err := crypto.GenerateJWT(config, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		err = config.Keys.Rotate()
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.VerifyJWT(config, jwtString)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(config.Keys.JWKS().Keys), 2)
+	})
+
+	t.Run("returns ErrUnknownKey on retired key", func(t *testing.T) {
+		config := crypto.JWTConfig{
+			Keys:      mustNewKeyRing(crypto.AlgorithmEdDSA, 0),
+			ExpiresAt: time.Minute,
+		}
+
+		jwtString, err := crypto.GenerateJWT(config, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		err = config.Keys.Rotate()
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.VerifyJWT(config, jwtString)
+		if !errors.Is(err, crypto.ErrUnknownKey) {
+			t.Errorf("got error %v want %v", err, crypto.ErrUnknownKey)
+		}
+		assert.Equal(t, len(config.Keys.JWKS().Keys), 1)
+	})
+
+	t.Run("shares keys through key store", func(t *testing.T) {
+		store := crypto.NewFileKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+
+		signer, err := crypto.NewKeyRing(store, crypto.AlgorithmRS256, time.Minute)
+		assert.RequireNoError(t, err)
+
+		verifier, err := crypto.NewKeyRing(store, crypto.AlgorithmRS256, time.Minute)
+		assert.RequireNoError(t, err)
+
+		err = signer.Rotate()
+		assert.RequireNoError(t, err)
+
+		err = verifier.Reload()
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, verifier.Current().ID, signer.Current().ID)
+
+		jwtString, err := crypto.GenerateJWT(crypto.JWTConfig{Keys: signer, ExpiresAt: time.Minute}, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.VerifyJWT(crypto.JWTConfig{Keys: verifier}, jwtString)
+		assert.RequireNoError(t, err)
+	})
+}
+
+func TestStaticKeySet(t *testing.T) {
+	t.Run("verifies JWT with pinned public key", func(t *testing.T) {
+		config := crypto.JWTConfig{
+			Keys:      mustNewKeyRing(crypto.AlgorithmRS256, time.Minute),
+			ExpiresAt: time.Minute,
+		}
+
+		publicKey, err := x509.MarshalPKIXPublicKey(config.Keys.Current().PublicKey())
+		assert.RequireNoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "public.pem")
+		err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600)
+		assert.RequireNoError(t, err)
+
+		keys, err := crypto.LoadStaticKeySet(path)
+		assert.RequireNoError(t, err)
+
+		jwtString, err := crypto.GenerateJWT(config, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		claims, err := crypto.ParseJWTWithKeys(keys, jwtString)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, claims.Subject, 10)
+	})
+}
@@ -0,0 +1,51 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+)
+
+// StaticKeySet verifies every JWT with the same public key regardless of
+// its kid. It is meant for deployments that pin a single signing key and
+// distribute its public half out of band, so key rotation has to be turned
+// off on the issuing side.
+type StaticKeySet struct {
+	key VerificationKey
+}
+
+func NewStaticKeySet(publicKey any) (StaticKeySet, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return StaticKeySet{VerificationKey{Algorithm: AlgorithmRS256, Key: publicKey}}, nil
+	case ed25519.PublicKey:
+		return StaticKeySet{VerificationKey{Algorithm: AlgorithmEdDSA, Key: publicKey}}, nil
+	}
+	return StaticKeySet{}, ErrUnsupportedAlgorithm
+}
+
+// LoadStaticKeySet reads a PEM encoded PKIX public key from path.
+func LoadStaticKeySet(path string) (StaticKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return StaticKeySet{}, NewCryptoError(err.Error())
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return StaticKeySet{}, ErrMalformedKey
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return StaticKeySet{}, NewCryptoError(err.Error())
+	}
+
+	return NewStaticKeySet(publicKey)
+}
+
+func (s StaticKeySet) VerificationKey(kid string) (VerificationKey, error) {
+	return s.key, nil
+}
@@ -0,0 +1,137 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type KeyStore interface {
+	Load() ([]SigningKey, error)
+	Save([]SigningKey) error
+}
+
+type InMemoryKeyStore struct {
+	mu   sync.Mutex
+	keys []SigningKey
+}
+
+func NewInMemoryKeyStore() *InMemoryKeyStore {
+	return &InMemoryKeyStore{}
+}
+
+func (i *InMemoryKeyStore) Load() ([]SigningKey, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]SigningKey{}, i.keys...), nil
+}
+
+func (i *InMemoryKeyStore) Save(keys []SigningKey) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.keys = append([]SigningKey{}, keys...)
+	return nil
+}
+
+type storedKey struct {
+	ID         string    `json:"kid"`
+	Algorithm  string    `json:"alg"`
+	CreatedAt  time.Time `json:"created_at"`
+	PrivateKey []byte    `json:"private_key"`
+}
+
+// FileKeyStore keeps the keys as PKCS #8 in a single JSON file, which is
+// replaced atomically on every save.
+type FileKeyStore struct {
+	path string
+}
+
+func NewFileKeyStore(path string) *FileKeyStore {
+	return &FileKeyStore{
+		path: path,
+	}
+}
+
+func (f *FileKeyStore) Load() ([]SigningKey, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, NewCryptoError(err.Error())
+	}
+
+	var stored []storedKey
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return nil, NewCryptoError(err.Error())
+	}
+
+	keys := make([]SigningKey, len(stored))
+	for i, s := range stored {
+		privateKey, err := x509.ParsePKCS8PrivateKey(s.PrivateKey)
+		if err != nil {
+			return nil, NewCryptoError(err.Error())
+		}
+
+		keys[i] = SigningKey{
+			ID:         s.ID,
+			Algorithm:  s.Algorithm,
+			CreatedAt:  s.CreatedAt,
+			PrivateKey: privateKey,
+		}
+	}
+
+	return keys, nil
+}
+
+func (f *FileKeyStore) Save(keys []SigningKey) error {
+	stored := make([]storedKey, len(keys))
+	for i, key := range keys {
+		privateKey, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+		if err != nil {
+			return NewCryptoError(err.Error())
+		}
+
+		stored[i] = storedKey{
+			ID:         key.ID,
+			Algorithm:  key.Algorithm,
+			CreatedAt:  key.CreatedAt,
+			PrivateKey: privateKey,
+		}
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return NewCryptoError(err.Error())
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return NewCryptoError(err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return NewCryptoError(err.Error())
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return NewCryptoError(err.Error())
+	}
+	if err := tmp.Close(); err != nil {
+		return NewCryptoError(err.Error())
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return NewCryptoError(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	purposeIDToken     = "id_token"
+	purposeOAuthAccess = "oauth_access"
+)
+
+// IDTokenClaims are carried by OpenID Connect ID tokens. Audience is the
+// client the token was issued to. Email, EmailVerified, GivenName and
+// FamilyName are only set when the matching scope was granted.
+type IDTokenClaims struct {
+	Issuer    string
+	Subject   int
+	Audience  string
+	Nonce     string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// GenerateIDToken signs the ID token with the current key of the ring, so
+// that clients verify it against the same JWKS as access tokens.
+func GenerateIDToken(config JWTConfig, claims IDTokenClaims) (string, error) {
+	return signJWT(config.Keys, jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    claims.Issuer,
+			Subject:   strconv.FormatInt(int64(claims.Subject), 10),
+			Audience:  jwt.ClaimStrings{claims.Audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
+		},
+		Nonce:         claims.Nonce,
+		AuthTime:      jwt.NewNumericDate(claims.AuthTime),
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+		Purpose:       purposeIDToken,
+	})
+}
+
+// ParseIDToken verifies the ID token and checks that it was issued by the
+// issuer to the client. The nonce is left for the client to compare.
+func ParseIDToken(keys KeySet, issuer, clientID, tokenString string) (IDTokenClaims, error) {
+	parsed, subject, err := parseJWT(keys, tokenString)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+
+	if parsed.Purpose != purposeIDToken {
+		return IDTokenClaims{}, ErrWrongPurpose
+	}
+	if parsed.Issuer != issuer {
+		return IDTokenClaims{}, ErrWrongIssuer
+	}
+	if !slices.Contains(parsed.Audience, clientID) {
+		return IDTokenClaims{}, ErrWrongAudience
+	}
+
+	claims := IDTokenClaims{
+		Issuer:        parsed.Issuer,
+		Subject:       subject,
+		Audience:      clientID,
+		Nonce:         parsed.Nonce,
+		Email:         parsed.Email,
+		EmailVerified: parsed.EmailVerified,
+		GivenName:     parsed.GivenName,
+		FamilyName:    parsed.FamilyName,
+	}
+	if parsed.AuthTime != nil {
+		claims.AuthTime = parsed.AuthTime.Time
+	}
+	if parsed.ExpiresAt != nil {
+		claims.ExpiresAt = parsed.ExpiresAt.Time
+	}
+
+	return claims, nil
+}
+
+// OAuthAccessClaims are carried by the access tokens handed to OpenID
+// Connect clients. They are only good for the userinfo endpoint, Scope is
+// the space separated list of scopes that were granted.
+type OAuthAccessClaims struct {
+	Issuer    string
+	Subject   int
+	ClientID  string
+	Scope     string
+	ExpiresAt time.Time
+}
+
+func GenerateOAuthAccessToken(config JWTConfig, claims OAuthAccessClaims) (string, error) {
+	return signJWT(config.Keys, jwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    claims.Issuer,
+			Subject:   strconv.FormatInt(int64(claims.Subject), 10),
+			Audience:  jwt.ClaimStrings{claims.ClientID},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
+		},
+		Scope:   claims.Scope,
+		Purpose: purposeOAuthAccess,
+	})
+}
+
+func ParseOAuthAccessToken(config JWTConfig, issuer, tokenString string) (OAuthAccessClaims, error) {
+	parsed, subject, err := parseJWT(config.Keys, tokenString)
+	if err != nil {
+		return OAuthAccessClaims{}, err
+	}
+
+	if parsed.Purpose != purposeOAuthAccess {
+		return OAuthAccessClaims{}, ErrWrongPurpose
+	}
+	if parsed.Issuer != issuer {
+		return OAuthAccessClaims{}, ErrWrongIssuer
+	}
+
+	claims := OAuthAccessClaims{
+		Issuer:  parsed.Issuer,
+		Subject: subject,
+		Scope:   parsed.Scope,
+	}
+	if len(parsed.Audience) > 0 {
+		claims.ClientID = parsed.Audience[0]
+	}
+	if parsed.ExpiresAt != nil {
+		claims.ExpiresAt = parsed.ExpiresAt.Time
+	}
+
+	return claims, nil
+}
+
+// PKCEChallenge derives the S256 code challenge (RFC 7636) from the code
+// verifier a client keeps to itself until it redeems the code.
+func PKCEChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func VerifyPKCE(verifier, challenge string) bool {
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const opaqueTokenLength = 32
+
+// APIKeyPrefix tells API keys apart from JWTs, which always start with the
+// encoded JSON header.
+const APIKeyPrefix = "ek_"
+
+// GenerateOpaqueToken returns a random token that carries no information by
+// itself, it is only meaningful to whoever stored its hash.
+func GenerateOpaqueToken() (string, error) {
+	token := make([]byte, opaqueTokenLength)
+	if _, err := rand.Read(token); err != nil {
+		return "", NewCryptoError(err.Error())
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// HashOpaqueToken is what gets stored in place of the token. Opaque tokens
+// are random, so unlike passwords they don't need a slow or salted hash.
+func HashOpaqueToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateAPIKey returns an opaque token marked as an API key. Like other
+// opaque tokens it is stored as HashOpaqueToken.
+func GenerateAPIKey() (string, error) {
+	token, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	return APIKeyPrefix + token, nil
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
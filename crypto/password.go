@@ -0,0 +1,231 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordAlgorithm string
+
+const (
+	AlgorithmBcrypt   PasswordAlgorithm = "bcrypt"
+	AlgorithmArgon2id PasswordAlgorithm = "argon2id"
+)
+
+// PasswordConfig picks the algorithm and parameters new hashes are made
+// with. AllowPlaintext makes VerifyPassword accept passwords stored before
+// the service hashed them, it should stay off once migration
+// 001_hash_passwords has run.
+type PasswordConfig struct {
+	Algorithm      PasswordAlgorithm
+	AllowPlaintext bool
+
+	BcryptCost int
+
+	Argon2Time       uint32
+	Argon2Memory     uint32
+	Argon2Threads    uint8
+	Argon2KeyLength  uint32
+	Argon2SaltLength uint32
+}
+
+var DefaultPasswordConfig = PasswordConfig{
+	Algorithm:        AlgorithmBcrypt,
+	BcryptCost:       bcrypt.DefaultCost,
+	Argon2Time:       1,
+	Argon2Memory:     64 * 1024,
+	Argon2Threads:    4,
+	Argon2KeyLength:  32,
+	Argon2SaltLength: 16,
+}
+
+// InitPasswordConfigFromEnv starts from DefaultPasswordConfig and overrides
+// whatever is set in the environment. Unlike the JWT config none of the
+// variables are required.
+func InitPasswordConfigFromEnv() (PasswordConfig, error) {
+	config := DefaultPasswordConfig
+
+	if algorithm, ok := os.LookupEnv("PASSWORD_ALGORITHM"); ok && algorithm != "" {
+		config.Algorithm = PasswordAlgorithm(algorithm)
+	}
+	if config.Algorithm != AlgorithmBcrypt && config.Algorithm != AlgorithmArgon2id {
+		return PasswordConfig{}, fmt.Errorf("unsupported password algorithm %v", config.Algorithm)
+	}
+
+	if err := lookupUintEnv("BCRYPT_COST", &config.BcryptCost); err != nil {
+		return PasswordConfig{}, err
+	}
+	if err := lookupUintEnv("ARGON2_TIME", &config.Argon2Time); err != nil {
+		return PasswordConfig{}, err
+	}
+	if err := lookupUintEnv("ARGON2_MEMORY", &config.Argon2Memory); err != nil {
+		return PasswordConfig{}, err
+	}
+	if err := lookupUintEnv("ARGON2_THREADS", &config.Argon2Threads); err != nil {
+		return PasswordConfig{}, err
+	}
+	if err := lookupBoolEnv("PASSWORD_ALLOW_PLAINTEXT", &config.AllowPlaintext); err != nil {
+		return PasswordConfig{}, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return PasswordConfig{}, err
+	}
+
+	return config, nil
+}
+
+// Validate catches parameters the hashing libraries would refuse or panic
+// on, so that they fail at startup rather than on the first signup.
+func (c PasswordConfig) Validate() error {
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("BCRYPT_COST must be between %v and %v", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if c.Argon2Time < 1 {
+		return fmt.Errorf("ARGON2_TIME must be at least 1")
+	}
+	if c.Argon2Threads < 1 {
+		return fmt.Errorf("ARGON2_THREADS must be between 1 and 255")
+	}
+	if c.Argon2Memory < 8*uint32(c.Argon2Threads) {
+		return fmt.Errorf("ARGON2_MEMORY must be at least 8 KiB per thread")
+	}
+	return nil
+}
+
+func lookupUintEnv[T int | uint8 | uint32](name string, value *T) error {
+	str, ok := os.LookupEnv(name)
+	if !ok || str == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		return fmt.Errorf("env variable %v must be a positive integer", name)
+	}
+	if uint64(T(parsed)) != parsed {
+		return fmt.Errorf("env variable %v is out of range", name)
+	}
+
+	*value = T(parsed)
+	return nil
+}
+
+func HashPassword(config PasswordConfig, password string) (string, error) {
+	switch config.Algorithm {
+	case AlgorithmBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), config.BcryptCost)
+		if err != nil {
+			return "", NewCryptoError(err.Error())
+		}
+		return string(hash), nil
+	case AlgorithmArgon2id:
+		return hashArgon2id(config, password)
+	}
+
+	return "", ErrUnsupportedAlgorithm
+}
+
+// VerifyPassword checks the password against the stored hash in constant
+// time. needsRehash reports that the hash was made with another algorithm
+// or other parameters than the configured ones, so the caller should store
+// a fresh hash while it still has the plaintext password at hand.
+//
+// Values that are neither a bcrypt nor an argon2id hash are malformed,
+// unless the config allows legacy plaintext passwords, which then always
+// need a rehash.
+func VerifyPassword(config PasswordConfig, hash, password string) (match bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, ErrMalformedHash
+		}
+
+		cost, _ := bcrypt.Cost([]byte(hash))
+		needsRehash = config.Algorithm != AlgorithmBcrypt || cost != config.BcryptCost
+		return true, needsRehash, nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(config, hash, password)
+	}
+
+	if !config.AllowPlaintext {
+		return false, false, ErrMalformedHash
+	}
+
+	match = subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1
+	return match, match, nil
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+func hashArgon2id(config PasswordConfig, password string) (string, error) {
+	salt := make([]byte, config.Argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", NewCryptoError(err.Error())
+	}
+
+	key := argon2.IDKey([]byte(password), salt,
+		config.Argon2Time, config.Argon2Memory, config.Argon2Threads, config.Argon2KeyLength)
+
+	encoding := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		config.Argon2Memory, config.Argon2Time, config.Argon2Threads,
+		encoding.EncodeToString(salt), encoding.EncodeToString(key)), nil
+}
+
+func verifyArgon2id(config PasswordConfig, hash, password string) (bool, bool, error) {
+	// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, false, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrMalformedHash
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return false, false, ErrMalformedHash
+	}
+
+	encoding := base64.RawStdEncoding
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrMalformedHash
+	}
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrMalformedHash
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+
+	needsRehash := config.Algorithm != AlgorithmArgon2id ||
+		params.time != config.Argon2Time ||
+		params.memory != config.Argon2Memory ||
+		params.threads != config.Argon2Threads ||
+		uint32(len(key)) != config.Argon2KeyLength
+
+	return true, needsRehash, nil
+}
@@ -0,0 +1,134 @@
+package crypto
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy is what a new password has to look like. It isn't applied
+// to passwords that are only checked, such as on login, so that tightening
+// the policy doesn't lock out existing users.
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength defaults to 72 since bcrypt refuses to hash passwords
+	// longer than 72 bytes. Zero means no limit.
+	MaxLength int
+
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+const bcryptMaxPasswordLength = 72
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: bcryptMaxPasswordLength,
+}
+
+// InitPasswordPolicyFromEnv starts from DefaultPasswordPolicy and overrides
+// whatever of PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH and
+// PASSWORD_REQUIRE_{UPPER,LOWER,DIGIT,SYMBOL} is set.
+func InitPasswordPolicyFromEnv() (PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy
+
+	if err := lookupUintEnv("PASSWORD_MIN_LENGTH", &policy.MinLength); err != nil {
+		return PasswordPolicy{}, err
+	}
+	if err := lookupUintEnv("PASSWORD_MAX_LENGTH", &policy.MaxLength); err != nil {
+		return PasswordPolicy{}, err
+	}
+	if policy.MaxLength < policy.MinLength {
+		return PasswordPolicy{}, fmt.Errorf("PASSWORD_MAX_LENGTH must not be less than PASSWORD_MIN_LENGTH")
+	}
+
+	if err := lookupBoolEnv("PASSWORD_REQUIRE_UPPER", &policy.RequireUpper); err != nil {
+		return PasswordPolicy{}, err
+	}
+	if err := lookupBoolEnv("PASSWORD_REQUIRE_LOWER", &policy.RequireLower); err != nil {
+		return PasswordPolicy{}, err
+	}
+	if err := lookupBoolEnv("PASSWORD_REQUIRE_DIGIT", &policy.RequireDigit); err != nil {
+		return PasswordPolicy{}, err
+	}
+	if err := lookupBoolEnv("PASSWORD_REQUIRE_SYMBOL", &policy.RequireSymbol); err != nil {
+		return PasswordPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// Validate makes sure every password the policy lets through can be hashed
+// with the config. bcrypt returns an error on passwords longer than 72
+// bytes, which would turn signups into server errors.
+func (p PasswordPolicy) Validate(config PasswordConfig) error {
+	if config.Algorithm == AlgorithmBcrypt && (p.MaxLength == 0 || p.MaxLength > bcryptMaxPasswordLength) {
+		return fmt.Errorf("PASSWORD_MAX_LENGTH must be at most %v with bcrypt", bcryptMaxPasswordLength)
+	}
+	return nil
+}
+
+// Check returns every rule the password breaks, nil if it follows the
+// policy. The minimum length is counted in characters and the maximum in
+// bytes, which is what bcrypt's limit is in.
+func (p PasswordPolicy) Check(password string) []string {
+	var violations []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %v characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %v bytes long", p.MaxLength))
+	}
+	if !utf8.ValidString(password) {
+		violations = append(violations, "must be valid UTF-8")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	if p.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	return violations
+}
+
+func lookupBoolEnv(name string, value *bool) error {
+	str, ok := os.LookupEnv(name)
+	if !ok || str == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseBool(str)
+	if err != nil {
+		return fmt.Errorf("env variable %v must be a boolean", name)
+	}
+
+	*value = parsed
+	return nil
+}
@@ -0,0 +1,91 @@
+package crypto_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	strictPolicy := crypto.PasswordPolicy{
+		MinLength:     10,
+		MaxLength:     72,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+
+	t.Run("accepts password following the policy", func(t *testing.T) {
+		violations := strictPolicy.Check("Sample-password1")
+		assert.Equal(t, len(violations), 0)
+	})
+
+	t.Run("reports every broken rule", func(t *testing.T) {
+		violations := strictPolicy.Check("short")
+		assert.Equal(t, violations, []string{
+			"must be at least 10 characters long",
+			"must contain an uppercase letter",
+			"must contain a digit",
+			"must contain a symbol",
+		})
+	})
+
+	t.Run("counts minimum length in characters", func(t *testing.T) {
+		violations := crypto.PasswordPolicy{MinLength: 4}.Check("пар")
+		assert.Equal(t, len(violations), 1)
+
+		violations = crypto.PasswordPolicy{MinLength: 3}.Check("пар")
+		assert.Equal(t, len(violations), 0)
+	})
+
+	t.Run("rejects password longer than bcrypt accepts", func(t *testing.T) {
+		violations := crypto.DefaultPasswordPolicy.Check(strings.Repeat("a", 73))
+		assert.Equal(t, violations, []string{"must be at most 72 bytes long"})
+	})
+
+	t.Run("reads policy from env", func(t *testing.T) {
+		t.Setenv("PASSWORD_MIN_LENGTH", "12")
+		t.Setenv("PASSWORD_REQUIRE_DIGIT", "true")
+
+		policy, err := crypto.InitPasswordPolicyFromEnv()
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, policy.MinLength, 12)
+		assert.Equal(t, policy.MaxLength, crypto.DefaultPasswordPolicy.MaxLength)
+		assert.Equal(t, policy.RequireDigit, true)
+	})
+
+	t.Run("returns error on max length below min length", func(t *testing.T) {
+		t.Setenv("PASSWORD_MIN_LENGTH", "20")
+		t.Setenv("PASSWORD_MAX_LENGTH", "10")
+
+		_, err := crypto.InitPasswordPolicyFromEnv()
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("returns error on max length bcrypt can't hash", func(t *testing.T) {
+		bcryptConfig := crypto.PasswordConfig{Algorithm: crypto.AlgorithmBcrypt}
+
+		err := crypto.DefaultPasswordPolicy.Validate(bcryptConfig)
+		assert.RequireNoError(t, err)
+
+		for _, maxLength := range []int{0, 73} {
+			err = crypto.PasswordPolicy{MinLength: 8, MaxLength: maxLength}.Validate(bcryptConfig)
+			if err == nil {
+				t.Errorf("expected error on max length %v, got nil", maxLength)
+			}
+		}
+	})
+
+	t.Run("allows max length above 72 with argon2id", func(t *testing.T) {
+		policy := crypto.PasswordPolicy{MinLength: 8, MaxLength: 256}
+
+		err := policy.Validate(crypto.PasswordConfig{Algorithm: crypto.AlgorithmArgon2id})
+		assert.RequireNoError(t, err)
+	})
+}
@@ -0,0 +1,159 @@
+package crypto_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+)
+
+var bcryptConfig = crypto.PasswordConfig{
+	Algorithm:  crypto.AlgorithmBcrypt,
+	BcryptCost: 4,
+}
+
+var argon2idConfig = crypto.PasswordConfig{
+	Algorithm:        crypto.AlgorithmArgon2id,
+	Argon2Time:       1,
+	Argon2Memory:     1024,
+	Argon2Threads:    1,
+	Argon2KeyLength:  32,
+	Argon2SaltLength: 16,
+}
+
+func TestPasswordHashing(t *testing.T) {
+	configs := map[string]crypto.PasswordConfig{
+		"bcrypt":   bcryptConfig,
+		"argon2id": argon2idConfig,
+	}
+
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			t.Run("verifies correct password", func(t *testing.T) {
+				hash, err := crypto.HashPassword(config, "samplepassword")
+				assert.RequireNoError(t, err)
+
+				match, needsRehash, err := crypto.VerifyPassword(config, hash, "samplepassword")
+				assert.RequireNoError(t, err)
+				assert.Equal(t, match, true)
+				assert.Equal(t, needsRehash, false)
+			})
+
+			t.Run("rejects wrong password", func(t *testing.T) {
+				hash, err := crypto.HashPassword(config, "samplepassword")
+				assert.RequireNoError(t, err)
+
+				match, _, err := crypto.VerifyPassword(config, hash, "wrongpassword")
+				assert.RequireNoError(t, err)
+				assert.Equal(t, match, false)
+			})
+
+			t.Run("doesn't store password in plaintext", func(t *testing.T) {
+				hash, err := crypto.HashPassword(config, "samplepassword")
+				assert.RequireNoError(t, err)
+
+				if strings.Contains(hash, "samplepassword") {
+					t.Errorf("hash %q contains the password", hash)
+				}
+			})
+		})
+	}
+
+	t.Run("requests rehash on changed bcrypt cost", func(t *testing.T) {
+		hash, err := crypto.HashPassword(bcryptConfig, "samplepassword")
+		assert.RequireNoError(t, err)
+
+		newConfig := bcryptConfig
+		newConfig.BcryptCost = 5
+
+		match, needsRehash, err := crypto.VerifyPassword(newConfig, hash, "samplepassword")
+		assert.RequireNoError(t, err)
+		assert.Equal(t, match, true)
+		assert.Equal(t, needsRehash, true)
+	})
+
+	t.Run("requests rehash on changed argon2id parameters", func(t *testing.T) {
+		hash, err := crypto.HashPassword(argon2idConfig, "samplepassword")
+		assert.RequireNoError(t, err)
+
+		newConfig := argon2idConfig
+		newConfig.Argon2Memory = 2048
+
+		match, needsRehash, err := crypto.VerifyPassword(newConfig, hash, "samplepassword")
+		assert.RequireNoError(t, err)
+		assert.Equal(t, match, true)
+		assert.Equal(t, needsRehash, true)
+	})
+
+	t.Run("requests rehash on changed algorithm", func(t *testing.T) {
+		hash, err := crypto.HashPassword(bcryptConfig, "samplepassword")
+		assert.RequireNoError(t, err)
+
+		match, needsRehash, err := crypto.VerifyPassword(argon2idConfig, hash, "samplepassword")
+		assert.RequireNoError(t, err)
+		assert.Equal(t, match, true)
+		assert.Equal(t, needsRehash, true)
+	})
+
+	t.Run("verifies legacy plaintext password and requests rehash when allowed", func(t *testing.T) {
+		config := bcryptConfig
+		config.AllowPlaintext = true
+
+		match, needsRehash, err := crypto.VerifyPassword(config, "samplepassword", "samplepassword")
+		assert.RequireNoError(t, err)
+		assert.Equal(t, match, true)
+		assert.Equal(t, needsRehash, true)
+	})
+
+	t.Run("returns ErrMalformedHash on plaintext password by default", func(t *testing.T) {
+		_, _, err := crypto.VerifyPassword(bcryptConfig, "samplepassword", "samplepassword")
+		assert.Equal(t, err, (error)(crypto.ErrMalformedHash))
+	})
+
+	t.Run("returns ErrMalformedHash on malformed hash", func(t *testing.T) {
+		_, _, err := crypto.VerifyPassword(argon2idConfig, "$argon2id$v=19$m=1024$salt", "samplepassword")
+		assert.Equal(t, err, (error)(crypto.ErrMalformedHash))
+	})
+}
+
+func TestPasswordConfigFromEnv(t *testing.T) {
+	invalid := map[string]string{
+		"ARGON2_TIME":    "0",
+		"ARGON2_THREADS": "0",
+		"ARGON2_MEMORY":  "4",
+		"BCRYPT_COST":    "40",
+	}
+
+	for name, value := range invalid {
+		t.Run("returns error on invalid "+name, func(t *testing.T) {
+			t.Setenv(name, value)
+
+			_, err := crypto.InitPasswordConfigFromEnv()
+			if err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+
+	t.Run("returns error on threads that don't fit in a byte", func(t *testing.T) {
+		t.Setenv("ARGON2_THREADS", "256")
+
+		_, err := crypto.InitPasswordConfigFromEnv()
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("allows plaintext passwords only when asked to", func(t *testing.T) {
+		config, err := crypto.InitPasswordConfigFromEnv()
+		assert.RequireNoError(t, err)
+		assert.Equal(t, config.AllowPlaintext, false)
+
+		t.Setenv("PASSWORD_ALLOW_PLAINTEXT", "true")
+
+		config, err = crypto.InitPasswordConfigFromEnv()
+		assert.RequireNoError(t, err)
+		assert.Equal(t, config.AllowPlaintext, true)
+	})
+}
@@ -0,0 +1,170 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	totpSecretLength = 20
+	totpDigits       = 6
+	totpPeriod       = 30 * time.Second
+	// totpSkew is how many periods a code may be off by either way, to
+	// allow for clocks that drift and codes typed in at the last second.
+	totpSkew = 1
+
+	recoveryCodeLength = 10
+
+	defaultMFAIssuer = "Elysium"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type MFAConfig struct {
+	// Issuer is what authenticator apps show the account under.
+	Issuer string
+	// EncryptionKey encrypts TOTP secrets at rest, since unlike passwords
+	// they have to be read back to check a code.
+	EncryptionKey []byte
+}
+
+// InitMFAConfigFromEnv reads the optional MFA_ISSUER and the required
+// MFA_ENCRYPTION_KEY, a hex encoded 32 byte AES-256 key.
+func InitMFAConfigFromEnv() (MFAConfig, error) {
+	issuer := defaultMFAIssuer
+	if value, ok := os.LookupEnv("MFA_ISSUER"); ok && value != "" {
+		issuer = value
+	}
+
+	keyStr, err := requireEnvVariable("MFA_ENCRYPTION_KEY")
+	if err != nil {
+		return MFAConfig{}, err
+	}
+
+	key, err := hex.DecodeString(keyStr)
+	if err != nil || len(key) != secretKeyLength {
+		return MFAConfig{}, fmt.Errorf("MFA_ENCRYPTION_KEY must be %v hex encoded bytes", secretKeyLength)
+	}
+
+	return MFAConfig{
+		Issuer:        issuer,
+		EncryptionKey: key,
+	}, nil
+}
+
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return "", NewCryptoError(err.Error())
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPProvisioningURI is the otpauth URI authenticator apps enroll from,
+// usually by scanning it as a QR code.
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return uri.String()
+}
+
+// TOTPCode returns the RFC 6238 code for the secret at the given time.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", ErrMalformedKey
+	}
+
+	return hotp(key, totpStep(t)), nil
+}
+
+// VerifyTOTP checks the code against the periods around t and returns the
+// period it matched, so that the caller can refuse to accept a code for the
+// same or an earlier period twice.
+func VerifyTOTP(secret, code string, t time.Time) (int64, bool, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false, ErrMalformedKey
+	}
+
+	step := totpStep(t)
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		want := hotp(key, step+offset)
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step + offset, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// hotp is the RFC 4226 code for the counter.
+func hotp(key []byte, counter int64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// GenerateRecoveryCodes returns n one-time codes that stand in for a TOTP
+// code when the authenticator is lost. Like opaque tokens they are stored
+// by HashRecoveryCode.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, NewCryptoError(err.Error())
+		}
+
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))[:recoveryCodeLength]
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode ignores case, spaces and dashes, so that the code can
+// be typed in however it was written down.
+func HashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return HashOpaqueToken(normalized)
+}
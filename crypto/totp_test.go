@@ -0,0 +1,103 @@
+package crypto_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+)
+
+// rfc6238Secret is the SHA1 secret from the RFC 6238 test vectors.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTP(t *testing.T) {
+	t.Run("matches RFC 6238 test vectors", func(t *testing.T) {
+		cases := map[int64]string{
+			59:         "287082",
+			1111111109: "081804",
+			1234567890: "005924",
+			2000000000: "279037",
+		}
+
+		for unix, want := range cases {
+			got, err := crypto.TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+			assert.RequireNoError(t, err)
+			assert.Equal(t, got, want)
+		}
+	})
+
+	t.Run("accepts code from adjacent period", func(t *testing.T) {
+		now := time.Unix(1234567890, 0)
+		code, err := crypto.TOTPCode(rfc6238Secret, now.Add(-30*time.Second))
+		assert.RequireNoError(t, err)
+
+		step, ok, err := crypto.VerifyTOTP(rfc6238Secret, code, now)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, step, int64(1234567890/30-1))
+	})
+
+	t.Run("rejects code from distant period", func(t *testing.T) {
+		now := time.Unix(1234567890, 0)
+		code, err := crypto.TOTPCode(rfc6238Secret, now.Add(-5*time.Minute))
+		assert.RequireNoError(t, err)
+
+		_, ok, err := crypto.VerifyTOTP(rfc6238Secret, code, now)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, ok, false)
+	})
+
+	t.Run("builds provisioning URI", func(t *testing.T) {
+		uri := crypto.TOTPProvisioningURI("Elysium", "john@example.com", rfc6238Secret)
+
+		if !strings.HasPrefix(uri, "otpauth://totp/Elysium:john@example.com?") {
+			t.Errorf("unexpected provisioning URI %q", uri)
+		}
+		if !strings.Contains(uri, "secret="+rfc6238Secret) {
+			t.Errorf("provisioning URI %q doesn't contain secret", uri)
+		}
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Run("generates distinct codes", func(t *testing.T) {
+		codes, err := crypto.GenerateRecoveryCodes(10)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(codes), 10)
+
+		seen := make(map[string]bool)
+		for _, code := range codes {
+			if seen[code] {
+				t.Errorf("got code %q twice", code)
+			}
+			seen[code] = true
+		}
+	})
+
+	t.Run("hashes code regardless of formatting", func(t *testing.T) {
+		assert.Equal(t, crypto.HashRecoveryCode("abcde-fghij"), crypto.HashRecoveryCode("ABCDE FGHIJ"))
+	})
+}
+
+func TestSecretEncryption(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	t.Run("decrypts what it encrypted", func(t *testing.T) {
+		ciphertext, err := crypto.EncryptSecret(key, rfc6238Secret)
+		assert.RequireNoError(t, err)
+
+		plaintext, err := crypto.DecryptSecret(key, ciphertext)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, plaintext, rfc6238Secret)
+	})
+
+	t.Run("returns ErrMalformedSecret on wrong key", func(t *testing.T) {
+		ciphertext, err := crypto.EncryptSecret(key, rfc6238Secret)
+		assert.RequireNoError(t, err)
+
+		_, err = crypto.DecryptSecret([]byte("fedcba9876543210fedcba9876543210"), ciphertext)
+		assert.Equal(t, err, (error)(crypto.ErrMalformedSecret))
+	})
+}
@@ -13,7 +13,10 @@ func main() {
 		log.Fatal("LoadGatewayConfig error: ", err)
 	}
 
-	gateway := handler.NewGateway(config)
+	gateway, err := handler.NewGateway(config)
+	if err != nil {
+		log.Fatal("NewGateway error: ", err)
+	}
 
 	log.Printf("Listening on %v...", config.ListenPort)
 	log.Fatal(http.ListenAndServe(config.ListenPort, gateway))
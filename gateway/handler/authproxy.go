@@ -1,55 +1,117 @@
 package handler
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 
-	"github.com/VitoNaychev/elysium-challenge/gateway/client"
-	"github.com/VitoNaychev/elysium-challenge/rpc/sessions"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+)
+
+// UserIDHeader and UserRolesHeader carry the ID and the comma separated
+// roles of the authenticated user to the proxied service. Requests made
+// with an API key carry ServiceAccountIDHeader instead of UserIDHeader, and
+// the roles are the scopes of the key. Any value sent by the client is
+// overwritten or removed.
+const (
+	UserIDHeader           = "User-ID"
+	UserRolesHeader        = "User-Roles"
+	ServiceAccountIDHeader = "Service-Account-ID"
+)
+
+var (
+	ErrEmailNotVerified = errors.New("email has to be verified first")
+	ErrMissingRole      = errors.New("user doesn't have a role required for this route")
+)
+
+const CodeEmailNotVerified apierror.Code = "email_not_verified"
+
+// gatewayErrors reports the errors of token verification. Rejections by
+// the sessions service arrive as gRPC statuses and are passed on as they
+// are, so only tokens checked locally get here.
+var gatewayErrors = append(append(apierror.Mapper{
+	{Err: ErrEmailNotVerified, Status: http.StatusForbidden, Code: CodeEmailNotVerified},
+	{Err: ErrMissingRole, Status: http.StatusForbidden, Code: apierror.CodePermissionDenied},
+}, apierror.CryptoErrors...),
+	apierror.Mapping{Err: ErrUnauthenticated, Status: http.StatusUnauthorized, Code: apierror.CodeUnauthenticated},
 )
 
 type AuthProxy struct {
-	proxy  *httputil.ReverseProxy
-	client sessions.UserClient
-}
+	proxy    *httputil.ReverseProxy
+	verifier TokenVerifier
 
-func NewAuthProxy(targetURL, authURL string) (*AuthProxy, error) {
-	target, err := url.Parse(targetURL)
-	if err != nil {
-		return nil, err
-	}
+	requireVerifiedEmail bool
+	roles                []string
+}
 
-	client, err := client.NewUserClient(authURL)
+// NewAuthProxy proxies requests with a valid token to the target. With
+// requireVerifiedEmail set, users who haven't verified their email yet are
+// turned away with Forbidden, and so are users without any of the roles
+// when roles are given. Service accounts have no email and only the roles
+// are checked for them.
+func NewAuthProxy(targetURL string, verifier TokenVerifier, requireVerifiedEmail bool, roles []string) (*AuthProxy, error) {
+	proxy, err := NewProxy(targetURL)
 	if err != nil {
 		return nil, err
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
 	return &AuthProxy{
-		proxy:  proxy,
-		client: client,
+		proxy:                proxy,
+		verifier:             verifier,
+		requireVerifiedEmail: requireVerifiedEmail,
+		roles:                roles,
 	}, nil
 }
 
 func (a *AuthProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	_, err := a.client.Authenticate(context.Background(), &sessions.AuthenticateRequest{Token: ""})
+	principal, err := a.verifier.Verify(r.Context(), requestToken(r))
 	if err != nil {
-		statusError, ok := status.FromError(err)
-		if ok && statusError.Code() == codes.Unauthenticated {
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(err.Error())
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(err.Error())
-		}
+		apierror.Write(w, gatewayErrors.Map(err))
+		return
+	}
+
+	isUser := principal.Kind != PrincipalServiceAccount
+
+	if a.requireVerifiedEmail && isUser && !principal.EmailVerified {
+		apierror.Write(w, gatewayErrors.Map(ErrEmailNotVerified))
+		return
+	}
+
+	if len(a.roles) > 0 && !hasAnyRole(principal.Roles, a.roles) {
+		apierror.Write(w, gatewayErrors.Map(ErrMissingRole))
 		return
 	}
 
+	if isUser {
+		r.Header.Set(UserIDHeader, strconv.Itoa(principal.UserID))
+		r.Header.Del(ServiceAccountIDHeader)
+	} else {
+		r.Header.Set(ServiceAccountIDHeader, strconv.Itoa(principal.ServiceAccountID))
+		r.Header.Del(UserIDHeader)
+	}
+	r.Header.Set(UserRolesHeader, strings.Join(principal.Roles, ","))
+
 	a.proxy.ServeHTTP(w, r)
 }
+
+func hasAnyRole(roles, wanted []string) bool {
+	for _, role := range wanted {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestToken reads the JWT or API key from the Token header. EventSource and
+// WebSocket clients in browsers can't set headers, so for them the token
+// may be passed in the "token" query parameter instead.
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get("Token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
@@ -0,0 +1,117 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/gateway/handler"
+)
+
+type SpyBackend struct {
+	calls   int
+	request *http.Request
+}
+
+func (s *SpyBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.calls++
+	s.request = r
+	w.WriteHeader(http.StatusOK)
+}
+
+func newAuthProxy(t testing.TB, verifier handler.TokenVerifier, requireVerifiedEmail bool, roles []string) (*handler.AuthProxy, *SpyBackend) {
+	t.Helper()
+
+	backend := &SpyBackend{}
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+
+	authProxy, err := handler.NewAuthProxy(server.URL, verifier, requireVerifiedEmail, roles)
+	assert.RequireNoError(t, err)
+
+	return authProxy, backend
+}
+
+func proxyRequest(authProxy *handler.AuthProxy, token string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, "/wallet/admin/risk", nil)
+	request.Header.Set("Token", token)
+	request.Header.Set(handler.UserIDHeader, "99")
+	response := httptest.NewRecorder()
+
+	authProxy.ServeHTTP(response, request)
+	return response
+}
+
+func TestAuthProxy(t *testing.T) {
+	adminRoles := []string{"admin", "support"}
+
+	t.Run("passes user with one of the roles on with their ID and roles", func(t *testing.T) {
+		verifier := &StubTokenVerifier{dummyPrincipal: handler.Principal{
+			Kind:          handler.PrincipalUser,
+			UserID:        10,
+			EmailVerified: true,
+			Roles:         []string{"player", "support"},
+		}}
+		authProxy, backend := newAuthProxy(t, verifier, false, adminRoles)
+
+		response := proxyRequest(authProxy, "sampleJWT")
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, verifier.spyToken, "sampleJWT")
+		assert.Equal(t, backend.request.Header.Get(handler.UserIDHeader), "10")
+		assert.Equal(t, backend.request.Header.Get(handler.UserRolesHeader), "player,support")
+	})
+
+	t.Run("returns Forbidden to user without any of the roles", func(t *testing.T) {
+		verifier := &StubTokenVerifier{dummyPrincipal: handler.Principal{
+			Kind:          handler.PrincipalUser,
+			UserID:        10,
+			EmailVerified: true,
+			Roles:         []string{"player"},
+		}}
+		authProxy, backend := newAuthProxy(t, verifier, false, adminRoles)
+
+		response := proxyRequest(authProxy, "sampleJWT")
+		assert.Equal(t, response.Code, http.StatusForbidden)
+		assert.Equal(t, backend.calls, 0)
+	})
+
+	t.Run("checks scopes of API key against roles", func(t *testing.T) {
+		verifier := &StubTokenVerifier{dummyPrincipal: handler.Principal{
+			Kind:             handler.PrincipalServiceAccount,
+			ServiceAccountID: 3,
+			Roles:            []string{"admin"},
+		}}
+		authProxy, backend := newAuthProxy(t, verifier, true, adminRoles)
+
+		response := proxyRequest(authProxy, "ek_sampleKey")
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, backend.request.Header.Get(handler.ServiceAccountIDHeader), "3")
+		assert.Equal(t, backend.request.Header.Get(handler.UserIDHeader), "")
+	})
+
+	t.Run("returns Forbidden to user with unverified email", func(t *testing.T) {
+		verifier := &StubTokenVerifier{dummyPrincipal: handler.Principal{
+			Kind:   handler.PrincipalUser,
+			UserID: 10,
+			Roles:  []string{"admin"},
+		}}
+		authProxy, backend := newAuthProxy(t, verifier, true, adminRoles)
+
+		response := proxyRequest(authProxy, "sampleJWT")
+		assert.Equal(t, response.Code, http.StatusForbidden)
+		assert.Equal(t, backend.calls, 0)
+	})
+
+	t.Run("returns Unauthorized on rejected token", func(t *testing.T) {
+		verifier := &StubTokenVerifier{dummyErr: fmt.Errorf("%w: session revoked", handler.ErrUnauthenticated)}
+		authProxy, backend := newAuthProxy(t, verifier, false, nil)
+
+		response := proxyRequest(authProxy, "sampleJWT")
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+		assert.Equal(t, backend.calls, 0)
+	})
+}
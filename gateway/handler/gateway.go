@@ -1,23 +1,54 @@
 package handler
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/gateway/client"
 	"github.com/spf13/viper"
 )
 
+const (
+	// VerificationRemote sends every token to the sessions service.
+	VerificationRemote = "remote"
+	// VerificationLocal checks tokens in the gateway and only asks the
+	// sessions service whether their session was revoked.
+	VerificationLocal = "local"
+
+	defaultJWKSMaxAge         = 5 * time.Minute
+	defaultRevocationCacheTTL = 10 * time.Second
+)
+
 type Route struct {
 	Name         string `mapstructure:"name"`
 	Context      string `mapstructure:"context"`
 	Target       string `mapstructure:"target"`
 	Authenticate bool   `mapstructure:"authenticate,omitempty"`
+	Verification string `mapstructure:"verification,omitempty"`
+	// RequireVerifiedEmail limits the route to users who have verified
+	// their email, it only applies to authenticated routes.
+	RequireVerifiedEmail bool `mapstructure:"requireVerifiedEmail,omitempty"`
+	// Roles limits the route to users who have at least one of them. A
+	// route with roles is always authenticated.
+	Roles []string `mapstructure:"roles,omitempty"`
 }
 
 type GatewayConfig struct {
-	ListenPort       string  `mapstructure:"listenPort"`
-	AuthenticateAddr string  `mapstructure:"authenticateAddr"`
-	Routes           []Route `mapstructure:"routes"`
+	ListenPort       string `mapstructure:"listenPort"`
+	AuthenticateAddr string `mapstructure:"authenticateAddr"`
+
+	// JWKSURL is where local verification fetches the signing keys from,
+	// unless VerificationKeyFile pins a single PEM encoded public key.
+	JWKSURL             string        `mapstructure:"jwksURL"`
+	JWKSMaxAge          time.Duration `mapstructure:"jwksMaxAge"`
+	VerificationKeyFile string        `mapstructure:"verificationKeyFile"`
+	RevocationCacheTTL  time.Duration `mapstructure:"revocationCacheTTL"`
+
+	Routes []Route `mapstructure:"routes"`
 }
 
 func LoadGatewayConfig(path string) (GatewayConfig, error) {
@@ -30,7 +61,10 @@ func LoadGatewayConfig(path string) (GatewayConfig, error) {
 		return GatewayConfig{}, nil
 	}
 
-	gatewayConfig := GatewayConfig{}
+	gatewayConfig := GatewayConfig{
+		JWKSMaxAge:         defaultJWKSMaxAge,
+		RevocationCacheTTL: defaultRevocationCacheTTL,
+	}
 	viper.UnmarshalKey("gateway", &gatewayConfig)
 
 	return gatewayConfig, nil
@@ -40,29 +74,99 @@ type Gateway struct {
 	http.Handler
 }
 
-func NewGateway(config GatewayConfig) *Gateway {
-	var (
-		proxy http.Handler
-		err   error
-	)
-
+// NewGateway maps every route of the config. A route that can't be built
+// fails the whole gateway, leaving it out would turn its requests into
+// NotFound, or hand them to a shorter route that may not authenticate.
+func NewGateway(config GatewayConfig) (*Gateway, error) {
 	mux := http.NewServeMux()
+	verifiers := newVerifiers(config)
 
 	for _, route := range config.Routes {
-		if route.Authenticate {
-			proxy, err = NewAuthProxy(route.Target, config.AuthenticateAddr)
-		} else {
-			proxy, err = NewProxy(route.Target)
-		}
+		proxy, err := newRouteProxy(route, verifiers)
 		if err != nil {
-			log.Println("NewProxy error: ", err)
+			return nil, fmt.Errorf("route '%v': %w", route.Name, err)
 		}
 
 		log.Printf("Mapping '%v' | %v ---> %v", route.Name, route.Context, route.Target)
-		mux.HandleFunc(route.Context, proxy.ServeHTTP)
+		mux.Handle(route.Context, proxy)
 	}
 
 	return &Gateway{
-		Handler: mux,
+		Handler: apierror.WithRequestID(mux),
+	}, nil
+}
+
+func newRouteProxy(route Route, verifiers *verifiers) (http.Handler, error) {
+	if !route.Authenticate && len(route.Roles) == 0 {
+		return NewProxy(route.Target)
+	}
+
+	verifier, err := verifiers.get(route.Verification)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthProxy(route.Target, verifier, route.RequireVerifiedEmail, route.Roles)
+}
+
+// verifiers builds the token verifiers on first use, so that routes using
+// the same verification mode share a JWKS and a revocation cache.
+type verifiers struct {
+	config GatewayConfig
+
+	remote *RemoteVerifier
+	local  *LocalVerifier
+}
+
+func newVerifiers(config GatewayConfig) *verifiers {
+	return &verifiers{
+		config: config,
+	}
+}
+
+func (v *verifiers) get(mode string) (TokenVerifier, error) {
+	switch mode {
+	case "", VerificationRemote:
+		return v.getRemote()
+	case VerificationLocal:
+		return v.getLocal()
+	}
+	return nil, fmt.Errorf("unknown verification mode %q", mode)
+}
+
+func (v *verifiers) getRemote() (*RemoteVerifier, error) {
+	if v.remote != nil {
+		return v.remote, nil
+	}
+
+	client, err := client.NewUserClient(v.config.AuthenticateAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	v.remote = NewRemoteVerifier(client)
+	return v.remote, nil
+}
+
+func (v *verifiers) getLocal() (*LocalVerifier, error) {
+	if v.local != nil {
+		return v.local, nil
+	}
+
+	remote, err := v.getRemote()
+	if err != nil {
+		return nil, err
 	}
+
+	var keys crypto.KeySet
+	if v.config.VerificationKeyFile != "" {
+		keys, err = crypto.LoadStaticKeySet(v.config.VerificationKeyFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		keys = NewJWKSKeySet(v.config.JWKSURL, v.config.JWKSMaxAge)
+	}
+
+	v.local = NewLocalVerifier(keys, remote, v.config.RevocationCacheTTL)
+	return v.local, nil
 }
@@ -0,0 +1,39 @@
+package handler_test
+
+import (
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/gateway/handler"
+)
+
+func TestNewGateway(t *testing.T) {
+	t.Run("builds routes of default config", func(t *testing.T) {
+		config, err := handler.LoadGatewayConfig("../config/default.yml")
+		assert.RequireNoError(t, err)
+
+		_, err = handler.NewGateway(config)
+		assert.RequireNoError(t, err)
+
+		gated := map[string][]string{}
+		for _, route := range config.Routes {
+			if len(route.Roles) > 0 {
+				gated[route.Context] = route.Roles
+			}
+		}
+		assert.Equal(t, gated["/user/roles"], []string{"admin"})
+		assert.Equal(t, gated["/wallet/games/"], []string{"game_provider"})
+	})
+
+	t.Run("returns error on authenticated route that can't be built", func(t *testing.T) {
+		config := handler.GatewayConfig{Routes: []handler.Route{
+			{Name: "public", Context: "/public/", Target: "http://localhost:8080"},
+			{Name: "admin", Context: "/public/admin/", Target: "http://localhost:8080", Roles: []string{"admin"}, Verification: "unknown"},
+		}}
+
+		_, err := handler.NewGateway(config)
+		if err == nil {
+			t.Errorf("got no error, want one")
+		}
+	})
+}
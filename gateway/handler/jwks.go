@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+)
+
+const (
+	jwksFetchTimeout = 5 * time.Second
+	// jwksMinRefetch stops tokens with made up kids, or an unreachable
+	// sessions service, from turning every request into a JWKS fetch.
+	jwksMinRefetch = time.Second
+)
+
+// JWKSKeySet is a KeySet backed by the JWKS the sessions service publishes.
+// The JWKS is refetched once it is older than maxAge, or early when a token
+// names a kid it doesn't contain, which is what happens right after a key
+// rotation.
+type JWKSKeySet struct {
+	url    string
+	maxAge time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	jwks        crypto.JWKS
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func NewJWKSKeySet(url string, maxAge time.Duration) *JWKSKeySet {
+	return &JWKSKeySet{
+		url:    url,
+		maxAge: maxAge,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+	}
+}
+
+func (j *JWKSKeySet) VerificationKey(kid string) (crypto.VerificationKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	canFetch := now.Sub(j.attemptedAt) >= jwksMinRefetch
+
+	if canFetch && now.Sub(j.fetchedAt) >= j.maxAge {
+		j.refresh(now)
+		canFetch = false
+	}
+
+	key, err := j.jwks.VerificationKey(kid)
+	if canFetch && errors.Is(err, crypto.ErrUnknownKey) {
+		j.refresh(now)
+		key, err = j.jwks.VerificationKey(kid)
+	}
+
+	return key, err
+}
+
+// refresh keeps serving the previous JWKS when the fetch fails, so that a
+// blip in the sessions service doesn't take down authentication. Expects
+// j.mu to be held.
+func (j *JWKSKeySet) refresh(now time.Time) {
+	j.attemptedAt = now
+
+	jwks, err := j.fetch()
+	if err != nil {
+		log.Printf("JWKS fetch error: %v", err)
+		return
+	}
+
+	j.jwks = jwks
+	j.fetchedAt = now
+}
+
+func (j *JWKSKeySet) fetch() (crypto.JWKS, error) {
+	response, err := j.client.Get(j.url)
+	if err != nil {
+		return crypto.JWKS{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return crypto.JWKS{}, fmt.Errorf("unexpected status %v from %v", response.StatusCode, j.url)
+	}
+
+	var jwks crypto.JWKS
+	err = json.NewDecoder(response.Body).Decode(&jwks)
+	if err != nil {
+		return crypto.JWKS{}, err
+	}
+
+	return jwks, nil
+}
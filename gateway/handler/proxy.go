@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"net/http"
 	"net/http/httputil"
 	"net/url"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
 )
 
 func NewProxy(targetURL string) (*httputil.ReverseProxy, error) {
@@ -11,5 +14,13 @@ func NewProxy(targetURL string) (*httputil.ReverseProxy, error) {
 		return nil, err
 	}
 
-	return httputil.NewSingleHostReverseProxy(target), nil
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	// the gateway has already set the request ID header of the response, a
+	// second copy from the service would only repeat it
+	proxy.ModifyResponse = func(response *http.Response) error {
+		response.Header.Del(apierror.RequestIDHeader)
+		return nil
+	}
+
+	return proxy, nil
 }
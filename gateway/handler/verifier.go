@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/rpc/sessions"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrSessionMismatch = errors.New("session does not belong to token subject")
+)
+
+type PrincipalKind string
+
+const (
+	PrincipalUser           PrincipalKind = "user"
+	PrincipalServiceAccount PrincipalKind = "service_account"
+)
+
+// Principal is who a verified token was issued to. UserID and
+// EmailVerified are only set for users, ServiceAccountID only for service
+// accounts.
+type Principal struct {
+	Kind             PrincipalKind
+	UserID           int
+	ServiceAccountID int
+	EmailVerified    bool
+	Roles            []string
+}
+
+// TokenVerifier resolves a JWT or an API key to who it was issued to. Errors
+// wrapping ErrUnauthenticated mean the token was rejected, anything else
+// means it could not be checked, which includes the context being done.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (Principal, error)
+}
+
+// RemoteVerifier asks the sessions service about every token.
+type RemoteVerifier struct {
+	client sessions.UserClient
+}
+
+func NewRemoteVerifier(client sessions.UserClient) *RemoteVerifier {
+	return &RemoteVerifier{
+		client: client,
+	}
+}
+
+func (r *RemoteVerifier) Verify(ctx context.Context, token string) (Principal, error) {
+	response, err := r.client.Authenticate(ctx, &sessions.AuthenticateRequest{Token: token})
+	if err != nil {
+		// keep the error the sessions service reported, so that its code
+		// reaches the client unchanged
+		apiErr, ok := apierror.FromGRPC(err)
+		if ok && status.Code(err) == codes.Unauthenticated {
+			return Principal{}, fmt.Errorf("%w: %w", ErrUnauthenticated, apiErr)
+		}
+		return Principal{}, err
+	}
+
+	if response.Kind == sessions.PrincipalKind_PRINCIPAL_KIND_SERVICE_ACCOUNT {
+		return Principal{Kind: PrincipalServiceAccount, ServiceAccountID: int(response.ServiceAccountId), Roles: response.Roles}, nil
+	}
+	return Principal{Kind: PrincipalUser, UserID: int(response.Id), EmailVerified: response.EmailVerified, Roles: response.Roles}, nil
+}
+
+type revocationEntry struct {
+	userID    int
+	err       error
+	expiresAt time.Time
+}
+
+// LocalVerifier checks the signature and expiry of a token itself and only
+// asks the sessions service whether the session behind it was revoked. The
+// answer is cached per session for revocationTTL, which bounds how long a
+// revoked session keeps working through the gateway. API keys can't be
+// checked locally and are always passed on to the sessions service.
+type LocalVerifier struct {
+	keys          crypto.KeySet
+	remote        TokenVerifier
+	revocationTTL time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]revocationEntry
+	lastSweep time.Time
+}
+
+func NewLocalVerifier(keys crypto.KeySet, remote TokenVerifier, revocationTTL time.Duration) *LocalVerifier {
+	return &LocalVerifier{
+		keys:          keys,
+		remote:        remote,
+		revocationTTL: revocationTTL,
+		entries:       make(map[string]revocationEntry),
+	}
+}
+
+func (l *LocalVerifier) Verify(ctx context.Context, token string) (Principal, error) {
+	if crypto.IsAPIKey(token) {
+		return l.remote.Verify(ctx, token)
+	}
+
+	claims, err := crypto.ParseJWTWithKeys(l.keys, token)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+
+	userID, err := l.checkRevocation(ctx, claims.SessionID, token)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if userID != claims.Subject {
+		return Principal{}, fmt.Errorf("%w: %w", ErrUnauthenticated, ErrSessionMismatch)
+	}
+
+	// the cached answer may be for an older JWT of the same session, so
+	// everything but revocation is taken from this one
+	return Principal{Kind: PrincipalUser, UserID: claims.Subject, EmailVerified: claims.EmailVerified, Roles: claims.Roles}, nil
+}
+
+func (l *LocalVerifier) checkRevocation(ctx context.Context, sessionID, token string) (int, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	entry, ok := l.entries[sessionID]
+	l.mu.Unlock()
+
+	if ok && now.Before(entry.expiresAt) {
+		return entry.userID, entry.err
+	}
+
+	principal, err := l.remote.Verify(ctx, token)
+	if err != nil && !errors.Is(err, ErrUnauthenticated) {
+		// don't remember that the sessions service was unreachable
+		return -1, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[sessionID] = revocationEntry{
+		userID:    principal.UserID,
+		err:       err,
+		expiresAt: now.Add(l.revocationTTL),
+	}
+	l.sweep(now)
+
+	return principal.UserID, err
+}
+
+// sweep drops expired entries, at most once per TTL. Expects l.mu to be held.
+func (l *LocalVerifier) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.revocationTTL {
+		return
+	}
+	l.lastSweep = now
+
+	for id, entry := range l.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(l.entries, id)
+		}
+	}
+}
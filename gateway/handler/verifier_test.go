@@ -0,0 +1,186 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/gateway/handler"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type StubTokenVerifier struct {
+	dummyPrincipal handler.Principal
+	dummyErr       error
+
+	spyCalls int
+	spyToken string
+}
+
+func (s *StubTokenVerifier) Verify(ctx context.Context, token string) (handler.Principal, error) {
+	s.spyCalls++
+	s.spyToken = token
+	return s.dummyPrincipal, s.dummyErr
+}
+
+func newJWTConfig(t testing.TB) crypto.JWTConfig {
+	t.Helper()
+
+	keyRing, err := crypto.NewKeyRing(crypto.NewInMemoryKeyStore(), crypto.AlgorithmEdDSA, time.Minute)
+	assert.RequireNoError(t, err)
+
+	return crypto.JWTConfig{Keys: keyRing, ExpiresAt: time.Minute}
+}
+
+func generateJWT(t testing.TB, config crypto.JWTConfig, claims crypto.Claims) string {
+	t.Helper()
+
+	jwt, err := crypto.GenerateJWT(config, claims)
+	assert.RequireNoError(t, err)
+
+	return jwt
+}
+
+func TestLocalVerifier(t *testing.T) {
+	jwtConfig := newJWTConfig(t)
+	claims := crypto.Claims{Subject: 10, SessionID: "sampleSession", EmailVerified: true, Roles: []string{"player"}}
+	userPrincipal := handler.Principal{Kind: handler.PrincipalUser, UserID: 10}
+
+	t.Run("returns principal from claims of JWT", func(t *testing.T) {
+		remote := &StubTokenVerifier{dummyPrincipal: userPrincipal}
+		verifier := handler.NewLocalVerifier(jwtConfig.Keys, remote, time.Minute)
+
+		principal, err := verifier.Verify(context.Background(), generateJWT(t, jwtConfig, claims))
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, principal, handler.Principal{
+			Kind:          handler.PrincipalUser,
+			UserID:        10,
+			EmailVerified: true,
+			Roles:         []string{"player"},
+		})
+	})
+
+	t.Run("asks sessions service about session only once within TTL", func(t *testing.T) {
+		remote := &StubTokenVerifier{dummyPrincipal: userPrincipal}
+		verifier := handler.NewLocalVerifier(jwtConfig.Keys, remote, time.Minute)
+
+		jwt := generateJWT(t, jwtConfig, claims)
+		for i := 0; i < 3; i++ {
+			_, err := verifier.Verify(context.Background(), jwt)
+			assert.RequireNoError(t, err)
+		}
+
+		assert.Equal(t, remote.spyCalls, 1)
+	})
+
+	t.Run("asks sessions service again once TTL expired", func(t *testing.T) {
+		remote := &StubTokenVerifier{dummyPrincipal: userPrincipal}
+		verifier := handler.NewLocalVerifier(jwtConfig.Keys, remote, 10*time.Millisecond)
+
+		jwt := generateJWT(t, jwtConfig, claims)
+		_, err := verifier.Verify(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+
+		remote.dummyErr = fmt.Errorf("%w: session revoked", handler.ErrUnauthenticated)
+		time.Sleep(20 * time.Millisecond)
+
+		_, err = verifier.Verify(context.Background(), jwt)
+		assert.Equal(t, errors.Is(err, handler.ErrUnauthenticated), true)
+		assert.Equal(t, remote.spyCalls, 2)
+	})
+
+	t.Run("keeps rejecting revoked session within TTL", func(t *testing.T) {
+		remote := &StubTokenVerifier{dummyErr: fmt.Errorf("%w: session revoked", handler.ErrUnauthenticated)}
+		verifier := handler.NewLocalVerifier(jwtConfig.Keys, remote, time.Minute)
+
+		jwt := generateJWT(t, jwtConfig, claims)
+		for i := 0; i < 2; i++ {
+			_, err := verifier.Verify(context.Background(), jwt)
+			assert.Equal(t, errors.Is(err, handler.ErrUnauthenticated), true)
+		}
+
+		assert.Equal(t, remote.spyCalls, 1)
+	})
+
+	t.Run("doesn't remember errors that aren't rejections", func(t *testing.T) {
+		remote := &StubTokenVerifier{dummyErr: status.Error(codes.Unavailable, "connection refused")}
+		verifier := handler.NewLocalVerifier(jwtConfig.Keys, remote, time.Minute)
+
+		jwt := generateJWT(t, jwtConfig, claims)
+		_, err := verifier.Verify(context.Background(), jwt)
+		assert.Equal(t, errors.Is(err, handler.ErrUnauthenticated), false)
+
+		remote.dummyErr = nil
+		remote.dummyPrincipal = userPrincipal
+
+		_, err = verifier.Verify(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, remote.spyCalls, 2)
+	})
+
+	t.Run("returns ErrSessionMismatch on session of another user", func(t *testing.T) {
+		remote := &StubTokenVerifier{dummyPrincipal: handler.Principal{Kind: handler.PrincipalUser, UserID: 11}}
+		verifier := handler.NewLocalVerifier(jwtConfig.Keys, remote, time.Minute)
+
+		_, err := verifier.Verify(context.Background(), generateJWT(t, jwtConfig, claims))
+		assert.Equal(t, errors.Is(err, handler.ErrUnauthenticated), true)
+		assert.Equal(t, errors.Is(err, handler.ErrSessionMismatch), true)
+	})
+
+	t.Run("returns ErrUnauthenticated on JWT of unknown key without asking sessions service", func(t *testing.T) {
+		remote := &StubTokenVerifier{dummyPrincipal: userPrincipal}
+		verifier := handler.NewLocalVerifier(newJWTConfig(t).Keys, remote, time.Minute)
+
+		_, err := verifier.Verify(context.Background(), generateJWT(t, jwtConfig, claims))
+		assert.Equal(t, errors.Is(err, handler.ErrUnauthenticated), true)
+		assert.Equal(t, remote.spyCalls, 0)
+	})
+
+	t.Run("passes API key on to sessions service", func(t *testing.T) {
+		remote := &StubTokenVerifier{dummyPrincipal: handler.Principal{Kind: handler.PrincipalServiceAccount, ServiceAccountID: 3}}
+		verifier := handler.NewLocalVerifier(jwtConfig.Keys, remote, time.Minute)
+
+		principal, err := verifier.Verify(context.Background(), "ek_sampleKey")
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, remote.spyToken, "ek_sampleKey")
+		assert.Equal(t, principal.ServiceAccountID, 3)
+	})
+
+	t.Run("refetches JWKS on JWT of unknown kid", func(t *testing.T) {
+		rotatingConfig := newJWTConfig(t)
+
+		fetches := 0
+		jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches++
+			json.NewEncoder(w).Encode(rotatingConfig.Keys.JWKS())
+		}))
+		defer jwksServer.Close()
+
+		remote := &StubTokenVerifier{dummyPrincipal: userPrincipal}
+		verifier := handler.NewLocalVerifier(handler.NewJWKSKeySet(jwksServer.URL, time.Hour), remote, time.Minute)
+
+		_, err := verifier.Verify(context.Background(), generateJWT(t, rotatingConfig, claims))
+		assert.RequireNoError(t, err)
+		assert.Equal(t, fetches, 1)
+
+		err = rotatingConfig.Keys.Rotate()
+		assert.RequireNoError(t, err)
+
+		// refetches are spaced at least a second apart
+		time.Sleep(1100 * time.Millisecond)
+
+		_, err = verifier.Verify(context.Background(), generateJWT(t, rotatingConfig, claims))
+		assert.RequireNoError(t, err)
+		assert.Equal(t, fetches, 2)
+	})
+}
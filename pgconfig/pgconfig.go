@@ -3,8 +3,24 @@ package pgconfig
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
+const (
+	defaultMaxConns          = 10
+	defaultMinConns          = 1
+	defaultMaxConnLifetime   = time.Hour
+	defaultMaxConnIdleTime   = 30 * time.Minute
+	defaultHealthCheckPeriod = time.Minute
+	defaultConnectTimeout    = time.Minute
+)
+
+// Config describes the database and the pool of connections to it.
+// Connections are recycled after MaxConnLifetime and closed after being
+// idle for MaxConnIdleTime, down to MinConns. Idle connections are health
+// checked every HealthCheckPeriod. ConnectTimeout is how long NewPool keeps
+// retrying before giving up on an unreachable database.
 type Config struct {
 	Host     string
 	Port     string
@@ -12,6 +28,13 @@ type Config struct {
 	Password string
 	Database string
 	Options  string
+
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	ConnectTimeout    time.Duration
 }
 
 func (c *Config) GetConnectionString() string {
@@ -19,6 +42,8 @@ func (c *Config) GetConnectionString() string {
 		c.User, c.Password, c.Host, c.Port, c.Database, c.Options)
 }
 
+// InitFromEnv requires the address and credentials of the database, pool
+// settings are optional and fall back to defaults.
 func InitFromEnv() (Config, error) {
 	var (
 		config Config
@@ -43,6 +68,34 @@ func InitFromEnv() (Config, error) {
 
 	config.Options = os.Getenv("POSTGRES_OPTIONS")
 
+	config.MaxConns = defaultMaxConns
+	config.MinConns = defaultMinConns
+	if err = lookupConnsEnv("POSTGRES_MAX_CONNS", &config.MaxConns); err != nil {
+		return Config{}, err
+	}
+	if err = lookupConnsEnv("POSTGRES_MIN_CONNS", &config.MinConns); err != nil {
+		return Config{}, err
+	}
+	if config.MaxConns == 0 {
+		return Config{}, fmt.Errorf("POSTGRES_MAX_CONNS must be at least 1")
+	}
+	if config.MinConns > config.MaxConns {
+		return Config{}, fmt.Errorf("POSTGRES_MIN_CONNS must not be greater than POSTGRES_MAX_CONNS")
+	}
+
+	if config.MaxConnLifetime, err = lookupDurationEnv("POSTGRES_MAX_CONN_LIFETIME", defaultMaxConnLifetime); err != nil {
+		return Config{}, err
+	}
+	if config.MaxConnIdleTime, err = lookupDurationEnv("POSTGRES_MAX_CONN_IDLE_TIME", defaultMaxConnIdleTime); err != nil {
+		return Config{}, err
+	}
+	if config.HealthCheckPeriod, err = lookupDurationEnv("POSTGRES_HEALTH_CHECK_PERIOD", defaultHealthCheckPeriod); err != nil {
+		return Config{}, err
+	}
+	if config.ConnectTimeout, err = lookupDurationEnv("POSTGRES_CONNECT_TIMEOUT", defaultConnectTimeout); err != nil {
+		return Config{}, err
+	}
+
 	return config, nil
 }
 
@@ -56,3 +109,31 @@ func requireEnvVariable(name string) (string, error) {
 	}
 	return value, nil
 }
+
+func lookupConnsEnv(name string, value *int32) error {
+	str, ok := os.LookupEnv(name)
+	if !ok || str == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseUint(str, 10, 31)
+	if err != nil {
+		return fmt.Errorf("env variable %v must be a positive integer", name)
+	}
+
+	*value = int32(parsed)
+	return nil
+}
+
+func lookupDurationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("env variable %v must be a positive duration", name)
+	}
+	return duration, nil
+}
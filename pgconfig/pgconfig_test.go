@@ -0,0 +1,82 @@
+package pgconfig_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/pgconfig"
+)
+
+func setRequiredEnv(t testing.TB) {
+	t.Setenv("POSTGRES_HOST", "localhost")
+	t.Setenv("POSTGRES_PORT", "5432")
+	t.Setenv("POSTGRES_USER", "postgres")
+	t.Setenv("POSTGRES_PASS", "password")
+	t.Setenv("POSTGRES_DB", "sessions")
+}
+
+func TestInitFromEnv(t *testing.T) {
+	t.Run("reads pool settings from env", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("POSTGRES_MAX_CONNS", "20")
+		t.Setenv("POSTGRES_MAX_CONN_LIFETIME", "15m")
+
+		config, err := pgconfig.InitFromEnv()
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, config.MaxConns, int32(20))
+		assert.Equal(t, config.MaxConnLifetime, 15*time.Minute)
+
+		poolConfig, err := config.PoolConfig()
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, poolConfig.MaxConns, int32(20))
+		assert.Equal(t, poolConfig.MaxConnLifetime, 15*time.Minute)
+		assert.Equal(t, poolConfig.HealthCheckPeriod, config.HealthCheckPeriod)
+	})
+
+	t.Run("returns error on min conns above max conns", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("POSTGRES_MAX_CONNS", "2")
+		t.Setenv("POSTGRES_MIN_CONNS", "5")
+
+		_, err := pgconfig.InitFromEnv()
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("returns error on invalid duration", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("POSTGRES_CONNECT_TIMEOUT", "soon")
+
+		_, err := pgconfig.InitFromEnv()
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestNewPool(t *testing.T) {
+	t.Run("gives up after connect timeout", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("POSTGRES_HOST", "127.0.0.1")
+		t.Setenv("POSTGRES_PORT", "1")
+		t.Setenv("POSTGRES_MIN_CONNS", "0")
+		t.Setenv("POSTGRES_CONNECT_TIMEOUT", "1s")
+
+		config, err := pgconfig.InitFromEnv()
+		assert.RequireNoError(t, err)
+
+		start := time.Now()
+		_, err = pgconfig.NewPool(context.Background(), config)
+		if err == nil {
+			t.Fatalf("expected error, got nil")
+		}
+		if elapsed := time.Since(start); elapsed < time.Second || elapsed > 5*time.Second {
+			t.Errorf("expected to retry for the connect timeout, took %v", elapsed)
+		}
+	})
+}
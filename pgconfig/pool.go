@@ -0,0 +1,67 @@
+package pgconfig
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	initialRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 10 * time.Second
+)
+
+func (c *Config) PoolConfig() (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(c.GetConnectionString())
+	if err != nil {
+		return nil, fmt.Errorf("invalid database config: %w", err)
+	}
+
+	poolConfig.MaxConns = c.MaxConns
+	poolConfig.MinConns = c.MinConns
+	poolConfig.MaxConnLifetime = c.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = c.MaxConnIdleTime
+	poolConfig.HealthCheckPeriod = c.HealthCheckPeriod
+
+	return poolConfig, nil
+}
+
+// NewPool opens a pool of connections to the database. Services usually
+// start alongside the database, so until it answers a ping NewPool retries
+// with exponential backoff, for at most ConnectTimeout.
+func NewPool(ctx context.Context, config Config) (*pgxpool.Pool, error) {
+	poolConfig, err := config.PoolConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.ConnectTimeout)
+	defer cancel()
+
+	delay := initialRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+
+		log.Printf("Database unreachable (attempt %v), retrying in %v: %v", attempt, delay, err)
+
+		select {
+		case <-ctx.Done():
+			pool.Close()
+			return nil, fmt.Errorf("unable to connect to database: %w", err)
+		case <-time.After(delay):
+		}
+
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
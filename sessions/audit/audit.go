@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+type EventType string
+
+const (
+	EventSignup          EventType = "signup"
+	EventLogin           EventType = "login"
+	EventLogout          EventType = "logout"
+	EventPasswordChanged EventType = "password_changed"
+	EventPasswordReset   EventType = "password_reset"
+	EventSessionRevoked  EventType = "session_revoked"
+	EventSessionsRevoked EventType = "sessions_revoked"
+	EventRolesChanged    EventType = "roles_changed"
+	EventAPIKeyRevoked   EventType = "api_key_revoked"
+	EventAccountLocked   EventType = "account_locked"
+	EventAccountUnlocked EventType = "account_unlocked"
+	EventAccountDeleted  EventType = "account_deleted"
+)
+
+type Result string
+
+const (
+	ResultSuccess Result = "success"
+	ResultFailure Result = "failure"
+)
+
+// Event is a security relevant action taken on an account. ActorID is the
+// user who took it, or 0 when that isn't known, like on a login with an
+// unknown email. When another service took it, ActorServiceAccountID is the
+// service account it called with instead. Email is what the account
+// was addressed by, since some events are recorded before it's known
+// whether the account exists. Target is what the action was taken on when
+// that isn't simply the actor's account.
+type Event struct {
+	ID        int64
+	Type      EventType
+	ActorID   int `db:"actor_id"`
+	Email     string
+	Target    string
+	IP        string
+	UserAgent string `db:"user_agent"`
+	Result    Result
+	Time      time.Time `db:"created_at"`
+
+	ActorServiceAccountID int `db:"actor_service_account_id"`
+}
+
+// Field limits match the columns of the audit_events table.
+const (
+	maxEmailLength     = 60
+	maxTargetLength    = 100
+	maxIPLength        = 45
+	maxUserAgentLength = 255
+)
+
+// Truncate cuts the fields that come from outside, like an email someone
+// tried to log in with, to the size of their columns, so that the event can
+// still be recorded.
+func (e Event) Truncate() Event {
+	e.Email = truncate(e.Email, maxEmailLength)
+	e.Target = truncate(e.Target, maxTargetLength)
+	e.IP = truncate(e.IP, maxIPLength)
+	e.UserAgent = truncate(e.UserAgent, maxUserAgentLength)
+	return e
+}
+
+func truncate(value string, limit int) string {
+	if utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+	return string([]rune(value)[:limit])
+}
+
+func SessionTarget(sessionID string) string {
+	return "session:" + sessionID
+}
+
+func UserTarget(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+func APIKeyTarget(keyID string) string {
+	return "api_key:" + keyID
+}
+
+// Filter narrows down a query of the log. Zero fields don't filter.
+// Events come newest first, Before continues from the ID of the last
+// event of the previous page.
+type Filter struct {
+	ActorID int
+	Email   string
+	Type    EventType
+	Result  Result
+	Since   time.Time
+	Until   time.Time
+	Before  int64
+	Limit   int
+}
+
+type Recorder interface {
+	Record(context.Context, Event) error
+}
+
+type Querier interface {
+	Query(context.Context, Filter) ([]Event, error)
+}
+
+// Log is append-only, events can be recorded and queried but never
+// changed.
+type Log interface {
+	Recorder
+	Querier
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+	"strings"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PGLog keeps events in the audit_events table, which refuses updates and
+// deletes.
+type PGLog struct {
+	pool *pgxpool.Pool
+}
+
+func NewPGLog(pool *pgxpool.Pool) *PGLog {
+	return &PGLog{pool}
+}
+
+func (p *PGLog) Record(ctx context.Context, event Event) error {
+	query := `insert into audit_events(type, actor_id, actor_service_account_id, email, target, ip, user_agent, result, created_at)
+	values (@type, @actorID, @actorServiceAccountID, @email, @target, @ip, @userAgent, @result, @createdAt)`
+	args := pgx.NamedArgs{
+		"type":                  event.Type,
+		"actorID":               event.ActorID,
+		"actorServiceAccountID": event.ActorServiceAccountID,
+		"email":                 event.Email,
+		"target":                event.Target,
+		"ip":                    event.IP,
+		"userAgent":             event.UserAgent,
+		"result":                event.Result,
+		"createdAt":             event.Time,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return repository.MapTransient(err)
+}
+
+func (p *PGLog) Query(ctx context.Context, filter Filter) ([]Event, error) {
+	conditions := []string{"true"}
+	args := pgx.NamedArgs{
+		"limit": filter.Limit,
+	}
+
+	if filter.ActorID != 0 {
+		conditions = append(conditions, "actor_id=@actorID")
+		args["actorID"] = filter.ActorID
+	}
+	if filter.Email != "" {
+		conditions = append(conditions, "email=@email")
+		args["email"] = filter.Email
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "type=@type")
+		args["type"] = filter.Type
+	}
+	if filter.Result != "" {
+		conditions = append(conditions, "result=@result")
+		args["result"] = filter.Result
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at>=@since")
+		args["since"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at<@until")
+		args["until"] = filter.Until
+	}
+	if filter.Before != 0 {
+		conditions = append(conditions, "id<@before")
+		args["before"] = filter.Before
+	}
+
+	query := `select * from audit_events where ` + strings.Join(conditions, " and ") +
+		` order by id desc limit @limit`
+
+	rows, _ := p.pool.Query(ctx, query, args)
+	events, err := pgx.CollectRows(rows, pgx.RowToStructByName[Event])
+	return events, repository.MapTransient(err)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net"
 	"net/http"
@@ -9,24 +10,54 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/VitoNaychev/elysium-challenge/apierror"
 	"github.com/VitoNaychev/elysium-challenge/crypto"
 	"github.com/VitoNaychev/elysium-challenge/pgconfig"
 	"github.com/VitoNaychev/elysium-challenge/rpc/sessions"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
 	"github.com/VitoNaychev/elysium-challenge/sessions/handler"
+	"github.com/VitoNaychev/elysium-challenge/sessions/mailer"
 	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
 	"github.com/VitoNaychev/elysium-challenge/sessions/service"
 	"google.golang.org/grpc"
 )
 
+const (
+	sessionPurgeInterval = time.Hour
+	// sessionCacheTTL is how long a session revoked through another
+	// instance of the service can still be used through this one
+	sessionCacheTTL = 15 * time.Second
+	// jwksMaxAge is how long verifiers may cache the published keys
+	jwksMaxAge = 5 * time.Minute
+)
+
 func main() {
 	pgConfig, err := pgconfig.InitFromEnv()
 	if err != nil {
 		log.Fatal("pgconfig InitFromEnv error: ", err)
 	}
 
-	userRepo, err := repository.NewPGUserRepository(context.Background(), pgConfig.GetConnectionString())
+	pool, err := pgconfig.NewPool(context.Background(), pgConfig)
+	if err != nil {
+		log.Fatal("pgconfig NewPool error: ", err)
+	}
+	defer pool.Close()
+
+	userRepo := repository.NewPGUserRepository(pool)
+	pgSessionRepo := repository.NewPGSessionRepository(pool)
+	sessionRepo := repository.NewCachedSessionRepository(pgSessionRepo, sessionCacheTTL)
+	refreshTokenRepo := repository.NewPGRefreshTokenRepository(pool)
+	actionTokenRepo := repository.NewPGActionTokenRepository(pool)
+	serviceAccountRepo := repository.NewPGServiceAccountRepository(pool)
+	oauthClientRepo := repository.NewPGOAuthClientRepository(pool)
+	authorizationCodeRepo := repository.NewPGAuthorizationCodeRepository(pool)
+	auditLog := audit.NewPGLog(pool)
+
+	mailConfig := mailer.InitConfigFromEnv()
+
+	fileMailer, err := mailer.NewFileMailer(mailConfig.Dir, mailConfig.From)
 	if err != nil {
-		log.Fatal("NewPGUserRepository error: ", err)
+		log.Fatal("NewFileMailer error: ", err)
 	}
 
 	jwtConfig, err := crypto.InitJWTConfigFromEnv()
@@ -34,21 +65,73 @@ func main() {
 		log.Fatal("InitJWTConfigFromEnv error: ", err)
 	}
 
-	userService := service.NewUserService(jwtConfig, userRepo)
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	if err != nil {
+		log.Fatal("InitPasswordConfigFromEnv error: ", err)
+	}
+
+	passwordPolicy, err := crypto.InitPasswordPolicyFromEnv()
+	if err != nil {
+		log.Fatal("InitPasswordPolicyFromEnv error: ", err)
+	}
+	if err = passwordPolicy.Validate(passwordConfig); err != nil {
+		log.Fatal("PasswordPolicy.Validate error: ", err)
+	}
 
-	userHTTPHandler := handler.NewUserHTTPHandler(userService)
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	if err != nil {
+		log.Fatal("InitMFAConfigFromEnv error: ", err)
+	}
+
+	rotationCtx, stopRotation := context.WithCancel(context.Background())
+	go jwtConfig.Keys.RunRotation(rotationCtx, jwtConfig.KeyRotation)
+
+	userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, userRepo, sessionRepo,
+		refreshTokenRepo, actionTokenRepo, serviceAccountRepo, fileMailer, mailConfig,
+		service.NewLoginThrottle(service.DefaultThrottleConfig), auditLog)
+
+	// there is no admin to grant the first admin role, so it is granted to
+	// the user with this email, once they have signed up and verified it
+	if email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL"); email != "" {
+		err = userService.BootstrapAdmin(context.Background(), email)
+		if err != nil {
+			log.Printf("BootstrapAdmin error: %v", err)
+		}
+	}
+
+	oidcConfig := service.InitOIDCConfigFromEnv()
+	oidcProvider := service.NewOIDCProvider(oidcConfig, userService, oauthClientRepo, authorizationCodeRepo)
+
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	go userService.RunSessionPurge(purgeCtx, sessionPurgeInterval)
+	go oidcProvider.RunCodePurge(purgeCtx, sessionPurgeInterval)
+
+	userHTTPHandler := handler.NewUserHTTPHandler(userService, passwordPolicy)
 	userRPCHandler := handler.NewUserRPCHandler(userService)
+	jwksHTTPHandler := handler.NewJWKSHTTPHandler(jwtConfig.Keys, jwksMaxAge)
+	oidcHTTPHandler := handler.NewOIDCHTTPHandler(oidcProvider, oidcConfig, jwtConfig.Keys)
+
+	mux := http.NewServeMux()
+	mux.Handle("/user/", userHTTPHandler)
+	mux.Handle("/.well-known/", jwksHTTPHandler)
+	mux.Handle("/.well-known/openid-configuration", oidcHTTPHandler)
+	mux.Handle("/oauth/", oidcHTTPHandler)
 
 	httpServer := &http.Server{
 		Addr:    "8080",
-		Handler: userHTTPHandler,
+		Handler: apierror.WithRequestID(mux),
 	}
 
-	rpcServer := grpc.NewServer()
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/debug/vars", expvar.Handler())
+	metricsServer := &http.Server{Handler: metricsMux}
+
+	rpcServer := grpc.NewServer(grpc.UnaryInterceptor(userRPCHandler.AuthenticateCaller))
 	sessions.RegisterUserServer(rpcServer, userRPCHandler)
 
 	go listenAndServeHTTP(httpServer, ":8080")
 	go listenAndServeRPC(rpcServer, ":6060")
+	go listenAndServeHTTP(metricsServer, ":9090")
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
@@ -56,7 +139,10 @@ func main() {
 	sig := <-sigCh
 	log.Printf("Received signal: %v. Shutting down...", sig)
 
+	stopPurge()
+	stopRotation()
 	shutdownHTTPServer(httpServer)
+	shutdownHTTPServer(metricsServer)
 	shutdownRPCServer(rpcServer)
 }
 
@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+	PurposeMFALogin      = "mfa_login"
+)
+
+// ActionToken records a mailed action token by its ID so that it can be
+// redeemed only once. The token itself is signed, so its claims don't have
+// to be stored.
+type ActionToken struct {
+	ID        string
+	UserID    int `db:"user_id"`
+	Purpose   string
+	ExpiresAt time.Time `db:"expires_at"`
+	Used      bool
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// OAuthClient is a partner site that signs its users in through the OpenID
+// Connect provider. Public clients, such as single page apps, can't keep a
+// secret and have an empty SecretHash, PKCE is all that protects their
+// codes.
+type OAuthClient struct {
+	ID           string
+	Name         string
+	SecretHash   string    `db:"secret_hash"`
+	RedirectURIs []string  `db:"redirect_uris"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+func (c *OAuthClient) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+// HasRedirectURI only accepts exact matches of the registered URIs.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AuthorizationCode is stored by the hash of the code that is handed to the
+// client. It remembers everything about the authorization request that the
+// token request has to match or that ends up in the ID token.
+type AuthorizationCode struct {
+	ID            string
+	ClientID      string `db:"client_id"`
+	UserID        int    `db:"user_id"`
+	RedirectURI   string `db:"redirect_uri"`
+	Scope         string
+	Nonce         string
+	CodeChallenge string    `db:"code_challenge"`
+	AuthTime      time.Time `db:"auth_time"`
+	ExpiresAt     time.Time `db:"expires_at"`
+	Used          bool
+}
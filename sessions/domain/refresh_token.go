@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// RefreshToken is stored by the hash of the token handed to the client.
+// Every refresh replaces the token with a new one from the same family, so
+// a used token showing up again means that one of the two copies was stolen.
+type RefreshToken struct {
+	TokenHash string    `db:"token_hash"`
+	UserID    int       `db:"user_id"`
+	FamilyID  string    `db:"family_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+	Used      bool
+	Revoked   bool
+}
+
+func (r *RefreshToken) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "slices"
+
+// Roles a user can have. Everyone who signs up is a player, the other roles
+// are granted by an admin.
+const (
+	RolePlayer  = "player"
+	RoleSupport = "support"
+	RoleFinance = "finance"
+	RoleAdmin   = "admin"
+)
+
+var roles = []string{RolePlayer, RoleSupport, RoleFinance, RoleAdmin}
+
+func IsRole(role string) bool {
+	return slices.Contains(roles, role)
+}
+
+func (u User) HasRole(role string) bool {
+	return slices.Contains(u.Roles, role)
+}
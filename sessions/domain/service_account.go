@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+// ServiceAccount is a non-human principal, such as a game provider or an
+// internal job, that authenticates with API keys instead of logging in.
+type ServiceAccount struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// ScopeGameProvider lets a key settle the game rounds of players on their
+// wallets. Keys can also be scoped to any of the roles, but unlike those it
+// is never given to users.
+const ScopeGameProvider = "game_provider"
+
+func IsScope(scope string) bool {
+	return IsRole(scope) || scope == ScopeGameProvider
+}
+
+// APIKey is stored by the hash of the key, which is shown only once when the
+// key is created. Prefix is the start of the key, kept so that keys can be
+// told apart in listings. Scopes are what the key may do, see IsScope.
+type APIKey struct {
+	ID               string
+	ServiceAccountID int    `db:"service_account_id"`
+	KeyHash          string `db:"key_hash"`
+	Prefix           string
+	Scopes           []string
+	CreatedAt        time.Time `db:"created_at"`
+	ExpiresAt        time.Time `db:"expires_at"`
+	Revoked          bool
+}
+
+func (k *APIKey) IsActive(now time.Time) bool {
+	return !k.Revoked && now.Before(k.ExpiresAt)
+}
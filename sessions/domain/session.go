@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// Session is created on signup and login and lives for as long as its
+// refresh tokens do. Its ID is the jti claim of every JWT issued within it
+// and the family ID of its refresh tokens.
+type Session struct {
+	ID         string
+	UserID     int       `db:"user_id"`
+	CreatedAt  time.Time `db:"created_at"`
+	LastSeenAt time.Time `db:"last_seen_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	UserAgent  string    `db:"user_agent"`
+	IP         string
+}
+
+func (s *Session) IsActive(now time.Time) bool {
+	return now.Before(s.ExpiresAt)
+}
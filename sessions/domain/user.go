@@ -1,34 +1,21 @@
 package domain
 
-import (
-	"errors"
-)
-
-var ErrJWTNotFound = errors.New("jwt not found is user JWTs array")
-
 type User struct {
-	ID        int
-	FirstName string `db:"first_name"`
-	LastName  string `db:"last_name"`
-	Email     string
-	Password  string
-	JWTs      []string
-}
-
-func (u *User) InvalidateJWT(jwt string) error {
-	jwtIdx := -1
-
-	for i := range u.JWTs {
-		if u.JWTs[i] == jwt {
-			jwtIdx = i
-			break
-		}
-	}
-
-	if jwtIdx == -1 {
-		return ErrJWTNotFound
-	}
+	ID            int
+	FirstName     string `db:"first_name"`
+	LastName      string `db:"last_name"`
+	Email         string
+	Password      string
+	EmailVerified bool     `db:"email_verified"`
+	Roles         []string `db:"roles"`
 
-	u.JWTs = append(u.JWTs[:jwtIdx], u.JWTs[jwtIdx+1:]...)
-	return nil
+	// MFASecret is the encrypted TOTP secret. It is set on enrollment but
+	// only checked once MFAEnabled is, which happens after the user proves
+	// their authenticator works.
+	MFASecret  string `db:"mfa_secret"`
+	MFAEnabled bool   `db:"mfa_enabled"`
+	// MFALastStep is the last TOTP period a code was accepted for, so that
+	// an intercepted code can't be replayed.
+	MFALastStep   int64    `db:"mfa_last_step"`
+	RecoveryCodes []string `db:"recovery_codes"`
 }
@@ -0,0 +1,255 @@
+// Command oidcclient walks through the OpenID Connect authorization code
+// flow with PKCE against a locally running sessions service, the way a
+// partner site would.
+//
+// Register a client with an admin's JWT first:
+//
+//	curl -X POST http://localhost:8080/oauth/clients -H "Token: $ADMIN_JWT" \
+//	    -d '{"name": "Example", "redirect_uris": ["http://localhost:9090/callback"]}'
+//
+// and run the example with the returned client ID and secret:
+//
+//	go run ./sessions/examples/oidcclient -client-id ... -client-secret ... \
+//	    -email johndoe@example.com -password ...
+//
+// The provider has no login page of its own, so the example logs the user
+// in through /user/login and calls the authorization endpoint with their
+// JWT, as the site's login page would. It reads the code from the redirect
+// instead of serving the redirect URI.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+)
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+func main() {
+	issuer := flag.String("issuer", "http://localhost:8080", "URL of the sessions service")
+	clientID := flag.String("client-id", "", "ID of the registered client")
+	clientSecret := flag.String("client-secret", "", "secret of the client, empty for public clients")
+	redirectURI := flag.String("redirect-uri", "http://localhost:9090/callback", "redirect URI registered for the client")
+	scope := flag.String("scope", "openid profile email", "scopes to ask for")
+	email := flag.String("email", "", "email of the user to sign in")
+	password := flag.String("password", "", "password of the user to sign in")
+	flag.Parse()
+
+	if *clientID == "" || *email == "" || *password == "" {
+		flag.Usage()
+		log.Fatal("client-id, email and password are required")
+	}
+
+	var config discovery
+	err := getJSON(*issuer+"/.well-known/openid-configuration", "", &config)
+	if err != nil {
+		log.Fatal("discovery error: ", err)
+	}
+
+	jwt, err := login(*issuer, *email, *password)
+	if err != nil {
+		log.Fatal("login error: ", err)
+	}
+
+	state := randomString()
+	nonce := randomString()
+	verifier := randomString()
+
+	code, err := authorize(config, jwt, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {*clientID},
+		"redirect_uri":          {*redirectURI},
+		"scope":                 {*scope},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {crypto.PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}, state)
+	if err != nil {
+		log.Fatal("authorization error: ", err)
+	}
+
+	tokens, err := exchangeCode(config, *clientID, *clientSecret, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {*redirectURI},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		log.Fatal("token error: ", err)
+	}
+
+	var jwks crypto.JWKS
+	err = getJSON(config.JWKSURI, "", &jwks)
+	if err != nil {
+		log.Fatal("JWKS error: ", err)
+	}
+
+	claims, err := crypto.ParseIDToken(jwks, config.Issuer, *clientID, tokens.IDToken)
+	if err != nil {
+		log.Fatal("ID token error: ", err)
+	}
+	if claims.Nonce != nonce {
+		log.Fatal("ID token error: nonce doesn't match")
+	}
+
+	fmt.Printf("ID token: sub=%v email=%q auth_time=%v\n", claims.Subject, claims.Email, claims.AuthTime)
+
+	var userInfo map[string]any
+	err = getJSON(config.UserInfoEndpoint, tokens.AccessToken, &userInfo)
+	if err != nil {
+		log.Fatal("userinfo error: ", err)
+	}
+
+	fmt.Printf("userinfo (scope %q): %v\n", tokens.Scope, userInfo)
+}
+
+func login(issuer, email, password string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+
+	response, err := http.Post(issuer+"/user/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", responseError(response)
+	}
+
+	var tokens struct {
+		Token       string `json:"token"`
+		MFARequired bool   `json:"mfa_required"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&tokens)
+	if err != nil {
+		return "", err
+	}
+	if tokens.MFARequired {
+		return "", errors.New("the example doesn't support users with two-factor authentication")
+	}
+
+	return tokens.Token, nil
+}
+
+// authorize doesn't follow the redirect, it only checks the state and takes
+// the code from it.
+func authorize(config discovery, jwt string, params url.Values, state string) (string, error) {
+	request, _ := http.NewRequest(http.MethodGet, config.AuthorizationEndpoint+"?"+params.Encode(), nil)
+	request.Header.Set("Token", jwt)
+
+	client := http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusFound {
+		return "", responseError(response)
+	}
+
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		return "", err
+	}
+
+	query := location.Query()
+	if query.Get("state") != state {
+		return "", errors.New("state doesn't match")
+	}
+	if query.Get("error") != "" {
+		return "", fmt.Errorf("%v: %v", query.Get("error"), query.Get("error_description"))
+	}
+
+	return query.Get("code"), nil
+}
+
+// exchangeCode authenticates confidential clients with HTTP Basic, public
+// clients only send their ID.
+func exchangeCode(config discovery, clientID, clientSecret string, form url.Values) (tokenResponse, error) {
+	if clientSecret == "" {
+		form.Set("client_id", clientID)
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, config.TokenEndpoint, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return tokenResponse{}, responseError(response)
+	}
+
+	var tokens tokenResponse
+	err = json.NewDecoder(response.Body).Decode(&tokens)
+	return tokens, err
+}
+
+func getJSON(url, bearer string, v any) error {
+	request, _ := http.NewRequest(http.MethodGet, url, nil)
+	if bearer != "" {
+		request.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return responseError(response)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+func responseError(response *http.Response) error {
+	body, _ := io.ReadAll(response.Body)
+	return fmt.Errorf("%v: %s", response.Status, bytes.TrimSpace(body))
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("rand.Read error: ", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
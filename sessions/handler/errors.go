@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+)
+
+const (
+	CodeMissingToken     apierror.Code = "missing_token"
+	CodeMissingSessionID apierror.Code = "missing_session_id"
+	CodeEmptyBody        apierror.Code = "empty_body"
+	CodeMalformedBody    apierror.Code = "malformed_body"
+
+	CodeMissingServiceAccountID apierror.Code = "missing_service_account_id"
+	CodeMissingAPIKeyID         apierror.Code = "missing_api_key_id"
+	CodeMissingClientID         apierror.Code = "missing_client_id"
+	CodeInvalidAuditQuery       apierror.Code = "invalid_audit_query"
+	CodeInvalidUserID           apierror.Code = "invalid_user_id"
+
+	CodeUserNotFound       apierror.Code = "user_not_found"
+	CodeWrongPassword      apierror.Code = "wrong_password"
+	CodeEmailTaken         apierror.Code = "email_taken"
+	CodeInvalidCredentials apierror.Code = "invalid_credentials"
+	CodeTooManyAttempts    apierror.Code = "too_many_attempts"
+	CodeInvalidRole        apierror.Code = "invalid_role"
+	CodeTooManyUsers       apierror.Code = "too_many_users"
+
+	CodeSessionNotFound     apierror.Code = "session_not_found"
+	CodeInvalidRefreshToken apierror.Code = "invalid_refresh_token"
+	CodeRefreshTokenReused  apierror.Code = "refresh_token_reused"
+
+	CodeInvalidAPIKey          apierror.Code = "invalid_api_key"
+	CodeServiceAccountNotFound apierror.Code = "service_account_not_found"
+	CodeAPIKeyNotFound         apierror.Code = "api_key_not_found"
+	CodeInvalidAPIKeyLifetime  apierror.Code = "invalid_api_key_lifetime"
+
+	CodeOAuthClientNotFound apierror.Code = "oauth_client_not_found"
+	CodeInvalidRedirectURI  apierror.Code = "invalid_redirect_uri"
+
+	CodeInvalidActionToken   apierror.Code = "invalid_action_token"
+	CodeEmailAlreadyVerified apierror.Code = "email_already_verified"
+
+	CodeMFAAlreadyEnabled   apierror.Code = "mfa_already_enabled"
+	CodeMFANotEnrolled      apierror.Code = "mfa_not_enrolled"
+	CodeMFANotEnabled       apierror.Code = "mfa_not_enabled"
+	CodeInvalidMFACode      apierror.Code = "invalid_mfa_code"
+	CodeInvalidMFAChallenge apierror.Code = "invalid_mfa_challenge"
+)
+
+// userErrors is how errors are reported unless an endpoint decides on a
+// different status.
+var userErrors = append(apierror.Mapper{
+	{Err: ErrMissingToken, Status: http.StatusBadRequest, Code: CodeMissingToken},
+	{Err: ErrMissingSessionID, Status: http.StatusBadRequest, Code: CodeMissingSessionID},
+	{Err: ErrEmptyBody, Status: http.StatusBadRequest, Code: CodeEmptyBody},
+	{Err: ErrMalformedBody, Status: http.StatusBadRequest, Code: CodeMalformedBody},
+	{Err: ErrMissingServiceAccountID, Status: http.StatusBadRequest, Code: CodeMissingServiceAccountID},
+	{Err: ErrMissingAPIKeyID, Status: http.StatusBadRequest, Code: CodeMissingAPIKeyID},
+	{Err: ErrMissingClientID, Status: http.StatusBadRequest, Code: CodeMissingClientID},
+	{Err: ErrInvalidAuditQuery, Status: http.StatusBadRequest, Code: CodeInvalidAuditQuery},
+	{Err: ErrInvalidUserID, Status: http.StatusBadRequest, Code: CodeInvalidUserID},
+	{Err: ErrMissingOAuthAccessToken, Status: http.StatusUnauthorized, Code: CodeMissingToken},
+	{Err: ErrMethodNotAllowed, Status: http.StatusMethodNotAllowed, Code: apierror.CodeMethodNotAllowed},
+	{Err: ErrValidation, Status: http.StatusUnprocessableEntity, Code: apierror.CodeValidationFailed},
+
+	{Err: service.ErrUserNotFound, Status: http.StatusNotFound, Code: CodeUserNotFound},
+	{Err: service.ErrWrongPassword, Status: http.StatusForbidden, Code: CodeWrongPassword},
+	{Err: service.ErrEmailTaken, Status: http.StatusConflict, Code: CodeEmailTaken},
+	{Err: service.ErrInvalidCredentials, Status: http.StatusUnauthorized, Code: CodeInvalidCredentials},
+	{Err: service.ErrTooManyAttempts, Status: http.StatusTooManyRequests, Code: CodeTooManyAttempts},
+	{Err: service.ErrPermissionDenied, Status: http.StatusForbidden, Code: apierror.CodePermissionDenied},
+	{Err: service.ErrInvalidRole, Status: http.StatusBadRequest, Code: CodeInvalidRole},
+	{Err: service.ErrTooManyUsers, Status: http.StatusBadRequest, Code: CodeTooManyUsers},
+
+	{Err: service.ErrInvalidJWT, Status: http.StatusUnauthorized, Code: apierror.CodeInvalidToken},
+	{Err: service.ErrSessionNotFound, Status: http.StatusUnauthorized, Code: CodeSessionNotFound},
+	{Err: service.ErrInvalidRefreshToken, Status: http.StatusUnauthorized, Code: CodeInvalidRefreshToken},
+	{Err: service.ErrRefreshTokenReused, Status: http.StatusUnauthorized, Code: CodeRefreshTokenReused},
+
+	{Err: service.ErrInvalidAPIKey, Status: http.StatusUnauthorized, Code: CodeInvalidAPIKey},
+	{Err: service.ErrServiceAccountNotFound, Status: http.StatusNotFound, Code: CodeServiceAccountNotFound},
+	{Err: service.ErrAPIKeyNotFound, Status: http.StatusNotFound, Code: CodeAPIKeyNotFound},
+	{Err: service.ErrInvalidAPIKeyLifetime, Status: http.StatusBadRequest, Code: CodeInvalidAPIKeyLifetime},
+
+	{Err: service.ErrOAuthClientNotFound, Status: http.StatusNotFound, Code: CodeOAuthClientNotFound},
+	{Err: service.ErrInvalidOAuthClient, Status: http.StatusBadRequest, Code: CodeOAuthInvalidClient},
+	{Err: service.ErrInvalidRedirectURI, Status: http.StatusBadRequest, Code: CodeInvalidRedirectURI},
+
+	{Err: service.ErrInvalidActionToken, Status: http.StatusBadRequest, Code: CodeInvalidActionToken},
+	{Err: service.ErrEmailAlreadyVerified, Status: http.StatusConflict, Code: CodeEmailAlreadyVerified},
+
+	{Err: service.ErrMFAAlreadyEnabled, Status: http.StatusConflict, Code: CodeMFAAlreadyEnabled},
+	{Err: service.ErrMFANotEnrolled, Status: http.StatusConflict, Code: CodeMFANotEnrolled},
+	{Err: service.ErrMFANotEnabled, Status: http.StatusConflict, Code: CodeMFANotEnabled},
+	{Err: service.ErrInvalidMFACode, Status: http.StatusForbidden, Code: CodeInvalidMFACode},
+	{Err: service.ErrInvalidMFAChallenge, Status: http.StatusUnauthorized, Code: CodeInvalidMFAChallenge},
+
+	{Err: repository.ErrTransient, Status: http.StatusServiceUnavailable, Code: apierror.CodeUnavailable},
+}, apierror.CryptoErrors...)
+
+// mapUserError is userErrors.MapStatus, except that transient database
+// errors keep their status whatever the endpoint decided on, so that clients
+// know to retry.
+func mapUserError(err error, status int) *apierror.Error {
+	if errors.Is(err, repository.ErrTransient) {
+		return userErrors.Map(err)
+	}
+	return userErrors.MapStatus(err, status)
+}
+
+// The error codes of RFC 6749, sections 4.1.2.1 and 5.2, and RFC 6750,
+// section 3.1.
+const (
+	CodeOAuthInvalidRequest          apierror.Code = "invalid_request"
+	CodeOAuthInvalidClient           apierror.Code = "invalid_client"
+	CodeOAuthInvalidGrant            apierror.Code = "invalid_grant"
+	CodeOAuthInvalidScope            apierror.Code = "invalid_scope"
+	CodeOAuthUnsupportedGrantType    apierror.Code = "unsupported_grant_type"
+	CodeOAuthUnsupportedResponseType apierror.Code = "unsupported_response_type"
+	CodeOAuthInvalidToken            apierror.Code = "invalid_token"
+	CodeOAuthServerError             apierror.Code = "server_error"
+	CodeOAuthTemporarilyUnavailable  apierror.Code = "temporarily_unavailable"
+)
+
+// oauthErrors is how the token and userinfo endpoints and the redirects of
+// the authorization endpoint report errors. OAuth clients only understand
+// the codes of the RFCs, so these don't use userErrors.
+var oauthErrors = apierror.Mapper{
+	{Err: ErrInvalidOAuthRequest, Status: http.StatusBadRequest, Code: CodeOAuthInvalidRequest},
+	{Err: ErrUnsupportedGrantType, Status: http.StatusBadRequest, Code: CodeOAuthUnsupportedGrantType},
+	{Err: service.ErrInvalidOAuthClient, Status: http.StatusUnauthorized, Code: CodeOAuthInvalidClient},
+	{Err: service.ErrInvalidGrant, Status: http.StatusBadRequest, Code: CodeOAuthInvalidGrant},
+	{Err: service.ErrInvalidScope, Status: http.StatusBadRequest, Code: CodeOAuthInvalidScope},
+	{Err: service.ErrInvalidCodeChallenge, Status: http.StatusBadRequest, Code: CodeOAuthInvalidRequest},
+	{Err: service.ErrUnsupportedResponseType, Status: http.StatusBadRequest, Code: CodeOAuthUnsupportedResponseType},
+	{Err: service.ErrInvalidOAuthToken, Status: http.StatusUnauthorized, Code: CodeOAuthInvalidToken},
+	{Err: repository.ErrTransient, Status: http.StatusServiceUnavailable, Code: CodeOAuthTemporarilyUnavailable},
+}
+
+func mapOAuthError(err error) *apierror.Error {
+	apiErr := oauthErrors.Map(err)
+	if apiErr.Code == apierror.CodeInternal {
+		apiErr.Code = CodeOAuthServerError
+	}
+	return apiErr
+}
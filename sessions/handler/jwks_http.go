@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+)
+
+type KeySource interface {
+	JWKS() crypto.JWKS
+}
+
+// JWKSHTTPHandler publishes the keys JWTs are verified with, so that other
+// services can verify them locally instead of calling Authenticate.
+type JWKSHTTPHandler struct {
+	keys   KeySource
+	maxAge time.Duration
+
+	http.Handler
+}
+
+// NewJWKSHTTPHandler serves the JWKS, letting clients cache it for maxAge.
+// maxAge should stay well below the rotation interval so that a freshly
+// rotated key is picked up before tokens signed with it show up.
+func NewJWKSHTTPHandler(keys KeySource, maxAge time.Duration) *JWKSHTTPHandler {
+	jwksHandler := JWKSHTTPHandler{
+		keys:   keys,
+		maxAge: maxAge,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", jwksHandler.JWKS)
+
+	jwksHandler.Handler = mux
+
+	return &jwksHandler
+}
+
+func (j *JWKSHTTPHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(j.maxAge.Seconds())))
+	json.NewEncoder(w).Encode(j.keys.JWKS())
+}
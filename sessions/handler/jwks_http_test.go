@@ -0,0 +1,46 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/handler"
+)
+
+func TestJWKS(t *testing.T) {
+	keys, err := crypto.NewKeyRing(crypto.NewInMemoryKeyStore(), crypto.AlgorithmEdDSA, time.Minute)
+	assert.RequireNoError(t, err)
+
+	jwksHandler := handler.NewJWKSHTTPHandler(keys, time.Minute)
+
+	t.Run("publishes verification keys", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		response := httptest.NewRecorder()
+
+		jwksHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, response.Header().Get("Cache-Control"), "public, max-age=60")
+
+		var jwks crypto.JWKS
+		json.NewDecoder(response.Body).Decode(&jwks)
+
+		assert.Equal(t, len(jwks.Keys), 1)
+		assert.Equal(t, jwks.Keys[0].KeyID, keys.Current().ID)
+		assert.Equal(t, jwks.Keys[0].KeyType, "OKP")
+	})
+
+	t.Run("returns Method Not Allowed on POST", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil)
+		response := httptest.NewRecorder()
+
+		jwksHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusMethodNotAllowed)
+	})
+}
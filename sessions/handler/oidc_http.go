@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+)
+
+var (
+	ErrMissingClientID         = errors.New("missing client ID in request")
+	ErrInvalidOAuthRequest     = errors.New("request is missing a required parameter")
+	ErrUnsupportedGrantType    = errors.New("only the authorization_code grant type is supported")
+	ErrMissingOAuthAccessToken = errors.New("missing bearer access token")
+)
+
+const grantTypeAuthorizationCode = "authorization_code"
+
+type OIDCProvider interface {
+	RegisterClient(context.Context, string, string, []string, bool) (domain.OAuthClient, string, error)
+	ListClients(context.Context, string) ([]domain.OAuthClient, error)
+	DeleteClient(context.Context, string, string) error
+
+	Authorize(context.Context, string, service.AuthorizationRequest) (string, error)
+	ExchangeCode(context.Context, service.TokenRequest) (service.OIDCTokens, error)
+	UserInfo(context.Context, string) (service.UserInfo, error)
+}
+
+// OIDCHTTPHandler serves the OpenID Connect provider: discovery, the
+// authorization, token and userinfo endpoints and the registration of
+// clients. The JWKS the ID tokens are verified with is served by
+// JWKSHTTPHandler.
+type OIDCHTTPHandler struct {
+	provider OIDCProvider
+	issuer   string
+	keys     KeySource
+
+	http.Handler
+}
+
+func NewOIDCHTTPHandler(provider OIDCProvider, config service.OIDCConfig, keys KeySource) *OIDCHTTPHandler {
+	oidcHandler := OIDCHTTPHandler{
+		provider: provider,
+		issuer:   config.Issuer,
+		keys:     keys,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", oidcHandler.Discovery)
+	mux.HandleFunc("/oauth/authorize", oidcHandler.Authorize)
+	mux.HandleFunc("/oauth/token", oidcHandler.Token)
+	mux.HandleFunc("/oauth/userinfo", oidcHandler.UserInfo)
+	mux.HandleFunc("/oauth/clients", oidcHandler.Clients)
+
+	oidcHandler.Handler = mux
+
+	return &oidcHandler
+}
+
+func (o *OIDCHTTPHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	// keys of a different algorithm may still be around after
+	// JWT_ALGORITHM was changed
+	algorithms := []string{}
+	for _, key := range o.keys.JWKS().Keys {
+		if !slices.Contains(algorithms, key.Algorithm) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DiscoveryResponse{
+		Issuer:                            o.issuer,
+		AuthorizationEndpoint:             o.issuer + "/oauth/authorize",
+		TokenEndpoint:                     o.issuer + "/oauth/token",
+		UserInfoEndpoint:                  o.issuer + "/oauth/userinfo",
+		JWKSURI:                           o.issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   service.SupportedScopes,
+		ResponseTypesSupported:            []string{service.ResponseTypeCode},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{service.CodeChallengeMethodS256},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"given_name", "family_name", "email", "email_verified"},
+	})
+}
+
+// Authorize expects the user to be logged in already, with their JWT in
+// the Token header. The provider has no login page of its own, the site's
+// login page sends the user here once they are logged in and follows the
+// redirect back to the client. Errors about the client or the redirect URI
+// and a missing login are answered directly, anything else is reported to
+// the client through the redirect.
+func (o *OIDCHTTPHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusUnauthorized, ErrMissingToken)
+		return
+	}
+
+	query := r.URL.Query()
+	request := service.AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	code, err := o.provider.Authorize(r.Context(), jwt, request)
+	if err != nil {
+		if isRedirectableError(err) {
+			apiErr := mapOAuthError(err)
+			redirectToClient(w, r, request.RedirectURI, url.Values{
+				"error":             {string(apiErr.Code)},
+				"error_description": {apiErr.Message},
+			}, query.Get("state"))
+			return
+		}
+		writeUserServiceError(w, err)
+		return
+	}
+
+	redirectToClient(w, r, request.RedirectURI, url.Values{"code": {code}}, query.Get("state"))
+}
+
+func isRedirectableError(err error) bool {
+	return errors.Is(err, service.ErrUnsupportedResponseType) ||
+		errors.Is(err, service.ErrInvalidScope) ||
+		errors.Is(err, service.ErrInvalidCodeChallenge)
+}
+
+func redirectToClient(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values, state string) {
+	target, _ := url.Parse(redirectURI)
+
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// Token redeems authorization codes. Confidential clients authenticate with
+// HTTP Basic or with client_secret in the form, public clients only send
+// client_id.
+func (o *OIDCHTTPHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, ErrInvalidOAuthRequest)
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != grantTypeAuthorizationCode {
+		writeOAuthError(w, ErrUnsupportedGrantType)
+		return
+	}
+
+	request := service.TokenRequest{
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	}
+	if clientID, clientSecret, ok := r.BasicAuth(); ok {
+		request.ClientID, _ = url.QueryUnescape(clientID)
+		request.ClientSecret, _ = url.QueryUnescape(clientSecret)
+	}
+
+	if request.Code == "" || request.RedirectURI == "" || request.ClientID == "" || request.CodeVerifier == "" {
+		writeOAuthError(w, ErrInvalidOAuthRequest)
+		return
+	}
+
+	tokens, err := o.provider.ExchangeCode(r.Context(), request)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(oidcTokensToTokenResponse(tokens))
+}
+
+// UserInfo takes the access token from the token endpoint as a bearer
+// token, as described in RFC 6750.
+func (o *OIDCHTTPHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeErrorResponse(w, http.StatusUnauthorized, ErrMissingOAuthAccessToken)
+		return
+	}
+
+	info, err := o.provider.UserInfo(r.Context(), accessToken)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	response := UserInfoResponse{
+		Subject:    strconv.Itoa(info.Subject),
+		GivenName:  info.GivenName,
+		FamilyName: info.FamilyName,
+		Email:      info.Email,
+	}
+	if slices.Contains(info.Scopes, service.ScopeEmail) {
+		response.EmailVerified = &info.EmailVerified
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (o *OIDCHTTPHandler) Clients(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		o.ListClients(w, r)
+	case http.MethodPost:
+		o.RegisterClient(w, r)
+	case http.MethodDelete:
+		o.DeleteClient(w, r)
+	default:
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+func (o *OIDCHTTPHandler) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request RegisterClientRequest
+	if !decodeRequest(w, r, &request) || !validateRequest(w, &request, crypto.PasswordPolicy{}) {
+		return
+	}
+
+	client, secret, err := o.provider.RegisterClient(r.Context(), jwt, request.Name, request.RedirectURIs, request.Public)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(RegisterClientResponse{Client: oauthClientToResponse(client), ClientSecret: secret})
+}
+
+func (o *OIDCHTTPHandler) ListClients(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	clients, err := o.provider.ListClients(r.Context(), jwt)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(oauthClientsToResponses(clients))
+}
+
+func (o *OIDCHTTPHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	clientID := r.URL.Query().Get("id")
+	if clientID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingClientID)
+		return
+	}
+
+	err := o.provider.DeleteClient(r.Context(), jwt, clientID)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeOAuthError answers in the format of RFC 6749, section 5.2, rather
+// than with an apierror.Error.
+func writeOAuthError(w http.ResponseWriter, err error) {
+	apiErr := mapOAuthError(err)
+
+	switch apiErr.Code {
+	case CodeOAuthInvalidClient:
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	case CodeOAuthInvalidToken:
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(OAuthErrorResponse{
+		Error:            string(apiErr.Code),
+		ErrorDescription: apiErr.Message,
+	})
+}
@@ -0,0 +1,321 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/handler"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+)
+
+type StubOIDCProvider struct {
+	dummyCode     string
+	dummyTokens   service.OIDCTokens
+	dummyUserInfo service.UserInfo
+	dummyErr      error
+
+	spyJWT          string
+	spyAuthorize    service.AuthorizationRequest
+	spyTokenRequest service.TokenRequest
+	spyAccessToken  string
+}
+
+func (s *StubOIDCProvider) RegisterClient(ctx context.Context, jwt, name string, redirectURIs []string, public bool) (domain.OAuthClient, string, error) {
+	s.spyJWT = jwt
+	return domain.OAuthClient{ID: "sampleClient", Name: name, RedirectURIs: redirectURIs}, "sampleSecret", s.dummyErr
+}
+
+func (s *StubOIDCProvider) ListClients(ctx context.Context, jwt string) ([]domain.OAuthClient, error) {
+	s.spyJWT = jwt
+	return nil, s.dummyErr
+}
+
+func (s *StubOIDCProvider) DeleteClient(ctx context.Context, jwt, clientID string) error {
+	s.spyJWT = jwt
+	return s.dummyErr
+}
+
+func (s *StubOIDCProvider) Authorize(ctx context.Context, jwt string, request service.AuthorizationRequest) (string, error) {
+	s.spyJWT = jwt
+	s.spyAuthorize = request
+	return s.dummyCode, s.dummyErr
+}
+
+func (s *StubOIDCProvider) ExchangeCode(ctx context.Context, request service.TokenRequest) (service.OIDCTokens, error) {
+	s.spyTokenRequest = request
+	return s.dummyTokens, s.dummyErr
+}
+
+func (s *StubOIDCProvider) UserInfo(ctx context.Context, accessToken string) (service.UserInfo, error) {
+	s.spyAccessToken = accessToken
+	return s.dummyUserInfo, s.dummyErr
+}
+
+func TestOIDCHandler(t *testing.T) {
+	keys, err := crypto.NewKeyRing(crypto.NewInMemoryKeyStore(), crypto.AlgorithmEdDSA, time.Minute)
+	assert.RequireNoError(t, err)
+
+	config := service.OIDCConfig{Issuer: "http://localhost:8080"}
+	redirectURI := "https://partner.example.com/callback"
+
+	authorizeURL := "/oauth/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"sampleClient"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"sampleState"},
+		"nonce":                 {"sampleNonce"},
+		"code_challenge":        {"sampleChallenge"},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	t.Run("publishes discovery document", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+		response := httptest.NewRecorder()
+
+		oidcHandler := handler.NewOIDCHTTPHandler(&StubOIDCProvider{}, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		var discovery handler.DiscoveryResponse
+		json.NewDecoder(response.Body).Decode(&discovery)
+
+		assert.Equal(t, discovery.Issuer, config.Issuer)
+		assert.Equal(t, discovery.TokenEndpoint, "http://localhost:8080/oauth/token")
+		assert.Equal(t, discovery.JWKSURI, "http://localhost:8080/.well-known/jwks.json")
+		assert.Equal(t, discovery.IDTokenSigningAlgValuesSupported, []string{crypto.AlgorithmEdDSA})
+		assert.Equal(t, discovery.CodeChallengeMethodsSupported, []string{"S256"})
+	})
+
+	t.Run("redirects with code and state", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, authorizeURL, nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		provider := &StubOIDCProvider{dummyCode: "sampleCode"}
+		oidcHandler := handler.NewOIDCHTTPHandler(provider, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusFound)
+		assert.Equal(t, response.Header().Get("Location"), redirectURI+"?code=sampleCode&state=sampleState")
+
+		assert.Equal(t, provider.spyJWT, "sampleToken")
+		assert.Equal(t, provider.spyAuthorize, service.AuthorizationRequest{
+			ResponseType:        "code",
+			ClientID:            "sampleClient",
+			RedirectURI:         redirectURI,
+			Scope:               "openid email",
+			Nonce:               "sampleNonce",
+			CodeChallenge:       "sampleChallenge",
+			CodeChallengeMethod: "S256",
+		})
+	})
+
+	t.Run("redirects with error on ErrInvalidScope", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, authorizeURL, nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		oidcHandler := handler.NewOIDCHTTPHandler(&StubOIDCProvider{dummyErr: service.ErrInvalidScope}, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusFound)
+
+		location, _ := url.Parse(response.Header().Get("Location"))
+		assert.Equal(t, location.Query().Get("error"), "invalid_scope")
+		assert.Equal(t, location.Query().Get("state"), "sampleState")
+	})
+
+	t.Run("doesn't redirect on ErrInvalidRedirectURI", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, authorizeURL, nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		oidcHandler := handler.NewOIDCHTTPHandler(&StubOIDCProvider{dummyErr: service.ErrInvalidRedirectURI}, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+		assert.Equal(t, response.Header().Get("Location"), "")
+	})
+
+	t.Run("returns Unauthorized on authorization without login", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, authorizeURL, nil)
+		response := httptest.NewRecorder()
+
+		oidcHandler := handler.NewOIDCHTTPHandler(&StubOIDCProvider{}, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("exchanges code with client from basic auth", func(t *testing.T) {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {"sampleCode"},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {"sampleVerifier"},
+		}
+
+		request, _ := http.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth("sampleClient", "sampleSecret")
+		response := httptest.NewRecorder()
+
+		provider := &StubOIDCProvider{dummyTokens: service.OIDCTokens{
+			AccessToken: "sampleAccessToken",
+			IDToken:     "sampleIDToken",
+			Scope:       "openid",
+			ExpiresIn:   time.Minute,
+		}}
+		oidcHandler := handler.NewOIDCHTTPHandler(provider, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, response.Header().Get("Cache-Control"), "no-store")
+
+		assert.Equal(t, provider.spyTokenRequest, service.TokenRequest{
+			Code:         "sampleCode",
+			RedirectURI:  redirectURI,
+			ClientID:     "sampleClient",
+			ClientSecret: "sampleSecret",
+			CodeVerifier: "sampleVerifier",
+		})
+
+		var gotResponse handler.TokenResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse, handler.TokenResponse{
+			AccessToken: "sampleAccessToken",
+			TokenType:   "Bearer",
+			ExpiresIn:   60,
+			IDToken:     "sampleIDToken",
+			Scope:       "openid",
+		})
+	})
+
+	t.Run("returns invalid_grant on ErrInvalidGrant", func(t *testing.T) {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {"usedCode"},
+			"redirect_uri":  {redirectURI},
+			"client_id":     {"sampleClient"},
+			"code_verifier": {"sampleVerifier"},
+		}
+
+		request, _ := http.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+
+		oidcHandler := handler.NewOIDCHTTPHandler(&StubOIDCProvider{dummyErr: service.ErrInvalidGrant}, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+
+		var gotResponse handler.OAuthErrorResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Error, "invalid_grant")
+	})
+
+	t.Run("returns unsupported_grant_type on refresh token grant", func(t *testing.T) {
+		form := url.Values{"grant_type": {"refresh_token"}}
+
+		request, _ := http.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+
+		oidcHandler := handler.NewOIDCHTTPHandler(&StubOIDCProvider{}, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+
+		var gotResponse handler.OAuthErrorResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Error, "unsupported_grant_type")
+	})
+
+	t.Run("returns user info for bearer token", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+		request.Header.Set("Authorization", "Bearer sampleAccessToken")
+		response := httptest.NewRecorder()
+
+		provider := &StubOIDCProvider{dummyUserInfo: service.UserInfo{
+			Subject: 10,
+			Scopes:  []string{service.ScopeOpenID, service.ScopeEmail},
+			Email:   "johndoe@example.com",
+		}}
+		oidcHandler := handler.NewOIDCHTTPHandler(provider, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, provider.spyAccessToken, "sampleAccessToken")
+
+		var gotResponse map[string]any
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse, map[string]any{
+			"sub":            "10",
+			"email":          "johndoe@example.com",
+			"email_verified": false,
+		})
+	})
+
+	t.Run("returns Unauthorized on ErrInvalidOAuthToken", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+		request.Header.Set("Authorization", "Bearer expiredToken")
+		response := httptest.NewRecorder()
+
+		oidcHandler := handler.NewOIDCHTTPHandler(&StubOIDCProvider{dummyErr: service.ErrInvalidOAuthToken}, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+		assert.Equal(t, response.Header().Get("WWW-Authenticate"), `Bearer error="invalid_token"`)
+	})
+
+	t.Run("returns client secret on registration", func(t *testing.T) {
+		body := strings.NewReader(`{"name": "Partner", "redirect_uris": ["https://partner.example.com/callback"]}`)
+
+		request, _ := http.NewRequest(http.MethodPost, "/oauth/clients", body)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		provider := &StubOIDCProvider{}
+		oidcHandler := handler.NewOIDCHTTPHandler(provider, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusCreated)
+		assert.Equal(t, provider.spyJWT, "sampleToken")
+
+		var gotResponse handler.RegisterClientResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Client.ClientID, "sampleClient")
+		assert.Equal(t, gotResponse.ClientSecret, "sampleSecret")
+	})
+
+	t.Run("returns Unprocessable Entity on redirect URI with fragment", func(t *testing.T) {
+		body := strings.NewReader(`{"name": "Partner", "redirect_uris": ["https://partner.example.com/callback#fragment"]}`)
+
+		request, _ := http.NewRequest(http.MethodPost, "/oauth/clients", body)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		provider := &StubOIDCProvider{}
+		oidcHandler := handler.NewOIDCHTTPHandler(provider, config, keys)
+		oidcHandler.ServeHTTP(response, request)
+
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+		assert.Equal(t, provider.spyJWT, "")
+	})
+}
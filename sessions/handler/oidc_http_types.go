@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+)
+
+// DiscoveryResponse is the OpenID Provider Metadata of OpenID Connect
+// Discovery 1.0, section 3.
+type DiscoveryResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+func oidcTokensToTokenResponse(tokens service.OIDCTokens) TokenResponse {
+	return TokenResponse{
+		AccessToken: tokens.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(tokens.ExpiresIn.Seconds()),
+		IDToken:     tokens.IDToken,
+		Scope:       tokens.Scope,
+	}
+}
+
+// OAuthErrorResponse is the error body of RFC 6749, section 5.2.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// UserInfoResponse leaves out the claims of scopes that weren't granted.
+type UserInfoResponse struct {
+	Subject       string `json:"sub"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+type RegisterClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public"`
+}
+
+type OAuthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func oauthClientToResponse(c domain.OAuthClient) OAuthClientResponse {
+	return OAuthClientResponse{
+		ClientID:     c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIs,
+		Public:       c.IsPublic(),
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+func oauthClientsToResponses(clients []domain.OAuthClient) []OAuthClientResponse {
+	responses := make([]OAuthClientResponse, len(clients))
+	for i, c := range clients {
+		responses[i] = oauthClientToResponse(c)
+	}
+	return responses
+}
+
+// RegisterClientResponse is the only time the client secret is shown. It
+// is empty for public clients.
+type RegisterClientResponse struct {
+	Client       OAuthClientResponse `json:"client"`
+	ClientSecret string              `json:"client_secret,omitempty"`
+}
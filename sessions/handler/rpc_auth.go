@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// adminRPCs act on the account of any user. Authenticate and Introspect
+// aren't among them, the gateway calls those with nothing but the token it
+// checks.
+var adminRPCs = map[string]bool{
+	"/sessions.User/GetUser":           true,
+	"/sessions.User/BatchGetUsers":     true,
+	"/sessions.User/ListSessions":      true,
+	"/sessions.User/RevokeSession":     true,
+	"/sessions.User/RevokeAllSessions": true,
+}
+
+// adminScopes are the scopes an API key needs to call adminRPCs.
+var adminScopes = []string{domain.RoleAdmin, domain.RoleSupport}
+
+type actorKey struct{}
+
+// AuthenticateCaller is the unary interceptor that guards adminRPCs. Their
+// callers have to send the API key of a service account with one of
+// adminScopes as "authorization: Bearer ek_...". The service account is
+// what gets audited as the actor, see rpcActor.
+func (u *UserRPCHandler) AuthenticateCaller(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !adminRPCs[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	key, ok := strings.CutPrefix(firstValue(md, "authorization"), "Bearer ")
+	if !ok || key == "" {
+		return nil, mapUserError(ErrMissingToken, http.StatusUnauthorized)
+	}
+	if !crypto.IsAPIKey(key) {
+		return nil, mapUserError(service.ErrInvalidAPIKey, http.StatusUnauthorized)
+	}
+
+	principal, err := u.userService.Authenticate(ctx, key)
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		return nil, mapUserError(err, http.StatusUnauthorized)
+	}
+	if err != nil {
+		return nil, mapUserError(err, http.StatusInternalServerError)
+	}
+
+	if !slices.ContainsFunc(principal.Roles, func(scope string) bool { return slices.Contains(adminScopes, scope) }) {
+		return nil, mapUserError(service.ErrPermissionDenied, http.StatusForbidden)
+	}
+
+	actor := service.Actor{
+		ServiceAccountID: principal.ServiceAccountID,
+		Client: service.ClientInfo{
+			UserAgent: truncate(firstValue(md, "user-agent"), maxUserAgentLength),
+			IP:        truncate(peerIP(ctx), maxIPLength),
+		},
+	}
+	return handler(context.WithValue(ctx, actorKey{}, actor), req)
+}
+
+// rpcActor is the caller AuthenticateCaller let through.
+func rpcActor(ctx context.Context) service.Actor {
+	actor, _ := ctx.Value(actorKey{}).(service.Actor)
+	return actor
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	ip, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return ip
+}
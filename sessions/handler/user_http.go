@@ -1,41 +1,118 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
 	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
 	"github.com/VitoNaychev/elysium-challenge/sessions/service"
 )
 
 var (
-	ErrEmptyBody    = errors.New("request body is empty")
-	ErrMissingToken = errors.New("missing token in request")
+	ErrEmptyBody        = errors.New("request body is empty")
+	ErrMissingToken     = errors.New("missing token in request")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrMissingSessionID = errors.New("missing session ID in request")
+	ErrMalformedBody    = errors.New("request body is malformed")
+	ErrValidation       = errors.New("request validation failed")
+
+	ErrMissingServiceAccountID = errors.New("missing service account ID in request")
+	ErrMissingAPIKeyID         = errors.New("missing API key ID in request")
+	ErrInvalidAuditQuery       = errors.New("invalid audit log query")
+	ErrInvalidUserID           = errors.New("invalid user ID in request")
 )
 
 type UserService interface {
-	Create(*domain.User) error
-	Login(string, string) (string, error)
-	Logout(string) error
-	Authenticate(string) (int, error)
+	Create(context.Context, *domain.User, service.ClientInfo) (service.Tokens, error)
+	Login(context.Context, string, string, service.ClientInfo) (service.Tokens, error)
+	Refresh(context.Context, string) (service.Tokens, error)
+	Logout(context.Context, string, service.ClientInfo) error
+	Authenticate(context.Context, string) (service.Principal, error)
+	Introspect(context.Context, string) (service.Introspection, error)
+
+	CompleteMFALogin(context.Context, string, string, service.ClientInfo) (service.Tokens, error)
+	EnrollMFA(context.Context, string) (service.MFAEnrollment, error)
+	ConfirmMFA(context.Context, string, string) ([]string, error)
+	DisableMFA(context.Context, string, string, string) error
+	RegenerateRecoveryCodes(context.Context, string, string, string) ([]string, error)
+
+	RequestEmailVerification(context.Context, string) error
+	VerifyEmail(context.Context, string) error
+	RequestPasswordReset(context.Context, string) error
+	ResetPassword(context.Context, string, string) error
+
+	GetUser(context.Context, string) (domain.User, error)
+	UpdateUser(context.Context, string, string, string, string, string, string) (domain.User, error)
+	ChangePassword(context.Context, string, string, string) error
+	Delete(context.Context, string) error
+	SetRoles(context.Context, string, int, []string) (domain.User, error)
+
+	CreateServiceAccount(context.Context, string, string) (domain.ServiceAccount, error)
+	ListServiceAccounts(context.Context, string) ([]domain.ServiceAccount, error)
+	DeleteServiceAccount(context.Context, string, int) error
+	CreateAPIKey(context.Context, string, int, []string, time.Duration) (string, domain.APIKey, error)
+	ListAPIKeys(context.Context, string, int) ([]domain.APIKey, error)
+	RevokeAPIKey(context.Context, string, int, string) error
+
+	ListAuditEvents(context.Context, string, audit.Filter) ([]audit.Event, int64, error)
+
+	ListSessions(context.Context, string) ([]domain.Session, string, error)
+	RevokeSession(context.Context, string, string) error
+	RevokeOtherSessions(context.Context, string) (int, error)
+
+	LookupUser(context.Context, int) (domain.User, error)
+	LookupUsers(context.Context, []int) ([]domain.User, error)
+	ListUserSessions(context.Context, int) ([]domain.Session, error)
+	RevokeUserSession(context.Context, int, string, service.Actor) error
+	RevokeAllUserSessions(context.Context, int, service.Actor) (int, error)
 }
 
 type UserHTTPHandler struct {
-	userService UserService
+	userService    UserService
+	passwordPolicy crypto.PasswordPolicy
 
 	http.Handler
 }
 
-func NewUserHTTPHandler(userService UserService) *UserHTTPHandler {
+func NewUserHTTPHandler(userService UserService, passwordPolicy crypto.PasswordPolicy) *UserHTTPHandler {
 	userHandler := UserHTTPHandler{
-		userService: userService,
+		userService:    userService,
+		passwordPolicy: passwordPolicy,
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/user/signup", userHandler.SignUp)
 	mux.HandleFunc("/user/login", userHandler.Login)
+	mux.HandleFunc("/user/login/mfa", userHandler.CompleteMFALogin)
 	mux.HandleFunc("/user/logout", userHandler.Logout)
+	mux.HandleFunc("/user/refresh", userHandler.Refresh)
+	mux.HandleFunc("/user/me", userHandler.Me)
+	mux.HandleFunc("/user/password", userHandler.ChangePassword)
+	mux.HandleFunc("/user/roles", userHandler.SetRoles)
+	mux.HandleFunc("/user/service-accounts", userHandler.ServiceAccounts)
+	mux.HandleFunc("/user/service-accounts/keys", userHandler.APIKeys)
+	mux.HandleFunc("/user/audit", userHandler.AuditEvents)
+	mux.HandleFunc("/user/password/forgot", userHandler.RequestPasswordReset)
+	mux.HandleFunc("/user/password/reset", userHandler.ResetPassword)
+	mux.HandleFunc("/user/email/verify", userHandler.VerifyEmail)
+	mux.HandleFunc("/user/email/verify/resend", userHandler.RequestEmailVerification)
+	mux.HandleFunc("/user/mfa/enroll", userHandler.EnrollMFA)
+	mux.HandleFunc("/user/mfa/confirm", userHandler.ConfirmMFA)
+	mux.HandleFunc("/user/mfa/disable", userHandler.DisableMFA)
+	mux.HandleFunc("/user/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+	mux.HandleFunc("/user/sessions", userHandler.Sessions)
+	mux.HandleFunc("/user/sessions/others", userHandler.RevokeOtherSessions)
 
 	userHandler.Handler = mux
 
@@ -43,38 +120,95 @@ func NewUserHTTPHandler(userService UserService) *UserHTTPHandler {
 }
 
 func (u *UserHTTPHandler) SignUp(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		writeErrorResponse(w, http.StatusBadRequest, ErrEmptyBody)
+	var request SignUpRequest
+	if !u.decodeAndValidate(w, r, &request) {
 		return
 	}
 
-	var request SignUpRequest
-	json.NewDecoder(r.Body).Decode(&request)
-
 	user := signUpRequestToUser(request)
 
-	err := u.userService.Create(&user)
+	tokens, err := u.userService.Create(r.Context(), &user, clientInfo(r))
 	if err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, err)
-		return
+		if errors.Is(err, service.ErrEmailTaken) {
+			writeErrorResponse(w, http.StatusConflict, err)
+			return
+		} else {
+			writeErrorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
 	}
 
-	response := userToSignUpResponse(user)
+	response := userToSignUpResponse(user, tokens)
 	json.NewEncoder(w).Encode(response)
 }
 
 func (u *UserHTTPHandler) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		writeErrorResponse(w, http.StatusBadRequest, ErrEmptyBody)
+	var request LoginRequest
+	if !u.decodeAndValidate(w, r, &request) {
 		return
 	}
 
-	var request LoginRequest
-	json.NewDecoder(r.Body).Decode(&request)
+	tokens, err := u.userService.Login(r.Context(), request.Email, request.Password, clientInfo(r))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			writeErrorResponse(w, http.StatusUnauthorized, err)
+			return
+		}
+		writeUserServiceError(w, err)
+		return
+	}
+
+	if tokens.MFAToken != "" {
+		json.NewEncoder(w).Encode(MFAChallengeResponse{MFARequired: true, MFAToken: tokens.MFAToken})
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokensToJWTResponse(tokens))
+}
 
-	jwt, err := u.userService.Login(request.Email, request.Password)
+func (u *UserHTTPHandler) CompleteMFALogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	var request MFALoginRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	if request.MFAToken == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	tokens, err := u.userService.CompleteMFALogin(r.Context(), request.MFAToken, request.Code, clientInfo(r))
 	if err != nil {
-		if errors.Is(err, service.ErrEmailNotFound) || errors.Is(err, service.ErrWrongPassword) {
+		if errors.Is(err, service.ErrInvalidMFAChallenge) || errors.Is(err, service.ErrInvalidMFACode) {
+			writeErrorResponse(w, http.StatusUnauthorized, err)
+			return
+		}
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokensToJWTResponse(tokens))
+}
+
+func (u *UserHTTPHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var request RefreshRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	if request.RefreshToken == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	tokens, err := u.userService.Refresh(r.Context(), request.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
 			writeErrorResponse(w, http.StatusUnauthorized, err)
 			return
 		} else {
@@ -83,10 +217,7 @@ func (u *UserHTTPHandler) Login(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	response := JWTResponse{
-		Token: jwt,
-	}
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(tokensToJWTResponse(tokens))
 }
 
 func (u *UserHTTPHandler) Logout(w http.ResponseWriter, r *http.Request) {
@@ -96,9 +227,9 @@ func (u *UserHTTPHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := u.userService.Logout(jwt)
+	err := u.userService.Logout(r.Context(), jwt, clientInfo(r))
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidJWT) {
+		if errors.Is(err, service.ErrInvalidJWT) || errors.Is(err, service.ErrSessionNotFound) {
 			writeErrorResponse(w, http.StatusUnauthorized, err)
 			return
 		} else if errors.Is(err, service.ErrUserNotFound) {
@@ -111,7 +242,683 @@ func (u *UserHTTPHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (u *UserHTTPHandler) Me(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u.GetUser(w, r)
+	case http.MethodPatch:
+		u.UpdateUser(w, r)
+	case http.MethodDelete:
+		u.DeleteUser(w, r)
+	default:
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+func (u *UserHTTPHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	user, err := u.userService.GetUser(r.Context(), jwt)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(userToUserResponse(user))
+}
+
+func (u *UserHTTPHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request UpdateUserRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	user, err := u.userService.UpdateUser(r.Context(), jwt, request.FirstName, request.LastName, request.Email,
+		request.Password, request.Code)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(userToUserResponse(user))
+}
+
+func (u *UserHTTPHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	err := u.userService.Delete(r.Context(), jwt)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserHTTPHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request ChangePasswordRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	err := u.userService.ChangePassword(r.Context(), jwt, request.OldPassword, request.NewPassword)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+}
+
+func (u *UserHTTPHandler) SetRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request SetRolesRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	user, err := u.userService.SetRoles(r.Context(), jwt, request.UserID, request.Roles)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(userToUserResponse(user))
+}
+
+func (u *UserHTTPHandler) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	err := u.userService.RequestEmailVerification(r.Context(), jwt)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail takes the token from the query so that the link in the email
+// works as is, or from the body of a POST.
+func (u *UserHTTPHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var token string
+	switch r.Method {
+	case http.MethodGet:
+		token = r.URL.Query().Get("token")
+	case http.MethodPost:
+		var request VerifyEmailRequest
+		if !decodeRequest(w, r, &request) {
+			return
+		}
+		token = request.Token
+	default:
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	if token == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	err := u.userService.VerifyEmail(r.Context(), token)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestPasswordReset always answers with Accepted, whether the email
+// belongs to a user or not.
+func (u *UserHTTPHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	var request PasswordResetRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	err := u.userService.RequestPasswordReset(r.Context(), request.Email)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (u *UserHTTPHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	var request ResetPasswordRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	if request.Token == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	err := u.userService.ResetPassword(r.Context(), request.Token, request.NewPassword)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserHTTPHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	enrollment, err := u.userService.EnrollMFA(r.Context(), jwt)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(MFAEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.ProvisioningURI,
+	})
+}
+
+func (u *UserHTTPHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request MFACodeRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	recoveryCodes, err := u.userService.ConfirmMFA(r.Context(), jwt, request.Code)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+func (u *UserHTTPHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request MFAReauthRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	err := u.userService.DisableMFA(r.Context(), jwt, request.Password, request.Code)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserHTTPHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request MFAReauthRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	recoveryCodes, err := u.userService.RegenerateRecoveryCodes(r.Context(), jwt, request.Password, request.Code)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+func (u *UserHTTPHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u.ListSessions(w, r)
+	case http.MethodDelete:
+		u.RevokeSession(w, r)
+	default:
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+func (u *UserHTTPHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	sessions, currentID, err := u.userService.ListSessions(r.Context(), jwt)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(sessionsToSessionResponses(sessions, currentID))
+}
+
+func (u *UserHTTPHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	sessionID := r.URL.Query().Get("id")
+	if sessionID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingSessionID)
+		return
+	}
+
+	err := u.userService.RevokeSession(r.Context(), jwt, sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			writeErrorResponse(w, http.StatusNotFound, err)
+			return
+		}
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserHTTPHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	revoked, err := u.userService.RevokeOtherSessions(r.Context(), jwt)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(RevokeSessionsResponse{Revoked: revoked})
+}
+
+func (u *UserHTTPHandler) ServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u.ListServiceAccounts(w, r)
+	case http.MethodPost:
+		u.CreateServiceAccount(w, r)
+	case http.MethodDelete:
+		u.DeleteServiceAccount(w, r)
+	default:
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+func (u *UserHTTPHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request CreateServiceAccountRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	account, err := u.userService.CreateServiceAccount(r.Context(), jwt, request.Name)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serviceAccountToResponse(account))
+}
+
+func (u *UserHTTPHandler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	accounts, err := u.userService.ListServiceAccounts(r.Context(), jwt)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(serviceAccountsToResponses(accounts))
+}
+
+func (u *UserHTTPHandler) DeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	accountID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingServiceAccountID)
+		return
+	}
+
+	err = u.userService.DeleteServiceAccount(r.Context(), jwt, accountID)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserHTTPHandler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u.ListAPIKeys(w, r)
+	case http.MethodPost:
+		u.CreateAPIKey(w, r)
+	case http.MethodDelete:
+		u.RevokeAPIKey(w, r)
+	default:
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
+
+func (u *UserHTTPHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	var request CreateAPIKeyRequest
+	if !u.decodeAndValidate(w, r, &request) {
+		return
+	}
+
+	lifetime := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+	key, apiKey, err := u.userService.CreateAPIKey(r.Context(), jwt, request.ServiceAccountID, request.Scopes, lifetime)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{Key: key, APIKey: apiKeyToResponse(apiKey)})
+}
+
+func (u *UserHTTPHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	accountID, err := strconv.Atoi(r.URL.Query().Get("service_account_id"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingServiceAccountID)
+		return
+	}
+
+	keys, err := u.userService.ListAPIKeys(r.Context(), jwt, accountID)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(apiKeysToResponses(keys))
+}
+
+func (u *UserHTTPHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	accountID, err := strconv.Atoi(r.URL.Query().Get("service_account_id"))
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingServiceAccountID)
+		return
+	}
+
+	keyID := r.URL.Query().Get("id")
+	if keyID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingAPIKeyID)
+		return
+	}
+
+	err = u.userService.RevokeAPIKey(r.Context(), jwt, accountID, keyID)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AuditEvents lists the audit log, filtered by the actor_id, email, type,
+// result, since and until query parameters. Times are RFC 3339. Pages are
+// asked for with limit and continued with the next_before of the previous
+// one.
+func (u *UserHTTPHandler) AuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	jwt := r.Header.Get("Token")
+	if jwt == "" {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMissingToken)
+		return
+	}
+
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	events, next, err := u.userService.ListAuditEvents(r.Context(), jwt, filter)
+	if err != nil {
+		writeUserServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(AuditEventsResponse{
+		Events:     auditEventsToResponses(events),
+		NextBefore: next,
+	})
+}
+
+func parseAuditFilter(query url.Values) (audit.Filter, error) {
+	filter := audit.Filter{
+		Email:  query.Get("email"),
+		Type:   audit.EventType(query.Get("type")),
+		Result: audit.Result(query.Get("result")),
+	}
+
+	actorID, err := queryInt(query, "actor_id")
+	if err != nil {
+		return audit.Filter{}, ErrInvalidAuditQuery
+	}
+	filter.ActorID = int(actorID)
+
+	filter.Before, err = queryInt(query, "before")
+	if err != nil {
+		return audit.Filter{}, ErrInvalidAuditQuery
+	}
+
+	limit, err := queryInt(query, "limit")
+	if err != nil {
+		return audit.Filter{}, ErrInvalidAuditQuery
+	}
+	filter.Limit = int(limit)
+
+	filter.Since, err = queryTime(query, "since")
+	if err != nil {
+		return audit.Filter{}, ErrInvalidAuditQuery
+	}
+
+	filter.Until, err = queryTime(query, "until")
+	if err != nil {
+		return audit.Filter{}, ErrInvalidAuditQuery
+	}
+
+	return filter, nil
+}
+
+// queryInt and queryTime return the zero value for a missing parameter.
+func queryInt(query url.Values, name string) (int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, ErrInvalidAuditQuery
+	}
+
+	return n, nil
+}
+
+func queryTime(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func writeUserServiceError(w http.ResponseWriter, err error) {
+	var throttleErr *service.ThrottleError
+	if errors.As(err, &throttleErr) {
+		retryAfter := int(math.Ceil(throttleErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	apierror.Write(w, userErrors.Map(err))
+}
+
+// clientInfo prefers X-Forwarded-For since requests normally come through
+// the gateway. Only the last entry is taken, it's the one the gateway
+// appended, everything before it is whatever the client sent.
+func clientInfo(r *http.Request) service.ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		forwarded := values[len(values)-1]
+		ip = strings.TrimSpace(forwarded[strings.LastIndex(forwarded, ",")+1:])
+	}
+
+	return service.ClientInfo{
+		UserAgent: truncate(r.UserAgent(), maxUserAgentLength),
+		IP:        truncate(ip, maxIPLength),
+	}
+}
+
+// writeErrorResponse reports the error with the status the endpoint decided
+// on, keeping the code the error is mapped to.
 func writeErrorResponse(w http.ResponseWriter, status int, err error) {
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Message: err.Error()})
+	apierror.Write(w, mapUserError(err, status))
 }
@@ -2,47 +2,289 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/VitoNaychev/elysium-challenge/apierror"
 	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
 	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
 	"github.com/VitoNaychev/elysium-challenge/sessions/handler"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
 	"github.com/VitoNaychev/elysium-challenge/sessions/service"
 )
 
 type StubUserService struct {
-	dummyUserID int
-	dummyJWT    string
-	dummyErr    error
+	dummyUserID       int
+	dummyJWT          string
+	dummyRefreshToken string
+	dummyErr          error
+
+	dummyUser      domain.User
+	dummyUsers     []domain.User
+	dummySessions  []domain.Session
+	dummyCurrentID string
+	dummyRevoked   int
+
+	dummyEmailVerified bool
+	dummyRoles         []string
+	dummyKind          service.PrincipalKind
+	dummyIntrospection service.Introspection
+
+	dummyMFAToken      string
+	dummyEnrollment    service.MFAEnrollment
+	dummyRecoveryCodes []string
+
+	dummyAccount domain.ServiceAccount
+	dummyAPIKey  domain.APIKey
+	dummyKey     string
+
+	dummyEvents     []audit.Event
+	dummyNextBefore int64
 
 	spyUser      domain.User
 	spyLogoutJWT string
+	spyRefresh   string
+	spyClient    service.ClientInfo
+	spyActor     service.Actor
+	spyUserID    int
+	spyUserIDs   []int
+	spySession   string
+	spyJWT       string
+	spyPasswords [2]string
+	spyToken     string
+	spyEmail     string
+	spyCode      string
+	spyRoles     []string
+	spyName      string
+	spyLifetime  time.Duration
+	spyFilter    audit.Filter
+	spyCtx       context.Context
 }
 
-func (s *StubUserService) Create(user *domain.User) error {
+func (s *StubUserService) Create(ctx context.Context, user *domain.User, client service.ClientInfo) (service.Tokens, error) {
 	s.spyUser = *user
+	s.spyClient = client
 
 	user.ID = s.dummyUserID
-	user.JWTs = []string{s.dummyJWT}
 
+	return s.dummyTokens(), s.dummyErr
+}
+
+func (s *StubUserService) Login(ctx context.Context, email, password string, client service.ClientInfo) (service.Tokens, error) {
+	s.spyClient = client
+	return s.dummyTokens(), s.dummyErr
+}
+
+func (s *StubUserService) Refresh(ctx context.Context, refreshToken string) (service.Tokens, error) {
+	s.spyRefresh = refreshToken
+	return s.dummyTokens(), s.dummyErr
+}
+
+func (s *StubUserService) ListSessions(ctx context.Context, jwt string) ([]domain.Session, string, error) {
+	s.spyJWT = jwt
+	return s.dummySessions, s.dummyCurrentID, s.dummyErr
+}
+
+func (s *StubUserService) RevokeSession(ctx context.Context, jwt string, sessionID string) error {
+	s.spyJWT = jwt
+	s.spySession = sessionID
+	return s.dummyErr
+}
+
+func (s *StubUserService) RevokeOtherSessions(ctx context.Context, jwt string) (int, error) {
+	s.spyJWT = jwt
+	return s.dummyRevoked, s.dummyErr
+}
+
+func (s *StubUserService) LookupUser(ctx context.Context, id int) (domain.User, error) {
+	s.spyUserID = id
+	return s.dummyUser, s.dummyErr
+}
+
+func (s *StubUserService) LookupUsers(ctx context.Context, ids []int) ([]domain.User, error) {
+	s.spyUserIDs = ids
+	return s.dummyUsers, s.dummyErr
+}
+
+func (s *StubUserService) ListUserSessions(ctx context.Context, userID int) ([]domain.Session, error) {
+	s.spyUserID = userID
+	return s.dummySessions, s.dummyErr
+}
+
+func (s *StubUserService) RevokeUserSession(ctx context.Context, userID int, sessionID string, actor service.Actor) error {
+	s.spyUserID = userID
+	s.spySession = sessionID
+	s.spyActor = actor
 	return s.dummyErr
 }
 
-func (s *StubUserService) Login(email, password string) (string, error) {
-	return s.dummyJWT, s.dummyErr
+func (s *StubUserService) RevokeAllUserSessions(ctx context.Context, userID int, actor service.Actor) (int, error) {
+	s.spyUserID = userID
+	s.spyActor = actor
+	return s.dummyRevoked, s.dummyErr
 }
 
-func (s *StubUserService) Logout(jwt string) error {
+func (s *StubUserService) dummyTokens() service.Tokens {
+	return service.Tokens{
+		AccessToken:  s.dummyJWT,
+		RefreshToken: s.dummyRefreshToken,
+		MFAToken:     s.dummyMFAToken,
+	}
+}
+
+func (s *StubUserService) Logout(ctx context.Context, jwt string, client service.ClientInfo) error {
 	s.spyLogoutJWT = jwt
+	s.spyClient = client
+	return s.dummyErr
+}
+
+func (s *StubUserService) Authenticate(ctx context.Context, jwt string) (service.Principal, error) {
+	s.spyCtx = ctx
+	if s.dummyKind == service.PrincipalServiceAccount {
+		return service.Principal{Kind: s.dummyKind, ServiceAccountID: s.dummyAccount.ID, Roles: s.dummyRoles}, s.dummyErr
+	}
+	return service.Principal{Kind: service.PrincipalUser, UserID: s.dummyUserID, EmailVerified: s.dummyEmailVerified, Roles: s.dummyRoles}, s.dummyErr
+}
+
+func (s *StubUserService) ListAuditEvents(ctx context.Context, jwt string, filter audit.Filter) ([]audit.Event, int64, error) {
+	s.spyJWT = jwt
+	s.spyFilter = filter
+	return s.dummyEvents, s.dummyNextBefore, s.dummyErr
+}
+
+func (s *StubUserService) Introspect(ctx context.Context, token string) (service.Introspection, error) {
+	s.spyToken = token
+	return s.dummyIntrospection, s.dummyErr
+}
+
+func (s *StubUserService) RequestEmailVerification(ctx context.Context, jwt string) error {
+	s.spyJWT = jwt
+	return s.dummyErr
+}
+
+func (s *StubUserService) VerifyEmail(ctx context.Context, token string) error {
+	s.spyToken = token
+	return s.dummyErr
+}
+
+func (s *StubUserService) RequestPasswordReset(ctx context.Context, email string) error {
+	s.spyEmail = email
+	return s.dummyErr
+}
+
+func (s *StubUserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	s.spyToken = token
+	s.spyPasswords = [2]string{"", newPassword}
+	return s.dummyErr
+}
+
+func (s *StubUserService) CompleteMFALogin(ctx context.Context, mfaToken, code string, client service.ClientInfo) (service.Tokens, error) {
+	s.spyToken = mfaToken
+	s.spyCode = code
+	s.spyClient = client
+	return service.Tokens{AccessToken: s.dummyJWT, RefreshToken: s.dummyRefreshToken}, s.dummyErr
+}
+
+func (s *StubUserService) EnrollMFA(ctx context.Context, jwt string) (service.MFAEnrollment, error) {
+	s.spyJWT = jwt
+	return s.dummyEnrollment, s.dummyErr
+}
+
+func (s *StubUserService) ConfirmMFA(ctx context.Context, jwt, code string) ([]string, error) {
+	s.spyJWT = jwt
+	s.spyCode = code
+	return s.dummyRecoveryCodes, s.dummyErr
+}
+
+func (s *StubUserService) DisableMFA(ctx context.Context, jwt, password, code string) error {
+	s.spyJWT = jwt
+	s.spyPasswords = [2]string{password, ""}
+	s.spyCode = code
+	return s.dummyErr
+}
+
+func (s *StubUserService) RegenerateRecoveryCodes(ctx context.Context, jwt, password, code string) ([]string, error) {
+	s.spyJWT = jwt
+	s.spyPasswords = [2]string{password, ""}
+	s.spyCode = code
+	return s.dummyRecoveryCodes, s.dummyErr
+}
+
+func (s *StubUserService) GetUser(ctx context.Context, jwt string) (domain.User, error) {
+	s.spyCtx = ctx
+	s.spyJWT = jwt
+	return s.dummyUser, s.dummyErr
+}
+
+func (s *StubUserService) UpdateUser(ctx context.Context, jwt string, firstName, lastName, email, password, code string) (domain.User, error) {
+	s.spyJWT = jwt
+	s.spyUser = domain.User{FirstName: firstName, LastName: lastName, Email: email, Password: password}
+	s.spyCode = code
+	return s.dummyUser, s.dummyErr
+}
+
+func (s *StubUserService) ChangePassword(ctx context.Context, jwt string, oldPassword, newPassword string) error {
+	s.spyJWT = jwt
+	s.spyPasswords = [2]string{oldPassword, newPassword}
+	return s.dummyErr
+}
+
+func (s *StubUserService) Delete(ctx context.Context, jwt string) error {
+	s.spyJWT = jwt
+	return s.dummyErr
+}
+
+func (s *StubUserService) SetRoles(ctx context.Context, jwt string, userID int, roles []string) (domain.User, error) {
+	s.spyJWT = jwt
+	s.spyUserID = userID
+	s.spyRoles = roles
+	return s.dummyUser, s.dummyErr
+}
+
+func (s *StubUserService) CreateServiceAccount(ctx context.Context, jwt string, name string) (domain.ServiceAccount, error) {
+	s.spyJWT = jwt
+	s.spyName = name
+	return s.dummyAccount, s.dummyErr
+}
+
+func (s *StubUserService) ListServiceAccounts(ctx context.Context, jwt string) ([]domain.ServiceAccount, error) {
+	s.spyJWT = jwt
+	return []domain.ServiceAccount{s.dummyAccount}, s.dummyErr
+}
+
+func (s *StubUserService) DeleteServiceAccount(ctx context.Context, jwt string, accountID int) error {
+	s.spyJWT = jwt
+	s.spyUserID = accountID
 	return s.dummyErr
 }
 
-func (s *StubUserService) Authenticate(jwt string) (int, error) {
-	return s.dummyUserID, s.dummyErr
+func (s *StubUserService) CreateAPIKey(ctx context.Context, jwt string, accountID int, scopes []string, lifetime time.Duration) (string, domain.APIKey, error) {
+	s.spyJWT = jwt
+	s.spyUserID = accountID
+	s.spyRoles = scopes
+	s.spyLifetime = lifetime
+	return s.dummyKey, s.dummyAPIKey, s.dummyErr
+}
+
+func (s *StubUserService) ListAPIKeys(ctx context.Context, jwt string, accountID int) ([]domain.APIKey, error) {
+	s.spyJWT = jwt
+	s.spyUserID = accountID
+	return []domain.APIKey{s.dummyAPIKey}, s.dummyErr
+}
+
+func (s *StubUserService) RevokeAPIKey(ctx context.Context, jwt string, accountID int, keyID string) error {
+	s.spyJWT = jwt
+	s.spyUserID = accountID
+	s.spyToken = keyID
+	return s.dummyErr
 }
 
 func TestSignUpHandler(t *testing.T) {
@@ -67,7 +309,7 @@ func TestSignUpHandler(t *testing.T) {
 		response := httptest.NewRecorder()
 
 		userService := &StubUserService{}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 		userHandler.SignUp(response, request)
 
 		assert.Equal(t, response.Code, http.StatusOK)
@@ -77,24 +319,25 @@ func TestSignUpHandler(t *testing.T) {
 	t.Run("writes JWT and new user to response", func(t *testing.T) {
 		dummyUserID := 10
 		dummyJWT := "sampleJWT"
+		dummyRefreshToken := "sampleRefreshToken"
 
 		wantResponse := handler.SignUpResponse{
 			JWT: handler.JWTResponse{
-				Token: dummyJWT,
+				Token:        dummyJWT,
+				RefreshToken: dummyRefreshToken,
 			},
 			User: handler.UserResponse{
 				ID:        dummyUserID,
 				FirstName: "John",
 				LastName:  "Doe",
 				Email:     "johndoe@example.com",
-				Password:  "samplepassword",
 			},
 		}
 		signUpRequest := handler.SignUpRequest{
 			FirstName: wantResponse.User.FirstName,
 			LastName:  wantResponse.User.LastName,
 			Email:     wantResponse.User.Email,
-			Password:  wantResponse.User.Password,
+			Password:  "samplepassword",
 		}
 
 		reqBody := bytes.NewBuffer([]byte{})
@@ -104,10 +347,11 @@ func TestSignUpHandler(t *testing.T) {
 		response := httptest.NewRecorder()
 
 		userService := &StubUserService{
-			dummyUserID: dummyUserID,
-			dummyJWT:    dummyJWT,
+			dummyUserID:       dummyUserID,
+			dummyJWT:          dummyJWT,
+			dummyRefreshToken: dummyRefreshToken,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.SignUp(response, request)
 		assert.Equal(t, response.Code, http.StatusOK)
@@ -118,17 +362,65 @@ func TestSignUpHandler(t *testing.T) {
 		assert.Equal(t, gotResponse, wantResponse)
 	})
 
+	t.Run("doesn't write password to response", func(t *testing.T) {
+		signUpRequest := handler.SignUpRequest{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+			Password:  "samplepassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(signUpRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/signup", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyJWT: "sampleJWT"}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.SignUp(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		if bytes.Contains(response.Body.Bytes(), []byte("password")) {
+			t.Errorf("response %q contains the password", response.Body.String())
+		}
+	})
+
+	t.Run("returns Conflict on ErrEmailTaken", func(t *testing.T) {
+		signUpRequest := handler.SignUpRequest{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+			Password:  "samplepassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(signUpRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/signup", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{
+			dummyErr: service.ErrEmailTaken,
+		}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.SignUp(response, request)
+		assert.Equal(t, response.Code, http.StatusConflict)
+	})
+
 	t.Run("returns Bad Request on missing request body", func(t *testing.T) {
 		request, _ := http.NewRequest(http.MethodPost, "/user/signup", nil)
 		response := httptest.NewRecorder()
 
 		userService := &StubUserService{}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.SignUp(response, request)
 		assert.Equal(t, response.Code, http.StatusBadRequest)
 
-		var errorResponse handler.ErrorResponse
+		var errorResponse apierror.Error
 		json.NewDecoder(response.Body).Decode(&errorResponse)
 
 		assert.Equal(t, errorResponse.Message, handler.ErrEmptyBody.Error())
@@ -153,12 +445,12 @@ func TestSignUpHandler(t *testing.T) {
 		userService := &StubUserService{
 			dummyErr: dummyError,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.SignUp(response, request)
 		assert.Equal(t, response.Code, http.StatusInternalServerError)
 
-		var errorResponse handler.ErrorResponse
+		var errorResponse apierror.Error
 		json.NewDecoder(response.Body).Decode(&errorResponse)
 
 		assert.Equal(t, errorResponse.Message, dummyError.Error())
@@ -168,7 +460,8 @@ func TestSignUpHandler(t *testing.T) {
 func TestLoginHandler(t *testing.T) {
 	t.Run("returns new JWT on correct email and password", func(t *testing.T) {
 		wantResponse := handler.JWTResponse{
-			Token: "sampleToken",
+			Token:        "sampleToken",
+			RefreshToken: "sampleRefreshToken",
 		}
 
 		loginRequest := handler.LoginRequest{
@@ -183,9 +476,10 @@ func TestLoginHandler(t *testing.T) {
 		response := httptest.NewRecorder()
 
 		userService := &StubUserService{
-			dummyJWT: wantResponse.Token,
+			dummyJWT:          wantResponse.Token,
+			dummyRefreshToken: wantResponse.RefreshToken,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Login(response, request)
 		assert.Equal(t, response.Code, http.StatusOK)
@@ -196,8 +490,113 @@ func TestLoginHandler(t *testing.T) {
 		assert.Equal(t, gotResponse, wantResponse)
 	})
 
-	t.Run("returns Unauthorized on ErrEmailNotFound", func(t *testing.T) {
-		dummyError := service.ErrEmailNotFound
+	t.Run("passes client info with the last X-Forwarded-For entry to UserService", func(t *testing.T) {
+		wantClient := service.ClientInfo{
+			UserAgent: "sampleAgent",
+			IP:        "203.0.113.7",
+		}
+
+		loginRequest := handler.LoginRequest{
+			Email:    "johndoe@example.com",
+			Password: "samplepassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(loginRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/login", reqBody)
+		request.Header.Set("User-Agent", wantClient.UserAgent)
+		request.Header.Set("X-Forwarded-For", "198.51.100.1, "+wantClient.IP)
+		request.RemoteAddr = "10.0.0.3:4321"
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.Login(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, userService.spyClient, wantClient)
+	})
+
+	t.Run("cuts client info to the size of the sessions columns", func(t *testing.T) {
+		loginRequest := handler.LoginRequest{
+			Email:    "johndoe@example.com",
+			Password: "samplepassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(loginRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/login", reqBody)
+		request.Header.Set("User-Agent", strings.Repeat("ü", 300))
+		request.Header.Set("X-Forwarded-For", strings.Repeat("f", 60))
+		request.RemoteAddr = "10.0.0.3:4321"
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.Login(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, userService.spyClient, service.ClientInfo{
+			UserAgent: strings.Repeat("ü", 255),
+			IP:        strings.Repeat("f", 45),
+		})
+	})
+
+	t.Run("passes client info with the remote address without X-Forwarded-For", func(t *testing.T) {
+		wantClient := service.ClientInfo{
+			UserAgent: "sampleAgent",
+			IP:        "203.0.113.7",
+		}
+
+		loginRequest := handler.LoginRequest{
+			Email:    "johndoe@example.com",
+			Password: "samplepassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(loginRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/login", reqBody)
+		request.Header.Set("User-Agent", wantClient.UserAgent)
+		request.RemoteAddr = wantClient.IP + ":4321"
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.Login(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, userService.spyClient, wantClient)
+	})
+
+	t.Run("returns MFA challenge when user has MFA enabled", func(t *testing.T) {
+		wantResponse := handler.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    "sampleMFAToken",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.LoginRequest{Email: "johndoe@example.com", Password: "samplepassword"})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/login", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyMFAToken: wantResponse.MFAToken}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.Login(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		var gotResponse handler.MFAChallengeResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse, wantResponse)
+	})
+
+	t.Run("returns Unauthorized on ErrInvalidCredentials", func(t *testing.T) {
+		dummyError := service.ErrInvalidCredentials
 
 		loginRequest := handler.LoginRequest{
 			Email:    "johndoe@example.com",
@@ -213,19 +612,19 @@ func TestLoginHandler(t *testing.T) {
 		userService := &StubUserService{
 			dummyErr: dummyError,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Login(response, request)
 		assert.Equal(t, response.Code, http.StatusUnauthorized)
 
-		var gotResponse handler.ErrorResponse
+		var gotResponse apierror.Error
 		json.NewDecoder(response.Body).Decode(&gotResponse)
 
 		assert.Equal(t, gotResponse.Message, dummyError.Error())
 	})
 
-	t.Run("returns Unauthorized on ErrWrongPassowrd", func(t *testing.T) {
-		dummyError := service.ErrWrongPassword
+	t.Run("returns Too Many Requests with Retry-After on ThrottleError", func(t *testing.T) {
+		dummyError := &service.ThrottleError{RetryAfter: 1500 * time.Millisecond}
 
 		loginRequest := handler.LoginRequest{
 			Email:    "johndoe@example.com",
@@ -241,15 +640,16 @@ func TestLoginHandler(t *testing.T) {
 		userService := &StubUserService{
 			dummyErr: dummyError,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Login(response, request)
-		assert.Equal(t, response.Code, http.StatusUnauthorized)
+		assert.Equal(t, response.Code, http.StatusTooManyRequests)
+		assert.Equal(t, response.Header().Get("Retry-After"), "2")
 
-		var gotResponse handler.ErrorResponse
+		var gotResponse apierror.Error
 		json.NewDecoder(response.Body).Decode(&gotResponse)
 
-		assert.Equal(t, gotResponse.Message, dummyError.Error())
+		assert.Equal(t, gotResponse.Message, service.ErrTooManyAttempts.Error())
 	})
 
 	t.Run("returns Internal Server Error on unknown error from UserService", func(t *testing.T) {
@@ -269,32 +669,94 @@ func TestLoginHandler(t *testing.T) {
 		userService := &StubUserService{
 			dummyErr: dummyError,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Login(response, request)
 		assert.Equal(t, response.Code, http.StatusInternalServerError)
 
-		var gotResponse handler.ErrorResponse
+		var gotResponse apierror.Error
 		json.NewDecoder(response.Body).Decode(&gotResponse)
 
 		assert.Equal(t, gotResponse.Message, dummyError.Error())
 	})
 }
 
+func TestRefreshHandler(t *testing.T) {
+	t.Run("returns new tokens on valid refresh token", func(t *testing.T) {
+		wantRefresh := "oldRefreshToken"
+		wantResponse := handler.JWTResponse{
+			Token:        "sampleToken",
+			RefreshToken: "sampleRefreshToken",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.RefreshRequest{RefreshToken: wantRefresh})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/refresh", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{
+			dummyJWT:          wantResponse.Token,
+			dummyRefreshToken: wantResponse.RefreshToken,
+		}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.Refresh(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, userService.spyRefresh, wantRefresh)
+
+		var gotResponse handler.JWTResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse, wantResponse)
+	})
+
+	t.Run("returns Bad Request on missing refresh token", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.RefreshRequest{})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/refresh", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.Refresh(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns Unauthorized on reused refresh token", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.RefreshRequest{RefreshToken: "oldRefreshToken"})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/refresh", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrRefreshTokenReused}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.Refresh(response, request)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+}
+
 func TestLogoutHandler(t *testing.T) {
 	t.Run("calls UserService.Logout", func(t *testing.T) {
 		wantJWT := "sampleToken"
 
 		request, _ := http.NewRequest(http.MethodPost, "/user/logout", nil)
 		request.Header.Add("Token", wantJWT)
+		request.Header.Set("User-Agent", "sampleAgent")
+		request.RemoteAddr = "203.0.113.7:4321"
 
 		response := httptest.NewRecorder()
 
 		userService := &StubUserService{}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Logout(response, request)
 		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, userService.spyClient, service.ClientInfo{UserAgent: "sampleAgent", IP: "203.0.113.7"})
 
 		assert.Equal(t, userService.spyLogoutJWT, wantJWT)
 	})
@@ -304,12 +766,12 @@ func TestLogoutHandler(t *testing.T) {
 		response := httptest.NewRecorder()
 
 		userService := &StubUserService{}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Logout(response, request)
 		assert.Equal(t, response.Code, http.StatusBadRequest)
 
-		var gotResponse handler.ErrorResponse
+		var gotResponse apierror.Error
 		json.NewDecoder(response.Body).Decode(&gotResponse)
 
 		assert.Equal(t, gotResponse.Message, handler.ErrMissingToken.Error())
@@ -327,7 +789,7 @@ func TestLogoutHandler(t *testing.T) {
 		userService := &StubUserService{
 			dummyErr: dummyErr,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Logout(response, request)
 		assert.Equal(t, response.Code, http.StatusUnauthorized)
@@ -345,7 +807,7 @@ func TestLogoutHandler(t *testing.T) {
 		userService := &StubUserService{
 			dummyErr: dummyErr,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Logout(response, request)
 		assert.Equal(t, response.Code, http.StatusNotFound)
@@ -363,14 +825,935 @@ func TestLogoutHandler(t *testing.T) {
 		userService := &StubUserService{
 			dummyErr: dummyError,
 		}
-		userHandler := handler.NewUserHTTPHandler(userService)
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
 
 		userHandler.Logout(response, request)
 		assert.Equal(t, response.Code, http.StatusInternalServerError)
 
-		var gotResponse handler.ErrorResponse
+		var gotResponse apierror.Error
 		json.NewDecoder(response.Body).Decode(&gotResponse)
 
 		assert.Equal(t, gotResponse.Message, dummyError.Error())
 	})
 }
+
+func TestMeHandler(t *testing.T) {
+	dummyUser := domain.User{
+		ID:        10,
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "johndoe@example.com",
+		Password:  "samplepassword",
+	}
+	wantResponse := handler.UserResponse{
+		ID:        dummyUser.ID,
+		FirstName: dummyUser.FirstName,
+		LastName:  dummyUser.LastName,
+		Email:     dummyUser.Email,
+	}
+
+	t.Run("returns current user on GET", func(t *testing.T) {
+		wantJWT := "sampleToken"
+
+		request, _ := http.NewRequest(http.MethodGet, "/user/me", nil)
+		request.Header.Add("Token", wantJWT)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyUser: dummyUser}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+		assert.Equal(t, userService.spyJWT, wantJWT)
+
+		var gotResponse handler.UserResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse, wantResponse)
+	})
+
+	t.Run("passes request context to service", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/user/me", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyUser: dummyUser}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+
+		cancel()
+		assert.Equal(t, userService.spyCtx.Err(), context.Canceled)
+	})
+
+	t.Run("updates user on PATCH", func(t *testing.T) {
+		updateRequest := handler.UpdateUserRequest{
+			FirstName: "Jane",
+			Email:     "janedoe@example.com",
+			Password:  "samplepassword",
+			Code:      "123456",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(updateRequest)
+
+		request, _ := http.NewRequest(http.MethodPatch, "/user/me", reqBody)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyUser: dummyUser}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		wantUpdate := domain.User{
+			FirstName: updateRequest.FirstName,
+			Email:     updateRequest.Email,
+			Password:  updateRequest.Password,
+		}
+		assert.Equal(t, userService.spyUser, wantUpdate)
+		assert.Equal(t, userService.spyCode, updateRequest.Code)
+	})
+
+	t.Run("returns Conflict on ErrEmailTaken", func(t *testing.T) {
+		updateRequest := handler.UpdateUserRequest{
+			Email:    "janedoe@example.com",
+			Password: "samplepassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(updateRequest)
+
+		request, _ := http.NewRequest(http.MethodPatch, "/user/me", reqBody)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrEmailTaken}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusConflict)
+	})
+
+	t.Run("deletes user on DELETE", func(t *testing.T) {
+		wantJWT := "sampleToken"
+
+		request, _ := http.NewRequest(http.MethodDelete, "/user/me", nil)
+		request.Header.Add("Token", wantJWT)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNoContent)
+		assert.Equal(t, userService.spyJWT, wantJWT)
+	})
+
+	t.Run("returns Bad Request on missing JWT", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/me", nil)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns Unauthorized on invalid JWT", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/me", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrInvalidJWT}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("returns Service Unavailable on transient database error", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/me", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		dummyErr := service.NewUserServiceError("couldn't get session",
+			&repository.TransientError{Err: errors.New("connection reset by peer")})
+		userService := &StubUserService{dummyErr: dummyErr}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusServiceUnavailable)
+	})
+
+	t.Run("returns Method Not Allowed on POST", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/user/me", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusMethodNotAllowed)
+	})
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	t.Run("calls UserService.ChangePassword", func(t *testing.T) {
+		wantJWT := "sampleToken"
+		changeRequest := handler.ChangePasswordRequest{
+			OldPassword: "oldpassword",
+			NewPassword: "newpassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(changeRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/password", reqBody)
+		request.Header.Add("Token", wantJWT)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ChangePassword(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, userService.spyJWT, wantJWT)
+		assert.Equal(t, userService.spyPasswords, [2]string{changeRequest.OldPassword, changeRequest.NewPassword})
+	})
+
+	t.Run("returns Forbidden on ErrWrongPassword", func(t *testing.T) {
+		changeRequest := handler.ChangePasswordRequest{
+			OldPassword: "wrongpassword",
+			NewPassword: "newpassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(changeRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/password", reqBody)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrWrongPassword}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ChangePassword(response, request)
+		assert.Equal(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("returns Bad Request on missing request body", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/user/password", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ChangePassword(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func TestSetRolesHandler(t *testing.T) {
+	t.Run("calls UserService.SetRoles", func(t *testing.T) {
+		wantJWT := "sampleToken"
+		rolesRequest := handler.SetRolesRequest{
+			UserID: 20,
+			Roles:  []string{domain.RolePlayer, domain.RoleSupport},
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(rolesRequest)
+
+		request, _ := http.NewRequest(http.MethodPut, "/user/roles", reqBody)
+		request.Header.Add("Token", wantJWT)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyUser: domain.User{ID: 20, Roles: rolesRequest.Roles}}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, userService.spyJWT, wantJWT)
+		assert.Equal(t, userService.spyUserID, rolesRequest.UserID)
+		assert.Equal(t, userService.spyRoles, rolesRequest.Roles)
+
+		var gotResponse handler.UserResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Roles, rolesRequest.Roles)
+	})
+
+	t.Run("returns Forbidden on ErrPermissionDenied", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.SetRolesRequest{UserID: 20, Roles: []string{domain.RoleAdmin}})
+
+		request, _ := http.NewRequest(http.MethodPut, "/user/roles", reqBody)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrPermissionDenied}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusForbidden)
+
+		var gotResponse apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Code, apierror.CodePermissionDenied)
+	})
+
+	t.Run("returns Unprocessable Entity on unknown role", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.SetRolesRequest{UserID: 20, Roles: []string{"superuser"}})
+
+		request, _ := http.NewRequest(http.MethodPut, "/user/roles", reqBody)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+		assert.Equal(t, userService.spyJWT, "")
+	})
+}
+
+func TestServiceAccountsHandler(t *testing.T) {
+	t.Run("creates service account", func(t *testing.T) {
+		wantJWT := "sampleToken"
+		wantAccount := domain.ServiceAccount{ID: 5, Name: "game-provider"}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.CreateServiceAccountRequest{Name: wantAccount.Name})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/service-accounts", reqBody)
+		request.Header.Add("Token", wantJWT)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyAccount: wantAccount}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusCreated)
+
+		assert.Equal(t, userService.spyJWT, wantJWT)
+		assert.Equal(t, userService.spyName, wantAccount.Name)
+
+		var gotResponse handler.ServiceAccountResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.ID, wantAccount.ID)
+		assert.Equal(t, gotResponse.Name, wantAccount.Name)
+	})
+
+	t.Run("deletes service account", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/user/service-accounts?id=5", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNoContent)
+
+		assert.Equal(t, userService.spyUserID, 5)
+	})
+
+	t.Run("returns key only on creation", func(t *testing.T) {
+		wantKey := "ek_sampleKey"
+		keyRequest := handler.CreateAPIKeyRequest{
+			ServiceAccountID: 5,
+			Scopes:           []string{domain.RoleFinance},
+			ExpiresInDays:    30,
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(keyRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/service-accounts/keys", reqBody)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{
+			dummyKey:    wantKey,
+			dummyAPIKey: domain.APIKey{ID: "sampleKeyID", ServiceAccountID: 5, KeyHash: "sampleHash", Prefix: "ek_sampl"},
+		}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusCreated)
+
+		assert.Equal(t, userService.spyUserID, keyRequest.ServiceAccountID)
+		assert.Equal(t, userService.spyRoles, keyRequest.Scopes)
+		assert.Equal(t, userService.spyLifetime, 30*24*time.Hour)
+
+		var gotResponse handler.CreateAPIKeyResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Key, wantKey)
+		assert.Equal(t, gotResponse.APIKey.ID, "sampleKeyID")
+		assert.Equal(t, gotResponse.APIKey.Prefix, "ek_sampl")
+	})
+
+	t.Run("revokes API key", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/user/service-accounts/keys?service_account_id=5&id=sampleKeyID", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNoContent)
+
+		assert.Equal(t, userService.spyUserID, 5)
+		assert.Equal(t, userService.spyToken, "sampleKeyID")
+	})
+
+	t.Run("returns Bad Request on missing API key ID", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/user/service-accounts/keys?service_account_id=5", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+
+		var gotResponse apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Code, handler.CodeMissingAPIKeyID)
+	})
+
+	t.Run("returns Not Found on ErrServiceAccountNotFound", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/service-accounts/keys?service_account_id=99", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrServiceAccountNotFound}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("returns Unprocessable Entity on too long key lifetime", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.CreateAPIKeyRequest{ServiceAccountID: 5, ExpiresInDays: 400})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/service-accounts/keys", reqBody)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+		assert.Equal(t, userService.spyJWT, "")
+	})
+}
+
+func TestEmailVerificationHandler(t *testing.T) {
+	t.Run("verifies email with token from link", func(t *testing.T) {
+		wantToken := "sampleActionToken"
+
+		request, _ := http.NewRequest(http.MethodGet, "/user/email/verify?token="+wantToken, nil)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNoContent)
+
+		assert.Equal(t, userService.spyToken, wantToken)
+	})
+
+	t.Run("verifies email with token from body", func(t *testing.T) {
+		wantToken := "sampleActionToken"
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.VerifyEmailRequest{Token: wantToken})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/email/verify", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNoContent)
+
+		assert.Equal(t, userService.spyToken, wantToken)
+	})
+
+	t.Run("returns Bad Request on ErrInvalidActionToken", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/email/verify?token=usedToken", nil)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrInvalidActionToken}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("resends verification email", func(t *testing.T) {
+		wantJWT := "sampleToken"
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/email/verify/resend", nil)
+		request.Header.Add("Token", wantJWT)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusAccepted)
+
+		assert.Equal(t, userService.spyJWT, wantJWT)
+	})
+
+	t.Run("returns Conflict on ErrEmailAlreadyVerified", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/user/email/verify/resend", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrEmailAlreadyVerified}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusConflict)
+	})
+}
+
+func TestPasswordResetHandler(t *testing.T) {
+	t.Run("requests password reset", func(t *testing.T) {
+		wantEmail := "john@example.com"
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.PasswordResetRequest{Email: wantEmail})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/password/forgot", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusAccepted)
+
+		assert.Equal(t, userService.spyEmail, wantEmail)
+	})
+
+	t.Run("resets password", func(t *testing.T) {
+		resetRequest := handler.ResetPasswordRequest{
+			Token:       "sampleActionToken",
+			NewPassword: "newpassword",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(resetRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/password/reset", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNoContent)
+
+		assert.Equal(t, userService.spyToken, resetRequest.Token)
+		assert.Equal(t, userService.spyPasswords[1], resetRequest.NewPassword)
+	})
+
+	t.Run("returns Bad Request on missing token", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.ResetPasswordRequest{NewPassword: "newpassword"})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/password/reset", reqBody)
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns Method Not Allowed on GET", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/password/reset", nil)
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusMethodNotAllowed)
+	})
+}
+
+func TestMFAHandler(t *testing.T) {
+	t.Run("completes MFA login", func(t *testing.T) {
+		wantResponse := handler.JWTResponse{
+			Token:        "sampleToken",
+			RefreshToken: "sampleRefreshToken",
+		}
+		mfaRequest := handler.MFALoginRequest{
+			MFAToken: "sampleMFAToken",
+			Code:     "123456",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(mfaRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/login/mfa", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{
+			dummyJWT:          wantResponse.Token,
+			dummyRefreshToken: wantResponse.RefreshToken,
+		}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		var gotResponse handler.JWTResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse, wantResponse)
+		assert.Equal(t, userService.spyToken, mfaRequest.MFAToken)
+		assert.Equal(t, userService.spyCode, mfaRequest.Code)
+	})
+
+	t.Run("returns Unauthorized on ErrInvalidMFACode at login", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.MFALoginRequest{MFAToken: "sampleMFAToken", Code: "000000"})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/login/mfa", reqBody)
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{dummyErr: service.ErrInvalidMFACode}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("returns enrollment", func(t *testing.T) {
+		wantResponse := handler.MFAEnrollmentResponse{
+			Secret:          "JBSWY3DPEHPK3PXP",
+			ProvisioningURI: "otpauth://totp/Elysium:johndoe@example.com?secret=JBSWY3DPEHPK3PXP",
+		}
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/mfa/enroll", nil)
+		request.Header.Set("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyEnrollment: service.MFAEnrollment{
+			Secret:          wantResponse.Secret,
+			ProvisioningURI: wantResponse.ProvisioningURI,
+		}}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		var gotResponse handler.MFAEnrollmentResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse, wantResponse)
+		assert.Equal(t, userService.spyJWT, "sampleToken")
+	})
+
+	t.Run("returns Conflict on ErrMFAAlreadyEnabled", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/user/mfa/enroll", nil)
+		request.Header.Set("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{dummyErr: service.ErrMFAAlreadyEnabled}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusConflict)
+	})
+
+	t.Run("returns recovery codes on confirmation", func(t *testing.T) {
+		wantCodes := []string{"abcde-fghij", "klmno-pqrst"}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.MFACodeRequest{Code: "123456"})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/mfa/confirm", reqBody)
+		request.Header.Set("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyRecoveryCodes: wantCodes}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		var gotResponse handler.RecoveryCodesResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.RecoveryCodes, wantCodes)
+		assert.Equal(t, userService.spyCode, "123456")
+	})
+
+	t.Run("disables MFA", func(t *testing.T) {
+		reauthRequest := handler.MFAReauthRequest{Password: "samplepassword", Code: "123456"}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(reauthRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/mfa/disable", reqBody)
+		request.Header.Set("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNoContent)
+
+		assert.Equal(t, userService.spyPasswords[0], reauthRequest.Password)
+		assert.Equal(t, userService.spyCode, reauthRequest.Code)
+	})
+
+	t.Run("returns Forbidden on ErrInvalidMFACode at re-authentication", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.MFAReauthRequest{Password: "samplepassword", Code: "000000"})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/mfa/recovery-codes", reqBody)
+		request.Header.Set("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{dummyErr: service.ErrInvalidMFACode}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("returns Bad Request on missing token", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/user/mfa/enroll", nil)
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func TestSessionsHandler(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dummySessions := []domain.Session{
+		{
+			ID:         "firstSession",
+			UserID:     10,
+			CreatedAt:  createdAt,
+			LastSeenAt: createdAt.Add(time.Hour),
+			ExpiresAt:  createdAt.Add(720 * time.Hour),
+			UserAgent:  "firstAgent",
+			IP:         "203.0.113.7",
+		},
+		{
+			ID:         "secondSession",
+			UserID:     10,
+			CreatedAt:  createdAt,
+			LastSeenAt: createdAt,
+			ExpiresAt:  createdAt.Add(720 * time.Hour),
+			UserAgent:  "secondAgent",
+			IP:         "198.51.100.4",
+		},
+	}
+
+	t.Run("lists sessions and marks the current one", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/sessions", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{
+			dummySessions:  dummySessions,
+			dummyCurrentID: "secondSession",
+		}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		var gotResponse []handler.SessionResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		wantResponse := []handler.SessionResponse{
+			{
+				ID:         "firstSession",
+				UserAgent:  "firstAgent",
+				IP:         "203.0.113.7",
+				CreatedAt:  dummySessions[0].CreatedAt,
+				LastSeenAt: dummySessions[0].LastSeenAt,
+				ExpiresAt:  dummySessions[0].ExpiresAt,
+			},
+			{
+				ID:         "secondSession",
+				UserAgent:  "secondAgent",
+				IP:         "198.51.100.4",
+				CreatedAt:  dummySessions[1].CreatedAt,
+				LastSeenAt: dummySessions[1].LastSeenAt,
+				ExpiresAt:  dummySessions[1].ExpiresAt,
+				Current:    true,
+			},
+		}
+		assert.Equal(t, gotResponse, wantResponse)
+	})
+
+	t.Run("revokes session on DELETE", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/user/sessions?id=firstSession", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNoContent)
+		assert.Equal(t, userService.spySession, "firstSession")
+	})
+
+	t.Run("returns Bad Request on missing session ID", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/user/sessions", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns Not Found on ErrSessionNotFound", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/user/sessions?id=otherSession", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrSessionNotFound}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("revokes other sessions", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/user/sessions/others", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyRevoked: 3}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		var gotResponse handler.RevokeSessionsResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Revoked, 3)
+	})
+
+	t.Run("returns Unauthorized on invalid JWT", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/sessions", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrInvalidJWT}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+}
+
+func TestAuditEventsHandler(t *testing.T) {
+	t.Run("lists audit events with filter", func(t *testing.T) {
+		eventTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		request, _ := http.NewRequest(http.MethodGet,
+			"/user/audit?actor_id=10&type=login&result=failure&since=2024-03-01T00:00:00Z&before=42&limit=20", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{
+			dummyEvents: []audit.Event{
+				{ID: 41, Type: audit.EventLogin, ActorID: 10, IP: "203.0.113.7", Result: audit.ResultFailure, Time: eventTime},
+			},
+			dummyNextBefore: 41,
+		}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, userService.spyJWT, "sampleToken")
+		assert.Equal(t, userService.spyFilter, audit.Filter{
+			ActorID: 10,
+			Type:    audit.EventLogin,
+			Result:  audit.ResultFailure,
+			Since:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			Before:  42,
+			Limit:   20,
+		})
+
+		var gotResponse handler.AuditEventsResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, len(gotResponse.Events), 1)
+		assert.Equal(t, gotResponse.Events[0].ID, int64(41))
+		assert.Equal(t, gotResponse.Events[0].IP, "203.0.113.7")
+		assert.Equal(t, gotResponse.Events[0].Time, eventTime)
+		assert.Equal(t, gotResponse.NextBefore, int64(41))
+	})
+
+	t.Run("returns Bad Request on malformed query", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/audit?since=yesterday", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+
+		var gotError apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotError)
+		assert.Equal(t, gotError.Code, handler.CodeInvalidAuditQuery)
+	})
+
+	t.Run("returns Forbidden for non-admin", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/user/audit", nil)
+		request.Header.Add("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{dummyErr: service.ErrPermissionDenied}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusForbidden)
+	})
+}
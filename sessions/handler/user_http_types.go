@@ -1,10 +1,12 @@
 package handler
 
-import "github.com/VitoNaychev/elysium-challenge/sessions/domain"
+import (
+	"time"
 
-type ErrorResponse struct {
-	Message string `json:"message"`
-}
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+)
 
 type LoginRequest struct {
 	Email    string `json:"email"`
@@ -16,31 +18,47 @@ type SignUpResponse struct {
 	User UserResponse `json:"user"`
 }
 
-func userToSignUpResponse(u domain.User) SignUpResponse {
+func userToSignUpResponse(u domain.User, tokens service.Tokens) SignUpResponse {
 	return SignUpResponse{
-		JWT: JWTResponse{
-			Token: u.JWTs[0],
-		},
-		User: UserResponse{
-			ID:        u.ID,
-			FirstName: u.FirstName,
-			LastName:  u.LastName,
-			Email:     u.Email,
-			Password:  u.Password,
-		},
+		JWT:  tokensToJWTResponse(tokens),
+		User: userToUserResponse(u),
 	}
 }
 
 type JWTResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func tokensToJWTResponse(tokens service.Tokens) JWTResponse {
+	return JWTResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type UserResponse struct {
-	ID        int    `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
+	ID            int      `json:"id"`
+	FirstName     string   `json:"first_name"`
+	LastName      string   `json:"last_name"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Roles         []string `json:"roles"`
+}
+
+func userToUserResponse(u domain.User) UserResponse {
+	return UserResponse{
+		ID:            u.ID,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Roles:         u.Roles,
+	}
 }
 
 type SignUpRequest struct {
@@ -58,3 +76,207 @@ func signUpRequestToUser(r SignUpRequest) domain.User {
 		Password:  r.Password,
 	}
 }
+
+// UpdateUserRequest needs Password, and Code if the user has MFA enabled,
+// only to change the email.
+type UpdateUserRequest struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Code      string `json:"code"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// SetRolesRequest replaces all roles of the user, roles that aren't listed
+// are taken away.
+type SetRolesRequest struct {
+	UserID int      `json:"user_id"`
+	Roles  []string `json:"roles"`
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func sessionsToSessionResponses(sessions []domain.Session, currentID string) []SessionResponse {
+	responses := make([]SessionResponse, len(sessions))
+	for i, s := range sessions {
+		responses[i] = SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == currentID,
+		}
+	}
+	return responses
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// MFAChallengeResponse is what login answers with when the user has
+// two-factor authentication enabled.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MFAEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFAReauthRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name string `json:"name"`
+}
+
+type ServiceAccountResponse struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func serviceAccountToResponse(a domain.ServiceAccount) ServiceAccountResponse {
+	return ServiceAccountResponse{
+		ID:        a.ID,
+		Name:      a.Name,
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+func serviceAccountsToResponses(accounts []domain.ServiceAccount) []ServiceAccountResponse {
+	responses := make([]ServiceAccountResponse, len(accounts))
+	for i, a := range accounts {
+		responses[i] = serviceAccountToResponse(a)
+	}
+	return responses
+}
+
+// CreateAPIKeyRequest leaves ExpiresInDays at zero for the default lifetime.
+type CreateAPIKeyRequest struct {
+	ServiceAccountID int      `json:"service_account_id"`
+	Scopes           []string `json:"scopes"`
+	ExpiresInDays    int      `json:"expires_in_days"`
+}
+
+type APIKeyResponse struct {
+	ID               string    `json:"id"`
+	ServiceAccountID int       `json:"service_account_id"`
+	Prefix           string    `json:"prefix"`
+	Scopes           []string  `json:"scopes"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	Revoked          bool      `json:"revoked"`
+}
+
+func apiKeyToResponse(k domain.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:               k.ID,
+		ServiceAccountID: k.ServiceAccountID,
+		Prefix:           k.Prefix,
+		Scopes:           k.Scopes,
+		CreatedAt:        k.CreatedAt,
+		ExpiresAt:        k.ExpiresAt,
+		Revoked:          k.Revoked,
+	}
+}
+
+func apiKeysToResponses(keys []domain.APIKey) []APIKeyResponse {
+	responses := make([]APIKeyResponse, len(keys))
+	for i, k := range keys {
+		responses[i] = apiKeyToResponse(k)
+	}
+	return responses
+}
+
+// CreateAPIKeyResponse is the only time the key itself is shown.
+type CreateAPIKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey APIKeyResponse `json:"api_key"`
+}
+
+type AuditEventResponse struct {
+	ID        int64           `json:"id"`
+	Type      audit.EventType `json:"type"`
+	ActorID   int             `json:"actor_id"`
+	Email     string          `json:"email"`
+	Target    string          `json:"target"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Result    audit.Result    `json:"result"`
+	Time      time.Time       `json:"time"`
+
+	ActorServiceAccountID int `json:"actor_service_account_id,omitempty"`
+}
+
+func auditEventsToResponses(events []audit.Event) []AuditEventResponse {
+	responses := make([]AuditEventResponse, len(events))
+	for i, e := range events {
+		responses[i] = AuditEventResponse{
+			ID:        e.ID,
+			Type:      e.Type,
+			ActorID:   e.ActorID,
+			Email:     e.Email,
+			Target:    e.Target,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			Result:    e.Result,
+			Time:      e.Time,
+
+			ActorServiceAccountID: e.ActorServiceAccountID,
+		}
+	}
+	return responses
+}
+
+// AuditEventsResponse leaves out NextBefore on the last page.
+type AuditEventsResponse struct {
+	Events     []AuditEventResponse `json:"events"`
+	NextBefore int64                `json:"next_before,omitempty"`
+}
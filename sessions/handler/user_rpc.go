@@ -2,10 +2,14 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"math"
+	"net/http"
 
 	"github.com/VitoNaychev/elysium-challenge/rpc/sessions"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type UserRPCHandler struct {
@@ -21,9 +25,174 @@ func NewUserRPCHandler(userService UserService) *UserRPCHandler {
 }
 
 func (u *UserRPCHandler) Authenticate(ctx context.Context, r *sessions.AuthenticateRequest) (*sessions.AuthenticateResponse, error) {
-	id, err := u.userService.Authenticate(r.Token)
+	principal, err := u.userService.Authenticate(ctx, r.Token)
 	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, err.Error())
+		// only rejections of the token are Unauthenticated, the gateway
+		// remembers those as revoked sessions
+		return nil, userErrors.Map(err)
+	}
+
+	return &sessions.AuthenticateResponse{
+		Id:               int64(principal.UserID),
+		EmailVerified:    principal.EmailVerified,
+		Roles:            principal.Roles,
+		Kind:             principalKind(principal),
+		ServiceAccountId: int64(principal.ServiceAccountID),
+	}, nil
+}
+
+func (u *UserRPCHandler) Introspect(ctx context.Context, r *sessions.IntrospectRequest) (*sessions.IntrospectResponse, error) {
+	introspection, err := u.userService.Introspect(ctx, r.Token)
+	if err != nil {
+		return nil, mapUserError(err, http.StatusInternalServerError)
+	}
+
+	if !introspection.Active {
+		return &sessions.IntrospectResponse{Active: false}, nil
+	}
+
+	subject := introspection.UserID
+	if introspection.Kind == service.PrincipalServiceAccount {
+		subject = introspection.ServiceAccountID
+	}
+
+	return &sessions.IntrospectResponse{
+		Active:        true,
+		Kind:          principalKind(introspection.Principal),
+		Subject:       int64(subject),
+		ExpiresAt:     timestamppb.New(introspection.ExpiresAt),
+		SessionId:     introspection.SessionID,
+		Scopes:        introspection.Roles,
+		EmailVerified: introspection.EmailVerified,
+	}, nil
+}
+
+func (u *UserRPCHandler) GetUser(ctx context.Context, r *sessions.GetUserRequest) (*sessions.GetUserResponse, error) {
+	id, err := parseUserID(r.Id)
+	if err != nil {
+		return nil, mapUserError(err, http.StatusBadRequest)
+	}
+
+	user, err := u.userService.LookupUser(ctx, id)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, mapUserError(err, http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, mapUserError(err, http.StatusInternalServerError)
+	}
+
+	return &sessions.GetUserResponse{User: userToProfile(user)}, nil
+}
+
+func (u *UserRPCHandler) BatchGetUsers(ctx context.Context, r *sessions.BatchGetUsersRequest) (*sessions.BatchGetUsersResponse, error) {
+	ids := make([]int, len(r.Ids))
+	for i, id := range r.Ids {
+		var err error
+		if ids[i], err = parseUserID(id); err != nil {
+			return nil, mapUserError(err, http.StatusBadRequest)
+		}
+	}
+
+	users, err := u.userService.LookupUsers(ctx, ids)
+	if errors.Is(err, service.ErrTooManyUsers) {
+		return nil, mapUserError(err, http.StatusBadRequest)
+	}
+	if err != nil {
+		return nil, mapUserError(err, http.StatusInternalServerError)
+	}
+
+	response := &sessions.BatchGetUsersResponse{
+		Users: make([]*sessions.UserProfile, len(users)),
+	}
+	for i, user := range users {
+		response.Users[i] = userToProfile(user)
+	}
+
+	return response, nil
+}
+
+func (u *UserRPCHandler) ListSessions(ctx context.Context, r *sessions.ListSessionsRequest) (*sessions.ListSessionsResponse, error) {
+	userID, err := parseUserID(r.UserId)
+	if err != nil {
+		return nil, mapUserError(err, http.StatusBadRequest)
+	}
+
+	userSessions, err := u.userService.ListUserSessions(ctx, userID)
+	if err != nil {
+		return nil, mapUserError(err, http.StatusInternalServerError)
+	}
+
+	response := &sessions.ListSessionsResponse{
+		Sessions: make([]*sessions.Session, len(userSessions)),
+	}
+	for i, s := range userSessions {
+		response.Sessions[i] = &sessions.Session{
+			Id:         s.ID,
+			CreatedAt:  timestamppb.New(s.CreatedAt),
+			LastSeenAt: timestamppb.New(s.LastSeenAt),
+			ExpiresAt:  timestamppb.New(s.ExpiresAt),
+			UserAgent:  s.UserAgent,
+			Ip:         s.IP,
+		}
+	}
+
+	return response, nil
+}
+
+func (u *UserRPCHandler) RevokeSession(ctx context.Context, r *sessions.RevokeSessionRequest) (*sessions.RevokeSessionResponse, error) {
+	userID, err := parseUserID(r.UserId)
+	if err != nil {
+		return nil, mapUserError(err, http.StatusBadRequest)
+	}
+
+	err = u.userService.RevokeUserSession(ctx, userID, r.SessionId, rpcActor(ctx))
+	if errors.Is(err, service.ErrSessionNotFound) {
+		return nil, mapUserError(err, http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, mapUserError(err, http.StatusInternalServerError)
+	}
+
+	return &sessions.RevokeSessionResponse{}, nil
+}
+
+func (u *UserRPCHandler) RevokeAllSessions(ctx context.Context, r *sessions.RevokeAllSessionsRequest) (*sessions.RevokeAllSessionsResponse, error) {
+	userID, err := parseUserID(r.UserId)
+	if err != nil {
+		return nil, mapUserError(err, http.StatusBadRequest)
+	}
+
+	revoked, err := u.userService.RevokeAllUserSessions(ctx, userID, rpcActor(ctx))
+	if err != nil {
+		return nil, mapUserError(err, http.StatusInternalServerError)
+	}
+
+	return &sessions.RevokeAllSessionsResponse{Revoked: int32(revoked)}, nil
+}
+
+// parseUserID converts an ID off the wire, rejecting those no user can have
+// instead of letting them wrap around on 32-bit builds.
+func parseUserID(id int64) (int, error) {
+	if id <= 0 || id > math.MaxInt {
+		return 0, ErrInvalidUserID
+	}
+	return int(id), nil
+}
+
+func principalKind(principal service.Principal) sessions.PrincipalKind {
+	if principal.Kind == service.PrincipalServiceAccount {
+		return sessions.PrincipalKind_PRINCIPAL_KIND_SERVICE_ACCOUNT
+	}
+	return sessions.PrincipalKind_PRINCIPAL_KIND_USER
+}
+
+func userToProfile(user domain.User) *sessions.UserProfile {
+	return &sessions.UserProfile{
+		Id:            int64(user.ID),
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Roles:         user.Roles,
 	}
-	return &sessions.AuthenticateResponse{Id: (int32)(id)}, nil
 }
@@ -2,14 +2,24 @@ package handler_test
 
 import (
 	"context"
+	"errors"
+	"net"
+	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/VitoNaychev/elysium-challenge/apierror"
 	"github.com/VitoNaychev/elysium-challenge/assert"
 	"github.com/VitoNaychev/elysium-challenge/rpc/sessions"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
 	"github.com/VitoNaychev/elysium-challenge/sessions/handler"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
 	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
@@ -21,15 +31,53 @@ func TestAuthenticateRPC(t *testing.T) {
 		request := &sessions.AuthenticateRequest{Token: dummyJWT}
 
 		userService := StubUserService{
-			dummyUserID: wantUserID,
-			dummyJWT:    dummyJWT,
+			dummyUserID:        wantUserID,
+			dummyJWT:           dummyJWT,
+			dummyEmailVerified: true,
+			dummyRoles:         []string{domain.RolePlayer, domain.RoleFinance},
 		}
 		userHandler := handler.NewUserRPCHandler(&userService)
 
 		response, err := userHandler.Authenticate(context.Background(), request)
 		assert.RequireNoError(t, err)
 
-		assert.Equal(t, response.Id, int32(wantUserID))
+		assert.Equal(t, response.Id, int64(wantUserID))
+		assert.Equal(t, response.EmailVerified, true)
+		assert.Equal(t, response.Roles, []string{domain.RolePlayer, domain.RoleFinance})
+		assert.Equal(t, response.Kind, sessions.PrincipalKind_PRINCIPAL_KIND_USER)
+	})
+
+	t.Run("passes incoming context to service", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		userService := StubUserService{}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		_, err := userHandler.Authenticate(ctx, &sessions.AuthenticateRequest{Token: "sampleToken"})
+		assert.RequireNoError(t, err)
+
+		cancel()
+		assert.Equal(t, userService.spyCtx.Err(), context.Canceled)
+	})
+
+	t.Run("returns service account ID on valid API key", func(t *testing.T) {
+		request := &sessions.AuthenticateRequest{Token: "ek_sampleKey"}
+
+		userService := StubUserService{
+			dummyKind:    service.PrincipalServiceAccount,
+			dummyAccount: domain.ServiceAccount{ID: 5},
+			dummyRoles:   []string{domain.RoleFinance},
+		}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		response, err := userHandler.Authenticate(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, response.Kind, sessions.PrincipalKind_PRINCIPAL_KIND_SERVICE_ACCOUNT)
+		assert.Equal(t, response.ServiceAccountId, int64(5))
+		assert.Equal(t, response.Id, int64(0))
+		assert.Equal(t, response.Roles, []string{domain.RoleFinance})
 	})
 
 	t.Run("returns Unauthenticated on invalid JWT", func(t *testing.T) {
@@ -52,5 +100,351 @@ func TestAuthenticateRPC(t *testing.T) {
 		}
 
 		assert.Equal(t, statusError.Code(), codes.Unauthenticated)
+
+		apiErr, _ := apierror.FromGRPC(err)
+		assert.Equal(t, apiErr.Code, apierror.CodeInvalidToken)
+		assert.Equal(t, apiErr.Status, http.StatusUnauthorized)
+	})
+
+	t.Run("returns Unauthenticated on revoked session", func(t *testing.T) {
+		userService := StubUserService{dummyErr: service.ErrSessionNotFound}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		_, err := userHandler.Authenticate(context.Background(), &sessions.AuthenticateRequest{Token: "sampleToken"})
+		assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	})
+
+	t.Run("returns Internal on error that isn't a rejection", func(t *testing.T) {
+		dummyErr := service.NewUserServiceError("couldn't get session", errors.New("relation \"sessions\" does not exist"))
+
+		userService := StubUserService{dummyErr: dummyErr}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		_, err := userHandler.Authenticate(context.Background(), &sessions.AuthenticateRequest{Token: "sampleToken"})
+		assert.Equal(t, status.Code(err), codes.Internal)
+	})
+
+	t.Run("returns Unavailable on transient database error", func(t *testing.T) {
+		dummyErr := service.NewUserServiceError("couldn't get session",
+			&repository.TransientError{Err: errors.New("connection reset by peer")})
+
+		userService := StubUserService{dummyErr: dummyErr}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		_, err := userHandler.Authenticate(context.Background(), &sessions.AuthenticateRequest{Token: "sampleToken"})
+
+		statusError, ok := status.FromError(err)
+		if !ok {
+			t.Fatalf("expected status.Error, got %v", reflect.TypeOf(err))
+		}
+
+		assert.Equal(t, statusError.Code(), codes.Unavailable)
+
+		apiErr, _ := apierror.FromGRPC(err)
+		assert.Equal(t, apiErr.Code, apierror.CodeUnavailable)
+	})
+}
+
+func TestIntrospectRPC(t *testing.T) {
+	t.Run("describes active user token", func(t *testing.T) {
+		expiresAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		userService := StubUserService{
+			dummyIntrospection: service.Introspection{
+				Active: true,
+				Principal: service.Principal{
+					Kind:          service.PrincipalUser,
+					UserID:        10,
+					EmailVerified: true,
+					Roles:         []string{domain.RolePlayer},
+				},
+				SessionID: "sampleSession",
+				ExpiresAt: expiresAt,
+			},
+		}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.IntrospectRequest{Token: "sampleToken"}
+		response, err := userHandler.Introspect(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, userService.spyToken, "sampleToken")
+		assert.Equal(t, response.Active, true)
+		assert.Equal(t, response.Kind, sessions.PrincipalKind_PRINCIPAL_KIND_USER)
+		assert.Equal(t, response.Subject, int64(10))
+		assert.Equal(t, response.SessionId, "sampleSession")
+		assert.Equal(t, response.ExpiresAt.AsTime(), expiresAt)
+		assert.Equal(t, response.Scopes, []string{domain.RolePlayer})
+		assert.Equal(t, response.EmailVerified, true)
+	})
+
+	t.Run("uses service account ID as subject of API key", func(t *testing.T) {
+		userService := StubUserService{
+			dummyIntrospection: service.Introspection{
+				Active: true,
+				Principal: service.Principal{
+					Kind:             service.PrincipalServiceAccount,
+					ServiceAccountID: 5,
+					Roles:            []string{domain.RoleFinance},
+				},
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+		}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.IntrospectRequest{Token: "ek_sampleKey"}
+		response, err := userHandler.Introspect(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, response.Kind, sessions.PrincipalKind_PRINCIPAL_KIND_SERVICE_ACCOUNT)
+		assert.Equal(t, response.Subject, int64(5))
+		assert.Equal(t, response.Scopes, []string{domain.RoleFinance})
+	})
+
+	t.Run("reports inactive token without error", func(t *testing.T) {
+		userService := StubUserService{}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.IntrospectRequest{Token: "sampleToken"}
+		response, err := userHandler.Introspect(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, response.Active, false)
+		assert.Equal(t, response.Subject, int64(0))
+		assert.Equal(t, response.ExpiresAt == nil, true)
+	})
+}
+
+func TestUserLookupRPC(t *testing.T) {
+	t.Run("gets user by ID", func(t *testing.T) {
+		userService := StubUserService{
+			dummyUser: domain.User{
+				ID:            10,
+				FirstName:     "Vito",
+				LastName:      "Naychev",
+				Email:         "vito@example.com",
+				Password:      "sampleHash",
+				EmailVerified: true,
+				Roles:         []string{domain.RolePlayer},
+			},
+		}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.GetUserRequest{Id: 10}
+		response, err := userHandler.GetUser(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, userService.spyUserID, 10)
+		assert.Equal(t, response.User.Id, int64(10))
+		assert.Equal(t, response.User.Email, "vito@example.com")
+		assert.Equal(t, response.User.EmailVerified, true)
+		assert.Equal(t, response.User.Roles, []string{domain.RolePlayer})
+	})
+
+	t.Run("returns NotFound on ErrUserNotFound", func(t *testing.T) {
+		userService := StubUserService{dummyErr: service.ErrUserNotFound}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.GetUserRequest{Id: 10}
+		_, err := userHandler.GetUser(context.Background(), request)
+
+		assert.Equal(t, status.Code(err), codes.NotFound)
 	})
+
+	t.Run("returns InvalidArgument on ID no user can have", func(t *testing.T) {
+		userService := StubUserService{}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		for _, id := range []int64{0, -1} {
+			_, err := userHandler.GetUser(context.Background(), &sessions.GetUserRequest{Id: id})
+			assert.Equal(t, status.Code(err), codes.InvalidArgument)
+
+			_, err = userHandler.BatchGetUsers(context.Background(), &sessions.BatchGetUsersRequest{Ids: []int64{1, id}})
+			assert.Equal(t, status.Code(err), codes.InvalidArgument)
+		}
+		assert.Equal(t, userService.spyUserIDs, []int(nil))
+	})
+
+	t.Run("gets users by IDs", func(t *testing.T) {
+		userService := StubUserService{
+			dummyUsers: []domain.User{{ID: 3}, {ID: 1}},
+		}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.BatchGetUsersRequest{Ids: []int64{3, 2, 1}}
+		response, err := userHandler.BatchGetUsers(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, userService.spyUserIDs, []int{3, 2, 1})
+		assert.Equal(t, len(response.Users), 2)
+		assert.Equal(t, response.Users[0].Id, int64(3))
+		assert.Equal(t, response.Users[1].Id, int64(1))
+	})
+
+	t.Run("returns InvalidArgument on ErrTooManyUsers", func(t *testing.T) {
+		userService := StubUserService{dummyErr: service.ErrTooManyUsers}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.BatchGetUsersRequest{Ids: []int64{1}}
+		_, err := userHandler.BatchGetUsers(context.Background(), request)
+
+		assert.Equal(t, status.Code(err), codes.InvalidArgument)
+
+		apiErr, _ := apierror.FromGRPC(err)
+		assert.Equal(t, apiErr.Code, handler.CodeTooManyUsers)
+	})
+}
+
+func TestSessionsRPC(t *testing.T) {
+	t.Run("lists sessions of user", func(t *testing.T) {
+		wantUserID := 10
+		createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		userService := StubUserService{
+			dummySessions: []domain.Session{
+				{
+					ID:         "sampleSession",
+					UserID:     wantUserID,
+					CreatedAt:  createdAt,
+					LastSeenAt: createdAt,
+					ExpiresAt:  createdAt.Add(time.Hour),
+					UserAgent:  "sampleAgent",
+					IP:         "203.0.113.7",
+				},
+			},
+		}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.ListSessionsRequest{UserId: int64(wantUserID)}
+		response, err := userHandler.ListSessions(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, userService.spyUserID, wantUserID)
+		assert.Equal(t, len(response.Sessions), 1)
+		assert.Equal(t, response.Sessions[0].Id, "sampleSession")
+		assert.Equal(t, response.Sessions[0].CreatedAt.AsTime(), createdAt)
+		assert.Equal(t, response.Sessions[0].Ip, "203.0.113.7")
+	})
+
+	t.Run("revokes session of user", func(t *testing.T) {
+		userService := StubUserService{}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.RevokeSessionRequest{UserId: 10, SessionId: "sampleSession"}
+		_, err := userHandler.RevokeSession(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, userService.spyUserID, 10)
+		assert.Equal(t, userService.spySession, "sampleSession")
+	})
+
+	t.Run("returns NotFound on ErrSessionNotFound", func(t *testing.T) {
+		userService := StubUserService{dummyErr: service.ErrSessionNotFound}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.RevokeSessionRequest{UserId: 10, SessionId: "sampleSession"}
+		_, err := userHandler.RevokeSession(context.Background(), request)
+
+		assert.Equal(t, status.Code(err), codes.NotFound)
+	})
+
+	t.Run("revokes all sessions of user", func(t *testing.T) {
+		userService := StubUserService{dummyRevoked: 2}
+		userHandler := handler.NewUserRPCHandler(&userService)
+
+		request := &sessions.RevokeAllSessionsRequest{UserId: 10}
+		response, err := userHandler.RevokeAllSessions(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, userService.spyUserID, 10)
+		assert.Equal(t, response.Revoked, int32(2))
+	})
+}
+
+func TestRPCCallerAuthentication(t *testing.T) {
+	revokeSession := &grpc.UnaryServerInfo{FullMethod: "/sessions.User/RevokeSession"}
+
+	callerContext := func(authorization string) context.Context {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			"authorization", authorization,
+			"user-agent", "grpc-go/1.63.2",
+		))
+		return peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 50000}})
+	}
+
+	t.Run("lets Authenticate through without API key", func(t *testing.T) {
+		userHandler := handler.NewUserRPCHandler(&StubUserService{})
+
+		called := false
+		_, err := userHandler.AuthenticateCaller(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/sessions.User/Authenticate"},
+			func(ctx context.Context, req any) (any, error) {
+				called = true
+				return nil, nil
+			})
+		assert.RequireNoError(t, err)
+		assert.Equal(t, called, true)
+	})
+
+	t.Run("returns Unauthenticated on admin RPC without API key", func(t *testing.T) {
+		userHandler := handler.NewUserRPCHandler(&StubUserService{})
+
+		_, err := userHandler.AuthenticateCaller(context.Background(), nil, revokeSession, failingUnaryHandler(t))
+		assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	})
+
+	t.Run("returns Unauthenticated on JWT instead of API key", func(t *testing.T) {
+		userService := &StubUserService{dummyUserID: 10, dummyRoles: []string{domain.RoleAdmin}}
+		userHandler := handler.NewUserRPCHandler(userService)
+
+		_, err := userHandler.AuthenticateCaller(callerContext("Bearer sampleJWT"), nil, revokeSession, failingUnaryHandler(t))
+		assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	})
+
+	t.Run("returns PermissionDenied on API key without admin or support scope", func(t *testing.T) {
+		userService := &StubUserService{
+			dummyKind:    service.PrincipalServiceAccount,
+			dummyAccount: domain.ServiceAccount{ID: 3},
+			dummyRoles:   []string{domain.RoleFinance},
+		}
+		userHandler := handler.NewUserRPCHandler(userService)
+
+		_, err := userHandler.AuthenticateCaller(callerContext("Bearer ek_sampleKey"), nil, revokeSession, failingUnaryHandler(t))
+		assert.Equal(t, status.Code(err), codes.PermissionDenied)
+	})
+
+	t.Run("returns Unavailable on transient error", func(t *testing.T) {
+		userService := &StubUserService{dummyErr: &repository.TransientError{Err: errors.New("connection refused")}}
+		userHandler := handler.NewUserRPCHandler(userService)
+
+		_, err := userHandler.AuthenticateCaller(callerContext("Bearer ek_sampleKey"), nil, revokeSession, failingUnaryHandler(t))
+		assert.Equal(t, status.Code(err), codes.Unavailable)
+	})
+
+	t.Run("passes service account of API key as actor", func(t *testing.T) {
+		userService := &StubUserService{
+			dummyKind:    service.PrincipalServiceAccount,
+			dummyAccount: domain.ServiceAccount{ID: 3},
+			dummyRoles:   []string{domain.RoleSupport},
+		}
+		userHandler := handler.NewUserRPCHandler(userService)
+
+		request := &sessions.RevokeSessionRequest{UserId: 10, SessionId: "sampleSession"}
+		_, err := userHandler.AuthenticateCaller(callerContext("Bearer ek_sampleKey"), request, revokeSession,
+			func(ctx context.Context, req any) (any, error) {
+				return userHandler.RevokeSession(ctx, req.(*sessions.RevokeSessionRequest))
+			})
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, userService.spyActor, service.Actor{
+			ServiceAccountID: 3,
+			Client:           service.ClientInfo{UserAgent: "grpc-go/1.63.2", IP: "10.0.0.5"},
+		})
+	})
+}
+
+func failingUnaryHandler(t testing.TB) grpc.UnaryHandler {
+	return func(ctx context.Context, req any) (any, error) {
+		t.Errorf("unauthenticated call got through")
+		return nil, nil
+	}
 }
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+)
+
+// Field limits match the columns of the users, service_accounts and
+// oauth_clients tables.
+const (
+	maxNameLength               = 20
+	maxEmailLength              = 60
+	maxServiceAccountNameLength = 60
+	maxOAuthClientNameLength    = 60
+)
+
+// Client limits match the user_agent and ip columns of the sessions table.
+// They aren't validated, clients don't pick them, so longer values are cut.
+const (
+	maxUserAgentLength = 255
+	maxIPLength        = 45
+)
+
+type validatable interface {
+	validate(*validator)
+}
+
+type validator struct {
+	policy crypto.PasswordPolicy
+	fields []apierror.FieldError
+}
+
+func (v *validator) fail(field, message string) {
+	v.fields = append(v.fields, apierror.FieldError{Field: field, Message: message})
+}
+
+func (v *validator) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.fail(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) name(field, value string) {
+	if value != "" && strings.TrimSpace(value) == "" {
+		v.fail(field, "must not be blank")
+	}
+	if utf8.RuneCountInString(value) > maxNameLength {
+		v.fail(field, fmt.Sprintf("must be at most %v characters long", maxNameLength))
+	}
+}
+
+func (v *validator) email(field, value string) {
+	if value == "" {
+		return
+	}
+
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		v.fail(field, "must be a valid email address")
+	}
+	if utf8.RuneCountInString(value) > maxEmailLength {
+		v.fail(field, fmt.Sprintf("must be at most %v characters long", maxEmailLength))
+	}
+}
+
+func (v *validator) roles(field string, values []string) {
+	for _, role := range values {
+		if !domain.IsRole(role) {
+			v.fail(field, fmt.Sprintf("%q is not a role", role))
+		}
+	}
+}
+
+func (v *validator) scopes(field string, values []string) {
+	for _, scope := range values {
+		if !domain.IsScope(scope) {
+			v.fail(field, fmt.Sprintf("%q is not a scope", scope))
+		}
+	}
+}
+
+func (v *validator) password(field, value string) {
+	for _, violation := range v.policy.Check(value) {
+		v.fail(field, violation)
+	}
+}
+
+func (r SignUpRequest) validate(v *validator) {
+	v.required("first_name", r.FirstName)
+	v.name("first_name", r.FirstName)
+	v.required("last_name", r.LastName)
+	v.name("last_name", r.LastName)
+	v.required("email", r.Email)
+	v.email("email", r.Email)
+	v.password("password", r.Password)
+}
+
+// validate doesn't apply the password policy on login, passwords set before
+// the policy changed have to keep working.
+func (r LoginRequest) validate(v *validator) {
+	v.required("email", r.Email)
+	v.required("password", r.Password)
+}
+
+// validate allows every field to be left out, only the ones given are
+// updated. Changing the email takes the current password.
+func (r UpdateUserRequest) validate(v *validator) {
+	v.name("first_name", r.FirstName)
+	v.name("last_name", r.LastName)
+	v.email("email", r.Email)
+	if r.Email != "" {
+		v.required("password", r.Password)
+	}
+}
+
+func (r ChangePasswordRequest) validate(v *validator) {
+	v.required("old_password", r.OldPassword)
+	v.password("new_password", r.NewPassword)
+}
+
+func (r SetRolesRequest) validate(v *validator) {
+	if r.UserID <= 0 {
+		v.fail("user_id", "is required")
+	}
+	v.roles("roles", r.Roles)
+}
+
+func (r CreateServiceAccountRequest) validate(v *validator) {
+	v.required("name", r.Name)
+	if utf8.RuneCountInString(r.Name) > maxServiceAccountNameLength {
+		v.fail("name", fmt.Sprintf("must be at most %v characters long", maxServiceAccountNameLength))
+	}
+}
+
+func (r CreateAPIKeyRequest) validate(v *validator) {
+	if r.ServiceAccountID <= 0 {
+		v.fail("service_account_id", "is required")
+	}
+	v.scopes("scopes", r.Scopes)
+
+	maxDays := int(service.MaxAPIKeyLifetime / (24 * time.Hour))
+	if r.ExpiresInDays < 0 || r.ExpiresInDays > maxDays {
+		v.fail("expires_in_days", fmt.Sprintf("must be between 0 and %v", maxDays))
+	}
+}
+
+func (r RegisterClientRequest) validate(v *validator) {
+	v.required("name", r.Name)
+	if utf8.RuneCountInString(r.Name) > maxOAuthClientNameLength {
+		v.fail("name", fmt.Sprintf("must be at most %v characters long", maxOAuthClientNameLength))
+	}
+
+	if len(r.RedirectURIs) == 0 {
+		v.fail("redirect_uris", "is required")
+	}
+	for _, uri := range r.RedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" {
+			v.fail("redirect_uris", fmt.Sprintf("%q is not an absolute URI without a fragment", uri))
+		}
+	}
+}
+
+func (r PasswordResetRequest) validate(v *validator) {
+	v.required("email", r.Email)
+	v.email("email", r.Email)
+}
+
+func (r ResetPasswordRequest) validate(v *validator) {
+	v.password("new_password", r.NewPassword)
+}
+
+func (r MFALoginRequest) validate(v *validator) {
+	v.required("code", r.Code)
+}
+
+func (r MFACodeRequest) validate(v *validator) {
+	v.required("code", r.Code)
+}
+
+func (r MFAReauthRequest) validate(v *validator) {
+	v.required("password", r.Password)
+	v.required("code", r.Code)
+}
+
+// decodeRequest answers with Bad Request when the body is missing or isn't
+// JSON, and reports whether the handler should go on.
+func decodeRequest(w http.ResponseWriter, r *http.Request, request any) bool {
+	if r.Body == nil {
+		writeErrorResponse(w, http.StatusBadRequest, ErrEmptyBody)
+		return false
+	}
+
+	err := json.NewDecoder(r.Body).Decode(request)
+	if errors.Is(err, io.EOF) {
+		writeErrorResponse(w, http.StatusBadRequest, ErrEmptyBody)
+		return false
+	}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, ErrMalformedBody)
+		return false
+	}
+
+	return true
+}
+
+// decodeAndValidate is decodeRequest followed by validateRequest.
+func (u *UserHTTPHandler) decodeAndValidate(w http.ResponseWriter, r *http.Request, request validatable) bool {
+	return decodeRequest(w, r, request) && validateRequest(w, request, u.passwordPolicy)
+}
+
+// validateRequest runs the request's own checks, which are answered with
+// Unprocessable Entity and the offending fields.
+func validateRequest(w http.ResponseWriter, request validatable, policy crypto.PasswordPolicy) bool {
+	v := validator{policy: policy}
+	request.validate(&v)
+
+	if len(v.fields) > 0 {
+		apiErr := userErrors.Map(ErrValidation)
+		apiErr.Fields = v.fields
+		apierror.Write(w, apiErr)
+		return false
+	}
+
+	return true
+}
+
+// truncate cuts value to at most limit characters, the way varchar columns
+// count them.
+func truncate(value string, limit int) string {
+	if utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+	return string([]rune(value)[:limit])
+}
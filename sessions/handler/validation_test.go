@@ -0,0 +1,175 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/handler"
+)
+
+func TestRequestValidation(t *testing.T) {
+	t.Run("returns Bad Request on malformed body", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/user/signup", strings.NewReader(`{"email": `))
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+
+		var gotResponse apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Message, handler.ErrMalformedBody.Error())
+	})
+
+	t.Run("returns Bad Request on empty body", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/user/login", strings.NewReader(""))
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+
+		var gotResponse apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Message, handler.ErrEmptyBody.Error())
+	})
+
+	t.Run("returns Unprocessable Entity with field errors on invalid signup", func(t *testing.T) {
+		signUpRequest := handler.SignUpRequest{
+			FirstName: "",
+			LastName:  strings.Repeat("a", 21),
+			Email:     "not an email",
+			Password:  "short",
+		}
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(signUpRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/signup", reqBody)
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+
+		var gotResponse apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse, apierror.Error{
+			Code:    apierror.CodeValidationFailed,
+			Status:  http.StatusUnprocessableEntity,
+			Message: handler.ErrValidation.Error(),
+			Fields: []apierror.FieldError{
+				{Field: "first_name", Message: "is required"},
+				{Field: "last_name", Message: "must be at most 20 characters long"},
+				{Field: "email", Message: "must be a valid email address"},
+				{Field: "password", Message: "must be at least 8 characters long"},
+			},
+		})
+		assert.Equal(t, userService.spyUser, domain.User{})
+	})
+
+	t.Run("rejects email with display name", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.PasswordResetRequest{Email: "John Doe <johndoe@example.com>"})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/password/forgot", reqBody)
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("doesn't apply password policy on login", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.LoginRequest{Email: "johndoe@example.com", Password: "short"})
+
+		request, _ := http.NewRequest(http.MethodPost, "/user/login", reqBody)
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("applies configured password policy on password change", func(t *testing.T) {
+		policy := crypto.DefaultPasswordPolicy
+		policy.RequireDigit = true
+
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.ChangePasswordRequest{OldPassword: "oldpassword", NewPassword: "newpassword"})
+
+		request, _ := http.NewRequest(http.MethodPut, "/user/password", reqBody)
+		request.Header.Set("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, policy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+
+		var gotResponse apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Fields, []apierror.FieldError{{Field: "new_password", Message: "must contain a digit"}})
+		assert.Equal(t, userService.spyJWT, "")
+	})
+
+	t.Run("allows partial update but checks given fields", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.UpdateUserRequest{FirstName: "   "})
+
+		request, _ := http.NewRequest(http.MethodPatch, "/user/me", reqBody)
+		request.Header.Set("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userHandler := handler.NewUserHTTPHandler(&StubUserService{}, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+
+		var gotResponse apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Fields, []apierror.FieldError{{Field: "first_name", Message: "must not be blank"}})
+	})
+
+	t.Run("requires password on email change", func(t *testing.T) {
+		reqBody := bytes.NewBuffer([]byte{})
+		json.NewEncoder(reqBody).Encode(handler.UpdateUserRequest{Email: "janedoe@example.com"})
+
+		request, _ := http.NewRequest(http.MethodPatch, "/user/me", reqBody)
+		request.Header.Set("Token", "sampleToken")
+		response := httptest.NewRecorder()
+
+		userService := &StubUserService{}
+		userHandler := handler.NewUserHTTPHandler(userService, crypto.DefaultPasswordPolicy)
+
+		userHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+
+		var gotResponse apierror.Error
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.Fields, []apierror.FieldError{{Field: "password", Message: "is required"}})
+		assert.Equal(t, userService.spyJWT, "")
+	})
+}
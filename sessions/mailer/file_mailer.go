@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer stands in for an SMTP server during development and tests. It
+// writes every message to its own .eml file in dir instead of sending it.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (f *FileMailer) Send(message Message) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%v-%v.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %v\r\n", f.from)
+	fmt.Fprintf(&b, "To: %v\r\n", headerValue(message.To))
+	fmt.Fprintf(&b, "Subject: %v\r\n", headerValue(message.Subject))
+	fmt.Fprintf(&b, "Date: %v\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&b, "\r\n%v\r\n", message.Body)
+
+	return os.WriteFile(filepath.Join(f.dir, name), []byte(b.String()), 0600)
+}
+
+// headerValue keeps a value with line breaks from adding headers of its own.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -0,0 +1,39 @@
+package mailer_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/sessions/mailer"
+)
+
+func TestFileMailer(t *testing.T) {
+	t.Run("writes each message to its own file", func(t *testing.T) {
+		dir := t.TempDir()
+
+		fileMailer, err := mailer.NewFileMailer(dir, "no-reply@example.com")
+		assert.RequireNoError(t, err)
+
+		err = fileMailer.Send(mailer.Message{To: "john@example.com", Subject: "First", Body: "first body"})
+		assert.RequireNoError(t, err)
+		err = fileMailer.Send(mailer.Message{To: "john@example.com", Subject: "Second", Body: "second body"})
+		assert.RequireNoError(t, err)
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(files), 2)
+
+		data, err := os.ReadFile(files[0])
+		assert.RequireNoError(t, err)
+
+		message := string(data)
+		for _, want := range []string{"From: no-reply@example.com", "To: john@example.com", "Subject: First", "first body"} {
+			if !strings.Contains(message, want) {
+				t.Errorf("message %q does not contain %q", message, want)
+			}
+		}
+	})
+}
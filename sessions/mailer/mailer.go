@@ -0,0 +1,48 @@
+package mailer
+
+import "os"
+
+const (
+	defaultFrom             = "no-reply@elysium.local"
+	defaultDir              = "mail"
+	defaultVerifyEmailURL   = "http://localhost:8080/user/email/verify"
+	defaultResetPasswordURL = "http://localhost:8080/user/password/reset"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(Message) error
+}
+
+// Config holds where mail is sent from and the links put in it. The action
+// token is appended to the links in the "token" query parameter.
+type Config struct {
+	From string
+	Dir  string
+
+	VerifyEmailURL   string
+	ResetPasswordURL string
+}
+
+// InitConfigFromEnv reads MAIL_FROM, MAIL_DIR, VERIFY_EMAIL_URL and
+// RESET_PASSWORD_URL, all of which are optional.
+func InitConfigFromEnv() Config {
+	return Config{
+		From:             lookupEnv("MAIL_FROM", defaultFrom),
+		Dir:              lookupEnv("MAIL_DIR", defaultDir),
+		VerifyEmailURL:   lookupEnv("VERIFY_EMAIL_URL", defaultVerifyEmailURL),
+		ResetPasswordURL: lookupEnv("RESET_PASSWORD_URL", defaultResetPasswordURL),
+	}
+}
+
+func lookupEnv(name, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+)
+
+type ActionTokenRepo interface {
+	Create(context.Context, *domain.ActionToken) error
+	// Consume reports false if the token is unknown or was already used.
+	Consume(context.Context, string) (bool, error)
+	// DeleteByUser drops the user's outstanding tokens for the purpose.
+	DeleteByUser(context.Context, int, string) error
+	DeleteExpired(context.Context, time.Time) (int, error)
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+)
+
+type sessionCacheEntry struct {
+	session     domain.Session
+	missing     bool
+	cachedUntil time.Time
+}
+
+// CachedSessionRepository keeps sessions looked up by ID in memory for a
+// short TTL, so that authenticating a request doesn't go to the database
+// every time. Sessions that were deleted or never existed are cached as
+// missing, which also keeps replayed revoked JWTs off the database.
+//
+// Deletes through this repository take effect immediately. Deletes made by
+// other instances of the service are only seen once the TTL runs out, so
+// the TTL bounds how long a revoked session can still be used elsewhere.
+type CachedSessionRepository struct {
+	SessionRepo
+
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]sessionCacheEntry
+	nextSweep time.Time
+}
+
+func NewCachedSessionRepository(repo SessionRepo, ttl time.Duration) *CachedSessionRepository {
+	return &CachedSessionRepository{
+		SessionRepo: repo,
+		ttl:         ttl,
+		entries:     make(map[string]sessionCacheEntry),
+		nextSweep:   time.Now().Add(ttl),
+	}
+}
+
+func (c *CachedSessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	err := c.SessionRepo.Create(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	c.put(session.ID, sessionCacheEntry{session: *session}, true)
+	return nil
+}
+
+func (c *CachedSessionRepository) Update(ctx context.Context, session *domain.Session) error {
+	err := c.SessionRepo.Update(ctx, session)
+	if err != nil {
+		c.forget(session.ID)
+		return err
+	}
+
+	c.put(session.ID, sessionCacheEntry{session: *session}, false)
+	return nil
+}
+
+func (c *CachedSessionRepository) Delete(ctx context.Context, id string) error {
+	err := c.SessionRepo.Delete(ctx, id)
+	c.put(id, sessionCacheEntry{missing: true}, true)
+	return err
+}
+
+func (c *CachedSessionRepository) GetByID(ctx context.Context, id string) (domain.Session, error) {
+	if entry, ok := c.get(id); ok {
+		if entry.missing {
+			return domain.Session{}, ErrNotFound
+		}
+		return entry.session, nil
+	}
+
+	session, err := c.SessionRepo.GetByID(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		c.put(id, sessionCacheEntry{missing: true}, true)
+		return domain.Session{}, err
+	}
+	if err != nil {
+		return domain.Session{}, err
+	}
+
+	c.put(id, sessionCacheEntry{session: session}, false)
+	return session, nil
+}
+
+func (c *CachedSessionRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	purged, err := c.SessionRepo.DeleteExpired(ctx, now)
+	if err != nil {
+		return purged, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, entry := range c.entries {
+		if !entry.missing && !entry.session.IsActive(now) {
+			delete(c.entries, id)
+		}
+	}
+
+	return purged, nil
+}
+
+func (c *CachedSessionRepository) get(id string) (sessionCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return sessionCacheEntry{}, false
+	}
+
+	if !time.Now().Before(entry.cachedUntil) {
+		delete(c.entries, id)
+		return sessionCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// put caches the entry unless it would bring a session that is cached as
+// missing back, which happens when a lookup or an update races with a
+// delete. Session IDs are never reused, so only Create and Delete, which
+// know the session's state for certain, overwrite a missing entry.
+func (c *CachedSessionRepository) put(id string, entry sessionCacheEntry, overwriteMissing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	existing, ok := c.entries[id]
+	if !overwriteMissing && ok && existing.missing && now.Before(existing.cachedUntil) {
+		return
+	}
+
+	entry.cachedUntil = now.Add(c.ttl)
+	c.entries[id] = entry
+
+	// stale entries are otherwise only dropped when they are looked up
+	// again, sweep them every TTL so the cache doesn't grow unbounded
+	if now.After(c.nextSweep) {
+		for id, entry := range c.entries {
+			if !now.Before(entry.cachedUntil) {
+				delete(c.entries, id)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+}
+
+func (c *CachedSessionRepository) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, id)
+}
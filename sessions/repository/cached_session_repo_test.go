@@ -0,0 +1,193 @@
+package repository_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+)
+
+type SpySessionRepo struct {
+	mu       sync.Mutex
+	sessions map[string]domain.Session
+	getCalls int
+	getGate  chan struct{}
+}
+
+func NewSpySessionRepo() *SpySessionRepo {
+	return &SpySessionRepo{
+		sessions: make(map[string]domain.Session),
+	}
+}
+
+func (s *SpySessionRepo) Create(ctx context.Context, session *domain.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+func (s *SpySessionRepo) Update(ctx context.Context, session *domain.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; ok {
+		s.sessions[session.ID] = *session
+	}
+	return nil
+}
+
+func (s *SpySessionRepo) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *SpySessionRepo) GetByID(ctx context.Context, id string) (domain.Session, error) {
+	s.mu.Lock()
+	s.getCalls++
+	session, ok := s.sessions[id]
+	gate := s.getGate
+	s.mu.Unlock()
+
+	if gate != nil {
+		<-gate
+	}
+
+	if !ok {
+		return domain.Session{}, repository.ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *SpySessionRepo) ListByUser(ctx context.Context, userID int) ([]domain.Session, error) {
+	return nil, nil
+}
+
+func (s *SpySessionRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+func (s *SpySessionRepo) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getCalls
+}
+
+var dummySession = domain.Session{
+	ID:        "sampleSession",
+	UserID:    10,
+	ExpiresAt: time.Now().Add(time.Hour),
+}
+
+func TestCachedSessionRepository(t *testing.T) {
+	t.Run("serves repeated lookups from cache", func(t *testing.T) {
+		spy := NewSpySessionRepo()
+		spy.sessions[dummySession.ID] = dummySession
+		repo := repository.NewCachedSessionRepository(spy, time.Minute)
+
+		for i := 0; i < 5; i++ {
+			session, err := repo.GetByID(context.Background(), dummySession.ID)
+			assert.RequireNoError(t, err)
+			assert.Equal(t, session, dummySession)
+		}
+
+		assert.Equal(t, spy.calls(), 1)
+	})
+
+	t.Run("doesn't look up created session", func(t *testing.T) {
+		spy := NewSpySessionRepo()
+		repo := repository.NewCachedSessionRepository(spy, time.Minute)
+
+		session := dummySession
+		err := repo.Create(context.Background(), &session)
+		assert.RequireNoError(t, err)
+
+		_, err = repo.GetByID(context.Background(), dummySession.ID)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, spy.calls(), 0)
+	})
+
+	t.Run("reports deleted session as missing right away", func(t *testing.T) {
+		spy := NewSpySessionRepo()
+		spy.sessions[dummySession.ID] = dummySession
+		repo := repository.NewCachedSessionRepository(spy, time.Minute)
+
+		_, err := repo.GetByID(context.Background(), dummySession.ID)
+		assert.RequireNoError(t, err)
+
+		err = repo.Delete(context.Background(), dummySession.ID)
+		assert.RequireNoError(t, err)
+
+		_, err = repo.GetByID(context.Background(), dummySession.ID)
+		assert.Equal(t, err, repository.ErrNotFound)
+		assert.Equal(t, spy.calls(), 1)
+	})
+
+	t.Run("caches missing sessions", func(t *testing.T) {
+		spy := NewSpySessionRepo()
+		repo := repository.NewCachedSessionRepository(spy, time.Minute)
+
+		for i := 0; i < 5; i++ {
+			_, err := repo.GetByID(context.Background(), "unknownSession")
+			assert.Equal(t, err, repository.ErrNotFound)
+		}
+
+		assert.Equal(t, spy.calls(), 1)
+	})
+
+	t.Run("looks session up again after TTL", func(t *testing.T) {
+		spy := NewSpySessionRepo()
+		spy.sessions[dummySession.ID] = dummySession
+		repo := repository.NewCachedSessionRepository(spy, 10*time.Millisecond)
+
+		_, err := repo.GetByID(context.Background(), dummySession.ID)
+		assert.RequireNoError(t, err)
+
+		// another instance deletes the session
+		delete(spy.sessions, dummySession.ID)
+		time.Sleep(20 * time.Millisecond)
+
+		_, err = repo.GetByID(context.Background(), dummySession.ID)
+		assert.Equal(t, err, repository.ErrNotFound)
+		assert.Equal(t, spy.calls(), 2)
+	})
+
+	t.Run("doesn't bring back session deleted during lookup", func(t *testing.T) {
+		spy := NewSpySessionRepo()
+		spy.sessions[dummySession.ID] = dummySession
+		spy.getGate = make(chan struct{})
+		repo := repository.NewCachedSessionRepository(spy, time.Minute)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			repo.GetByID(context.Background(), dummySession.ID)
+		}()
+
+		// wait for the lookup to read the session before deleting it
+		for spy.calls() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		err := repo.Delete(context.Background(), dummySession.ID)
+		assert.RequireNoError(t, err)
+
+		close(spy.getGate)
+		<-done
+
+		_, err = repo.GetByID(context.Background(), dummySession.ID)
+		assert.Equal(t, err, repository.ErrNotFound)
+	})
+}
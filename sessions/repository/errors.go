@@ -1,7 +1,79 @@
 package repository
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
 
 var (
-	ErrNotFound = errors.New("didn't find object in repository")
+	ErrNotFound       = errors.New("didn't find object in repository")
+	ErrDuplicateEmail = errors.New("user with this email already exists")
+	ErrTransient      = errors.New("database temporarily unavailable")
 )
+
+// TransientError is a failure that may go away if the operation is retried,
+// like a lost connection or a serialization conflict. It matches
+// ErrTransient.
+type TransientError struct {
+	Err error
+}
+
+func (t *TransientError) Error() string {
+	return ErrTransient.Error() + ": " + t.Err.Error()
+}
+
+func (t *TransientError) Unwrap() error {
+	return t.Err
+}
+
+func (t *TransientError) Is(target error) bool {
+	return target == ErrTransient
+}
+
+// SQLSTATE codes of server errors worth a retry, besides the whole
+// connection exception class
+var transientCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// MapTransient wraps err in a TransientError if it is one, otherwise it
+// returns err as it is. Cancelled and timed out contexts are the caller's
+// doing, so they aren't transient.
+func MapTransient(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	if isTransient(err) {
+		return &TransientError{err}
+	}
+	return err
+}
+
+func isTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08") || transientCodes[pgErr.Code]
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return pgconn.SafeToRetry(err)
+}
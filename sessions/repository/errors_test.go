@@ -0,0 +1,45 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestMapTransient(t *testing.T) {
+	t.Run("marks lost connection as transient", func(t *testing.T) {
+		err := repository.MapTransient(&pgconn.PgError{Code: "08006"})
+		assert.Equal(t, errors.Is(err, repository.ErrTransient), true)
+	})
+
+	t.Run("marks serialization failure as transient", func(t *testing.T) {
+		err := repository.MapTransient(&pgconn.PgError{Code: "40001"})
+		assert.Equal(t, errors.Is(err, repository.ErrTransient), true)
+	})
+
+	t.Run("keeps underlying error", func(t *testing.T) {
+		pgErr := &pgconn.PgError{Code: "57P01"}
+		err := repository.MapTransient(pgErr)
+
+		var unwrapped *pgconn.PgError
+		assert.Equal(t, errors.As(err, &unwrapped), true)
+		assert.Equal(t, unwrapped, pgErr)
+	})
+
+	t.Run("leaves constraint violation as it is", func(t *testing.T) {
+		pgErr := &pgconn.PgError{Code: "23505"}
+		assert.Equal(t, repository.MapTransient(pgErr), (error)(pgErr))
+	})
+
+	t.Run("leaves cancelled context as it is", func(t *testing.T) {
+		assert.Equal(t, repository.MapTransient(context.Canceled), context.Canceled)
+	})
+
+	t.Run("leaves nil as it is", func(t *testing.T) {
+		assert.Equal(t, repository.MapTransient(nil), nil)
+	})
+}
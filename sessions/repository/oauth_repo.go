@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+)
+
+// OAuthClientRepo stores the registered OpenID Connect clients, deleting a
+// client deletes its outstanding authorization codes.
+type OAuthClientRepo interface {
+	Create(context.Context, *domain.OAuthClient) error
+	GetByID(context.Context, string) (domain.OAuthClient, error)
+	List(context.Context) ([]domain.OAuthClient, error)
+	Delete(context.Context, string) error
+}
+
+type AuthorizationCodeRepo interface {
+	Create(context.Context, *domain.AuthorizationCode) error
+	// Consume marks the code as used and returns it. It reports ErrNotFound
+	// if the code is unknown or was already used.
+	Consume(context.Context, string) (domain.AuthorizationCode, error)
+	DeleteExpired(context.Context, time.Time) (int, error)
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PGActionTokenRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPGActionTokenRepository(pool *pgxpool.Pool) *PGActionTokenRepository {
+	return &PGActionTokenRepository{pool}
+}
+
+func (p *PGActionTokenRepository) Create(ctx context.Context, token *domain.ActionToken) error {
+	query := `insert into action_tokens(id, user_id, purpose, expires_at, used) 
+	values (@id, @userID, @purpose, @expiresAt, @used)`
+	args := pgx.NamedArgs{
+		"id":        token.ID,
+		"userID":    token.UserID,
+		"purpose":   token.Purpose,
+		"expiresAt": token.ExpiresAt,
+		"used":      token.Used,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
+
+func (p *PGActionTokenRepository) Consume(ctx context.Context, id string) (bool, error) {
+	query := `update action_tokens set used=true where id=@id and not used`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return false, MapTransient(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *PGActionTokenRepository) DeleteByUser(ctx context.Context, userID int, purpose string) error {
+	query := `delete from action_tokens where user_id=@userID and purpose=@purpose`
+	args := pgx.NamedArgs{
+		"userID":  userID,
+		"purpose": purpose,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
+
+func (p *PGActionTokenRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	query := `delete from action_tokens where expires_at <= @now`
+	args := pgx.NamedArgs{
+		"now": now,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return 0, MapTransient(err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PGOAuthClientRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPGOAuthClientRepository(pool *pgxpool.Pool) *PGOAuthClientRepository {
+	return &PGOAuthClientRepository{pool}
+}
+
+func (p *PGOAuthClientRepository) Create(ctx context.Context, client *domain.OAuthClient) error {
+	query := `insert into oauth_clients(id, name, secret_hash, redirect_uris, created_at) 
+	values (@id, @name, @secretHash, @redirectURIs, @createdAt)`
+	args := pgx.NamedArgs{
+		"id":           client.ID,
+		"name":         client.Name,
+		"secretHash":   client.SecretHash,
+		"redirectURIs": append([]string{}, client.RedirectURIs...),
+		"createdAt":    client.CreatedAt,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
+
+func (p *PGOAuthClientRepository) GetByID(ctx context.Context, id string) (domain.OAuthClient, error) {
+	query := `select * from oauth_clients where id=@id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	row, _ := p.pool.Query(ctx, query, args)
+	client, err := pgx.CollectOneRow(row, pgx.RowToStructByName[domain.OAuthClient])
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.OAuthClient{}, ErrNotFound
+		}
+		return domain.OAuthClient{}, MapTransient(err)
+	}
+
+	return client, nil
+}
+
+func (p *PGOAuthClientRepository) List(ctx context.Context) ([]domain.OAuthClient, error) {
+	query := `select * from oauth_clients order by created_at`
+
+	rows, _ := p.pool.Query(ctx, query)
+	clients, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.OAuthClient])
+	return clients, MapTransient(err)
+}
+
+func (p *PGOAuthClientRepository) Delete(ctx context.Context, id string) error {
+	query := `delete from oauth_clients where id=@id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return MapTransient(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+type PGAuthorizationCodeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPGAuthorizationCodeRepository(pool *pgxpool.Pool) *PGAuthorizationCodeRepository {
+	return &PGAuthorizationCodeRepository{pool}
+}
+
+func (p *PGAuthorizationCodeRepository) Create(ctx context.Context, code *domain.AuthorizationCode) error {
+	query := `insert into authorization_codes(id, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at, used) 
+	values (@id, @clientID, @userID, @redirectURI, @scope, @nonce, @codeChallenge, @authTime, @expiresAt, @used)`
+	args := pgx.NamedArgs{
+		"id":            code.ID,
+		"clientID":      code.ClientID,
+		"userID":        code.UserID,
+		"redirectURI":   code.RedirectURI,
+		"scope":         code.Scope,
+		"nonce":         code.Nonce,
+		"codeChallenge": code.CodeChallenge,
+		"authTime":      code.AuthTime,
+		"expiresAt":     code.ExpiresAt,
+		"used":          code.Used,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
+
+func (p *PGAuthorizationCodeRepository) Consume(ctx context.Context, id string) (domain.AuthorizationCode, error) {
+	query := `update authorization_codes set used=true where id=@id and not used returning *`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	row, _ := p.pool.Query(ctx, query, args)
+	code, err := pgx.CollectOneRow(row, pgx.RowToStructByName[domain.AuthorizationCode])
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.AuthorizationCode{}, ErrNotFound
+		}
+		return domain.AuthorizationCode{}, MapTransient(err)
+	}
+
+	return code, nil
+}
+
+func (p *PGAuthorizationCodeRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	query := `delete from authorization_codes where expires_at <= @now`
+	args := pgx.NamedArgs{
+		"now": now,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return 0, MapTransient(err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
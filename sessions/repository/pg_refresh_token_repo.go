@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PGRefreshTokenRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPGRefreshTokenRepository(pool *pgxpool.Pool) *PGRefreshTokenRepository {
+	return &PGRefreshTokenRepository{pool}
+}
+
+func (p *PGRefreshTokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	query := `insert into refresh_tokens(token_hash, user_id, family_id, expires_at, used, revoked) 
+	values (@tokenHash, @userID, @familyID, @expiresAt, @used, @revoked)`
+	args := pgx.NamedArgs{
+		"tokenHash": token.TokenHash,
+		"userID":    token.UserID,
+		"familyID":  token.FamilyID,
+		"expiresAt": token.ExpiresAt,
+		"used":      token.Used,
+		"revoked":   token.Revoked,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
+
+func (p *PGRefreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	query := `select * from refresh_tokens where token_hash=@tokenHash`
+	args := pgx.NamedArgs{
+		"tokenHash": tokenHash,
+	}
+
+	row, _ := p.pool.Query(ctx, query, args)
+	token, err := pgx.CollectOneRow(row, pgx.RowToStructByName[domain.RefreshToken])
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.RefreshToken{}, ErrNotFound
+		}
+		return domain.RefreshToken{}, MapTransient(err)
+	}
+
+	return token, nil
+}
+
+func (p *PGRefreshTokenRepository) MarkUsed(ctx context.Context, tokenHash string) (bool, error) {
+	query := `update refresh_tokens set used=true where token_hash=@tokenHash and not used`
+	args := pgx.NamedArgs{
+		"tokenHash": tokenHash,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return false, MapTransient(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *PGRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	query := `update refresh_tokens set revoked=true where family_id=@familyID`
+	args := pgx.NamedArgs{
+		"familyID": familyID,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PGServiceAccountRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPGServiceAccountRepository(pool *pgxpool.Pool) *PGServiceAccountRepository {
+	return &PGServiceAccountRepository{pool}
+}
+
+func (p *PGServiceAccountRepository) Create(ctx context.Context, account *domain.ServiceAccount) error {
+	query := `insert into service_accounts(name, created_at) values (@name, @createdAt) returning id`
+	args := pgx.NamedArgs{
+		"name":      account.Name,
+		"createdAt": account.CreatedAt,
+	}
+
+	err := p.pool.QueryRow(ctx, query, args).Scan(&account.ID)
+	return MapTransient(err)
+}
+
+func (p *PGServiceAccountRepository) GetByID(ctx context.Context, id int) (domain.ServiceAccount, error) {
+	query := `select * from service_accounts where id=@id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	row, _ := p.pool.Query(ctx, query, args)
+	account, err := pgx.CollectOneRow(row, pgx.RowToStructByName[domain.ServiceAccount])
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ServiceAccount{}, ErrNotFound
+		}
+		return domain.ServiceAccount{}, MapTransient(err)
+	}
+
+	return account, nil
+}
+
+func (p *PGServiceAccountRepository) List(ctx context.Context) ([]domain.ServiceAccount, error) {
+	query := `select * from service_accounts order by id`
+
+	rows, _ := p.pool.Query(ctx, query)
+	accounts, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.ServiceAccount])
+	return accounts, MapTransient(err)
+}
+
+func (p *PGServiceAccountRepository) Delete(ctx context.Context, id int) error {
+	query := `delete from service_accounts where id=@id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return MapTransient(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *PGServiceAccountRepository) CreateKey(ctx context.Context, key *domain.APIKey) error {
+	query := `insert into api_keys(id, service_account_id, key_hash, prefix, scopes, created_at, expires_at, revoked)
+	values (@id, @serviceAccountID, @keyHash, @prefix, @scopes, @createdAt, @expiresAt, @revoked)`
+	args := pgx.NamedArgs{
+		"id":               key.ID,
+		"serviceAccountID": key.ServiceAccountID,
+		"keyHash":          key.KeyHash,
+		"prefix":           key.Prefix,
+		"scopes":           append([]string{}, key.Scopes...),
+		"createdAt":        key.CreatedAt,
+		"expiresAt":        key.ExpiresAt,
+		"revoked":          key.Revoked,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
+
+func (p *PGServiceAccountRepository) GetKeyByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	query := `select * from api_keys where key_hash=@keyHash`
+	args := pgx.NamedArgs{
+		"keyHash": keyHash,
+	}
+
+	row, _ := p.pool.Query(ctx, query, args)
+	key, err := pgx.CollectOneRow(row, pgx.RowToStructByName[domain.APIKey])
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.APIKey{}, ErrNotFound
+		}
+		return domain.APIKey{}, MapTransient(err)
+	}
+
+	return key, nil
+}
+
+func (p *PGServiceAccountRepository) ListKeys(ctx context.Context, serviceAccountID int) ([]domain.APIKey, error) {
+	query := `select * from api_keys where service_account_id=@serviceAccountID order by created_at`
+	args := pgx.NamedArgs{
+		"serviceAccountID": serviceAccountID,
+	}
+
+	rows, _ := p.pool.Query(ctx, query, args)
+	keys, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.APIKey])
+	return keys, MapTransient(err)
+}
+
+func (p *PGServiceAccountRepository) RevokeKey(ctx context.Context, serviceAccountID int, id string) error {
+	query := `update api_keys set revoked=true where id=@id and service_account_id=@serviceAccountID`
+	args := pgx.NamedArgs{
+		"id":               id,
+		"serviceAccountID": serviceAccountID,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return MapTransient(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
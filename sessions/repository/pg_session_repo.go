@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PGSessionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPGSessionRepository(pool *pgxpool.Pool) *PGSessionRepository {
+	return &PGSessionRepository{pool}
+}
+
+func (p *PGSessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	query := `insert into sessions(id, user_id, created_at, last_seen_at, expires_at, user_agent, ip) 
+	values (@id, @userID, @createdAt, @lastSeenAt, @expiresAt, @userAgent, @ip)`
+	args := pgx.NamedArgs{
+		"id":         session.ID,
+		"userID":     session.UserID,
+		"createdAt":  session.CreatedAt,
+		"lastSeenAt": session.LastSeenAt,
+		"expiresAt":  session.ExpiresAt,
+		"userAgent":  session.UserAgent,
+		"ip":         session.IP,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
+
+func (p *PGSessionRepository) Update(ctx context.Context, session *domain.Session) error {
+	query := `update sessions set last_seen_at=@lastSeenAt, expires_at=@expiresAt, 
+		user_agent=@userAgent, ip=@ip where id=@id`
+	args := pgx.NamedArgs{
+		"id":         session.ID,
+		"lastSeenAt": session.LastSeenAt,
+		"expiresAt":  session.ExpiresAt,
+		"userAgent":  session.UserAgent,
+		"ip":         session.IP,
+	}
+
+	_, err := p.pool.Exec(ctx, query, args)
+	return MapTransient(err)
+}
+
+func (p *PGSessionRepository) Delete(ctx context.Context, id string) error {
+	query := `delete from sessions where id=@id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return MapTransient(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *PGSessionRepository) GetByID(ctx context.Context, id string) (domain.Session, error) {
+	query := `select * from sessions where id=@id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	row, _ := p.pool.Query(ctx, query, args)
+	session, err := pgx.CollectOneRow(row, pgx.RowToStructByName[domain.Session])
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.Session{}, ErrNotFound
+		}
+		return domain.Session{}, MapTransient(err)
+	}
+
+	return session, nil
+}
+
+func (p *PGSessionRepository) ListByUser(ctx context.Context, userID int) ([]domain.Session, error) {
+	query := `select * from sessions where user_id=@userID order by created_at`
+	args := pgx.NamedArgs{
+		"userID": userID,
+	}
+
+	rows, _ := p.pool.Query(ctx, query, args)
+	sessions, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.Session])
+	return sessions, MapTransient(err)
+}
+
+func (p *PGSessionRepository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	query := `delete from sessions where expires_at <= @now`
+	args := pgx.NamedArgs{
+		"now": now,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return 0, MapTransient(err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
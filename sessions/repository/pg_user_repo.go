@@ -3,90 +3,164 @@ package repository
 import (
 	"context"
 	"errors"
-	"fmt"
 
 	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const uniqueViolationCode = "23505"
+
 type PGUserRepository struct {
-	conn *pgx.Conn
+	pool *pgxpool.Pool
 }
 
-func NewPGUserRepository(ctx context.Context, connString string) (*PGUserRepository, error) {
-	conn, err := pgx.Connect(ctx, connString)
-	if err != nil {
-		return nil, fmt.Errorf("unable to connect to database: %w", err)
+func NewPGUserRepository(pool *pgxpool.Pool) *PGUserRepository {
+	return &PGUserRepository{pool}
+}
+
+func (p *PGUserRepository) Create(ctx context.Context, user *domain.User) error {
+	query := `insert into users(first_name, last_name, email, password, email_verified, roles) 
+	values (@firstName, @lastName, @email, @password, @emailVerified, @roles) returning id`
+	args := pgx.NamedArgs{
+		"firstName":     user.FirstName,
+		"lastName":      user.LastName,
+		"email":         user.Email,
+		"password":      user.Password,
+		"emailVerified": user.EmailVerified,
+		"roles":         append([]string{}, user.Roles...),
 	}
 
-	return &PGUserRepository{conn}, nil
+	err := p.pool.QueryRow(ctx, query, args).Scan(&user.ID)
+	return mapUniqueViolation(err)
 }
 
-func (p *PGUserRepository) Create(user *domain.User) error {
-	query := `insert into users(first_name, last_name, email, password, jwts) 
-	values (@firstName, @lastName, @email, @password, @jwts) returning id`
+func (p *PGUserRepository) Update(ctx context.Context, user *domain.User) error {
+	query := `update users set first_name=@first_name, last_name=@last_name, 
+		email=@email, password=@password, email_verified=@email_verified, roles=@roles, 
+		mfa_secret=@mfa_secret, mfa_enabled=@mfa_enabled, recovery_codes=@recovery_codes where id=@id`
 	args := pgx.NamedArgs{
-		"firstName": user.FirstName,
-		"lastName":  user.LastName,
-		"email":     user.Email,
-		"password":  user.Password,
-		"jwts":      user.JWTs,
+		"id":             user.ID,
+		"first_name":     user.FirstName,
+		"last_name":      user.LastName,
+		"email":          user.Email,
+		"password":       user.Password,
+		"email_verified": user.EmailVerified,
+		"roles":          append([]string{}, user.Roles...),
+		"mfa_secret":     user.MFASecret,
+		"mfa_enabled":    user.MFAEnabled,
+		// a nil slice would be written as NULL
+		"recovery_codes": append([]string{}, user.RecoveryCodes...),
 	}
 
-	err := p.conn.QueryRow(context.Background(), query, args).Scan(&user.ID)
-	return err
+	_, err := p.pool.Exec(ctx, query, args)
+	return mapUniqueViolation(err)
 }
 
-func (p *PGUserRepository) Update(user *domain.User) error {
-	query := `update users set first_name=@first_name, last_name=@last_name, 
-		email=@email, password=@password, jwts=@jwts where id=@id`
+func (p *PGUserRepository) Delete(ctx context.Context, id int) error {
+	query := `delete from users where id=@id`
 	args := pgx.NamedArgs{
-		"id":         user.ID,
-		"first_name": user.FirstName,
-		"last_name":  user.LastName,
-		"email":      user.Email,
-		"password":   user.Password,
-		"jwts":       user.JWTs,
+		"id": id,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return MapTransient(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
 	}
 
-	_, err := p.conn.Exec(context.Background(), query, args)
-	return err
+	return nil
 }
 
-func (p *PGUserRepository) GetByID(id int) (domain.User, error) {
+func (p *PGUserRepository) GetByID(ctx context.Context, id int) (domain.User, error) {
 	query := `select * from users where id=@id`
 	args := pgx.NamedArgs{
 		"id": id,
 	}
 
-	row, _ := p.conn.Query(context.Background(), query, args)
+	row, _ := p.pool.Query(ctx, query, args)
 	user, err := pgx.CollectOneRow(row, pgx.RowToStructByName[domain.User])
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return domain.User{}, ErrNotFound
 		}
-		return domain.User{}, err
+		return domain.User{}, MapTransient(err)
 	}
 
 	return user, nil
 }
 
-func (p *PGUserRepository) GetByEmail(email string) (domain.User, error) {
+func (p *PGUserRepository) GetByIDs(ctx context.Context, ids []int) ([]domain.User, error) {
+	query := `select * from users where id = any(@ids)`
+	args := pgx.NamedArgs{
+		"ids": ids,
+	}
+
+	rows, _ := p.pool.Query(ctx, query, args)
+	users, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.User])
+	return users, MapTransient(err)
+}
+
+func (p *PGUserRepository) GetByEmail(ctx context.Context, email string) (domain.User, error) {
 	query := `select * from users where email=@email`
 	args := pgx.NamedArgs{
 		"email": email,
 	}
 
-	row, _ := p.conn.Query(context.Background(), query, args)
+	row, _ := p.pool.Query(ctx, query, args)
 	user, err := pgx.CollectOneRow(row, pgx.RowToStructByName[domain.User])
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return domain.User{}, ErrNotFound
 		}
-		return domain.User{}, err
+		return domain.User{}, MapTransient(err)
 	}
 
 	return user, nil
 }
+
+func (p *PGUserRepository) ConsumeRecoveryCode(ctx context.Context, id int, codeHash string) (bool, error) {
+	query := `update users set recovery_codes=array_remove(recovery_codes, @codeHash) 
+		where id=@id and @codeHash=any(recovery_codes)`
+	args := pgx.NamedArgs{
+		"id":       id,
+		"codeHash": codeHash,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return false, MapTransient(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *PGUserRepository) AdvanceMFAStep(ctx context.Context, id int, step int64) (bool, error) {
+	query := `update users set mfa_last_step=@step where id=@id and mfa_last_step < @step`
+	args := pgx.NamedArgs{
+		"id":   id,
+		"step": step,
+	}
+
+	tag, err := p.pool.Exec(ctx, query, args)
+	if err != nil {
+		return false, MapTransient(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// email is the only unique column besides the primary key, so any unique
+// violation on users means the email is taken
+func mapUniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+		return ErrDuplicateEmail
+	}
+	return MapTransient(err)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+)
+
+type RefreshTokenRepo interface {
+	Create(context.Context, *domain.RefreshToken) error
+	GetByHash(context.Context, string) (domain.RefreshToken, error)
+	// MarkUsed reports false if the token was already used, so that two
+	// concurrent refreshes with the same token can't both succeed.
+	MarkUsed(context.Context, string) (bool, error)
+	RevokeFamily(context.Context, string) error
+}
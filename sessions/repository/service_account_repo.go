@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+)
+
+// ServiceAccountRepo stores service accounts together with their API keys,
+// deleting an account deletes its keys.
+type ServiceAccountRepo interface {
+	Create(context.Context, *domain.ServiceAccount) error
+	GetByID(context.Context, int) (domain.ServiceAccount, error)
+	List(context.Context) ([]domain.ServiceAccount, error)
+	Delete(context.Context, int) error
+
+	CreateKey(context.Context, *domain.APIKey) error
+	GetKeyByHash(context.Context, string) (domain.APIKey, error)
+	ListKeys(context.Context, int) ([]domain.APIKey, error)
+	// RevokeKey reports ErrNotFound if the account has no such key.
+	RevokeKey(context.Context, int, string) error
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+)
+
+type SessionRepo interface {
+	Create(context.Context, *domain.Session) error
+	Update(context.Context, *domain.Session) error
+	Delete(context.Context, string) error
+	GetByID(context.Context, string) (domain.Session, error)
+	ListByUser(context.Context, int) ([]domain.Session, error)
+	// DeleteExpired removes sessions that expired before the given time and
+	// returns how many were removed.
+	DeleteExpired(context.Context, time.Time) (int, error)
+}
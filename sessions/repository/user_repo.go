@@ -1,10 +1,25 @@
 package repository
 
-import "github.com/VitoNaychev/elysium-challenge/sessions/domain"
+import (
+	"context"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+)
 
 type UserRepo interface {
-	Create(*domain.User) error
-	Update(*domain.User) error
-	GetByEmail(string) (domain.User, error)
-	GetByID(int) (domain.User, error)
+	Create(context.Context, *domain.User) error
+	Update(context.Context, *domain.User) error
+	Delete(context.Context, int) error
+	GetByEmail(context.Context, string) (domain.User, error)
+	GetByID(context.Context, int) (domain.User, error)
+	// GetByIDs leaves out the IDs that don't exist and returns the rest in
+	// no particular order.
+	GetByIDs(context.Context, []int) ([]domain.User, error)
+
+	// ConsumeRecoveryCode removes the hashed recovery code from the user
+	// and reports false if the user didn't have it.
+	ConsumeRecoveryCode(context.Context, int, string) (bool, error)
+	// AdvanceMFAStep records the TOTP period a code was accepted for and
+	// reports false if a code for it or a later period was accepted already.
+	AdvanceMFAStep(context.Context, int, int64) (bool, error)
 }
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
+)
+
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 200
+)
+
+// ListAuditEvents queries the audit log, newest events first. Only admins
+// may do it. A limit outside of (0, MaxAuditPageSize] gets the default or
+// the maximum. Alongside a page it returns the Before of the next page, or 0
+// if this one is the last.
+func (u *UserService) ListAuditEvents(ctx context.Context, jwt string, filter audit.Filter) ([]audit.Event, int64, error) {
+	err := u.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAuditPageSize
+	}
+	filter.Limit = min(filter.Limit, MaxAuditPageSize)
+
+	// one more than asked for tells whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+
+	events, err := u.audit.Query(ctx, filter)
+	if err != nil {
+		return nil, 0, NewUserServiceError("couldn't query audit log", err)
+	}
+
+	if len(events) <= limit {
+		return events, 0, nil
+	}
+
+	events = events[:limit]
+	return events, events[limit-1].ID, nil
+}
@@ -0,0 +1,239 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"strings"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"github.com/joho/godotenv"
+)
+
+func TestAuditLog(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	signUp := func(t testing.TB, roles ...string) (*service.UserService, *SpyAuditRecorder, domain.User, string) {
+		t.Helper()
+
+		repo := &StubUserRepo{nextUserID: 10}
+		recorder := &SpyAuditRecorder{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), recorder)
+
+		user := domain.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com", Password: "samplepassword"}
+		tokens, err := userService.Create(context.Background(), &user, dummyClient)
+		assert.RequireNoError(t, err)
+
+		user = repo.spyCreateUser
+		user.Roles = append(user.Roles, roles...)
+		repo.users = append(repo.users, user)
+
+		return userService, recorder, user, tokens.AccessToken
+	}
+
+	lastEvent := func(recorder *SpyAuditRecorder) audit.Event {
+		return recorder.events[len(recorder.events)-1]
+	}
+
+	t.Run("records signup with client", func(t *testing.T) {
+		_, recorder, user, _ := signUp(t)
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Type, audit.EventSignup)
+		assert.Equal(t, event.ActorID, user.ID)
+		assert.Equal(t, event.Email, user.Email)
+		assert.Equal(t, event.IP, dummyClient.IP)
+		assert.Equal(t, event.UserAgent, dummyClient.UserAgent)
+		assert.Equal(t, event.Result, audit.ResultSuccess)
+	})
+
+	t.Run("records login", func(t *testing.T) {
+		userService, recorder, user, _ := signUp(t)
+
+		_, err := userService.Login(context.Background(), user.Email, "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Type, audit.EventLogin)
+		assert.Equal(t, event.ActorID, user.ID)
+		assert.Equal(t, event.Result, audit.ResultSuccess)
+	})
+
+	t.Run("records failed login of existing user", func(t *testing.T) {
+		userService, recorder, user, _ := signUp(t)
+
+		_, err := userService.Login(context.Background(), user.Email, "wrongpassword", dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Type, audit.EventLogin)
+		assert.Equal(t, event.ActorID, user.ID)
+		assert.Equal(t, event.Result, audit.ResultFailure)
+	})
+
+	t.Run("records failed login of unknown email without actor", func(t *testing.T) {
+		userService, recorder, _, _ := signUp(t)
+
+		_, err := userService.Login(context.Background(), "missingemail@example.com", "wrongpassword", dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.ActorID, 0)
+		assert.Equal(t, event.Email, "missingemail@example.com")
+		assert.Equal(t, event.Result, audit.ResultFailure)
+	})
+
+	t.Run("records failed login with email and client cut to size of columns", func(t *testing.T) {
+		userService, recorder, _, _ := signUp(t)
+
+		email := strings.Repeat("a", 100) + "@example.com"
+		client := service.ClientInfo{UserAgent: strings.Repeat("ü", 300), IP: dummyClient.IP}
+
+		_, err := userService.Login(context.Background(), email, "wrongpassword", client)
+		assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Email, email[:60])
+		assert.Equal(t, event.UserAgent, strings.Repeat("ü", 255))
+	})
+
+	t.Run("counts events that couldn't be recorded", func(t *testing.T) {
+		userService, recorder, user, _ := signUp(t)
+		recorder.err = errors.New("value too long for type character varying(255)")
+
+		failures := expvar.Get("audit_record_failures").(*expvar.Int)
+		before := failures.Value()
+
+		_, err := userService.Login(context.Background(), user.Email, "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, failures.Value(), before+1)
+	})
+
+	t.Run("records password change with client of session", func(t *testing.T) {
+		userService, recorder, user, jwt := signUp(t)
+
+		err := userService.ChangePassword(context.Background(), jwt, "samplepassword", "newpassword")
+		assert.RequireNoError(t, err)
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Type, audit.EventPasswordChanged)
+		assert.Equal(t, event.ActorID, user.ID)
+		assert.Equal(t, event.IP, dummyClient.IP)
+		assert.Equal(t, event.Result, audit.ResultSuccess)
+	})
+
+	t.Run("records logout with client", func(t *testing.T) {
+		userService, recorder, user, jwt := signUp(t)
+
+		claims, err := crypto.ParseJWT(jwtConfig, jwt)
+		assert.RequireNoError(t, err)
+
+		client := service.ClientInfo{UserAgent: "otherAgent", IP: "198.51.100.9"}
+		err = userService.Logout(context.Background(), jwt, client)
+		assert.RequireNoError(t, err)
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Type, audit.EventLogout)
+		assert.Equal(t, event.ActorID, user.ID)
+		assert.Equal(t, event.Target, audit.SessionTarget(claims.SessionID))
+		assert.Equal(t, event.IP, client.IP)
+		assert.Equal(t, event.UserAgent, client.UserAgent)
+	})
+
+	t.Run("records account deletion with client of session", func(t *testing.T) {
+		userService, recorder, user, jwt := signUp(t)
+
+		err := userService.Delete(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Type, audit.EventAccountDeleted)
+		assert.Equal(t, event.ActorID, user.ID)
+		assert.Equal(t, event.Email, user.Email)
+		assert.Equal(t, event.IP, dummyClient.IP)
+		assert.Equal(t, event.Result, audit.ResultSuccess)
+	})
+
+	t.Run("records session revocation", func(t *testing.T) {
+		userService, recorder, user, _ := signUp(t)
+
+		tokens, err := userService.Login(context.Background(), user.Email, "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		claims, err := crypto.ParseJWT(jwtConfig, tokens.AccessToken)
+		assert.RequireNoError(t, err)
+
+		err = userService.RevokeUserSession(context.Background(), user.ID, claims.SessionID, service.Actor{})
+		assert.RequireNoError(t, err)
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Type, audit.EventSessionRevoked)
+		assert.Equal(t, event.ActorID, 0)
+		assert.Equal(t, event.Target, audit.SessionTarget(claims.SessionID))
+	})
+
+	t.Run("records service account of session revocation by another service", func(t *testing.T) {
+		userService, recorder, user, _ := signUp(t)
+		actor := service.Actor{ServiceAccountID: 3, Client: service.ClientInfo{UserAgent: "grpc-go", IP: "198.51.100.4"}}
+
+		_, err := userService.RevokeAllUserSessions(context.Background(), user.ID, actor)
+		assert.RequireNoError(t, err)
+
+		event := lastEvent(recorder)
+		assert.Equal(t, event.Type, audit.EventSessionsRevoked)
+		assert.Equal(t, event.ActorID, 0)
+		assert.Equal(t, event.ActorServiceAccountID, actor.ServiceAccountID)
+		assert.Equal(t, event.Target, audit.UserTarget(user.ID))
+		assert.Equal(t, event.IP, actor.Client.IP)
+		assert.Equal(t, event.UserAgent, actor.Client.UserAgent)
+	})
+
+	t.Run("lists events of actor page by page", func(t *testing.T) {
+		userService, _, user, jwt := signUp(t, domain.RoleAdmin)
+
+		for i := 0; i < 3; i++ {
+			_, err := userService.Login(context.Background(), user.Email, "samplepassword", dummyClient)
+			assert.RequireNoError(t, err)
+		}
+		_, err := userService.Login(context.Background(), "missingemail@example.com", "wrongpassword", dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
+
+		filter := audit.Filter{ActorID: user.ID, Type: audit.EventLogin, Limit: 2}
+
+		events, next, err := userService.ListAuditEvents(context.Background(), jwt, filter)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(events), 2)
+		assert.Equal(t, next, events[1].ID)
+
+		filter.Before = next
+		events, next, err = userService.ListAuditEvents(context.Background(), jwt, filter)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(events), 1)
+		assert.Equal(t, events[0].ActorID, user.ID)
+		assert.Equal(t, next, int64(0))
+	})
+
+	t.Run("returns ErrPermissionDenied for non-admin", func(t *testing.T) {
+		userService, _, _, jwt := signUp(t)
+
+		_, _, err := userService.ListAuditEvents(context.Background(), jwt, audit.Filter{})
+		assert.Equal(t, err, (error)(service.ErrPermissionDenied))
+	})
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/mailer"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+)
+
+// RequestEmailVerification mails the user the JWT belongs to another link
+// to verify their email.
+func (u *UserService) RequestEmailVerification(ctx context.Context, jwt string) error {
+	user, _, err := u.authenticateUser(ctx, jwt)
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	return u.sendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail redeems a verification token. The token is bound to the email
+// it was sent to, so it is rejected if the user has changed it since. JWTs
+// issued before the verification still say the email is unverified until
+// they are refreshed.
+func (u *UserService) VerifyEmail(ctx context.Context, token string) error {
+	user, err := u.redeemActionToken(ctx, domain.PurposeVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+
+	user.EmailVerified = true
+
+	err = u.repo.Update(ctx, &user)
+	if err != nil {
+		return NewUserServiceError("couldn't update user", err)
+	}
+
+	err = u.actionRepo.DeleteByUser(ctx, user.ID, domain.PurposeVerifyEmail)
+	if err != nil {
+		return NewUserServiceError("couldn't delete verification tokens", err)
+	}
+
+	return nil
+}
+
+// RequestPasswordReset mails a password reset link to the email. It doesn't
+// report whether the email belongs to a user, so that it can't be used to
+// find out who has an account.
+func (u *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := u.repo.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return NewUserServiceError("couldn't get user", err)
+	}
+
+	return u.sendActionEmail(ctx, user, domain.PurposeResetPassword, u.jwtConfig.ResetPasswordExpiresAt,
+		u.mailConfig.ResetPasswordURL, "Reset your password",
+		"Someone asked to reset the password of your account. If it was you, follow the link below within %v:\n\n%v\n\n"+
+			"If it wasn't you, you can ignore this email.")
+}
+
+// ResetPassword redeems a password reset token and sets the new password.
+// All sessions of the user are ended, since whoever holds them might be the
+// reason the password is being reset. Getting the token also proves that
+// the user owns the email, so it counts as verified.
+func (u *UserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	user, err := u.redeemActionToken(ctx, domain.PurposeResetPassword, token)
+	if err != nil {
+		return err
+	}
+
+	hash, err := crypto.HashPassword(u.passwordConfig, newPassword)
+	if err != nil {
+		return NewUserServiceError("couldn't hash password", err)
+	}
+
+	user.Password = hash
+	user.EmailVerified = true
+
+	err = u.repo.Update(ctx, &user)
+	if err != nil {
+		return NewUserServiceError("couldn't update user", err)
+	}
+
+	err = u.actionRepo.DeleteByUser(ctx, user.ID, domain.PurposeResetPassword)
+	if err != nil {
+		return NewUserServiceError("couldn't delete password reset tokens", err)
+	}
+
+	u.recordAudit(ctx, audit.Event{Type: audit.EventPasswordReset, ActorID: user.ID, Email: user.Email, Result: audit.ResultSuccess},
+		ClientInfo{})
+
+	_, err = u.endUserSessions(ctx, user.ID, "")
+	return err
+}
+
+// PurgeExpiredActionTokens removes action tokens that can no longer be
+// redeemed and returns how many were removed.
+func (u *UserService) PurgeExpiredActionTokens(ctx context.Context) (int, error) {
+	purged, err := u.actionRepo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return 0, NewUserServiceError("couldn't purge action tokens", err)
+	}
+
+	return purged, nil
+}
+
+// trySendVerificationEmail is for flows that shouldn't fail just because
+// the verification email couldn't be sent.
+func (u *UserService) trySendVerificationEmail(ctx context.Context, user domain.User) {
+	err := u.sendVerificationEmail(ctx, user)
+	if err != nil {
+		log.Printf("Couldn't send verification email to user %v: %v", user.ID, err)
+	}
+}
+
+func (u *UserService) sendVerificationEmail(ctx context.Context, user domain.User) error {
+	return u.sendActionEmail(ctx, user, domain.PurposeVerifyEmail, u.jwtConfig.VerifyEmailExpiresAt,
+		u.mailConfig.VerifyEmailURL, "Verify your email",
+		"Follow the link below within %v to verify your email:\n\n%v")
+}
+
+// sendActionEmail records a new action token and mails it to the user as
+// part of a link. body is formatted with the token lifetime and the link.
+func (u *UserService) sendActionEmail(ctx context.Context, user domain.User, purpose string, expiresAt time.Duration,
+	link, subject, body string) error {
+	token, err := u.issueActionToken(ctx, user, purpose, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	link, err = withToken(link, token)
+	if err != nil {
+		return NewUserServiceError("couldn't build link", err)
+	}
+
+	err = u.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf(body, expiresAt, link),
+	})
+	if err != nil {
+		return NewUserServiceError("couldn't send email", err)
+	}
+
+	return nil
+}
+
+// issueActionToken records a new action token for the user and returns it
+// signed.
+func (u *UserService) issueActionToken(ctx context.Context, user domain.User, purpose string, expiresAt time.Duration) (string, error) {
+	tokenID, err := crypto.GenerateOpaqueToken()
+	if err != nil {
+		return "", NewUserServiceError("couldn't generate token ID", err)
+	}
+
+	actionToken := domain.ActionToken{
+		ID:        tokenID,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(expiresAt),
+	}
+
+	err = u.actionRepo.Create(ctx, &actionToken)
+	if err != nil {
+		return "", NewUserServiceError("couldn't store action token", err)
+	}
+
+	token, err := crypto.GenerateActionToken(u.jwtConfig, crypto.ActionClaims{
+		Purpose:   purpose,
+		Subject:   user.ID,
+		ID:        tokenID,
+		Email:     user.Email,
+		ExpiresAt: actionToken.ExpiresAt,
+	})
+	if err != nil {
+		return "", NewUserServiceError("couldn't generate action token", err)
+	}
+
+	return token, nil
+}
+
+// redeemActionToken checks the token and uses it up, returning the user it
+// was issued to.
+func (u *UserService) redeemActionToken(ctx context.Context, purpose, token string) (domain.User, error) {
+	claims, err := crypto.ParseActionToken(u.jwtConfig, purpose, token)
+	if err != nil {
+		return domain.User{}, ErrInvalidActionToken.Wrap(err)
+	}
+
+	return u.consumeActionToken(ctx, claims)
+}
+
+// consumeActionToken uses up the token of already parsed claims.
+func (u *UserService) consumeActionToken(ctx context.Context, claims crypto.ActionClaims) (domain.User, error) {
+	ok, err := u.actionRepo.Consume(ctx, claims.ID)
+	if err != nil {
+		return domain.User{}, NewUserServiceError("couldn't consume action token", err)
+	}
+	if !ok {
+		return domain.User{}, ErrInvalidActionToken
+	}
+
+	user, err := u.repo.GetByID(ctx, claims.Subject)
+	if errors.Is(err, repository.ErrNotFound) {
+		return domain.User{}, ErrInvalidActionToken
+	}
+	if err != nil {
+		return domain.User{}, NewUserServiceError("couldn't get user", err)
+	}
+
+	if user.Email != claims.Email {
+		return domain.User{}, ErrInvalidActionToken
+	}
+
+	return user, nil
+}
+
+func withToken(link, token string) (string, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+
+	query := parsed.Query()
+	query.Set("token", token)
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String(), nil
+}
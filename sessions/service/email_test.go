@@ -0,0 +1,261 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"github.com/joho/godotenv"
+)
+
+var linkTokenRegexp = regexp.MustCompile(`token=([^\s]+)`)
+
+func TestEmailVerification(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	signUp := func(t testing.TB) (*service.UserService, *StubUserRepo, *SpyMailer) {
+		t.Helper()
+
+		repo := &StubUserRepo{nextUserID: 10}
+		mailer := &SpyMailer{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), mailer, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		user := domain.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com", Password: "samplepassword"}
+		_, err := userService.Create(context.Background(), &user, dummyClient)
+		assert.RequireNoError(t, err)
+
+		repo.users = append(repo.users, repo.spyCreateUser)
+
+		return userService, repo, mailer
+	}
+
+	t.Run("mails verification link on signup", func(t *testing.T) {
+		_, repo, mailer := signUp(t)
+
+		assert.Equal(t, repo.spyCreateUser.EmailVerified, false)
+		assert.Equal(t, len(mailer.messages), 1)
+		assert.Equal(t, mailer.messages[0].To, "johndoe@example.com")
+
+		token := mailedToken(t, mailer)
+		_, err := crypto.ParseActionToken(jwtConfig, domain.PurposeVerifyEmail, token)
+		assert.RequireNoError(t, err)
+	})
+
+	t.Run("verifies email with mailed token", func(t *testing.T) {
+		userService, repo, mailer := signUp(t)
+
+		err := userService.VerifyEmail(context.Background(), mailedToken(t, mailer))
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, repo.spyUpdateUser.ID, 10)
+		assert.Equal(t, repo.spyUpdateUser.EmailVerified, true)
+	})
+
+	t.Run("returns ErrInvalidActionToken on reused token", func(t *testing.T) {
+		userService, _, mailer := signUp(t)
+		token := mailedToken(t, mailer)
+
+		err := userService.VerifyEmail(context.Background(), token)
+		assert.RequireNoError(t, err)
+
+		err = userService.VerifyEmail(context.Background(), token)
+		assert.ErrorType[*service.UserServiceError](t, err)
+		assert.Equal(t, err, (error)(service.ErrInvalidActionToken))
+	})
+
+	t.Run("returns ErrInvalidActionToken after email change", func(t *testing.T) {
+		userService, repo, mailer := signUp(t)
+		token := mailedToken(t, mailer)
+
+		repo.users[0].Email = "janedoe@example.com"
+
+		err := userService.VerifyEmail(context.Background(), token)
+		assert.Equal(t, err, (error)(service.ErrInvalidActionToken))
+	})
+
+	t.Run("returns ErrInvalidActionToken on password reset token", func(t *testing.T) {
+		userService, _, mailer := signUp(t)
+
+		err := userService.RequestPasswordReset(context.Background(), "johndoe@example.com")
+		assert.RequireNoError(t, err)
+
+		err = userService.VerifyEmail(context.Background(), mailedToken(t, mailer))
+		assert.Equal(t, err, (error)(service.ErrInvalidActionToken))
+	})
+
+	t.Run("returns ErrEmailAlreadyVerified on resend for verified user", func(t *testing.T) {
+		userService, repo, _ := signUp(t)
+		repo.users[0].EmailVerified = true
+
+		tokens, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		err = userService.RequestEmailVerification(context.Background(), tokens.AccessToken)
+		assert.Equal(t, err, (error)(service.ErrEmailAlreadyVerified))
+	})
+
+	t.Run("puts verification status in JWT", func(t *testing.T) {
+		userService, repo, _ := signUp(t)
+		repo.users[0].EmailVerified = true
+
+		tokens, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		principal, err := userService.Authenticate(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, principal.EmailVerified, true)
+	})
+
+	t.Run("mails verification link on email change", func(t *testing.T) {
+		userService, repo, mailer := signUp(t)
+		repo.users[0].EmailVerified = true
+
+		tokens, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		user, err := userService.UpdateUser(context.Background(), tokens.AccessToken, "", "", "janedoe@example.com", "samplepassword", "")
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, user.EmailVerified, false)
+		assert.Equal(t, len(mailer.messages), 2)
+		assert.Equal(t, mailer.messages[1].To, "janedoe@example.com")
+	})
+
+	t.Run("returns ErrWrongPassword on email change with wrong password", func(t *testing.T) {
+		userService, repo, mailer := signUp(t)
+
+		tokens, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.UpdateUser(context.Background(), tokens.AccessToken, "", "", "janedoe@example.com", "wrongpassword", "")
+		assert.Equal(t, err, (error)(service.ErrWrongPassword))
+
+		assert.Equal(t, repo.spyUpdateUser, domain.User{})
+		assert.Equal(t, len(mailer.messages), 1)
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	hash, err := crypto.HashPassword(passwordConfig, "samplepassword")
+	assert.RequireNoError(t, err)
+
+	dummyUser := domain.User{
+		ID:        10,
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "johndoe@example.com",
+		Password:  hash,
+	}
+
+	t.Run("doesn't mail unknown email", func(t *testing.T) {
+		mailer := &SpyMailer{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, &StubUserRepo{}, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), mailer, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		err := userService.RequestPasswordReset(context.Background(), "unknown@example.com")
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, len(mailer.messages), 0)
+	})
+
+	t.Run("resets password and ends sessions", func(t *testing.T) {
+		repo := &StubUserRepo{users: []domain.User{dummyUser}}
+		sessionRepo := NewStubSessionRepo()
+		mailer := &SpyMailer{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), mailer, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		tokens, err := userService.Login(context.Background(), dummyUser.Email, "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		err = userService.RequestPasswordReset(context.Background(), dummyUser.Email)
+		assert.RequireNoError(t, err)
+
+		err = userService.ResetPassword(context.Background(), mailedToken(t, mailer), "newpassword")
+		assert.RequireNoError(t, err)
+
+		assertPasswordHash(t, passwordConfig, repo.spyUpdateUser.Password, "newpassword")
+		assert.Equal(t, repo.spyUpdateUser.EmailVerified, true)
+
+		_, err = userService.Authenticate(context.Background(), tokens.AccessToken)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("invalidates other outstanding reset tokens", func(t *testing.T) {
+		repo := &StubUserRepo{users: []domain.User{dummyUser}}
+		mailer := &SpyMailer{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), mailer, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		err := userService.RequestPasswordReset(context.Background(), dummyUser.Email)
+		assert.RequireNoError(t, err)
+		firstToken := mailedToken(t, mailer)
+
+		err = userService.RequestPasswordReset(context.Background(), dummyUser.Email)
+		assert.RequireNoError(t, err)
+
+		err = userService.ResetPassword(context.Background(), mailedToken(t, mailer), "newpassword")
+		assert.RequireNoError(t, err)
+
+		err = userService.ResetPassword(context.Background(), firstToken, "otherpassword")
+		assert.Equal(t, err, (error)(service.ErrInvalidActionToken))
+	})
+
+	t.Run("returns ErrInvalidActionToken on forged token", func(t *testing.T) {
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, &StubUserRepo{users: []domain.User{dummyUser}},
+			NewStubSessionRepo(), NewStubRefreshTokenRepo(), NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		err := userService.ResetPassword(context.Background(), "forgedToken", "newpassword")
+		assert.Equal(t, err, (error)(service.ErrInvalidActionToken))
+	})
+}
+
+// mailedToken pulls the action token out of the link in the last mail sent.
+func mailedToken(t testing.TB, mailer *SpyMailer) string {
+	t.Helper()
+
+	if len(mailer.messages) == 0 {
+		t.Fatalf("no mail was sent")
+	}
+
+	match := linkTokenRegexp.FindStringSubmatch(mailer.messages[len(mailer.messages)-1].Body)
+	if match == nil {
+		t.Fatalf("mail doesn't contain a token")
+	}
+
+	token, err := url.QueryUnescape(match[1])
+	assert.RequireNoError(t, err)
+
+	return token
+}
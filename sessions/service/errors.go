@@ -1,5 +1,7 @@
 package service
 
+import "time"
+
 type UserServiceError struct {
 	msg string
 	err error
@@ -27,8 +29,57 @@ func (u *UserServiceError) Wrap(err error) error {
 
 var (
 	ErrUserNotFound  = &UserServiceError{msg: "user doesn't exist"}
-	ErrEmailNotFound = &UserServiceError{msg: "user with this email doesn't exist"}
 	ErrWrongPassword = &UserServiceError{msg: "wrong password for user with this email"}
+	ErrEmailTaken    = &UserServiceError{msg: "user with this email already exists"}
+	ErrTooManyUsers  = &UserServiceError{msg: "too many users asked for at once"}
+
+	ErrPermissionDenied = &UserServiceError{msg: "user doesn't have the role required for this"}
+	ErrInvalidRole      = &UserServiceError{msg: "unknown role"}
+
+	ErrInvalidCredentials = &UserServiceError{msg: "invalid email or password"}
+	ErrTooManyAttempts    = &UserServiceError{msg: "too many failed login attempts, try again later"}
+
+	ErrInvalidJWT      = &UserServiceError{msg: "invalid JWT"}
+	ErrSessionNotFound = &UserServiceError{msg: "session has ended or doesn't exist"}
+
+	ErrInvalidRefreshToken = &UserServiceError{msg: "invalid refresh token"}
+	ErrRefreshTokenReused  = &UserServiceError{msg: "refresh token was already used"}
+
+	ErrInvalidActionToken   = &UserServiceError{msg: "invalid, expired or already used token"}
+	ErrEmailAlreadyVerified = &UserServiceError{msg: "email is already verified"}
+	ErrEmailNotVerified     = &UserServiceError{msg: "email isn't verified yet"}
+
+	ErrInvalidAPIKey          = &UserServiceError{msg: "invalid, expired or revoked API key"}
+	ErrServiceAccountNotFound = &UserServiceError{msg: "service account doesn't exist"}
+	ErrAPIKeyNotFound         = &UserServiceError{msg: "API key doesn't exist"}
+	ErrInvalidAPIKeyLifetime  = &UserServiceError{msg: "API key lifetime must be positive and at most a year"}
 
-	ErrInvalidJWT = &UserServiceError{msg: "invalid JWT"}
+	ErrOAuthClientNotFound     = &UserServiceError{msg: "client doesn't exist"}
+	ErrInvalidOAuthClient      = &UserServiceError{msg: "unknown client or wrong client secret"}
+	ErrInvalidRedirectURI      = &UserServiceError{msg: "redirect URI isn't registered for the client"}
+	ErrUnsupportedResponseType = &UserServiceError{msg: "only the code response type is supported"}
+	ErrInvalidScope            = &UserServiceError{msg: "scope has to include openid and only supported scopes"}
+	ErrInvalidCodeChallenge    = &UserServiceError{msg: "an S256 code challenge is required"}
+	ErrInvalidGrant            = &UserServiceError{msg: "invalid, expired or already used authorization code"}
+	ErrInvalidOAuthToken       = &UserServiceError{msg: "invalid or expired access token"}
+
+	ErrMFAAlreadyEnabled   = &UserServiceError{msg: "two-factor authentication is already enabled"}
+	ErrMFANotEnrolled      = &UserServiceError{msg: "two-factor authentication enrollment wasn't started"}
+	ErrMFANotEnabled       = &UserServiceError{msg: "two-factor authentication isn't enabled"}
+	ErrInvalidMFACode      = &UserServiceError{msg: "invalid or already used two-factor code"}
+	ErrInvalidMFAChallenge = &UserServiceError{msg: "invalid or expired two-factor challenge"}
 )
+
+// ThrottleError is returned instead of checking credentials while the
+// account or the IP has to wait after failed logins.
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (t *ThrottleError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (t *ThrottleError) Unwrap() error {
+	return ErrTooManyAttempts
+}
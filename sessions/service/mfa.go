@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+)
+
+const (
+	recoveryCodeCount = 10
+	// mfaChallengeExpiresAt is how long the user has to enter a code after
+	// logging in with their password.
+	mfaChallengeExpiresAt = 5 * time.Minute
+	totpCodeLength        = 6
+)
+
+// MFAEnrollment is what the user needs to add the account to their
+// authenticator app.
+type MFAEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// EnrollMFA starts two-factor enrollment by generating a new TOTP secret.
+// Two-factor authentication isn't enabled until ConfirmMFA is called with a
+// code from the authenticator.
+func (u *UserService) EnrollMFA(ctx context.Context, jwt string) (MFAEnrollment, error) {
+	user, _, err := u.authenticateUser(ctx, jwt)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+
+	if user.MFAEnabled {
+		return MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := crypto.GenerateTOTPSecret()
+	if err != nil {
+		return MFAEnrollment{}, NewUserServiceError("couldn't generate TOTP secret", err)
+	}
+
+	user.MFASecret, err = crypto.EncryptSecret(u.mfaConfig.EncryptionKey, secret)
+	if err != nil {
+		return MFAEnrollment{}, NewUserServiceError("couldn't encrypt TOTP secret", err)
+	}
+
+	err = u.repo.Update(ctx, &user)
+	if err != nil {
+		return MFAEnrollment{}, NewUserServiceError("couldn't update user", err)
+	}
+
+	return MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: crypto.TOTPProvisioningURI(u.mfaConfig.Issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA enables two-factor authentication once the user shows a valid
+// code for the enrolled secret, and returns the recovery codes. They are
+// only stored hashed, so this is the only time they can be shown.
+func (u *UserService) ConfirmMFA(ctx context.Context, jwt, code string) ([]string, error) {
+	user, _, err := u.authenticateUser(ctx, jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFASecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	err = u.verifyTOTPCode(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	user.MFAEnabled = true
+	return u.replaceRecoveryCodes(ctx, user)
+}
+
+// CompleteMFALogin finishes a login that Login answered with an MFA token.
+// The code may be a TOTP code or one of the recovery codes. The MFA token is
+// used up even if the code is wrong, so every guess costs a password login.
+func (u *UserService) CompleteMFALogin(ctx context.Context, mfaToken, code string, client ClientInfo) (Tokens, error) {
+	claims, err := crypto.ParseActionToken(u.jwtConfig, domain.PurposeMFALogin, mfaToken)
+	if err != nil {
+		return Tokens{}, ErrInvalidMFAChallenge
+	}
+
+	now := time.Now()
+
+	// the throttle is checked before the token is spent, so that a throttled
+	// player can still complete the login once the wait is over
+	err = u.checkThrottle(ctx, claims.Email, client, now)
+	if err != nil {
+		return Tokens{}, err
+	}
+	defer u.throttle.Release(claims.Email, client.IP)
+
+	user, err := u.consumeActionToken(ctx, claims)
+	if errors.Is(err, ErrInvalidActionToken) {
+		return Tokens{}, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if user.MFAEnabled {
+		err = u.verifySecondFactor(ctx, user, code)
+		if errors.Is(err, ErrInvalidMFACode) {
+			return Tokens{}, u.loginFailed(ctx, user.ID, user.Email, client, now, err)
+		}
+		if err != nil {
+			return Tokens{}, err
+		}
+	}
+
+	return u.loginSucceeded(ctx, user, client)
+}
+
+// DisableMFA turns two-factor authentication off. Since a stolen session
+// would otherwise be enough to strip the account of its second factor, it
+// asks for both the password and a code.
+func (u *UserService) DisableMFA(ctx context.Context, jwt, password, code string) error {
+	user, err := u.reauthenticate(ctx, jwt, password, code)
+	if err != nil {
+		return err
+	}
+
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.RecoveryCodes = nil
+
+	err = u.repo.Update(ctx, &user)
+	if err != nil {
+		return NewUserServiceError("couldn't update user", err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user with new
+// ones. It asks for the password and a code just like DisableMFA.
+func (u *UserService) RegenerateRecoveryCodes(ctx context.Context, jwt, password, code string) ([]string, error) {
+	user, err := u.reauthenticate(ctx, jwt, password, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.replaceRecoveryCodes(ctx, user)
+}
+
+func (u *UserService) reauthenticate(ctx context.Context, jwt, password, code string) (domain.User, error) {
+	user, _, err := u.authenticateUser(ctx, jwt)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	if !user.MFAEnabled {
+		return domain.User{}, ErrMFANotEnabled
+	}
+
+	err = u.confirmIdentity(ctx, user, password, code)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+// confirmIdentity checks the password of an already authenticated user, and
+// the code too if they have MFA enabled.
+func (u *UserService) confirmIdentity(ctx context.Context, user domain.User, password, code string) error {
+	match, _, err := crypto.VerifyPassword(u.passwordConfig, user.Password, password)
+	if err != nil {
+		return NewUserServiceError("couldn't verify password", err)
+	}
+	if !match {
+		return ErrWrongPassword
+	}
+
+	if !user.MFAEnabled {
+		return nil
+	}
+	return u.verifySecondFactor(ctx, user, code)
+}
+
+func (u *UserService) replaceRecoveryCodes(ctx context.Context, user domain.User) ([]string, error) {
+	codes, err := crypto.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, NewUserServiceError("couldn't generate recovery codes", err)
+	}
+
+	user.RecoveryCodes = make([]string, len(codes))
+	for i, code := range codes {
+		user.RecoveryCodes[i] = crypto.HashRecoveryCode(code)
+	}
+
+	err = u.repo.Update(ctx, &user)
+	if err != nil {
+		return nil, NewUserServiceError("couldn't update user", err)
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor takes six digits to be a TOTP code and anything else
+// to be a recovery code.
+func (u *UserService) verifySecondFactor(ctx context.Context, user domain.User, code string) error {
+	if isTOTPCode(code) {
+		return u.verifyTOTPCode(ctx, user, code)
+	}
+
+	ok, err := u.repo.ConsumeRecoveryCode(ctx, user.ID, crypto.HashRecoveryCode(code))
+	if err != nil {
+		return NewUserServiceError("couldn't consume recovery code", err)
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+func (u *UserService) verifyTOTPCode(ctx context.Context, user domain.User, code string) error {
+	secret, err := crypto.DecryptSecret(u.mfaConfig.EncryptionKey, user.MFASecret)
+	if err != nil {
+		return NewUserServiceError("couldn't decrypt TOTP secret", err)
+	}
+
+	step, ok, err := crypto.VerifyTOTP(secret, code, time.Now())
+	if err != nil {
+		return NewUserServiceError("couldn't verify TOTP code", err)
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	advanced, err := u.repo.AdvanceMFAStep(ctx, user.ID, step)
+	if err != nil {
+		return NewUserServiceError("couldn't record TOTP code", err)
+	}
+	if !advanced {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpCodeLength {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,268 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"github.com/joho/godotenv"
+)
+
+func TestMFA(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	signUp := func(t testing.TB) (*service.UserService, *StubUserRepo, string) {
+		t.Helper()
+
+		repo := &StubUserRepo{nextUserID: 10}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		user := domain.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com", Password: "samplepassword"}
+		tokens, err := userService.Create(context.Background(), &user, dummyClient)
+		assert.RequireNoError(t, err)
+
+		repo.users = append(repo.users, repo.spyCreateUser)
+
+		return userService, repo, tokens.AccessToken
+	}
+
+	// enableMFA enrolls and confirms the user, returning the TOTP secret and
+	// the recovery codes. The code used to confirm is already spent.
+	enableMFA := func(t testing.TB, userService *service.UserService, repo *StubUserRepo, jwt string) (string, []string) {
+		t.Helper()
+
+		enrollment, err := userService.EnrollMFA(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+		repo.users[0].MFASecret = repo.spyUpdateUser.MFASecret
+
+		code, err := crypto.TOTPCode(enrollment.Secret, time.Now())
+		assert.RequireNoError(t, err)
+
+		recoveryCodes, err := userService.ConfirmMFA(context.Background(), jwt, code)
+		assert.RequireNoError(t, err)
+		repo.users[0].MFAEnabled = repo.spyUpdateUser.MFAEnabled
+		repo.users[0].RecoveryCodes = repo.spyUpdateUser.RecoveryCodes
+
+		return enrollment.Secret, recoveryCodes
+	}
+
+	nextCode := func(t testing.TB, secret string) string {
+		t.Helper()
+
+		code, err := crypto.TOTPCode(secret, time.Now().Add(30*time.Second))
+		assert.RequireNoError(t, err)
+
+		return code
+	}
+
+	t.Run("stores encrypted secret on enrollment", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+
+		enrollment, err := userService.EnrollMFA(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, repo.spyUpdateUser.MFAEnabled, false)
+		if repo.spyUpdateUser.MFASecret == enrollment.Secret {
+			t.Errorf("secret is stored in plaintext")
+		}
+		if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") {
+			t.Errorf("got provisioning URI %q want otpauth://totp/ prefix", enrollment.ProvisioningURI)
+		}
+	})
+
+	t.Run("enables MFA and hashes recovery codes on confirmation", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+
+		_, recoveryCodes := enableMFA(t, userService, repo, jwt)
+
+		assert.Equal(t, repo.users[0].MFAEnabled, true)
+		assert.Equal(t, len(recoveryCodes), 10)
+		assert.Equal(t, repo.users[0].RecoveryCodes[0], crypto.HashRecoveryCode(recoveryCodes[0]))
+	})
+
+	t.Run("returns ErrMFANotEnrolled on confirmation without enrollment", func(t *testing.T) {
+		userService, _, jwt := signUp(t)
+
+		_, err := userService.ConfirmMFA(context.Background(), jwt, "123456")
+		assert.Equal(t, err, (error)(service.ErrMFANotEnrolled))
+	})
+
+	t.Run("returns ErrInvalidMFACode on confirmation with wrong code", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+
+		_, err := userService.EnrollMFA(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+		repo.users[0].MFASecret = repo.spyUpdateUser.MFASecret
+
+		_, err = userService.ConfirmMFA(context.Background(), jwt, "000000")
+		assert.Equal(t, err, (error)(service.ErrInvalidMFACode))
+	})
+
+	t.Run("returns ErrMFAAlreadyEnabled on second enrollment", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		enableMFA(t, userService, repo, jwt)
+
+		_, err := userService.EnrollMFA(context.Background(), jwt)
+		assert.Equal(t, err, (error)(service.ErrMFAAlreadyEnabled))
+	})
+
+	t.Run("challenges login and completes it with TOTP code", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		secret, _ := enableMFA(t, userService, repo, jwt)
+
+		challenge, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, challenge.AccessToken, "")
+		assert.Equal(t, challenge.RefreshToken, "")
+
+		tokens, err := userService.CompleteMFALogin(context.Background(), challenge.MFAToken, nextCode(t, secret), dummyClient)
+		assert.RequireNoError(t, err)
+
+		principal, err := userService.Authenticate(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, principal.UserID, 10)
+	})
+
+	t.Run("returns ErrInvalidMFACode on replayed TOTP code", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		secret, _ := enableMFA(t, userService, repo, jwt)
+		code := nextCode(t, secret)
+
+		challenge, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+		_, err = userService.CompleteMFALogin(context.Background(), challenge.MFAToken, code, dummyClient)
+		assert.RequireNoError(t, err)
+
+		challenge, err = userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+		_, err = userService.CompleteMFALogin(context.Background(), challenge.MFAToken, code, dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidMFACode))
+	})
+
+	t.Run("completes login with recovery code only once", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		_, recoveryCodes := enableMFA(t, userService, repo, jwt)
+
+		challenge, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+		_, err = userService.CompleteMFALogin(context.Background(), challenge.MFAToken, strings.ToUpper(recoveryCodes[3]), dummyClient)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(repo.users[0].RecoveryCodes), 9)
+
+		challenge, err = userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+		_, err = userService.CompleteMFALogin(context.Background(), challenge.MFAToken, recoveryCodes[3], dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidMFACode))
+	})
+
+	t.Run("returns ErrInvalidMFAChallenge on reused MFA token", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		secret, _ := enableMFA(t, userService, repo, jwt)
+
+		challenge, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+		_, err = userService.CompleteMFALogin(context.Background(), challenge.MFAToken, "000000", dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidMFACode))
+
+		_, err = userService.CompleteMFALogin(context.Background(), challenge.MFAToken, nextCode(t, secret), dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidMFAChallenge))
+	})
+
+	t.Run("keeps MFA token of throttled login for after the wait", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		secret, _ := enableMFA(t, userService, repo, jwt)
+
+		challenge, err := userService.Login(context.Background(), "johndoe@example.com", "samplepassword", dummyClient)
+		assert.RequireNoError(t, err)
+
+		for i := 0; i < service.DefaultThrottleConfig.FreeAttempts+1; i++ {
+			_, err = userService.Login(context.Background(), "johndoe@example.com", "wrongpassword", dummyClient)
+			assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
+		}
+
+		_, err = userService.CompleteMFALogin(context.Background(), challenge.MFAToken, nextCode(t, secret), dummyClient)
+		var throttleErr *service.ThrottleError
+		if !errors.As(err, &throttleErr) {
+			t.Fatalf("got %v want ThrottleError", err)
+		}
+
+		time.Sleep(throttleErr.RetryAfter)
+
+		_, err = userService.CompleteMFALogin(context.Background(), challenge.MFAToken, nextCode(t, secret), dummyClient)
+		assert.RequireNoError(t, err)
+	})
+
+	t.Run("disables MFA with password and code", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		secret, _ := enableMFA(t, userService, repo, jwt)
+
+		err := userService.DisableMFA(context.Background(), jwt, "samplepassword", nextCode(t, secret))
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, repo.spyUpdateUser.MFAEnabled, false)
+		assert.Equal(t, repo.spyUpdateUser.MFASecret, "")
+		assert.Equal(t, len(repo.spyUpdateUser.RecoveryCodes), 0)
+	})
+
+	t.Run("returns ErrWrongPassword on disable with wrong password", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		secret, _ := enableMFA(t, userService, repo, jwt)
+
+		err := userService.DisableMFA(context.Background(), jwt, "wrongpassword", nextCode(t, secret))
+		assert.Equal(t, err, (error)(service.ErrWrongPassword))
+	})
+
+	t.Run("returns ErrMFANotEnabled on disable without MFA", func(t *testing.T) {
+		userService, _, jwt := signUp(t)
+
+		err := userService.DisableMFA(context.Background(), jwt, "samplepassword", "123456")
+		assert.Equal(t, err, (error)(service.ErrMFANotEnabled))
+	})
+
+	t.Run("changes email only with password and code", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		secret, _ := enableMFA(t, userService, repo, jwt)
+		repo.spyUpdateUser = domain.User{}
+
+		_, err := userService.UpdateUser(context.Background(), jwt, "", "", "janedoe@example.com", "samplepassword", "")
+		assert.Equal(t, err, (error)(service.ErrInvalidMFACode))
+		assert.Equal(t, repo.spyUpdateUser, domain.User{})
+
+		user, err := userService.UpdateUser(context.Background(), jwt, "", "", "janedoe@example.com", "samplepassword", nextCode(t, secret))
+		assert.RequireNoError(t, err)
+		assert.Equal(t, user.Email, "janedoe@example.com")
+	})
+
+	t.Run("regenerates recovery codes", func(t *testing.T) {
+		userService, repo, jwt := signUp(t)
+		_, oldCodes := enableMFA(t, userService, repo, jwt)
+
+		newCodes, err := userService.RegenerateRecoveryCodes(context.Background(), jwt, "samplepassword", oldCodes[0])
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, len(newCodes), 10)
+		assert.Equal(t, repo.spyUpdateUser.RecoveryCodes[0], crypto.HashRecoveryCode(newCodes[0]))
+		for _, hash := range repo.spyUpdateUser.RecoveryCodes {
+			if hash == crypto.HashRecoveryCode(oldCodes[1]) {
+				t.Errorf("old recovery code survived regeneration")
+			}
+		}
+	})
+}
@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+
+	ResponseTypeCode        = "code"
+	CodeChallengeMethodS256 = "S256"
+
+	defaultOIDCIssuer = "http://localhost:8080"
+
+	// AuthorizationCodeLifetime is how long a client has to redeem a code,
+	// it is expected to do so right after the redirect.
+	AuthorizationCodeLifetime = time.Minute
+)
+
+// SupportedScopes are the scopes a client may ask for. Every request has to
+// include ScopeOpenID.
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// OIDCConfig holds the issuer, the URL the provider is reached at, which
+// ends up in the iss claim and in the discovery document.
+type OIDCConfig struct {
+	Issuer string
+}
+
+// InitOIDCConfigFromEnv reads OIDC_ISSUER, which is optional.
+func InitOIDCConfigFromEnv() OIDCConfig {
+	issuer := defaultOIDCIssuer
+	if value, ok := os.LookupEnv("OIDC_ISSUER"); ok && value != "" {
+		issuer = value
+	}
+
+	return OIDCConfig{
+		Issuer: strings.TrimSuffix(issuer, "/"),
+	}
+}
+
+// AuthorizationRequest is what a client asks for when it sends the user
+// to the authorization endpoint.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest redeems an authorization code. ClientSecret is left empty by
+// public clients.
+type TokenRequest struct {
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+// OIDCTokens are handed to a client for an authorization code. The access
+// token is only good for the userinfo endpoint.
+type OIDCTokens struct {
+	AccessToken string
+	IDToken     string
+	Scope       string
+	ExpiresIn   time.Duration
+}
+
+// UserInfo holds the claims of the user that the granted scopes allow the
+// client to see, the rest are left empty.
+type UserInfo struct {
+	Subject int
+	Scopes  []string
+
+	GivenName     string
+	FamilyName    string
+	Email         string
+	EmailVerified bool
+}
+
+// OIDCProvider lets partner sites sign users in with their account through
+// the OpenID Connect authorization code flow with PKCE. Users are
+// authenticated with their JWT, the provider has no login page of its own.
+type OIDCProvider struct {
+	config     OIDCConfig
+	users      *UserService
+	clientRepo repository.OAuthClientRepo
+	codeRepo   repository.AuthorizationCodeRepo
+}
+
+func NewOIDCProvider(config OIDCConfig, users *UserService, clientRepo repository.OAuthClientRepo,
+	codeRepo repository.AuthorizationCodeRepo) *OIDCProvider {
+	return &OIDCProvider{
+		config:     config,
+		users:      users,
+		clientRepo: clientRepo,
+		codeRepo:   codeRepo,
+	}
+}
+
+// RegisterClient adds a client allowed to redirect to the given URIs. The
+// secret is returned only here and is empty for public clients. Only admins
+// may register, list and delete clients.
+func (o *OIDCProvider) RegisterClient(ctx context.Context, jwt string, name string, redirectURIs []string, public bool) (domain.OAuthClient, string, error) {
+	err := o.users.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return domain.OAuthClient{}, "", err
+	}
+
+	for _, uri := range redirectURIs {
+		if !isValidRedirectURI(uri) {
+			return domain.OAuthClient{}, "", ErrInvalidRedirectURI
+		}
+	}
+
+	clientID, err := crypto.GenerateOpaqueToken()
+	if err != nil {
+		return domain.OAuthClient{}, "", NewUserServiceError("couldn't generate client ID", err)
+	}
+
+	client := domain.OAuthClient{
+		ID:           clientID,
+		Name:         name,
+		RedirectURIs: append([]string{}, redirectURIs...),
+		CreatedAt:    time.Now(),
+	}
+
+	var secret string
+	if !public {
+		secret, err = crypto.GenerateOpaqueToken()
+		if err != nil {
+			return domain.OAuthClient{}, "", NewUserServiceError("couldn't generate client secret", err)
+		}
+		client.SecretHash = crypto.HashOpaqueToken(secret)
+	}
+
+	err = o.clientRepo.Create(ctx, &client)
+	if err != nil {
+		return domain.OAuthClient{}, "", NewUserServiceError("couldn't create client", err)
+	}
+
+	return client, secret, nil
+}
+
+func (o *OIDCProvider) ListClients(ctx context.Context, jwt string) ([]domain.OAuthClient, error) {
+	err := o.users.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	clients, err := o.clientRepo.List(ctx)
+	if err != nil {
+		return nil, NewUserServiceError("couldn't list clients", err)
+	}
+
+	return clients, nil
+}
+
+func (o *OIDCProvider) DeleteClient(ctx context.Context, jwt string, clientID string) error {
+	err := o.users.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return err
+	}
+
+	err = o.clientRepo.Delete(ctx, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return NewUserServiceError("couldn't delete client", err)
+	}
+
+	return nil
+}
+
+// Authorize issues an authorization code for the user the JWT belongs to.
+// The client and the redirect URI are checked first, errors about them
+// must not be sent to the redirect URI.
+func (o *OIDCProvider) Authorize(ctx context.Context, jwt string, request AuthorizationRequest) (string, error) {
+	client, err := o.getClient(ctx, request.ClientID)
+	if err != nil {
+		return "", err
+	}
+
+	if !client.HasRedirectURI(request.RedirectURI) {
+		return "", ErrInvalidRedirectURI
+	}
+
+	user, session, err := o.users.authenticateUser(ctx, jwt)
+	if err != nil {
+		return "", err
+	}
+
+	if request.ResponseType != ResponseTypeCode {
+		return "", ErrUnsupportedResponseType
+	}
+
+	scope, err := normalizeScope(request.Scope)
+	if err != nil {
+		return "", err
+	}
+
+	if request.CodeChallenge == "" || request.CodeChallengeMethod != CodeChallengeMethodS256 {
+		return "", ErrInvalidCodeChallenge
+	}
+
+	code, err := crypto.GenerateOpaqueToken()
+	if err != nil {
+		return "", NewUserServiceError("couldn't generate authorization code", err)
+	}
+
+	err = o.codeRepo.Create(ctx, &domain.AuthorizationCode{
+		ID:            crypto.HashOpaqueToken(code),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectURI:   request.RedirectURI,
+		Scope:         scope,
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AuthTime:      session.CreatedAt,
+		ExpiresAt:     time.Now().Add(AuthorizationCodeLifetime),
+	})
+	if err != nil {
+		return "", NewUserServiceError("couldn't store authorization code", err)
+	}
+
+	return code, nil
+}
+
+// ExchangeCode redeems the authorization code for an ID token and an access
+// token. A code can only be redeemed once, by the client it was issued to,
+// with the same redirect URI and with the verifier of its code challenge.
+func (o *OIDCProvider) ExchangeCode(ctx context.Context, request TokenRequest) (OIDCTokens, error) {
+	client, err := o.getClient(ctx, request.ClientID)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+
+	if !client.IsPublic() {
+		secretHash := crypto.HashOpaqueToken(request.ClientSecret)
+		if subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.SecretHash)) != 1 {
+			return OIDCTokens{}, ErrInvalidOAuthClient
+		}
+	}
+
+	code, err := o.codeRepo.Consume(ctx, crypto.HashOpaqueToken(request.Code))
+	if errors.Is(err, repository.ErrNotFound) {
+		return OIDCTokens{}, ErrInvalidGrant
+	}
+	if err != nil {
+		return OIDCTokens{}, NewUserServiceError("couldn't consume authorization code", err)
+	}
+
+	now := time.Now()
+	if code.ClientID != client.ID || code.RedirectURI != request.RedirectURI || !now.Before(code.ExpiresAt) {
+		return OIDCTokens{}, ErrInvalidGrant
+	}
+	if !crypto.VerifyPKCE(request.CodeVerifier, code.CodeChallenge) {
+		return OIDCTokens{}, ErrInvalidGrant
+	}
+
+	user, err := o.users.repo.GetByID(ctx, code.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return OIDCTokens{}, ErrInvalidGrant
+	}
+	if err != nil {
+		return OIDCTokens{}, NewUserServiceError("couldn't get user", err)
+	}
+
+	lifetime := o.users.jwtConfig.ExpiresAt
+	info := userInfo(user, strings.Fields(code.Scope))
+
+	idToken, err := crypto.GenerateIDToken(o.users.jwtConfig, crypto.IDTokenClaims{
+		Issuer:        o.config.Issuer,
+		Subject:       user.ID,
+		Audience:      client.ID,
+		Nonce:         code.Nonce,
+		AuthTime:      code.AuthTime,
+		ExpiresAt:     now.Add(lifetime),
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		GivenName:     info.GivenName,
+		FamilyName:    info.FamilyName,
+	})
+	if err != nil {
+		return OIDCTokens{}, NewUserServiceError("couldn't generate ID token", err)
+	}
+
+	accessToken, err := crypto.GenerateOAuthAccessToken(o.users.jwtConfig, crypto.OAuthAccessClaims{
+		Issuer:    o.config.Issuer,
+		Subject:   user.ID,
+		ClientID:  client.ID,
+		Scope:     code.Scope,
+		ExpiresAt: now.Add(lifetime),
+	})
+	if err != nil {
+		return OIDCTokens{}, NewUserServiceError("couldn't generate access token", err)
+	}
+
+	return OIDCTokens{
+		AccessToken: accessToken,
+		IDToken:     idToken,
+		Scope:       code.Scope,
+		ExpiresIn:   lifetime,
+	}, nil
+}
+
+// UserInfo returns the claims the access token's scopes allow.
+func (o *OIDCProvider) UserInfo(ctx context.Context, accessToken string) (UserInfo, error) {
+	claims, err := crypto.ParseOAuthAccessToken(o.users.jwtConfig, o.config.Issuer, accessToken)
+	if err != nil {
+		return UserInfo{}, ErrInvalidOAuthToken
+	}
+
+	user, err := o.users.repo.GetByID(ctx, claims.Subject)
+	if errors.Is(err, repository.ErrNotFound) {
+		return UserInfo{}, ErrInvalidOAuthToken
+	}
+	if err != nil {
+		return UserInfo{}, NewUserServiceError("couldn't get user", err)
+	}
+
+	return userInfo(user, strings.Fields(claims.Scope)), nil
+}
+
+func (o *OIDCProvider) PurgeExpiredCodes(ctx context.Context) (int, error) {
+	purged, err := o.codeRepo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return 0, NewUserServiceError("couldn't purge expired authorization codes", err)
+	}
+
+	return purged, nil
+}
+
+// RunCodePurge purges expired authorization codes every interval until the
+// context is done. It is meant to be run in its own goroutine.
+func (o *OIDCProvider) RunCodePurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := o.PurgeExpiredCodes(ctx)
+			if err != nil {
+				log.Printf("Authorization code purge error: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %v expired authorization codes", purged)
+			}
+		}
+	}
+}
+
+func (o *OIDCProvider) getClient(ctx context.Context, clientID string) (domain.OAuthClient, error) {
+	client, err := o.clientRepo.GetByID(ctx, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return domain.OAuthClient{}, ErrInvalidOAuthClient
+	}
+	if err != nil {
+		return domain.OAuthClient{}, NewUserServiceError("couldn't get client", err)
+	}
+
+	return client, nil
+}
+
+func userInfo(user domain.User, scopes []string) UserInfo {
+	info := UserInfo{
+		Subject: user.ID,
+		Scopes:  scopes,
+	}
+
+	if slices.Contains(scopes, ScopeProfile) {
+		info.GivenName = user.FirstName
+		info.FamilyName = user.LastName
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		info.Email = user.Email
+		info.EmailVerified = user.EmailVerified
+	}
+
+	return info
+}
+
+// normalizeScope checks the space separated scopes and returns them sorted
+// and without duplicates.
+func normalizeScope(scope string) (string, error) {
+	scopes := strings.Fields(scope)
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return "", ErrInvalidScope
+	}
+
+	for _, s := range scopes {
+		if !slices.Contains(SupportedScopes, s) {
+			return "", ErrInvalidScope
+		}
+	}
+
+	slices.Sort(scopes)
+	return strings.Join(slices.Compact(scopes), " "), nil
+}
+
+// isValidRedirectURI follows RFC 6749, section 3.1.2: an absolute URI
+// without a fragment.
+func isValidRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+
+	return parsed.IsAbs() && parsed.Host != "" && parsed.Fragment == ""
+}
@@ -0,0 +1,326 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"github.com/joho/godotenv"
+)
+
+type StubOAuthClientRepo struct {
+	clients map[string]domain.OAuthClient
+}
+
+func NewStubOAuthClientRepo() *StubOAuthClientRepo {
+	return &StubOAuthClientRepo{
+		clients: make(map[string]domain.OAuthClient),
+	}
+}
+
+func (s *StubOAuthClientRepo) Create(ctx context.Context, client *domain.OAuthClient) error {
+	s.clients[client.ID] = *client
+
+	return nil
+}
+
+func (s *StubOAuthClientRepo) GetByID(ctx context.Context, id string) (domain.OAuthClient, error) {
+	client, ok := s.clients[id]
+	if !ok {
+		return domain.OAuthClient{}, repository.ErrNotFound
+	}
+
+	return client, nil
+}
+
+func (s *StubOAuthClientRepo) List(ctx context.Context) ([]domain.OAuthClient, error) {
+	clients := []domain.OAuthClient{}
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+func (s *StubOAuthClientRepo) Delete(ctx context.Context, id string) error {
+	if _, ok := s.clients[id]; !ok {
+		return repository.ErrNotFound
+	}
+
+	delete(s.clients, id)
+
+	return nil
+}
+
+type StubAuthorizationCodeRepo struct {
+	codes map[string]domain.AuthorizationCode
+}
+
+func NewStubAuthorizationCodeRepo() *StubAuthorizationCodeRepo {
+	return &StubAuthorizationCodeRepo{
+		codes: make(map[string]domain.AuthorizationCode),
+	}
+}
+
+func (s *StubAuthorizationCodeRepo) Create(ctx context.Context, code *domain.AuthorizationCode) error {
+	s.codes[code.ID] = *code
+
+	return nil
+}
+
+func (s *StubAuthorizationCodeRepo) Consume(ctx context.Context, id string) (domain.AuthorizationCode, error) {
+	code, ok := s.codes[id]
+	if !ok || code.Used {
+		return domain.AuthorizationCode{}, repository.ErrNotFound
+	}
+
+	code.Used = true
+	s.codes[id] = code
+
+	return code, nil
+}
+
+func (s *StubAuthorizationCodeRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	for id, code := range s.codes {
+		if !now.Before(code.ExpiresAt) {
+			delete(s.codes, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func TestOIDCProvider(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	oidcConfig := service.OIDCConfig{Issuer: "http://localhost:8080"}
+	redirectURI := "https://partner.example.com/callback"
+
+	// setUp signs up an admin, who registers a client, and returns the
+	// admin's JWT to authorize with
+	setUp := func(t testing.TB, public bool) (*service.OIDCProvider, *StubAuthorizationCodeRepo, domain.OAuthClient, string, string) {
+		t.Helper()
+
+		repo := &StubUserRepo{nextUserID: 10}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		user := domain.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com", Password: "samplepassword"}
+		tokens, err := userService.Create(context.Background(), &user, dummyClient)
+		assert.RequireNoError(t, err)
+
+		user = repo.spyCreateUser
+		user.Roles = append(user.Roles, domain.RoleAdmin)
+		repo.users = append(repo.users, user)
+
+		codeRepo := NewStubAuthorizationCodeRepo()
+		provider := service.NewOIDCProvider(oidcConfig, userService, NewStubOAuthClientRepo(), codeRepo)
+
+		client, secret, err := provider.RegisterClient(context.Background(), tokens.AccessToken, "Partner", []string{redirectURI}, public)
+		assert.RequireNoError(t, err)
+
+		return provider, codeRepo, client, secret, tokens.AccessToken
+	}
+
+	authorize := func(t testing.TB, provider *service.OIDCProvider, clientID, jwt, verifier string) string {
+		t.Helper()
+
+		code, err := provider.Authorize(context.Background(), jwt, service.AuthorizationRequest{
+			ResponseType:        service.ResponseTypeCode,
+			ClientID:            clientID,
+			RedirectURI:         redirectURI,
+			Scope:               "openid email profile",
+			Nonce:               "sampleNonce",
+			CodeChallenge:       crypto.PKCEChallenge(verifier),
+			CodeChallengeMethod: service.CodeChallengeMethodS256,
+		})
+		assert.RequireNoError(t, err)
+
+		return code
+	}
+
+	t.Run("issues ID token for authorization code", func(t *testing.T) {
+		provider, _, client, secret, jwt := setUp(t, false)
+
+		code := authorize(t, provider, client.ID, jwt, "sampleVerifier")
+
+		tokens, err := provider.ExchangeCode(context.Background(), service.TokenRequest{
+			Code:         code,
+			RedirectURI:  redirectURI,
+			ClientID:     client.ID,
+			ClientSecret: secret,
+			CodeVerifier: "sampleVerifier",
+		})
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, tokens.Scope, "email openid profile")
+
+		claims, err := crypto.ParseIDToken(jwtConfig.Keys, oidcConfig.Issuer, client.ID, tokens.IDToken)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, claims.Subject, 10)
+		assert.Equal(t, claims.Nonce, "sampleNonce")
+		assert.Equal(t, claims.Email, "johndoe@example.com")
+		assert.Equal(t, claims.GivenName, "John")
+	})
+
+	t.Run("returns user info for granted scopes", func(t *testing.T) {
+		provider, _, client, _, jwt := setUp(t, true)
+
+		code, err := provider.Authorize(context.Background(), jwt, service.AuthorizationRequest{
+			ResponseType:        service.ResponseTypeCode,
+			ClientID:            client.ID,
+			RedirectURI:         redirectURI,
+			Scope:               "openid email",
+			CodeChallenge:       crypto.PKCEChallenge("sampleVerifier"),
+			CodeChallengeMethod: service.CodeChallengeMethodS256,
+		})
+		assert.RequireNoError(t, err)
+
+		tokens, err := provider.ExchangeCode(context.Background(), service.TokenRequest{
+			Code:         code,
+			RedirectURI:  redirectURI,
+			ClientID:     client.ID,
+			CodeVerifier: "sampleVerifier",
+		})
+		assert.RequireNoError(t, err)
+
+		info, err := provider.UserInfo(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, info, service.UserInfo{
+			Subject: 10,
+			Scopes:  []string{service.ScopeEmail, service.ScopeOpenID},
+			Email:   "johndoe@example.com",
+		})
+	})
+
+	t.Run("returns ErrInvalidGrant on reused code", func(t *testing.T) {
+		provider, _, client, _, jwt := setUp(t, true)
+
+		code := authorize(t, provider, client.ID, jwt, "sampleVerifier")
+		request := service.TokenRequest{
+			Code:         code,
+			RedirectURI:  redirectURI,
+			ClientID:     client.ID,
+			CodeVerifier: "sampleVerifier",
+		}
+
+		_, err := provider.ExchangeCode(context.Background(), request)
+		assert.RequireNoError(t, err)
+
+		_, err = provider.ExchangeCode(context.Background(), request)
+		assert.Equal(t, err, (error)(service.ErrInvalidGrant))
+	})
+
+	t.Run("returns ErrInvalidGrant on wrong code verifier", func(t *testing.T) {
+		provider, _, client, _, jwt := setUp(t, true)
+
+		code := authorize(t, provider, client.ID, jwt, "sampleVerifier")
+
+		_, err := provider.ExchangeCode(context.Background(), service.TokenRequest{
+			Code:         code,
+			RedirectURI:  redirectURI,
+			ClientID:     client.ID,
+			CodeVerifier: "otherVerifier",
+		})
+		assert.Equal(t, err, (error)(service.ErrInvalidGrant))
+	})
+
+	t.Run("returns ErrInvalidGrant on expired code", func(t *testing.T) {
+		provider, codeRepo, client, _, jwt := setUp(t, true)
+
+		code := authorize(t, provider, client.ID, jwt, "sampleVerifier")
+
+		stored := codeRepo.codes[crypto.HashOpaqueToken(code)]
+		stored.ExpiresAt = time.Now().Add(-time.Second)
+		codeRepo.codes[stored.ID] = stored
+
+		_, err := provider.ExchangeCode(context.Background(), service.TokenRequest{
+			Code:         code,
+			RedirectURI:  redirectURI,
+			ClientID:     client.ID,
+			CodeVerifier: "sampleVerifier",
+		})
+		assert.Equal(t, err, (error)(service.ErrInvalidGrant))
+	})
+
+	t.Run("returns ErrInvalidOAuthClient on wrong client secret", func(t *testing.T) {
+		provider, _, client, _, jwt := setUp(t, false)
+
+		code := authorize(t, provider, client.ID, jwt, "sampleVerifier")
+
+		_, err := provider.ExchangeCode(context.Background(), service.TokenRequest{
+			Code:         code,
+			RedirectURI:  redirectURI,
+			ClientID:     client.ID,
+			ClientSecret: "wrongSecret",
+			CodeVerifier: "sampleVerifier",
+		})
+		assert.Equal(t, err, (error)(service.ErrInvalidOAuthClient))
+	})
+
+	t.Run("returns ErrInvalidRedirectURI on unregistered redirect URI", func(t *testing.T) {
+		provider, _, client, _, jwt := setUp(t, true)
+
+		_, err := provider.Authorize(context.Background(), jwt, service.AuthorizationRequest{
+			ResponseType:        service.ResponseTypeCode,
+			ClientID:            client.ID,
+			RedirectURI:         "https://attacker.example.com/callback",
+			Scope:               "openid",
+			CodeChallenge:       crypto.PKCEChallenge("sampleVerifier"),
+			CodeChallengeMethod: service.CodeChallengeMethodS256,
+		})
+		assert.Equal(t, err, (error)(service.ErrInvalidRedirectURI))
+	})
+
+	t.Run("returns ErrInvalidScope without openid scope", func(t *testing.T) {
+		provider, _, client, _, jwt := setUp(t, true)
+
+		_, err := provider.Authorize(context.Background(), jwt, service.AuthorizationRequest{
+			ResponseType:        service.ResponseTypeCode,
+			ClientID:            client.ID,
+			RedirectURI:         redirectURI,
+			Scope:               "email",
+			CodeChallenge:       crypto.PKCEChallenge("sampleVerifier"),
+			CodeChallengeMethod: service.CodeChallengeMethodS256,
+		})
+		assert.Equal(t, err, (error)(service.ErrInvalidScope))
+	})
+
+	t.Run("returns ErrInvalidCodeChallenge without PKCE", func(t *testing.T) {
+		provider, _, client, _, jwt := setUp(t, true)
+
+		_, err := provider.Authorize(context.Background(), jwt, service.AuthorizationRequest{
+			ResponseType: service.ResponseTypeCode,
+			ClientID:     client.ID,
+			RedirectURI:  redirectURI,
+			Scope:        "openid",
+		})
+		assert.Equal(t, err, (error)(service.ErrInvalidCodeChallenge))
+	})
+
+	t.Run("returns ErrInvalidOAuthToken on session JWT", func(t *testing.T) {
+		provider, _, _, _, jwt := setUp(t, true)
+
+		_, err := provider.UserInfo(context.Background(), jwt)
+		assert.Equal(t, err, (error)(service.ErrInvalidOAuthToken))
+	})
+}
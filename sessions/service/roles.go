@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+)
+
+// SetRoles replaces the roles of a user. Only admins may do it. The roles
+// of the user only reach their tokens on the next refresh.
+func (u *UserService) SetRoles(ctx context.Context, jwt string, userID int, roles []string) (domain.User, error) {
+	admin, session, err := u.authenticateAdmin(ctx, jwt)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	for _, role := range roles {
+		if !domain.IsRole(role) {
+			return domain.User{}, ErrInvalidRole
+		}
+	}
+
+	user, err := u.repo.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return domain.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return domain.User{}, NewUserServiceError("couldn't get user", err)
+	}
+
+	roles = slices.Clone(roles)
+	slices.Sort(roles)
+	user.Roles = slices.Compact(roles)
+
+	err = u.repo.Update(ctx, &user)
+	if err != nil {
+		return domain.User{}, NewUserServiceError("couldn't update user", err)
+	}
+
+	u.recordAudit(ctx, audit.Event{
+		Type:    audit.EventRolesChanged,
+		ActorID: admin.ID,
+		Email:   admin.Email,
+		Target:  audit.UserTarget(user.ID),
+		Result:  audit.ResultSuccess,
+	}, sessionClient(session))
+
+	return user, nil
+}
+
+// BootstrapAdmin makes the user with the email an admin, so that there is
+// someone to grant roles to everyone else. The email has to be verified,
+// otherwise whoever signed up with it first would get the role.
+func (u *UserService) BootstrapAdmin(ctx context.Context, email string) error {
+	user, err := u.repo.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return NewUserServiceError("couldn't get user", err)
+	}
+
+	if !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	if user.HasRole(domain.RoleAdmin) {
+		return nil
+	}
+
+	user.Roles = append(user.Roles, domain.RoleAdmin)
+	slices.Sort(user.Roles)
+
+	err = u.repo.Update(ctx, &user)
+	if err != nil {
+		return NewUserServiceError("couldn't update user", err)
+	}
+
+	u.recordAudit(ctx, audit.Event{
+		Type:   audit.EventRolesChanged,
+		Email:  user.Email,
+		Target: audit.UserTarget(user.ID),
+		Result: audit.ResultSuccess,
+	}, ClientInfo{})
+
+	return nil
+}
+
+// authorizeAdmin checks the stored roles of the caller rather than the ones
+// in the JWT, so that a revoked admin can't keep going until the JWT
+// expires.
+func (u *UserService) authorizeAdmin(ctx context.Context, jwt string) error {
+	_, _, err := u.authenticateAdmin(ctx, jwt)
+	return err
+}
+
+// authenticateAdmin is authorizeAdmin for when the admin has to be known.
+func (u *UserService) authenticateAdmin(ctx context.Context, jwt string) (domain.User, domain.Session, error) {
+	admin, session, err := u.authenticateUser(ctx, jwt)
+	if err != nil {
+		return domain.User{}, domain.Session{}, err
+	}
+
+	if !admin.HasRole(domain.RoleAdmin) {
+		return domain.User{}, domain.Session{}, ErrPermissionDenied
+	}
+
+	return admin, session, nil
+}
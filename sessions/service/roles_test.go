@@ -0,0 +1,114 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"github.com/joho/godotenv"
+)
+
+func TestRoles(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	dummyPlayer := domain.User{ID: 20, Email: "janedoe@example.com", Roles: []string{domain.RolePlayer}}
+
+	signUp := func(t testing.TB, roles ...string) (*service.UserService, *StubUserRepo, string) {
+		t.Helper()
+
+		repo := &StubUserRepo{nextUserID: 10, users: []domain.User{dummyPlayer}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		user := domain.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com", Password: "samplepassword"}
+		tokens, err := userService.Create(context.Background(), &user, dummyClient)
+		assert.RequireNoError(t, err)
+
+		user = repo.spyCreateUser
+		user.Roles = append(user.Roles, roles...)
+		repo.users = append(repo.users, user)
+
+		return userService, repo, tokens.AccessToken
+	}
+
+	t.Run("embeds roles in JWT", func(t *testing.T) {
+		_, _, jwt := signUp(t)
+
+		claims, err := crypto.ParseJWT(jwtConfig, jwt)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, claims.Roles, []string{domain.RolePlayer})
+	})
+
+	t.Run("returns roles of principal", func(t *testing.T) {
+		userService, _, jwt := signUp(t)
+
+		principal, err := userService.Authenticate(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, principal.Roles, []string{domain.RolePlayer})
+	})
+
+	t.Run("sets roles of user as admin", func(t *testing.T) {
+		userService, repo, jwt := signUp(t, domain.RoleAdmin)
+
+		user, err := userService.SetRoles(context.Background(), jwt, dummyPlayer.ID, []string{domain.RoleSupport, domain.RolePlayer, domain.RoleSupport})
+		assert.RequireNoError(t, err)
+
+		wantRoles := []string{domain.RolePlayer, domain.RoleSupport}
+		assert.Equal(t, user.Roles, wantRoles)
+		assert.Equal(t, repo.spyUpdateUser.ID, dummyPlayer.ID)
+		assert.Equal(t, repo.spyUpdateUser.Roles, wantRoles)
+	})
+
+	t.Run("returns ErrPermissionDenied for non-admin", func(t *testing.T) {
+		userService, repo, jwt := signUp(t, domain.RoleSupport)
+
+		_, err := userService.SetRoles(context.Background(), jwt, dummyPlayer.ID, []string{domain.RoleAdmin})
+		assert.Equal(t, err, (error)(service.ErrPermissionDenied))
+		assert.Equal(t, repo.spyUpdateUser.ID, 0)
+	})
+
+	t.Run("returns ErrInvalidRole on unknown role", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		_, err := userService.SetRoles(context.Background(), jwt, dummyPlayer.ID, []string{"superuser"})
+		assert.Equal(t, err, (error)(service.ErrInvalidRole))
+	})
+
+	t.Run("returns ErrUserNotFound on missing user", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		_, err := userService.SetRoles(context.Background(), jwt, 99, []string{domain.RolePlayer})
+		assert.Equal(t, err, (error)(service.ErrUserNotFound))
+	})
+
+	t.Run("bootstraps admin with verified email", func(t *testing.T) {
+		userService, repo, _ := signUp(t)
+		repo.users[0].EmailVerified = true
+
+		err := userService.BootstrapAdmin(context.Background(), dummyPlayer.Email)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, repo.spyUpdateUser.ID, dummyPlayer.ID)
+		assert.Equal(t, repo.spyUpdateUser.Roles, []string{domain.RoleAdmin, domain.RolePlayer})
+	})
+
+	t.Run("returns ErrEmailNotVerified on bootstrapping admin with unverified email", func(t *testing.T) {
+		userService, _, _ := signUp(t)
+
+		err := userService.BootstrapAdmin(context.Background(), dummyPlayer.Email)
+		assert.Equal(t, err, (error)(service.ErrEmailNotVerified))
+	})
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+)
+
+const (
+	DefaultAPIKeyLifetime = 90 * 24 * time.Hour
+	MaxAPIKeyLifetime     = 365 * 24 * time.Hour
+
+	// apiKeyPrefixLength is how much of a key is kept to tell it apart in
+	// listings, a few characters past APIKeyPrefix.
+	apiKeyPrefixLength = len(crypto.APIKeyPrefix) + 6
+)
+
+// CreateServiceAccount adds an account without any keys. Like everything
+// else about service accounts and their keys, only admins may do it.
+func (u *UserService) CreateServiceAccount(ctx context.Context, jwt string, name string) (domain.ServiceAccount, error) {
+	err := u.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return domain.ServiceAccount{}, err
+	}
+
+	account := domain.ServiceAccount{
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	err = u.accountRepo.Create(ctx, &account)
+	if err != nil {
+		return domain.ServiceAccount{}, NewUserServiceError("couldn't create service account", err)
+	}
+
+	return account, nil
+}
+
+func (u *UserService) ListServiceAccounts(ctx context.Context, jwt string) ([]domain.ServiceAccount, error) {
+	err := u.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := u.accountRepo.List(ctx)
+	if err != nil {
+		return nil, NewUserServiceError("couldn't list service accounts", err)
+	}
+
+	return accounts, nil
+}
+
+// DeleteServiceAccount deletes the account together with all of its keys.
+func (u *UserService) DeleteServiceAccount(ctx context.Context, jwt string, id int) error {
+	err := u.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return err
+	}
+
+	err = u.accountRepo.Delete(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return NewUserServiceError("couldn't delete service account", err)
+	}
+
+	return nil
+}
+
+// CreateAPIKey issues a key for the service account. The key is returned
+// only here, only its hash is stored. A zero lifetime means
+// DefaultAPIKeyLifetime.
+func (u *UserService) CreateAPIKey(ctx context.Context, jwt string, accountID int, scopes []string, lifetime time.Duration) (string, domain.APIKey, error) {
+	err := u.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return "", domain.APIKey{}, err
+	}
+
+	if lifetime == 0 {
+		lifetime = DefaultAPIKeyLifetime
+	}
+	if lifetime < 0 || lifetime > MaxAPIKeyLifetime {
+		return "", domain.APIKey{}, ErrInvalidAPIKeyLifetime
+	}
+
+	for _, scope := range scopes {
+		if !domain.IsScope(scope) {
+			return "", domain.APIKey{}, ErrInvalidRole
+		}
+	}
+
+	err = u.getServiceAccount(ctx, accountID)
+	if err != nil {
+		return "", domain.APIKey{}, err
+	}
+
+	key, err := crypto.GenerateAPIKey()
+	if err != nil {
+		return "", domain.APIKey{}, NewUserServiceError("couldn't generate API key", err)
+	}
+
+	keyID, err := crypto.GenerateOpaqueToken()
+	if err != nil {
+		return "", domain.APIKey{}, NewUserServiceError("couldn't generate API key ID", err)
+	}
+
+	now := time.Now()
+	apiKey := domain.APIKey{
+		ID:               keyID,
+		ServiceAccountID: accountID,
+		KeyHash:          crypto.HashOpaqueToken(key),
+		Prefix:           key[:apiKeyPrefixLength],
+		Scopes:           append([]string{}, scopes...),
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(lifetime),
+	}
+
+	err = u.accountRepo.CreateKey(ctx, &apiKey)
+	if err != nil {
+		return "", domain.APIKey{}, NewUserServiceError("couldn't store API key", err)
+	}
+
+	return key, apiKey, nil
+}
+
+func (u *UserService) ListAPIKeys(ctx context.Context, jwt string, accountID int) ([]domain.APIKey, error) {
+	err := u.authorizeAdmin(ctx, jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.getServiceAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := u.accountRepo.ListKeys(ctx, accountID)
+	if err != nil {
+		return nil, NewUserServiceError("couldn't list API keys", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey takes effect immediately, keys aren't cached.
+func (u *UserService) RevokeAPIKey(ctx context.Context, jwt string, accountID int, keyID string) error {
+	admin, session, err := u.authenticateAdmin(ctx, jwt)
+	if err != nil {
+		return err
+	}
+
+	err = u.accountRepo.RevokeKey(ctx, accountID, keyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return NewUserServiceError("couldn't revoke API key", err)
+	}
+
+	u.recordAudit(ctx, audit.Event{
+		Type:    audit.EventAPIKeyRevoked,
+		ActorID: admin.ID,
+		Email:   admin.Email,
+		Target:  audit.APIKeyTarget(keyID),
+		Result:  audit.ResultSuccess,
+	}, sessionClient(session))
+
+	return nil
+}
+
+func (u *UserService) getServiceAccount(ctx context.Context, id int) error {
+	_, err := u.accountRepo.GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return NewUserServiceError("couldn't get service account", err)
+	}
+
+	return nil
+}
+
+func (u *UserService) authenticateAPIKey(ctx context.Context, key string) (Principal, error) {
+	apiKey, err := u.getActiveAPIKey(ctx, key)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	return apiKeyPrincipal(apiKey), nil
+}
+
+func (u *UserService) introspectAPIKey(ctx context.Context, key string) (Introspection, error) {
+	apiKey, err := u.getActiveAPIKey(ctx, key)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		return Introspection{}, nil
+	}
+	if err != nil {
+		return Introspection{}, err
+	}
+
+	return Introspection{
+		Active:    true,
+		Principal: apiKeyPrincipal(apiKey),
+		ExpiresAt: apiKey.ExpiresAt,
+	}, nil
+}
+
+func (u *UserService) getActiveAPIKey(ctx context.Context, key string) (domain.APIKey, error) {
+	apiKey, err := u.accountRepo.GetKeyByHash(ctx, crypto.HashOpaqueToken(key))
+	if errors.Is(err, repository.ErrNotFound) {
+		return domain.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return domain.APIKey{}, NewUserServiceError("couldn't get API key", err)
+	}
+
+	if !apiKey.IsActive(time.Now()) {
+		return domain.APIKey{}, ErrInvalidAPIKey
+	}
+
+	return apiKey, nil
+}
+
+func apiKeyPrincipal(apiKey domain.APIKey) Principal {
+	return Principal{
+		Kind:             PrincipalServiceAccount,
+		ServiceAccountID: apiKey.ServiceAccountID,
+		Roles:            apiKey.Scopes,
+	}
+}
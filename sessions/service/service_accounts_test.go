@@ -0,0 +1,220 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"github.com/joho/godotenv"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	signUp := func(t testing.TB, roles ...string) (*service.UserService, *StubServiceAccountRepo, string) {
+		t.Helper()
+
+		repo := &StubUserRepo{nextUserID: 10}
+		accountRepo := NewStubServiceAccountRepo()
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), accountRepo, &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		user := domain.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com", Password: "samplepassword"}
+		tokens, err := userService.Create(context.Background(), &user, dummyClient)
+		assert.RequireNoError(t, err)
+
+		user = repo.spyCreateUser
+		user.Roles = append(user.Roles, roles...)
+		repo.users = append(repo.users, user)
+
+		return userService, accountRepo, tokens.AccessToken
+	}
+
+	createKey := func(t testing.TB, userService *service.UserService, jwt string, scopes ...string) (string, domain.APIKey) {
+		t.Helper()
+
+		account, err := userService.CreateServiceAccount(context.Background(), jwt, "game-provider")
+		assert.RequireNoError(t, err)
+
+		key, apiKey, err := userService.CreateAPIKey(context.Background(), jwt, account.ID, scopes, 0)
+		assert.RequireNoError(t, err)
+
+		return key, apiKey
+	}
+
+	t.Run("stores only hash of API key", func(t *testing.T) {
+		userService, accountRepo, jwt := signUp(t, domain.RoleAdmin)
+
+		key, apiKey := createKey(t, userService, jwt, domain.RoleFinance)
+
+		stored := accountRepo.keys[apiKey.ID]
+		assert.Equal(t, stored.KeyHash, crypto.HashOpaqueToken(key))
+		assert.Equal(t, strings.HasPrefix(key, stored.Prefix), true)
+		assert.Equal(t, stored.Scopes, []string{domain.RoleFinance})
+		assert.Equal(t, stored.ExpiresAt.Sub(stored.CreatedAt), service.DefaultAPIKeyLifetime)
+	})
+
+	t.Run("authenticates service account by API key", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		key, apiKey := createKey(t, userService, jwt, domain.RoleFinance)
+
+		principal, err := userService.Authenticate(context.Background(), key)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, principal, service.Principal{
+			Kind:             service.PrincipalServiceAccount,
+			ServiceAccountID: apiKey.ServiceAccountID,
+			Roles:            []string{domain.RoleFinance},
+		})
+	})
+
+	t.Run("authenticates API key with game provider scope", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		key, _ := createKey(t, userService, jwt, domain.ScopeGameProvider)
+
+		principal, err := userService.Authenticate(context.Background(), key)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, principal.Roles, []string{domain.ScopeGameProvider})
+	})
+
+	t.Run("introspects API key", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		key, apiKey := createKey(t, userService, jwt, domain.RoleFinance)
+
+		introspection, err := userService.Introspect(context.Background(), key)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, introspection, service.Introspection{
+			Active: true,
+			Principal: service.Principal{
+				Kind:             service.PrincipalServiceAccount,
+				ServiceAccountID: apiKey.ServiceAccountID,
+				Roles:            []string{domain.RoleFinance},
+			},
+			ExpiresAt: apiKey.ExpiresAt,
+		})
+	})
+
+	t.Run("reports revoked API key as inactive", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		key, apiKey := createKey(t, userService, jwt)
+
+		err := userService.RevokeAPIKey(context.Background(), jwt, apiKey.ServiceAccountID, apiKey.ID)
+		assert.RequireNoError(t, err)
+
+		introspection, err := userService.Introspect(context.Background(), key)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, introspection.Active, false)
+	})
+
+	t.Run("returns ErrInvalidAPIKey on unknown API key", func(t *testing.T) {
+		userService, _, _ := signUp(t)
+
+		_, err := userService.Authenticate(context.Background(), crypto.APIKeyPrefix+"forgedKey")
+		assert.Equal(t, err, (error)(service.ErrInvalidAPIKey))
+	})
+
+	t.Run("returns ErrInvalidAPIKey on revoked API key", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		key, apiKey := createKey(t, userService, jwt)
+
+		err := userService.RevokeAPIKey(context.Background(), jwt, apiKey.ServiceAccountID, apiKey.ID)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), key)
+		assert.Equal(t, err, (error)(service.ErrInvalidAPIKey))
+	})
+
+	t.Run("returns ErrInvalidAPIKey on expired API key", func(t *testing.T) {
+		userService, accountRepo, jwt := signUp(t, domain.RoleAdmin)
+
+		key, apiKey := createKey(t, userService, jwt)
+
+		expired := accountRepo.keys[apiKey.ID]
+		expired.ExpiresAt = time.Now().Add(-time.Minute)
+		accountRepo.keys[apiKey.ID] = expired
+
+		_, err := userService.Authenticate(context.Background(), key)
+		assert.Equal(t, err, (error)(service.ErrInvalidAPIKey))
+	})
+
+	t.Run("returns ErrInvalidAPIKey after service account is deleted", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		key, apiKey := createKey(t, userService, jwt)
+
+		err := userService.DeleteServiceAccount(context.Background(), jwt, apiKey.ServiceAccountID)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), key)
+		assert.Equal(t, err, (error)(service.ErrInvalidAPIKey))
+	})
+
+	t.Run("lists service accounts and keys", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		_, apiKey := createKey(t, userService, jwt)
+
+		accounts, err := userService.ListServiceAccounts(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(accounts), 1)
+		assert.Equal(t, accounts[0].Name, "game-provider")
+
+		keys, err := userService.ListAPIKeys(context.Background(), jwt, accounts[0].ID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, keys, []domain.APIKey{apiKey})
+	})
+
+	t.Run("returns ErrPermissionDenied for non-admin", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleFinance)
+
+		_, err := userService.CreateServiceAccount(context.Background(), jwt, "game-provider")
+		assert.Equal(t, err, (error)(service.ErrPermissionDenied))
+	})
+
+	t.Run("returns ErrInvalidAPIKeyLifetime on too long lifetime", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		account, err := userService.CreateServiceAccount(context.Background(), jwt, "game-provider")
+		assert.RequireNoError(t, err)
+
+		_, _, err = userService.CreateAPIKey(context.Background(), jwt, account.ID, nil, service.MaxAPIKeyLifetime+time.Hour)
+		assert.Equal(t, err, (error)(service.ErrInvalidAPIKeyLifetime))
+	})
+
+	t.Run("returns ErrServiceAccountNotFound on key for missing account", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		_, _, err := userService.CreateAPIKey(context.Background(), jwt, 99, nil, 0)
+		assert.Equal(t, err, (error)(service.ErrServiceAccountNotFound))
+	})
+
+	t.Run("returns ErrAPIKeyNotFound on revoking key of other account", func(t *testing.T) {
+		userService, _, jwt := signUp(t, domain.RoleAdmin)
+
+		_, apiKey := createKey(t, userService, jwt)
+
+		err := userService.RevokeAPIKey(context.Background(), jwt, apiKey.ServiceAccountID+1, apiKey.ID)
+		assert.Equal(t, err, (error)(service.ErrAPIKeyNotFound))
+	})
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunSessionPurge purges expired sessions and action tokens and forgets old
+// failed logins every interval until the context is done. It is meant to be
+// run in its own goroutine.
+func (u *UserService) RunSessionPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := u.PurgeExpiredSessions(ctx)
+			if err != nil {
+				log.Printf("Session purge error: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %v expired sessions", purged)
+			}
+
+			purged, err = u.PurgeExpiredActionTokens(ctx)
+			if err != nil {
+				log.Printf("Action token purge error: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %v expired action tokens", purged)
+			}
+
+			u.throttle.Purge(time.Now())
+		}
+	}
+}
@@ -0,0 +1,643 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"github.com/joho/godotenv"
+)
+
+func TestRefresh(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	wantUser := domain.User{
+		ID:        10,
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "johndoe@example.com",
+		Password:  "samplepassword",
+	}
+
+	t.Run("returns new tokens on refresh token from login", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, wantUser)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		loginTokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		tokens, err := userService.Refresh(context.Background(), loginTokens.RefreshToken)
+		assert.RequireNoError(t, err)
+
+		assertValidJWT(t, jwtConfig, tokens.AccessToken, wantUser.ID)
+		if tokens.RefreshToken == loginTokens.RefreshToken {
+			t.Errorf("didn't rotate refresh token")
+		}
+	})
+
+	t.Run("stays within the same session", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, wantUser)}
+		sessionRepo := NewStubSessionRepo()
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		loginTokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		tokens, err := userService.Refresh(context.Background(), loginTokens.RefreshToken)
+		assert.RequireNoError(t, err)
+
+		loginClaims, err := crypto.ParseJWT(jwtConfig, loginTokens.AccessToken)
+		assert.RequireNoError(t, err)
+		claims, err := crypto.ParseJWT(jwtConfig, tokens.AccessToken)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, claims.SessionID, loginClaims.SessionID)
+		assert.Equal(t, len(sessionRepo.sessions), 1)
+	})
+
+	t.Run("accepts rotated refresh token", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, wantUser)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		loginTokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		tokens, err := userService.Refresh(context.Background(), loginTokens.RefreshToken)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Refresh(context.Background(), tokens.RefreshToken)
+		assert.RequireNoError(t, err)
+	})
+
+	t.Run("returns ErrRefreshTokenReused and ends session on reuse", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, wantUser)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		loginTokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		tokens, err := userService.Refresh(context.Background(), loginTokens.RefreshToken)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Refresh(context.Background(), loginTokens.RefreshToken)
+		assert.Equal(t, err, (error)(service.ErrRefreshTokenReused))
+
+		_, err = userService.Refresh(context.Background(), tokens.RefreshToken)
+		assert.Equal(t, err, (error)(service.ErrInvalidRefreshToken))
+
+		_, err = userService.Authenticate(context.Background(), tokens.AccessToken)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("doesn't end other sessions on reuse", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, wantUser)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		stolenTokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+		otherTokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Refresh(context.Background(), stolenTokens.RefreshToken)
+		assert.RequireNoError(t, err)
+		_, err = userService.Refresh(context.Background(), stolenTokens.RefreshToken)
+		assert.Equal(t, err, (error)(service.ErrRefreshTokenReused))
+
+		_, err = userService.Refresh(context.Background(), otherTokens.RefreshToken)
+		assert.RequireNoError(t, err)
+	})
+
+	t.Run("returns ErrInvalidRefreshToken after logout", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, wantUser)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		tokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		err = userService.Logout(context.Background(), tokens.AccessToken, dummyClient)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Refresh(context.Background(), tokens.RefreshToken)
+		assert.Equal(t, err, (error)(service.ErrInvalidRefreshToken))
+	})
+
+	t.Run("returns ErrInvalidRefreshToken on unknown token", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, wantUser)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		_, err := userService.Refresh(context.Background(), "unknownToken")
+		assert.Equal(t, err, (error)(service.ErrInvalidRefreshToken))
+	})
+
+	t.Run("returns ErrInvalidRefreshToken on expired token", func(t *testing.T) {
+		expiredConfig := jwtConfig
+		expiredConfig.RefreshExpiresAt = -time.Second
+
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, wantUser)}
+		userService := service.NewUserService(expiredConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		loginTokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Refresh(context.Background(), loginTokens.RefreshToken)
+		assert.Equal(t, err, (error)(service.ErrInvalidRefreshToken))
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	t.Run("returns UserServiceError on invalid JWT", func(t *testing.T) {
+		invalidJWT := "invalidJWT"
+
+		repo := &StubUserRepo{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		_, err := userService.Authenticate(context.Background(), invalidJWT)
+		assert.ErrorType[*service.UserServiceError](t, err)
+	})
+
+	t.Run("returns ErrSessionNotFound on missing session", func(t *testing.T) {
+		repo := &StubUserRepo{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		jwt, err := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "unknownSession"})
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), jwt)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("returns ErrSessionNotFound on expired session", func(t *testing.T) {
+		sessionRepo := NewStubSessionRepo()
+		sessionRepo.sessions["sampleSession"] = domain.Session{
+			ID:        "sampleSession",
+			UserID:    10,
+			ExpiresAt: time.Now().Add(-time.Second),
+		}
+
+		repo := &StubUserRepo{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		jwt, err := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), jwt)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("returns ErrSessionNotFound on session of another user", func(t *testing.T) {
+		sessionRepo := NewStubSessionRepo()
+		sessionRepo.sessions["sampleSession"] = domain.Session{
+			ID:        "sampleSession",
+			UserID:    11,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		repo := &StubUserRepo{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		jwt, err := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), jwt)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("returns user ID on valid JWT", func(t *testing.T) {
+		wantUser := domain.User{
+			ID:        10,
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+			Password:  "samplepassword",
+		}
+
+		repo := &StubUserRepo{
+			users: hashedUsers(t, passwordConfig, wantUser),
+		}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		tokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		gotPrincipal, err := userService.Authenticate(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, gotPrincipal, service.Principal{Kind: service.PrincipalUser, UserID: wantUser.ID, EmailVerified: wantUser.EmailVerified})
+	})
+
+	t.Run("updates last seen time", func(t *testing.T) {
+		lastSeen := time.Now().Add(-time.Hour)
+
+		sessionRepo := NewStubSessionRepo()
+		sessionRepo.sessions["sampleSession"] = domain.Session{
+			ID:         "sampleSession",
+			UserID:     10,
+			LastSeenAt: lastSeen,
+			ExpiresAt:  time.Now().Add(time.Hour),
+		}
+
+		repo := &StubUserRepo{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		jwt, err := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "sampleSession"})
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+
+		if !sessionRepo.sessions["sampleSession"].LastSeenAt.After(lastSeen) {
+			t.Errorf("didn't update last seen time")
+		}
+	})
+}
+
+func TestIntrospect(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	user := domain.User{
+		ID:            10,
+		FirstName:     "John",
+		LastName:      "Doe",
+		Email:         "johndoe@example.com",
+		Password:      "samplepassword",
+		EmailVerified: true,
+		Roles:         []string{domain.RolePlayer},
+	}
+
+	newService := func() *service.UserService {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, user)}
+		return service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+	}
+
+	t.Run("describes active JWT", func(t *testing.T) {
+		userService := newService()
+
+		tokens, err := userService.Login(context.Background(), user.Email, user.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		claims, err := crypto.ParseJWT(jwtConfig, tokens.AccessToken)
+		assert.RequireNoError(t, err)
+
+		introspection, err := userService.Introspect(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, introspection, service.Introspection{
+			Active: true,
+			Principal: service.Principal{
+				Kind:          service.PrincipalUser,
+				UserID:        user.ID,
+				EmailVerified: true,
+				Roles:         []string{domain.RolePlayer},
+			},
+			SessionID: claims.SessionID,
+			ExpiresAt: claims.ExpiresAt,
+		})
+	})
+
+	t.Run("reports invalid JWT as inactive", func(t *testing.T) {
+		userService := newService()
+
+		introspection, err := userService.Introspect(context.Background(), "invalidJWT")
+		assert.RequireNoError(t, err)
+		assert.Equal(t, introspection, service.Introspection{})
+	})
+
+	t.Run("reports logged out JWT as inactive", func(t *testing.T) {
+		userService := newService()
+
+		tokens, err := userService.Login(context.Background(), user.Email, user.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		err = userService.Logout(context.Background(), tokens.AccessToken, dummyClient)
+		assert.RequireNoError(t, err)
+
+		introspection, err := userService.Introspect(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, introspection, service.Introspection{})
+	})
+}
+
+func TestLogout(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	t.Run("returns UserServiceError on invalid JWT", func(t *testing.T) {
+		invalidJWT := "invalidJWT"
+
+		repo := &StubUserRepo{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		err := userService.Logout(context.Background(), invalidJWT, dummyClient)
+		assert.ErrorType[*service.UserServiceError](t, err)
+	})
+
+	t.Run("returns ErrSessionNotFound on missing session", func(t *testing.T) {
+		repo := &StubUserRepo{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		jwt, err := crypto.GenerateJWT(jwtConfig, crypto.Claims{Subject: 10, SessionID: "unknownSession"})
+		assert.RequireNoError(t, err)
+
+		err = userService.Logout(context.Background(), jwt, dummyClient)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("ends only the session of the JWT", func(t *testing.T) {
+		wantUser := domain.User{
+			ID:        10,
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+			Password:  "samplepassword",
+		}
+
+		repo := &StubUserRepo{
+			users: hashedUsers(t, passwordConfig, wantUser),
+		}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		otherTokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+		tokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		err = userService.Logout(context.Background(), tokens.AccessToken, dummyClient)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), tokens.AccessToken)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+
+		_, err = userService.Authenticate(context.Background(), otherTokens.AccessToken)
+		assert.RequireNoError(t, err)
+	})
+}
+
+func TestPurgeExpiredSessions(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	t.Run("removes only expired sessions", func(t *testing.T) {
+		sessionRepo := NewStubSessionRepo()
+		sessionRepo.sessions["expiredSession"] = domain.Session{
+			ID:        "expiredSession",
+			UserID:    10,
+			ExpiresAt: time.Now().Add(-time.Second),
+		}
+		sessionRepo.sessions["activeSession"] = domain.Session{
+			ID:        "activeSession",
+			UserID:    10,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		repo := &StubUserRepo{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		purged, err := userService.PurgeExpiredSessions(context.Background())
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, purged, 1)
+		if _, ok := sessionRepo.sessions["activeSession"]; !ok {
+			t.Errorf("purged active session")
+		}
+	})
+}
+
+func TestSessionManagement(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	users := []domain.User{
+		{
+			ID:       10,
+			Email:    "johndoe@example.com",
+			Password: "samplepassword",
+		},
+		{
+			ID:       11,
+			Email:    "janedoe@example.com",
+			Password: "samplepassword",
+		},
+	}
+
+	sessionID := func(t testing.TB, jwt string) string {
+		t.Helper()
+
+		claims, err := crypto.ParseJWT(jwtConfig, jwt)
+		assert.RequireNoError(t, err)
+
+		return claims.SessionID
+	}
+
+	t.Run("lists active sessions of the caller", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, users...)}
+		sessionRepo := NewStubSessionRepo()
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		otherTokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+		tokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+		_, err = userService.Login(context.Background(), users[1].Email, users[1].Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		sessionRepo.sessions["expiredSession"] = domain.Session{
+			ID:        "expiredSession",
+			UserID:    users[0].ID,
+			ExpiresAt: time.Now().Add(-time.Second),
+		}
+
+		sessions, currentID, err := userService.ListSessions(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, currentID, sessionID(t, tokens.AccessToken))
+		assert.Equal(t, len(sessions), 2)
+		for _, session := range sessions {
+			if session.ID != currentID && session.ID != sessionID(t, otherTokens.AccessToken) {
+				t.Errorf("got unexpected session %q", session.ID)
+			}
+		}
+	})
+
+	t.Run("revokes session of the caller", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, users...)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		otherTokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+		tokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		err = userService.RevokeSession(context.Background(), tokens.AccessToken, sessionID(t, otherTokens.AccessToken))
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), otherTokens.AccessToken)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("returns ErrSessionNotFound on session of another user", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, users...)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		tokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+		otherUserTokens, err := userService.Login(context.Background(), users[1].Email, users[1].Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		err = userService.RevokeSession(context.Background(), tokens.AccessToken, sessionID(t, otherUserTokens.AccessToken))
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+
+		_, err = userService.Authenticate(context.Background(), otherUserTokens.AccessToken)
+		assert.RequireNoError(t, err)
+	})
+
+	t.Run("revokes every other session of the caller", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, users...)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		firstTokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+		secondTokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+		tokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+		otherUserTokens, err := userService.Login(context.Background(), users[1].Email, users[1].Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		revoked, err := userService.RevokeOtherSessions(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, revoked, 2)
+
+		for _, jwt := range []string{firstTokens.AccessToken, secondTokens.AccessToken} {
+			_, err = userService.Authenticate(context.Background(), jwt)
+			assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+		}
+
+		_, err = userService.Authenticate(context.Background(), tokens.AccessToken)
+		assert.RequireNoError(t, err)
+		_, err = userService.Authenticate(context.Background(), otherUserTokens.AccessToken)
+		assert.RequireNoError(t, err)
+	})
+
+	t.Run("revokes all sessions of a user", func(t *testing.T) {
+		repo := &StubUserRepo{users: hashedUsers(t, passwordConfig, users...)}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		tokens, err := userService.Login(context.Background(), users[0].Email, users[0].Password, dummyClient)
+		assert.RequireNoError(t, err)
+
+		revoked, err := userService.RevokeAllUserSessions(context.Background(), users[0].ID, service.Actor{})
+		assert.RequireNoError(t, err)
+		assert.Equal(t, revoked, 1)
+
+		_, err = userService.Authenticate(context.Background(), tokens.AccessToken)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+
+		_, err = userService.Refresh(context.Background(), tokens.RefreshToken)
+		assert.Equal(t, err, (error)(service.ErrInvalidRefreshToken))
+	})
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
+)
+
+// ListSessions returns the active sessions of the user the JWT belongs to
+// along with the ID of the session the JWT was issued within.
+func (u *UserService) ListSessions(ctx context.Context, jwt string) ([]domain.Session, string, error) {
+	current, err := u.authenticateSession(ctx, jwt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessions, err := u.ListUserSessions(ctx, current.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sessions, current.ID, nil
+}
+
+// RevokeSession ends one of the caller's own sessions, which may be the
+// current one.
+func (u *UserService) RevokeSession(ctx context.Context, jwt string, sessionID string) error {
+	current, err := u.authenticateSession(ctx, jwt)
+	if err != nil {
+		return err
+	}
+
+	err = u.revokeUserSession(ctx, current.UserID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	u.recordAudit(ctx, audit.Event{
+		Type:    audit.EventSessionRevoked,
+		ActorID: current.UserID,
+		Target:  audit.SessionTarget(sessionID),
+		Result:  audit.ResultSuccess,
+	}, sessionClient(current))
+
+	return nil
+}
+
+// RevokeOtherSessions ends every session of the caller except the current
+// one and returns how many were ended.
+func (u *UserService) RevokeOtherSessions(ctx context.Context, jwt string) (int, error) {
+	current, err := u.authenticateSession(ctx, jwt)
+	if err != nil {
+		return 0, err
+	}
+
+	ended, err := u.endUserSessions(ctx, current.UserID, current.ID)
+	if err != nil {
+		return ended, err
+	}
+
+	u.recordAudit(ctx, audit.Event{
+		Type:    audit.EventSessionsRevoked,
+		ActorID: current.UserID,
+		Result:  audit.ResultSuccess,
+	}, sessionClient(current))
+
+	return ended, nil
+}
+
+// ListUserSessions, RevokeUserSession and RevokeAllUserSessions act on any
+// user and are meant for internal callers only. Their events are recorded
+// without an actor.
+func (u *UserService) ListUserSessions(ctx context.Context, userID int) ([]domain.Session, error) {
+	sessions, err := u.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, NewUserServiceError("couldn't list sessions", err)
+	}
+
+	now := time.Now()
+	active := make([]domain.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.IsActive(now) {
+			active = append(active, session)
+		}
+	}
+
+	return active, nil
+}
+
+func (u *UserService) RevokeUserSession(ctx context.Context, userID int, sessionID string, actor Actor) error {
+	err := u.revokeUserSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	u.recordAudit(ctx, audit.Event{
+		Type:                  audit.EventSessionRevoked,
+		ActorServiceAccountID: actor.ServiceAccountID,
+		Target:                audit.SessionTarget(sessionID),
+		Result:                audit.ResultSuccess,
+	}, actor.Client)
+
+	return nil
+}
+
+func (u *UserService) RevokeAllUserSessions(ctx context.Context, userID int, actor Actor) (int, error) {
+	ended, err := u.endUserSessions(ctx, userID, "")
+	if err != nil {
+		return ended, err
+	}
+
+	u.recordAudit(ctx, audit.Event{
+		Type:                  audit.EventSessionsRevoked,
+		ActorServiceAccountID: actor.ServiceAccountID,
+		Target:                audit.UserTarget(userID),
+		Result:                audit.ResultSuccess,
+	}, actor.Client)
+
+	return ended, nil
+}
+
+func (u *UserService) revokeUserSession(ctx context.Context, userID int, sessionID string) error {
+	session, err := u.sessionRepo.GetByID(ctx, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return NewUserServiceError("couldn't get session", err)
+	}
+
+	// other users' sessions are reported as missing so that their IDs
+	// can't be probed
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	err = u.endSession(ctx, session.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return NewUserServiceError("couldn't end session", err)
+	}
+
+	return nil
+}
+
+// endUserSessions ends every session of the user except the one with the
+// given ID and returns how many were ended.
+func (u *UserService) endUserSessions(ctx context.Context, userID int, keepID string) (int, error) {
+	sessions, err := u.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return 0, NewUserServiceError("couldn't list sessions", err)
+	}
+
+	ended := 0
+	for _, session := range sessions {
+		if session.ID == keepID {
+			continue
+		}
+
+		err = u.endSession(ctx, session.ID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return ended, NewUserServiceError("couldn't end session", err)
+		}
+		ended++
+	}
+
+	return ended, nil
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type ThrottleConfig struct {
+	// FreeAttempts is how many failed logins in a row an account gets before
+	// every further attempt has to wait.
+	FreeAttempts int
+	// BaseDelay is the first wait, doubled with every further failure up to
+	// MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAttempts failed logins in a row lock the account for
+	// LockoutDuration.
+	LockoutAttempts int
+	LockoutDuration time.Duration
+	// IPFreeAttempts is FreeAttempts for all logins from one IP. It is higher
+	// since an IP may be shared by many users.
+	IPFreeAttempts int
+	// ResetAfter forgets the failures of an account or IP that hasn't failed
+	// for this long.
+	ResetAfter time.Duration
+}
+
+var DefaultThrottleConfig = ThrottleConfig{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAttempts: 10,
+	LockoutDuration: 15 * time.Minute,
+	IPFreeAttempts:  20,
+	ResetAfter:      24 * time.Hour,
+}
+
+type attempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	locked       bool
+	// inFlight are the attempts Allow let through that haven't been
+	// released yet.
+	inFlight int
+}
+
+// LoginThrottle tracks failed logins per account and per IP. Accounts are
+// tracked by email whether they exist or not, so that throttling doesn't
+// tell which emails are registered.
+type LoginThrottle struct {
+	config ThrottleConfig
+
+	mu       sync.Mutex
+	accounts map[string]*attempts
+	ips      map[string]*attempts
+}
+
+func NewLoginThrottle(config ThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		config:   config,
+		accounts: make(map[string]*attempts),
+		ips:      make(map[string]*attempts),
+	}
+}
+
+// Allow returns how long a login for the email from the IP has to wait, zero
+// if it may go ahead. unlocked reports that the account's lockout has just
+// run out.
+//
+// An attempt that may go ahead is reserved until Release, and attempts in
+// flight are counted as if they had already failed. Otherwise parallel
+// guesses would all be let through before the first of them fails.
+func (l *LoginThrottle) Allow(email, ip string, now time.Time) (wait time.Duration, unlocked bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	account := l.track(l.accounts, accountKey(email))
+	if account.locked && !now.Before(account.blockedUntil) {
+		account.locked = false
+		account.failures = 0
+		unlocked = true
+	}
+
+	address := l.track(l.ips, ip)
+
+	wait = max(l.wait(account, l.config.FreeAttempts, now), l.wait(address, l.config.IPFreeAttempts, now))
+	if wait > 0 {
+		return wait, unlocked
+	}
+
+	account.inFlight++
+	address.inFlight++
+
+	return 0, unlocked
+}
+
+// Release ends an attempt Allow let through. It has to be called whatever
+// the outcome, after Fail or Succeed.
+func (l *LoginThrottle) Release(email, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if account, ok := l.accounts[accountKey(email)]; ok && account.inFlight > 0 {
+		account.inFlight--
+	}
+	if address, ok := l.ips[ip]; ok && address.inFlight > 0 {
+		address.inFlight--
+	}
+}
+
+// Fail records a failed login and returns whether it locked the account.
+func (l *LoginThrottle) Fail(email, ip string, now time.Time) (locked bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	account := l.fail(l.accounts, accountKey(email), l.config.FreeAttempts, now)
+	if account.failures >= l.config.LockoutAttempts && !account.locked {
+		account.locked = true
+		account.blockedUntil = now.Add(l.config.LockoutDuration)
+		locked = true
+	}
+
+	l.fail(l.ips, ip, l.config.IPFreeAttempts, now)
+
+	return locked
+}
+
+// Succeed forgets the failures of the account. Failures of the IP are kept,
+// otherwise logging into one account would reset guessing at the others.
+func (l *LoginThrottle) Succeed(email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.accounts, accountKey(email))
+}
+
+// Purge drops accounts and IPs that are no longer blocked and whose failures
+// are old enough to be forgotten.
+func (l *LoginThrottle) Purge(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.purge(l.accounts, now) + l.purge(l.ips, now)
+}
+
+func (l *LoginThrottle) track(tracked map[string]*attempts, key string) *attempts {
+	entry, ok := tracked[key]
+	if !ok {
+		entry = &attempts{}
+		tracked[key] = entry
+	}
+	return entry
+}
+
+func (l *LoginThrottle) wait(entry *attempts, freeAttempts int, now time.Time) time.Duration {
+	wait := entry.blockedUntil.Sub(now)
+	if entry.inFlight > 0 && !entry.locked {
+		wait = max(wait, l.delay(entry.failures+entry.inFlight, freeAttempts))
+	}
+	return max(wait, 0)
+}
+
+func (l *LoginThrottle) fail(tracked map[string]*attempts, key string, freeAttempts int, now time.Time) *attempts {
+	entry := l.track(tracked, key)
+	if now.Sub(entry.lastFailure) > l.config.ResetAfter {
+		*entry = attempts{inFlight: entry.inFlight}
+	}
+
+	entry.failures++
+	entry.lastFailure = now
+	if !entry.locked {
+		entry.blockedUntil = now.Add(l.delay(entry.failures, freeAttempts))
+	}
+
+	return entry
+}
+
+func (l *LoginThrottle) purge(tracked map[string]*attempts, now time.Time) int {
+	purged := 0
+	for key, entry := range tracked {
+		if entry.inFlight == 0 && now.After(entry.blockedUntil) && now.Sub(entry.lastFailure) > l.config.ResetAfter {
+			delete(tracked, key)
+			purged++
+		}
+	}
+	return purged
+}
+
+func (l *LoginThrottle) delay(failures, freeAttempts int) time.Duration {
+	if failures <= freeAttempts {
+		return 0
+	}
+
+	delay := l.config.BaseDelay
+	for i := freeAttempts + 1; i < failures && delay < l.config.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, l.config.MaxDelay)
+}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,252 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
+	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/service"
+	"github.com/joho/godotenv"
+)
+
+var dummyThrottleConfig = service.ThrottleConfig{
+	FreeAttempts:    2,
+	BaseDelay:       time.Second,
+	MaxDelay:        10 * time.Second,
+	LockoutAttempts: 6,
+	LockoutDuration: time.Hour,
+	IPFreeAttempts:  4,
+	ResetAfter:      24 * time.Hour,
+}
+
+func TestLoginThrottle(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	email := "johndoe@example.com"
+	ip := "203.0.113.7"
+
+	t.Run("backs off exponentially after free attempts", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		wantWaits := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second}
+		for _, wantWait := range wantWaits {
+			throttle.Fail(email, ip, now)
+
+			gotWait, _ := throttle.Allow(email, "198.51.100.1", now)
+			assert.Equal(t, gotWait, wantWait)
+			throttle.Release(email, "198.51.100.1")
+		}
+	})
+
+	t.Run("caps delay at MaxDelay", func(t *testing.T) {
+		config := dummyThrottleConfig
+		config.LockoutAttempts = 100
+		throttle := service.NewLoginThrottle(config)
+
+		for i := 0; i < 20; i++ {
+			throttle.Fail(email, ip, now)
+		}
+
+		gotWait, _ := throttle.Allow(email, "198.51.100.1", now)
+		assert.Equal(t, gotWait, config.MaxDelay)
+	})
+
+	t.Run("tracks account by normalized email", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		for i := 0; i < 3; i++ {
+			throttle.Fail(" JohnDoe@Example.com", ip, now)
+		}
+
+		gotWait, _ := throttle.Allow(email, "198.51.100.1", now)
+		assert.Equal(t, gotWait, time.Second)
+	})
+
+	t.Run("throttles IP across accounts", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		for _, account := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+			throttle.Fail(account, ip, now)
+		}
+
+		gotWait, _ := throttle.Allow("f@example.com", ip, now)
+		assert.Equal(t, gotWait, time.Second)
+	})
+
+	t.Run("locks and unlocks account", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		var locked bool
+		for i := 0; i < dummyThrottleConfig.LockoutAttempts; i++ {
+			locked = throttle.Fail(email, ip, now)
+		}
+		assert.Equal(t, locked, true)
+
+		gotWait, unlocked := throttle.Allow(email, "198.51.100.1", now)
+		assert.Equal(t, gotWait, dummyThrottleConfig.LockoutDuration)
+		assert.Equal(t, unlocked, false)
+
+		gotWait, unlocked = throttle.Allow(email, "198.51.100.1", now.Add(dummyThrottleConfig.LockoutDuration))
+		assert.Equal(t, gotWait, time.Duration(0))
+		assert.Equal(t, unlocked, true)
+	})
+
+	t.Run("forgets account failures on success but not IP failures", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		for i := 0; i < 5; i++ {
+			throttle.Fail(email, ip, now)
+		}
+		throttle.Succeed(email)
+
+		gotWait, _ := throttle.Allow(email, "198.51.100.1", now)
+		assert.Equal(t, gotWait, time.Duration(0))
+
+		gotWait, _ = throttle.Allow(email, ip, now)
+		assert.Equal(t, gotWait, time.Second)
+	})
+
+	t.Run("counts attempts in flight as failures", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		wantWaits := []time.Duration{0, 0, 0, time.Second}
+		for _, wantWait := range wantWaits {
+			gotWait, _ := throttle.Allow(email, ip, now)
+			assert.Equal(t, gotWait, wantWait)
+		}
+	})
+
+	t.Run("lets attempts through again once released", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		for i := 0; i < 3; i++ {
+			throttle.Allow(email, ip, now)
+		}
+		throttle.Succeed(email)
+		for i := 0; i < 3; i++ {
+			throttle.Release(email, ip)
+		}
+
+		gotWait, _ := throttle.Allow(email, ip, now)
+		assert.Equal(t, gotWait, time.Duration(0))
+	})
+
+	t.Run("keeps failure of released attempt", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		for i := 0; i < 3; i++ {
+			throttle.Allow(email, ip, now)
+			throttle.Fail(email, ip, now)
+			throttle.Release(email, ip)
+		}
+
+		gotWait, _ := throttle.Allow(email, ip, now)
+		assert.Equal(t, gotWait, time.Second)
+	})
+
+	t.Run("purges old failures", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+
+		throttle.Fail(email, ip, now)
+
+		purged := throttle.Purge(now.Add(time.Hour))
+		assert.Equal(t, purged, 0)
+
+		purged = throttle.Purge(now.Add(dummyThrottleConfig.ResetAfter + time.Second))
+		assert.Equal(t, purged, 2)
+	})
+}
+
+func TestLoginThrottling(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	dummyUser := domain.User{ID: 10, Email: "johndoe@example.com", Password: "samplepassword"}
+
+	newService := func() (*service.UserService, *service.LoginThrottle, *SpyAuditRecorder) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+		recorder := &SpyAuditRecorder{}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, &StubUserRepo{users: hashedUsers(t, passwordConfig, dummyUser)},
+			NewStubSessionRepo(), NewStubRefreshTokenRepo(), NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			throttle, recorder)
+
+		return userService, throttle, recorder
+	}
+
+	t.Run("returns ThrottleError after free attempts", func(t *testing.T) {
+		userService, _, _ := newService()
+
+		for i := 0; i < dummyThrottleConfig.FreeAttempts+1; i++ {
+			_, err := userService.Login(context.Background(), dummyUser.Email, "wrongpassword", dummyClient)
+			assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
+		}
+
+		_, err := userService.Login(context.Background(), dummyUser.Email, dummyUser.Password, dummyClient)
+		assert.ErrorType[*service.ThrottleError](t, err)
+		if !errors.Is(err, service.ErrTooManyAttempts) {
+			t.Errorf("got %v want ErrTooManyAttempts", err)
+		}
+	})
+
+	t.Run("throttles unknown email like a registered one", func(t *testing.T) {
+		userService, _, _ := newService()
+
+		for i := 0; i < dummyThrottleConfig.FreeAttempts+1; i++ {
+			_, err := userService.Login(context.Background(), "missingemail@example.com", "wrongpassword", dummyClient)
+			assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
+		}
+
+		_, err := userService.Login(context.Background(), "missingemail@example.com", "wrongpassword", dummyClient)
+		assert.ErrorType[*service.ThrottleError](t, err)
+	})
+
+	t.Run("counts password that can't be verified as failure", func(t *testing.T) {
+		throttle := service.NewLoginThrottle(dummyThrottleConfig)
+		user := dummyUser
+		user.Password = "not a hash"
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, &StubUserRepo{users: []domain.User{user}},
+			NewStubSessionRepo(), NewStubRefreshTokenRepo(), NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			throttle, &SpyAuditRecorder{})
+
+		for i := 0; i < dummyThrottleConfig.FreeAttempts+1; i++ {
+			_, err := userService.Login(context.Background(), user.Email, "samplepassword", dummyClient)
+			assert.ErrorType[*service.UserServiceError](t, err)
+		}
+
+		_, err := userService.Login(context.Background(), user.Email, "samplepassword", dummyClient)
+		assert.ErrorType[*service.ThrottleError](t, err)
+	})
+
+	t.Run("records lockout audit event", func(t *testing.T) {
+		userService, throttle, recorder := newService()
+
+		// earlier failures from another IP an hour ago, the account may try
+		// again by now and its next failure locks it
+		now := time.Now()
+		for i := 0; i < dummyThrottleConfig.LockoutAttempts-1; i++ {
+			throttle.Fail(dummyUser.Email, "198.51.100.1", now.Add(-time.Hour))
+		}
+
+		_, err := userService.Login(context.Background(), dummyUser.Email, "wrongpassword", dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
+
+		assert.Equal(t, len(recorder.events), 2)
+		assert.Equal(t, recorder.events[0].Type, audit.EventLogin)
+		assert.Equal(t, recorder.events[0].Result, audit.ResultFailure)
+		assert.Equal(t, recorder.events[1].Type, audit.EventAccountLocked)
+		assert.Equal(t, recorder.events[1].Email, dummyUser.Email)
+		assert.Equal(t, recorder.events[1].IP, dummyClient.IP)
+	})
+}
@@ -1,96 +1,678 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
 	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
 	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/mailer"
 	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
 )
 
+// MaxLookupUsers is how many IDs LookupUsers takes at once.
+const MaxLookupUsers = 100
+
+// lastSeenResolution limits how often Authenticate writes to the session,
+// a session that is in use would otherwise be updated on every request.
+const lastSeenResolution = time.Minute
+
+// auditRecordFailures counts the events that couldn't be recorded. Recording
+// doesn't fail the action it's about, so this is how lost events show up.
+var auditRecordFailures = expvar.NewInt("audit_record_failures")
+
+// Tokens is what a client gets on signup, login and refresh: a short-lived
+// JWT to authenticate with and an opaque refresh token to get the next one.
+// When the user has two-factor authentication enabled, login only gets as
+// far as MFAToken, which has to be completed with a code.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	MFAToken     string
+}
+
+// ClientInfo describes where a session was started from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// Actor is the service account another service called with, and where the
+// call came from.
+type Actor struct {
+	ServiceAccountID int
+	Client           ClientInfo
+}
+
+type PrincipalKind string
+
+const (
+	PrincipalUser           PrincipalKind = "user"
+	PrincipalServiceAccount PrincipalKind = "service_account"
+)
+
+// Principal is who an authenticated request is made by. Depending on Kind
+// either UserID or ServiceAccountID is set. Service accounts never have a
+// verified email.
+type Principal struct {
+	Kind             PrincipalKind
+	UserID           int
+	ServiceAccountID int
+	EmailVerified    bool
+	Roles            []string
+}
+
 type UserService struct {
-	jwtConfig crypto.JWTConfig
-	repo      repository.UserRepo
+	jwtConfig      crypto.JWTConfig
+	passwordConfig crypto.PasswordConfig
+	repo           repository.UserRepo
+	sessionRepo    repository.SessionRepo
+	refreshRepo    repository.RefreshTokenRepo
+	actionRepo     repository.ActionTokenRepo
+	accountRepo    repository.ServiceAccountRepo
+	mailer         mailer.Mailer
+	mailConfig     mailer.Config
+	mfaConfig      crypto.MFAConfig
+	throttle       *LoginThrottle
+	audit          audit.Log
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-func NewUserService(jwtConfig crypto.JWTConfig, repo repository.UserRepo) *UserService {
+func NewUserService(jwtConfig crypto.JWTConfig, passwordConfig crypto.PasswordConfig, mfaConfig crypto.MFAConfig,
+	repo repository.UserRepo, sessionRepo repository.SessionRepo, refreshRepo repository.RefreshTokenRepo,
+	actionRepo repository.ActionTokenRepo, accountRepo repository.ServiceAccountRepo, mailer mailer.Mailer, mailConfig mailer.Config,
+	throttle *LoginThrottle, audit audit.Log) *UserService {
 	return &UserService{
-		jwtConfig: jwtConfig,
-		repo:      repo,
+		jwtConfig:      jwtConfig,
+		passwordConfig: passwordConfig,
+		mfaConfig:      mfaConfig,
+		repo:           repo,
+		sessionRepo:    sessionRepo,
+		refreshRepo:    refreshRepo,
+		actionRepo:     actionRepo,
+		accountRepo:    accountRepo,
+		mailer:         mailer,
+		mailConfig:     mailConfig,
+		throttle:       throttle,
+		audit:          audit,
 	}
 }
 
-func (u *UserService) Create(user *domain.User) error {
-	err := u.repo.Create(user)
+// Create signs the user up and mails them a link to verify their email.
+// Failing to send the mail doesn't fail the signup, the user can ask for
+// another one.
+func (u *UserService) Create(ctx context.Context, user *domain.User, client ClientInfo) (Tokens, error) {
+	hash, err := crypto.HashPassword(u.passwordConfig, user.Password)
 	if err != nil {
-		return NewUserServiceError("couldn't create user", err)
+		return Tokens{}, NewUserServiceError("couldn't hash password", err)
 	}
+	user.Password = hash
+	user.EmailVerified = false
+	user.Roles = []string{domain.RolePlayer}
 
-	jwt, err := crypto.GenerateJWT(u.jwtConfig, user.ID)
+	err = u.repo.Create(ctx, user)
+	if errors.Is(err, repository.ErrDuplicateEmail) {
+		u.recordAudit(ctx, audit.Event{Type: audit.EventSignup, Email: user.Email, Result: audit.ResultFailure}, client)
+		return Tokens{}, ErrEmailTaken
+	}
 	if err != nil {
-		return NewUserServiceError("couldn't generate JWT", err)
+		return Tokens{}, NewUserServiceError("couldn't create user", err)
 	}
 
-	user.JWTs = []string{jwt}
+	u.recordAudit(ctx, audit.Event{Type: audit.EventSignup, ActorID: user.ID, Email: user.Email, Result: audit.ResultSuccess}, client)
+
+	u.trySendVerificationEmail(ctx, *user)
+
+	return u.startSession(ctx, *user, client)
+}
 
-	err = u.repo.Update(user)
+// Login answers an unknown email and a wrong password the same way, and
+// makes the account and the IP wait after repeated failures.
+func (u *UserService) Login(ctx context.Context, email, password string, client ClientInfo) (Tokens, error) {
+	now := time.Now()
+
+	err := u.checkThrottle(ctx, email, client, now)
 	if err != nil {
-		return NewUserServiceError("couldn't update user", err)
+		return Tokens{}, err
+	}
+	defer u.throttle.Release(email, client.IP)
+
+	user, err := u.repo.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		// spend as long as on a real password, otherwise the response time
+		// tells which emails are registered
+		u.verifyDummyPassword(password)
+		return Tokens{}, u.loginFailed(ctx, 0, email, client, now, ErrInvalidCredentials)
+	}
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't get user", err)
+	}
+
+	match, needsRehash, err := crypto.VerifyPassword(u.passwordConfig, user.Password, password)
+	if err != nil {
+		// still a guess at the password, which mustn't go uncounted
+		return Tokens{}, u.loginFailed(ctx, user.ID, email, client, now, NewUserServiceError("couldn't verify password", err))
+	}
+	if !match {
+		return Tokens{}, u.loginFailed(ctx, user.ID, email, client, now, ErrInvalidCredentials)
+	}
+
+	// the hash is upgraded here since this is the only time the plaintext
+	// password is available
+	if needsRehash {
+		if hash, err := crypto.HashPassword(u.passwordConfig, password); err == nil {
+			user.Password = hash
+			u.repo.Update(ctx, &user)
+		}
+	}
+
+	// failures are only forgotten once the second factor is in as well,
+	// otherwise the password would buy unlimited guesses at the code
+	if user.MFAEnabled {
+		mfaToken, err := u.issueActionToken(ctx, user, domain.PurposeMFALogin, mfaChallengeExpiresAt)
+		if err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{MFAToken: mfaToken}, nil
+	}
+
+	return u.loginSucceeded(ctx, user, client)
+}
+
+// checkThrottle reserves the login attempt when it may go ahead, the caller
+// has to release it once the attempt failed or succeeded.
+func (u *UserService) checkThrottle(ctx context.Context, email string, client ClientInfo, now time.Time) error {
+	wait, unlocked := u.throttle.Allow(email, client.IP, now)
+	if unlocked {
+		u.recordAudit(ctx, audit.Event{Type: audit.EventAccountUnlocked, Email: email, Result: audit.ResultSuccess, Time: now}, client)
+	}
+	if wait > 0 {
+		return &ThrottleError{RetryAfter: wait}
 	}
 
 	return nil
 }
 
-func (u *UserService) Login(email, password string) (string, error) {
-	user, err := u.repo.GetByEmail(email)
+// loginFailed takes the ID of the user when the email belongs to one, or 0.
+func (u *UserService) loginFailed(ctx context.Context, userID int, email string, client ClientInfo, now time.Time, err error) error {
+	u.recordAudit(ctx, audit.Event{Type: audit.EventLogin, ActorID: userID, Email: email, Result: audit.ResultFailure, Time: now}, client)
+
+	if u.throttle.Fail(email, client.IP, now) {
+		u.recordAudit(ctx, audit.Event{Type: audit.EventAccountLocked, ActorID: userID, Email: email, Result: audit.ResultSuccess, Time: now}, client)
+	}
+
+	return err
+}
+
+func (u *UserService) loginSucceeded(ctx context.Context, user domain.User, client ClientInfo) (Tokens, error) {
+	u.throttle.Succeed(user.Email)
+
+	u.recordAudit(ctx, audit.Event{Type: audit.EventLogin, ActorID: user.ID, Email: user.Email, Result: audit.ResultSuccess}, client)
+
+	return u.startSession(ctx, user, client)
+}
+
+// recordAudit fills in the client and, unless it's set, the time of the
+// event. A failure to record is logged rather than failing the action. The
+// event is recorded even if the caller has gone away by then, since the
+// action it describes has already happened.
+func (u *UserService) recordAudit(ctx context.Context, event audit.Event, client ClientInfo) {
+	event.IP = client.IP
+	event.UserAgent = client.UserAgent
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	err := u.audit.Record(context.WithoutCancel(ctx), event.Truncate())
 	if err != nil {
-		return "", ErrEmailNotFound
+		auditRecordFailures.Add(1)
+		log.Printf("Audit record error: %v", err)
 	}
+}
 
-	if user.Password != password {
-		return "", ErrWrongPassword
+// sessionClient is the client a session was started from. Most methods that
+// take a JWT aren't given the client, so their events are recorded with
+// this one.
+func sessionClient(session domain.Session) ClientInfo {
+	return ClientInfo{UserAgent: session.UserAgent, IP: session.IP}
+}
+
+func (u *UserService) verifyDummyPassword(password string) {
+	u.dummyHashOnce.Do(func() {
+		u.dummyHash, _ = crypto.HashPassword(u.passwordConfig, "dummy password")
+	})
+
+	crypto.VerifyPassword(u.passwordConfig, u.dummyHash, password)
+}
+
+// Refresh exchanges a refresh token for a new pair of tokens and extends
+// the session. The refresh token can be used only once, using it again ends
+// the session it belongs to.
+func (u *UserService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	now := time.Now()
+
+	token, err := u.refreshRepo.GetByHash(ctx, crypto.HashOpaqueToken(refreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't get refresh token", err)
 	}
 
-	jwt, _ := crypto.GenerateJWT(u.jwtConfig, user.ID)
-	user.JWTs = append(user.JWTs, jwt)
+	if token.Revoked || token.IsExpired(now) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
 
-	u.repo.Update(&user)
+	ok, err := u.refreshRepo.MarkUsed(ctx, token.TokenHash)
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't update refresh token", err)
+	}
+	if !ok {
+		err = u.endSession(ctx, token.FamilyID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return Tokens{}, NewUserServiceError("couldn't end session", err)
+		}
+		return Tokens{}, ErrRefreshTokenReused
+	}
 
-	return jwt, nil
+	session, err := u.sessionRepo.GetByID(ctx, token.FamilyID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return Tokens{}, NewUserServiceError("couldn't get session", err)
+	}
+	if err != nil || !session.IsActive(now) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(u.jwtConfig.RefreshExpiresAt)
+
+	err = u.sessionRepo.Update(ctx, &session)
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't update session", err)
+	}
+
+	// the user is read again so that the new JWT picks up changes like a
+	// freshly verified email
+	user, err := u.repo.GetByID(ctx, session.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't get user", err)
+	}
+
+	return u.issueTokens(ctx, session, user)
 }
 
-func (u *UserService) Authenticate(jwt string) (int, error) {
-	id, err := crypto.VerifyJWT(u.jwtConfig, jwt)
+// Authenticate accepts either a user JWT or a service account API key.
+func (u *UserService) Authenticate(ctx context.Context, token string) (Principal, error) {
+	if crypto.IsAPIKey(token) {
+		return u.authenticateAPIKey(ctx, token)
+	}
+
+	claims, _, err := u.authenticate(ctx, token)
 	if err != nil {
-		return -1, ErrInvalidJWT.Wrap(err)
+		return Principal{}, err
 	}
 
-	_, err = u.repo.GetByID(id)
+	return Principal{
+		Kind:          PrincipalUser,
+		UserID:        claims.Subject,
+		EmailVerified: claims.EmailVerified,
+		Roles:         claims.Roles,
+	}, nil
+}
+
+// Introspection describes a token as far as other services need to know.
+// Inactive tokens carry nothing but Active. SessionID is only set for
+// users.
+type Introspection struct {
+	Active bool
+	Principal
+	SessionID string
+	ExpiresAt time.Time
+}
+
+// Introspect is Authenticate for services that want to know more about a
+// token. A token that doesn't authenticate anyone is reported as inactive
+// rather than with an error, an error means it couldn't be checked.
+func (u *UserService) Introspect(ctx context.Context, token string) (Introspection, error) {
+	if crypto.IsAPIKey(token) {
+		return u.introspectAPIKey(ctx, token)
+	}
+
+	claims, session, err := u.authenticate(ctx, token)
+	if errors.Is(err, ErrInvalidJWT) || errors.Is(err, ErrSessionNotFound) {
+		return Introspection{}, nil
+	}
 	if err != nil {
-		return -1, ErrUserNotFound
+		return Introspection{}, err
 	}
 
-	return id, nil
+	return Introspection{
+		Active: true,
+		Principal: Principal{
+			Kind:          PrincipalUser,
+			UserID:        claims.Subject,
+			EmailVerified: claims.EmailVerified,
+			Roles:         claims.Roles,
+		},
+		SessionID: session.ID,
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
 }
 
-func (u *UserService) Logout(jwt string) error {
-	id, err := crypto.VerifyJWT(u.jwtConfig, jwt)
+func (u *UserService) Logout(ctx context.Context, jwt string, client ClientInfo) error {
+	claims, err := crypto.ParseJWT(u.jwtConfig, jwt)
 	if err != nil {
 		return ErrInvalidJWT.Wrap(err)
 	}
 
-	user, err := u.repo.GetByID(id)
+	err = u.endSession(ctx, claims.SessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrSessionNotFound
+	}
 	if err != nil {
-		return ErrUserNotFound
+		return NewUserServiceError("couldn't end session", err)
 	}
 
-	err = user.InvalidateJWT(jwt)
+	u.recordAudit(ctx, audit.Event{
+		Type:    audit.EventLogout,
+		ActorID: claims.Subject,
+		Target:  audit.SessionTarget(claims.SessionID),
+		Result:  audit.ResultSuccess,
+	}, client)
+
+	return nil
+}
+
+// PurgeExpiredSessions removes sessions that can no longer be refreshed and
+// returns how many were removed.
+func (u *UserService) PurgeExpiredSessions(ctx context.Context) (int, error) {
+	purged, err := u.sessionRepo.DeleteExpired(ctx, time.Now())
 	if err != nil {
-		return ErrInvalidJWT.Wrap(err)
+		return 0, NewUserServiceError("couldn't purge sessions", err)
+	}
+
+	return purged, nil
+}
+
+func (u *UserService) GetUser(ctx context.Context, jwt string) (domain.User, error) {
+	user, _, err := u.authenticateUser(ctx, jwt)
+	return user, err
+}
+
+// LookupUser is for other services that already know who they are asking
+// about, it doesn't authenticate anyone.
+func (u *UserService) LookupUser(ctx context.Context, id int) (domain.User, error) {
+	user, err := u.repo.GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return domain.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return domain.User{}, NewUserServiceError("couldn't get user", err)
+	}
+
+	return user, nil
+}
+
+// LookupUsers is LookupUser for up to MaxLookupUsers IDs. Users that don't
+// exist are left out, the rest are returned in the order of the IDs.
+func (u *UserService) LookupUsers(ctx context.Context, ids []int) ([]domain.User, error) {
+	if len(ids) > MaxLookupUsers {
+		return nil, ErrTooManyUsers
+	}
+	if len(ids) == 0 {
+		return []domain.User{}, nil
+	}
+
+	found, err := u.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, NewUserServiceError("couldn't get users", err)
+	}
+
+	byID := make(map[int]domain.User, len(found))
+	for _, user := range found {
+		byID[user.ID] = user
+	}
+
+	users := make([]domain.User, 0, len(found))
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			users = append(users, user)
+			delete(byID, id)
+		}
+	}
+
+	return users, nil
+}
+
+// UpdateUser changes the profile of the user the JWT belongs to. Empty
+// fields are left as they are. A new email has to be verified again, and
+// since password resets go to it, changing it takes the current password
+// and a second factor if the user has MFA enabled, just like ChangePassword.
+func (u *UserService) UpdateUser(ctx context.Context, jwt string, firstName, lastName, email, password, code string) (domain.User, error) {
+	user, _, err := u.authenticateUser(ctx, jwt)
+	if err != nil {
+		return domain.User{}, err
 	}
 
-	err = u.repo.Update(&user)
+	emailChanged := email != "" && email != user.Email
+	if emailChanged {
+		err = u.confirmIdentity(ctx, user, password, code)
+		if err != nil {
+			return domain.User{}, err
+		}
+	}
+
+	if firstName != "" {
+		user.FirstName = firstName
+	}
+	if lastName != "" {
+		user.LastName = lastName
+	}
+	if emailChanged {
+		user.Email = email
+		user.EmailVerified = false
+	}
+
+	err = u.repo.Update(ctx, &user)
+	if errors.Is(err, repository.ErrDuplicateEmail) {
+		return domain.User{}, ErrEmailTaken
+	}
+	if err != nil {
+		return domain.User{}, NewUserServiceError("couldn't update user", err)
+	}
+
+	if emailChanged {
+		u.trySendVerificationEmail(ctx, user)
+	}
+
+	return user, nil
+}
+
+// ChangePassword requires the current password even though the caller is
+// authenticated, so that a stolen JWT isn't enough to take over the account.
+// All other sessions of the user are ended.
+func (u *UserService) ChangePassword(ctx context.Context, jwt string, oldPassword, newPassword string) error {
+	user, session, err := u.authenticateUser(ctx, jwt)
+	if err != nil {
+		return err
+	}
+
+	match, _, err := crypto.VerifyPassword(u.passwordConfig, user.Password, oldPassword)
+	if err != nil {
+		return NewUserServiceError("couldn't verify password", err)
+	}
+	if !match {
+		u.recordAudit(ctx, audit.Event{Type: audit.EventPasswordChanged, ActorID: user.ID, Email: user.Email, Result: audit.ResultFailure},
+			sessionClient(session))
+		return ErrWrongPassword
+	}
+
+	hash, err := crypto.HashPassword(u.passwordConfig, newPassword)
+	if err != nil {
+		return NewUserServiceError("couldn't hash password", err)
+	}
+
+	user.Password = hash
+
+	err = u.repo.Update(ctx, &user)
 	if err != nil {
 		return NewUserServiceError("couldn't update user", err)
 	}
 
+	u.recordAudit(ctx, audit.Event{Type: audit.EventPasswordChanged, ActorID: user.ID, Email: user.Email, Result: audit.ResultSuccess},
+		sessionClient(session))
+
+	_, err = u.endUserSessions(ctx, user.ID, session.ID)
+	return err
+}
+
+// Delete removes the user along with their sessions. The database drops
+// the sessions on its own, but they're ended through the session repository
+// first so that cached copies of them stop authenticating right away.
+func (u *UserService) Delete(ctx context.Context, jwt string) error {
+	user, session, err := u.authenticateUser(ctx, jwt)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.endUserSessions(ctx, user.ID, "")
+	if err != nil {
+		return err
+	}
+
+	err = u.repo.Delete(ctx, user.ID)
+	if err != nil {
+		return NewUserServiceError("couldn't delete user", err)
+	}
+
+	u.recordAudit(ctx, audit.Event{Type: audit.EventAccountDeleted, ActorID: user.ID, Email: user.Email, Result: audit.ResultSuccess},
+		sessionClient(session))
+
 	return nil
 }
+
+func (u *UserService) startSession(ctx context.Context, user domain.User, client ClientInfo) (Tokens, error) {
+	sessionID, err := crypto.GenerateOpaqueToken()
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't generate session ID", err)
+	}
+
+	now := time.Now()
+	session := domain.Session{
+		ID:         sessionID,
+		UserID:     user.ID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(u.jwtConfig.RefreshExpiresAt),
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+	}
+
+	err = u.sessionRepo.Create(ctx, &session)
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't create session", err)
+	}
+
+	return u.issueTokens(ctx, session, user)
+}
+
+// endSession deletes the session and revokes its refresh tokens, so that
+// neither its JWTs nor its refresh tokens are accepted anymore.
+func (u *UserService) endSession(ctx context.Context, sessionID string) error {
+	err := u.refreshRepo.RevokeFamily(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return u.sessionRepo.Delete(ctx, sessionID)
+}
+
+func (u *UserService) issueTokens(ctx context.Context, session domain.Session, user domain.User) (Tokens, error) {
+	jwt, err := crypto.GenerateJWT(u.jwtConfig, crypto.Claims{
+		Subject:       session.UserID,
+		SessionID:     session.ID,
+		EmailVerified: user.EmailVerified,
+		Roles:         user.Roles,
+	})
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't generate JWT", err)
+	}
+
+	refreshToken, err := crypto.GenerateOpaqueToken()
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't generate refresh token", err)
+	}
+
+	err = u.refreshRepo.Create(ctx, &domain.RefreshToken{
+		TokenHash: crypto.HashOpaqueToken(refreshToken),
+		UserID:    session.UserID,
+		FamilyID:  session.ID,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return Tokens{}, NewUserServiceError("couldn't store refresh token", err)
+	}
+
+	return Tokens{AccessToken: jwt, RefreshToken: refreshToken}, nil
+}
+
+// authenticateSession returns the session the JWT was issued within, as
+// long as it hasn't been logged out or expired.
+func (u *UserService) authenticateSession(ctx context.Context, jwt string) (domain.Session, error) {
+	_, session, err := u.authenticate(ctx, jwt)
+	return session, err
+}
+
+func (u *UserService) authenticate(ctx context.Context, jwt string) (crypto.Claims, domain.Session, error) {
+	claims, err := crypto.ParseJWT(u.jwtConfig, jwt)
+	if err != nil {
+		return crypto.Claims{}, domain.Session{}, ErrInvalidJWT.Wrap(err)
+	}
+
+	session, err := u.sessionRepo.GetByID(ctx, claims.SessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return crypto.Claims{}, domain.Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return crypto.Claims{}, domain.Session{}, NewUserServiceError("couldn't get session", err)
+	}
+
+	now := time.Now()
+	if session.UserID != claims.Subject || !session.IsActive(now) {
+		return crypto.Claims{}, domain.Session{}, ErrSessionNotFound
+	}
+
+	if now.Sub(session.LastSeenAt) >= lastSeenResolution {
+		session.LastSeenAt = now
+		u.sessionRepo.Update(ctx, &session)
+	}
+
+	return claims, session, nil
+}
+
+func (u *UserService) authenticateUser(ctx context.Context, jwt string) (domain.User, domain.Session, error) {
+	session, err := u.authenticateSession(ctx, jwt)
+	if err != nil {
+		return domain.User{}, domain.Session{}, err
+	}
+
+	user, err := u.repo.GetByID(ctx, session.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return domain.User{}, domain.Session{}, ErrUserNotFound
+	}
+	if err != nil {
+		return domain.User{}, domain.Session{}, NewUserServiceError("couldn't get user", err)
+	}
+
+	return user, session, nil
+}
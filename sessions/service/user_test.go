@@ -1,11 +1,17 @@
 package service_test
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/VitoNaychev/elysium-challenge/assert"
 	"github.com/VitoNaychev/elysium-challenge/crypto"
+	"github.com/VitoNaychev/elysium-challenge/sessions/audit"
 	"github.com/VitoNaychev/elysium-challenge/sessions/domain"
+	"github.com/VitoNaychev/elysium-challenge/sessions/mailer"
 	"github.com/VitoNaychev/elysium-challenge/sessions/repository"
 	"github.com/VitoNaychev/elysium-challenge/sessions/service"
 	"github.com/joho/godotenv"
@@ -15,24 +21,36 @@ type StubUserRepo struct {
 	users []domain.User
 
 	nextUserID    int
+	dummyErr      error
 	spyCreateUser domain.User
 	spyUpdateUser domain.User
+	spyDeleteID   int
 }
 
-func (s *StubUserRepo) Create(user *domain.User) error {
+func (s *StubUserRepo) Create(ctx context.Context, user *domain.User) error {
 	user.ID = s.nextUserID
 	s.spyCreateUser = *user
 
-	return nil
+	return s.dummyErr
 }
 
-func (s *StubUserRepo) Update(user *domain.User) error {
+func (s *StubUserRepo) Update(ctx context.Context, user *domain.User) error {
 	s.spyUpdateUser = *user
 
-	return nil
+	return s.dummyErr
+}
+
+func (s *StubUserRepo) Delete(ctx context.Context, id int) error {
+	s.spyDeleteID = id
+
+	return s.dummyErr
 }
 
-func (s *StubUserRepo) GetByEmail(email string) (domain.User, error) {
+func (s *StubUserRepo) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
 	for _, user := range s.users {
 		if user.Email == email {
 			return user, nil
@@ -42,7 +60,7 @@ func (s *StubUserRepo) GetByEmail(email string) (domain.User, error) {
 	return domain.User{}, repository.ErrNotFound
 }
 
-func (s *StubUserRepo) GetByID(id int) (domain.User, error) {
+func (s *StubUserRepo) GetByID(ctx context.Context, id int) (domain.User, error) {
 	for _, user := range s.users {
 		if user.ID == id {
 			return user, nil
@@ -52,12 +70,365 @@ func (s *StubUserRepo) GetByID(id int) (domain.User, error) {
 	return domain.User{}, repository.ErrNotFound
 }
 
+func (s *StubUserRepo) GetByIDs(ctx context.Context, ids []int) ([]domain.User, error) {
+	users := []domain.User{}
+	for _, user := range s.users {
+		if slices.Contains(ids, user.ID) {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+func (s *StubUserRepo) ConsumeRecoveryCode(ctx context.Context, id int, codeHash string) (bool, error) {
+	for i, user := range s.users {
+		if user.ID != id {
+			continue
+		}
+
+		for j, hash := range user.RecoveryCodes {
+			if hash == codeHash {
+				s.users[i].RecoveryCodes = append(user.RecoveryCodes[:j:j], user.RecoveryCodes[j+1:]...)
+				return true, nil
+			}
+		}
+	}
+
+	return false, s.dummyErr
+}
+
+func (s *StubUserRepo) AdvanceMFAStep(ctx context.Context, id int, step int64) (bool, error) {
+	for i, user := range s.users {
+		if user.ID == id && user.MFALastStep < step {
+			s.users[i].MFALastStep = step
+			return true, nil
+		}
+	}
+
+	return false, s.dummyErr
+}
+
+type StubRefreshTokenRepo struct {
+	tokens map[string]domain.RefreshToken
+}
+
+func NewStubRefreshTokenRepo() *StubRefreshTokenRepo {
+	return &StubRefreshTokenRepo{
+		tokens: make(map[string]domain.RefreshToken),
+	}
+}
+
+func (s *StubRefreshTokenRepo) Create(ctx context.Context, token *domain.RefreshToken) error {
+	s.tokens[token.TokenHash] = *token
+
+	return nil
+}
+
+func (s *StubRefreshTokenRepo) GetByHash(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	token, ok := s.tokens[tokenHash]
+	if !ok {
+		return domain.RefreshToken{}, repository.ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (s *StubRefreshTokenRepo) MarkUsed(ctx context.Context, tokenHash string) (bool, error) {
+	token := s.tokens[tokenHash]
+	if token.Used {
+		return false, nil
+	}
+
+	token.Used = true
+	s.tokens[tokenHash] = token
+
+	return true, nil
+}
+
+func (s *StubRefreshTokenRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	for hash, token := range s.tokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+			s.tokens[hash] = token
+		}
+	}
+
+	return nil
+}
+
+type StubSessionRepo struct {
+	sessions map[string]domain.Session
+}
+
+func NewStubSessionRepo() *StubSessionRepo {
+	return &StubSessionRepo{
+		sessions: make(map[string]domain.Session),
+	}
+}
+
+func (s *StubSessionRepo) Create(ctx context.Context, session *domain.Session) error {
+	s.sessions[session.ID] = *session
+
+	return nil
+}
+
+func (s *StubSessionRepo) Update(ctx context.Context, session *domain.Session) error {
+	s.sessions[session.ID] = *session
+
+	return nil
+}
+
+func (s *StubSessionRepo) Delete(ctx context.Context, id string) error {
+	if _, ok := s.sessions[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(s.sessions, id)
+
+	return nil
+}
+
+func (s *StubSessionRepo) GetByID(ctx context.Context, id string) (domain.Session, error) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return domain.Session{}, repository.ErrNotFound
+	}
+
+	return session, nil
+}
+
+func (s *StubSessionRepo) ListByUser(ctx context.Context, userID int) ([]domain.Session, error) {
+	var sessions []domain.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *StubSessionRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	purged := 0
+	for id, session := range s.sessions {
+		if !session.IsActive(now) {
+			delete(s.sessions, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+type StubActionTokenRepo struct {
+	tokens map[string]domain.ActionToken
+}
+
+func NewStubActionTokenRepo() *StubActionTokenRepo {
+	return &StubActionTokenRepo{
+		tokens: make(map[string]domain.ActionToken),
+	}
+}
+
+func (s *StubActionTokenRepo) Create(ctx context.Context, token *domain.ActionToken) error {
+	s.tokens[token.ID] = *token
+
+	return nil
+}
+
+func (s *StubActionTokenRepo) Consume(ctx context.Context, id string) (bool, error) {
+	token, ok := s.tokens[id]
+	if !ok || token.Used {
+		return false, nil
+	}
+
+	token.Used = true
+	s.tokens[id] = token
+
+	return true, nil
+}
+
+func (s *StubActionTokenRepo) DeleteByUser(ctx context.Context, userID int, purpose string) error {
+	for id, token := range s.tokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(s.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *StubActionTokenRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	purged := 0
+	for id, token := range s.tokens {
+		if !now.Before(token.ExpiresAt) {
+			delete(s.tokens, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+type StubServiceAccountRepo struct {
+	accounts map[int]domain.ServiceAccount
+	keys     map[string]domain.APIKey
+	nextID   int
+}
+
+func NewStubServiceAccountRepo() *StubServiceAccountRepo {
+	return &StubServiceAccountRepo{
+		accounts: make(map[int]domain.ServiceAccount),
+		keys:     make(map[string]domain.APIKey),
+		nextID:   1,
+	}
+}
+
+func (s *StubServiceAccountRepo) Create(ctx context.Context, account *domain.ServiceAccount) error {
+	account.ID = s.nextID
+	s.nextID++
+	s.accounts[account.ID] = *account
+
+	return nil
+}
+
+func (s *StubServiceAccountRepo) GetByID(ctx context.Context, id int) (domain.ServiceAccount, error) {
+	account, ok := s.accounts[id]
+	if !ok {
+		return domain.ServiceAccount{}, repository.ErrNotFound
+	}
+
+	return account, nil
+}
+
+func (s *StubServiceAccountRepo) List(ctx context.Context) ([]domain.ServiceAccount, error) {
+	accounts := []domain.ServiceAccount{}
+	for id := 1; id < s.nextID; id++ {
+		if account, ok := s.accounts[id]; ok {
+			accounts = append(accounts, account)
+		}
+	}
+
+	return accounts, nil
+}
+
+func (s *StubServiceAccountRepo) Delete(ctx context.Context, id int) error {
+	if _, ok := s.accounts[id]; !ok {
+		return repository.ErrNotFound
+	}
+
+	delete(s.accounts, id)
+	for keyID, key := range s.keys {
+		if key.ServiceAccountID == id {
+			delete(s.keys, keyID)
+		}
+	}
+
+	return nil
+}
+
+func (s *StubServiceAccountRepo) CreateKey(ctx context.Context, key *domain.APIKey) error {
+	s.keys[key.ID] = *key
+
+	return nil
+}
+
+func (s *StubServiceAccountRepo) GetKeyByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	for _, key := range s.keys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+
+	return domain.APIKey{}, repository.ErrNotFound
+}
+
+func (s *StubServiceAccountRepo) ListKeys(ctx context.Context, serviceAccountID int) ([]domain.APIKey, error) {
+	keys := []domain.APIKey{}
+	for _, key := range s.keys {
+		if key.ServiceAccountID == serviceAccountID {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *StubServiceAccountRepo) RevokeKey(ctx context.Context, serviceAccountID int, id string) error {
+	key, ok := s.keys[id]
+	if !ok || key.ServiceAccountID != serviceAccountID {
+		return repository.ErrNotFound
+	}
+
+	key.Revoked = true
+	s.keys[id] = key
+
+	return nil
+}
+
+type SpyMailer struct {
+	messages []mailer.Message
+}
+
+func (s *SpyMailer) Send(message mailer.Message) error {
+	s.messages = append(s.messages, message)
+
+	return nil
+}
+
+type SpyAuditRecorder struct {
+	events []audit.Event
+	err    error
+}
+
+func (s *SpyAuditRecorder) Record(ctx context.Context, event audit.Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	event.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *SpyAuditRecorder) Query(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	events := []audit.Event{}
+	for i := len(s.events) - 1; i >= 0 && len(events) < filter.Limit; i-- {
+		event := s.events[i]
+		if (filter.ActorID != 0 && event.ActorID != filter.ActorID) ||
+			(filter.Email != "" && event.Email != filter.Email) ||
+			(filter.Type != "" && event.Type != filter.Type) ||
+			(filter.Result != "" && event.Result != filter.Result) ||
+			(filter.Before != 0 && event.ID >= filter.Before) {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+var dummyMailConfig = mailer.Config{
+	VerifyEmailURL:   "http://localhost/verify",
+	ResetPasswordURL: "http://localhost/reset",
+}
+
+var dummyClient = service.ClientInfo{
+	UserAgent: "sampleAgent",
+	IP:        "203.0.113.7",
+}
+
 func TestCreateUser(t *testing.T) {
 	godotenv.Load("../test.env")
 
 	jwtConfig, err := crypto.InitJWTConfigFromEnv()
 	assert.RequireNoError(t, err)
 
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
 	t.Run("stores new user", func(t *testing.T) {
 		wantUserID := 10
 		wantUser := domain.User{
@@ -68,13 +439,19 @@ func TestCreateUser(t *testing.T) {
 		}
 
 		repo := &StubUserRepo{nextUserID: wantUserID}
-		userService := service.NewUserService(jwtConfig, repo)
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
 		dirtyUser := wantUser
-		err := userService.Create(&dirtyUser)
+		_, err := userService.Create(context.Background(), &dirtyUser, dummyClient)
 		assert.RequireNoError(t, err)
 
+		assertPasswordHash(t, passwordConfig, repo.spyCreateUser.Password, wantUser.Password)
+
 		wantUser.ID = wantUserID
+		wantUser.Password = repo.spyCreateUser.Password
+		wantUser.Roles = []string{domain.RolePlayer}
 		assert.Equal(t, repo.spyCreateUser, wantUser)
 	})
 
@@ -88,22 +465,37 @@ func TestCreateUser(t *testing.T) {
 		}
 
 		repo := &StubUserRepo{nextUserID: wantUserID}
-		userService := service.NewUserService(jwtConfig, repo)
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
 		dirtyUser := wantUser
-		err := userService.Create(&dirtyUser)
+		tokens, err := userService.Create(context.Background(), &dirtyUser, dummyClient)
 		assert.RequireNoError(t, err)
 
-		if len(dirtyUser.JWTs) != 1 {
-			t.Fatalf("got %v JWTs but want one", len(dirtyUser.JWTs))
+		assertValidJWT(t, jwtConfig, tokens.AccessToken, wantUserID)
+	})
+
+	t.Run("returns ErrEmailTaken on duplicate email", func(t *testing.T) {
+		user := domain.User{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+			Password:  "samplepassword",
 		}
 
-		assertValidJWT(t, jwtConfig, dirtyUser.JWTs[0], wantUserID)
+		repo := &StubUserRepo{dummyErr: repository.ErrDuplicateEmail}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		_, err := userService.Create(context.Background(), &user, dummyClient)
+		assert.Equal(t, err, (error)(service.ErrEmailTaken))
 	})
 
-	t.Run("updates JWT array", func(t *testing.T) {
+	t.Run("starts session", func(t *testing.T) {
 		wantUserID := 10
-		wantUser := domain.User{
+		user := domain.User{
 			FirstName: "John",
 			LastName:  "Doe",
 			Email:     "johndoe@example.com",
@@ -111,21 +503,15 @@ func TestCreateUser(t *testing.T) {
 		}
 
 		repo := &StubUserRepo{nextUserID: wantUserID}
-		userService := service.NewUserService(jwtConfig, repo)
+		sessionRepo := NewStubSessionRepo()
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		dirtyUser := wantUser
-		err := userService.Create(&dirtyUser)
+		tokens, err := userService.Create(context.Background(), &user, dummyClient)
 		assert.RequireNoError(t, err)
 
-		// check that the JWT was persisted in the repository
-		if len(repo.spyUpdateUser.JWTs) != 1 {
-			t.Fatalf("got %v JWTs but want one", len(repo.spyUpdateUser.JWTs))
-		}
-
-		// check that all other data is unchanged
-		wantUser.ID = wantUserID
-		wantUser.JWTs = repo.spyUpdateUser.JWTs
-		assert.Equal(t, repo.spyUpdateUser, wantUser)
+		assertSession(t, jwtConfig, sessionRepo, tokens.AccessToken, wantUserID)
 	})
 }
 
@@ -135,7 +521,13 @@ func TestLoginUser(t *testing.T) {
 	jwtConfig, err := crypto.InitJWTConfigFromEnv()
 	assert.RequireNoError(t, err)
 
-	t.Run("return ErrEmailNotFound on user with no such email", func(t *testing.T) {
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	t.Run("return ErrInvalidCredentials on user with no such email", func(t *testing.T) {
 		wantUser := domain.User{
 			FirstName: "John",
 			LastName:  "Doe",
@@ -144,15 +536,17 @@ func TestLoginUser(t *testing.T) {
 		}
 
 		repo := &StubUserRepo{
-			users: []domain.User{wantUser},
+			users: hashedUsers(t, passwordConfig, wantUser),
 		}
-		userService := service.NewUserService(jwtConfig, repo)
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		_, err := userService.Login("missingemail@example.com", wantUser.Password)
-		assert.Equal(t, err, (error)(service.ErrEmailNotFound))
+		_, err := userService.Login(context.Background(), "missingemail@example.com", wantUser.Password, dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
 	})
 
-	t.Run("return ErrWrongPassword on wrong password", func(t *testing.T) {
+	t.Run("return ErrInvalidCredentials on wrong password", func(t *testing.T) {
 		wantUser := domain.User{
 			FirstName: "John",
 			LastName:  "Doe",
@@ -161,12 +555,14 @@ func TestLoginUser(t *testing.T) {
 		}
 
 		repo := &StubUserRepo{
-			users: []domain.User{wantUser},
+			users: hashedUsers(t, passwordConfig, wantUser),
 		}
-		userService := service.NewUserService(jwtConfig, repo)
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		_, err := userService.Login(wantUser.Email, "wrongpassword")
-		assert.Equal(t, err, (error)(service.ErrWrongPassword))
+		_, err := userService.Login(context.Background(), wantUser.Email, "wrongpassword", dummyClient)
+		assert.Equal(t, err, (error)(service.ErrInvalidCredentials))
 	})
 
 	t.Run("generates JWT", func(t *testing.T) {
@@ -179,171 +575,358 @@ func TestLoginUser(t *testing.T) {
 		}
 
 		repo := &StubUserRepo{
-			users: []domain.User{wantUser},
+			users: hashedUsers(t, passwordConfig, wantUser),
 		}
-		userService := service.NewUserService(jwtConfig, repo)
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		jwt, err := userService.Login(wantUser.Email, wantUser.Password)
+		tokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
 		assert.RequireNoError(t, err)
 
-		assertValidJWT(t, jwtConfig, jwt, wantUser.ID)
+		assertValidJWT(t, jwtConfig, tokens.AccessToken, wantUser.ID)
 	})
 
-	t.Run("updates JWT array", func(t *testing.T) {
+	t.Run("starts session", func(t *testing.T) {
 		wantUser := domain.User{
 			ID:        10,
 			FirstName: "John",
 			LastName:  "Doe",
 			Email:     "johndoe@example.com",
 			Password:  "samplepassword",
-			JWTs:      []string{"testJWT"},
 		}
 
 		repo := &StubUserRepo{
-			users: []domain.User{wantUser},
+			users: hashedUsers(t, passwordConfig, wantUser),
 		}
-		userService := service.NewUserService(jwtConfig, repo)
+		sessionRepo := NewStubSessionRepo()
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		jwt, err := userService.Login(wantUser.Email, wantUser.Password)
+		tokens, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
 		assert.RequireNoError(t, err)
 
-		if len(repo.spyUpdateUser.JWTs) != 2 {
-			t.Fatalf("didn't update JWT array before update call")
-		}
-
-		assert.Equal(t, repo.spyUpdateUser.JWTs[1], jwt)
+		assertSession(t, jwtConfig, sessionRepo, tokens.AccessToken, wantUser.ID)
 	})
-}
-
-func TestAuthenticate(t *testing.T) {
-	godotenv.Load("../test.env")
 
-	jwtConfig, err := crypto.InitJWTConfigFromEnv()
-	assert.RequireNoError(t, err)
+	t.Run("stops on cancelled context", func(t *testing.T) {
+		wantUser := domain.User{
+			ID:       10,
+			Email:    "johndoe@example.com",
+			Password: "samplepassword",
+		}
 
-	t.Run("returns UserServiceError on invalid JWT", func(t *testing.T) {
-		invalidJWT := "invalidJWT"
+		repo := &StubUserRepo{
+			users: hashedUsers(t, passwordConfig, wantUser),
+		}
+		sessionRepo := NewStubSessionRepo()
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		repo := &StubUserRepo{}
-		userService := service.NewUserService(jwtConfig, repo)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
 
-		_, err := userService.Authenticate(invalidJWT)
-		assert.ErrorType[*service.UserServiceError](t, err)
+		_, err := userService.Login(ctx, wantUser.Email, wantUser.Password, dummyClient)
+		assert.Equal(t, errors.Is(err, context.Canceled), true)
+		assert.Equal(t, len(sessionRepo.sessions), 0)
 	})
 
-	t.Run("return ErrUserNotFound on missing user", func(t *testing.T) {
-		unknownUserID := 15
+	t.Run("starts separate session on every login", func(t *testing.T) {
+		wantUser := domain.User{
+			ID:        10,
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+			Password:  "samplepassword",
+		}
 
-		repo := &StubUserRepo{}
-		userService := service.NewUserService(jwtConfig, repo)
+		repo := &StubUserRepo{
+			users: hashedUsers(t, passwordConfig, wantUser),
+		}
+		sessionRepo := NewStubSessionRepo()
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		jwt, err := crypto.GenerateJWT(jwtConfig, unknownUserID)
+		_, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
+		_, err = userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
 		assert.RequireNoError(t, err)
 
-		_, err = userService.Authenticate(jwt)
-		assert.Equal(t, err, (error)(service.ErrUserNotFound))
+		assert.Equal(t, len(sessionRepo.sessions), 2)
 	})
 
-	t.Run("returns user ID on valid JWT", func(t *testing.T) {
+	t.Run("verifies hashed password", func(t *testing.T) {
+		password := "samplepassword"
+		hash, err := crypto.HashPassword(passwordConfig, password)
+		assert.RequireNoError(t, err)
+
 		wantUser := domain.User{
 			ID:        10,
 			FirstName: "John",
 			LastName:  "Doe",
 			Email:     "johndoe@example.com",
-			Password:  "samplepassword",
+			Password:  hash,
 		}
 
-		jwt, err := crypto.GenerateJWT(jwtConfig, wantUser.ID)
-		assert.RequireNoError(t, err)
-
-		wantUser.JWTs = []string{jwt}
 		repo := &StubUserRepo{
 			users: []domain.User{wantUser},
 		}
-		userService := service.NewUserService(jwtConfig, repo)
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		gotUserID, err := userService.Authenticate(jwt)
+		_, err = userService.Login(context.Background(), wantUser.Email, password, dummyClient)
 		assert.RequireNoError(t, err)
 
-		assert.Equal(t, gotUserID, wantUser.ID)
+		// parameters haven't changed so the user is left as is
+		assert.Equal(t, repo.spyUpdateUser, domain.User{})
 	})
-}
 
-func TestLogout(t *testing.T) {
-	godotenv.Load("../test.env")
+	t.Run("rehashes legacy plaintext password", func(t *testing.T) {
+		wantUser := domain.User{
+			ID:        10,
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+			Password:  "samplepassword",
+		}
 
-	jwtConfig, err := crypto.InitJWTConfigFromEnv()
-	assert.RequireNoError(t, err)
+		repo := &StubUserRepo{
+			users: []domain.User{wantUser},
+		}
+		legacyConfig := passwordConfig
+		legacyConfig.AllowPlaintext = true
 
-	t.Run("returns UserServiceError on invalid JWT", func(t *testing.T) {
-		invalidJWT := "invalidJWT"
+		userService := service.NewUserService(jwtConfig, legacyConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
 
-		repo := &StubUserRepo{}
-		userService := service.NewUserService(jwtConfig, repo)
+		_, err := userService.Login(context.Background(), wantUser.Email, wantUser.Password, dummyClient)
+		assert.RequireNoError(t, err)
 
-		err := userService.Logout(invalidJWT)
-		assert.ErrorType[*service.UserServiceError](t, err)
+		assertPasswordHash(t, passwordConfig, repo.spyUpdateUser.Password, wantUser.Password)
 	})
 
-	t.Run("return ErrUserNotFound on missing user", func(t *testing.T) {
-		unknownUserID := 15
+	t.Run("rehashes password on changed parameters", func(t *testing.T) {
+		password := "samplepassword"
 
-		repo := &StubUserRepo{}
-		userService := service.NewUserService(jwtConfig, repo)
-
-		jwt, err := crypto.GenerateJWT(jwtConfig, unknownUserID)
+		oldConfig := passwordConfig
+		oldConfig.BcryptCost = passwordConfig.BcryptCost + 1
+		hash, err := crypto.HashPassword(oldConfig, password)
 		assert.RequireNoError(t, err)
 
-		err = userService.Logout(jwt)
-		assert.Equal(t, err, (error)(service.ErrUserNotFound))
-	})
-
-	t.Run("returns UserServiceError on missing JWTs array entry", func(t *testing.T) {
 		wantUser := domain.User{
 			ID:        10,
 			FirstName: "John",
 			LastName:  "Doe",
 			Email:     "johndoe@example.com",
-			Password:  "samplepassword",
+			Password:  hash,
 		}
 
-		jwt, err := crypto.GenerateJWT(jwtConfig, wantUser.ID)
-		assert.RequireNoError(t, err)
-
-		wantUser.JWTs = []string{"sampleEntry"}
 		repo := &StubUserRepo{
 			users: []domain.User{wantUser},
 		}
-		userService := service.NewUserService(jwtConfig, repo)
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+		_, err = userService.Login(context.Background(), wantUser.Email, password, dummyClient)
+		assert.RequireNoError(t, err)
 
-		err = userService.Logout(jwt)
-		assert.ErrorType[*service.UserServiceError](t, err)
+		if repo.spyUpdateUser.Password == hash {
+			t.Fatalf("didn't rehash password before update call")
+		}
+		assertPasswordHash(t, passwordConfig, repo.spyUpdateUser.Password, password)
 	})
+}
 
-	t.Run("removes JWTs array entry on valid JWT", func(t *testing.T) {
-		wantUser := domain.User{
+func TestUserProfile(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	newUser := func(t testing.TB) domain.User {
+		t.Helper()
+
+		hash, err := crypto.HashPassword(passwordConfig, "samplepassword")
+		assert.RequireNoError(t, err)
+
+		return domain.User{
 			ID:        10,
 			FirstName: "John",
 			LastName:  "Doe",
 			Email:     "johndoe@example.com",
-			Password:  "samplepassword",
+			Password:  hash,
 		}
+	}
 
-		jwt, err := crypto.GenerateJWT(jwtConfig, wantUser.ID)
+	login := func(t testing.TB, userService *service.UserService, user domain.User) string {
+		t.Helper()
+
+		tokens, err := userService.Login(context.Background(), user.Email, "samplepassword", dummyClient)
 		assert.RequireNoError(t, err)
 
-		wantUser.JWTs = []string{"sampleEntry", jwt}
-		repo := &StubUserRepo{
-			users: []domain.User{wantUser},
-		}
-		userService := service.NewUserService(jwtConfig, repo)
+		return tokens.AccessToken
+	}
+
+	t.Run("returns user on valid JWT", func(t *testing.T) {
+		wantUser := newUser(t)
+
+		repo := &StubUserRepo{users: []domain.User{wantUser}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		jwt := login(t, userService, wantUser)
+
+		gotUser, err := userService.GetUser(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, gotUser, wantUser)
+	})
+
+	t.Run("returns ErrSessionNotFound on logged out JWT", func(t *testing.T) {
+		user := newUser(t)
 
-		err = userService.Logout(jwt)
+		repo := &StubUserRepo{users: []domain.User{user}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		jwt := login(t, userService, user)
+
+		err := userService.Logout(context.Background(), jwt, dummyClient)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.GetUser(context.Background(), jwt)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("updates only non-empty fields", func(t *testing.T) {
+		wantUser := newUser(t)
+
+		repo := &StubUserRepo{users: []domain.User{wantUser}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		jwt := login(t, userService, wantUser)
+
+		gotUser, err := userService.UpdateUser(context.Background(), jwt, "Jane", "", "janedoe@example.com", "samplepassword", "")
+		assert.RequireNoError(t, err)
+
+		wantUser.FirstName = "Jane"
+		wantUser.Email = "janedoe@example.com"
+		assert.Equal(t, gotUser, wantUser)
+		assert.Equal(t, repo.spyUpdateUser, wantUser)
+	})
+
+	t.Run("updates name without password", func(t *testing.T) {
+		wantUser := newUser(t)
+
+		repo := &StubUserRepo{users: []domain.User{wantUser}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		jwt := login(t, userService, wantUser)
+
+		_, err := userService.UpdateUser(context.Background(), jwt, "Jane", "", wantUser.Email, "", "")
 		assert.RequireNoError(t, err)
 
-		wantUser.JWTs = []string{"sampleEntry"}
+		wantUser.FirstName = "Jane"
 		assert.Equal(t, repo.spyUpdateUser, wantUser)
 	})
+
+	t.Run("returns ErrEmailTaken on duplicate email", func(t *testing.T) {
+		user := newUser(t)
+
+		repo := &StubUserRepo{users: []domain.User{user}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		jwt := login(t, userService, user)
+
+		repo.dummyErr = repository.ErrDuplicateEmail
+
+		_, err := userService.UpdateUser(context.Background(), jwt, "", "", "janedoe@example.com", "samplepassword", "")
+		assert.Equal(t, err, (error)(service.ErrEmailTaken))
+	})
+
+	t.Run("changes password and ends other sessions", func(t *testing.T) {
+		user := newUser(t)
+
+		repo := &StubUserRepo{users: []domain.User{user}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		otherJWT := login(t, userService, user)
+		jwt := login(t, userService, user)
+
+		err := userService.ChangePassword(context.Background(), jwt, "samplepassword", "newpassword")
+		assert.RequireNoError(t, err)
+
+		assertPasswordHash(t, passwordConfig, repo.spyUpdateUser.Password, "newpassword")
+
+		_, err = userService.Authenticate(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+
+		_, err = userService.Authenticate(context.Background(), otherJWT)
+		assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+	})
+
+	t.Run("returns ErrWrongPassword on wrong old password", func(t *testing.T) {
+		user := newUser(t)
+
+		repo := &StubUserRepo{users: []domain.User{user}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		jwt := login(t, userService, user)
+
+		err := userService.ChangePassword(context.Background(), jwt, "wrongpassword", "newpassword")
+		assert.Equal(t, err, (error)(service.ErrWrongPassword))
+	})
+
+	t.Run("deletes user", func(t *testing.T) {
+		user := newUser(t)
+
+		repo := &StubUserRepo{users: []domain.User{user}}
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		jwt := login(t, userService, user)
+
+		err := userService.Delete(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, repo.spyDeleteID, user.ID)
+	})
+
+	t.Run("ends sessions of deleted user", func(t *testing.T) {
+		user := newUser(t)
+
+		repo := &StubUserRepo{users: []domain.User{user}}
+		sessionRepo := NewStubSessionRepo()
+		userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, sessionRepo, NewStubRefreshTokenRepo(),
+			NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+			service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+		otherJWT := login(t, userService, user)
+		jwt := login(t, userService, user)
+
+		err := userService.Delete(context.Background(), jwt)
+		assert.RequireNoError(t, err)
+
+		for _, token := range []string{jwt, otherJWT} {
+			_, err = userService.Authenticate(context.Background(), token)
+			assert.Equal(t, err, (error)(service.ErrSessionNotFound))
+		}
+		assert.Equal(t, len(sessionRepo.sessions), 0)
+	})
 }
 
 func assertValidJWT(t testing.TB, jwtConfig crypto.JWTConfig, jwt string, wantUserID int) {
@@ -354,3 +937,98 @@ func assertValidJWT(t testing.TB, jwtConfig crypto.JWTConfig, jwt string, wantUs
 
 	assert.Equal(t, gotUserID, wantUserID)
 }
+
+func hashedUsers(t testing.TB, passwordConfig crypto.PasswordConfig, users ...domain.User) []domain.User {
+	t.Helper()
+
+	hashed := make([]domain.User, len(users))
+	for i, user := range users {
+		hash, err := crypto.HashPassword(passwordConfig, user.Password)
+		assert.RequireNoError(t, err)
+
+		user.Password = hash
+		hashed[i] = user
+	}
+	return hashed
+}
+
+func assertPasswordHash(t testing.TB, passwordConfig crypto.PasswordConfig, hash, password string) {
+	t.Helper()
+
+	match, needsRehash, err := crypto.VerifyPassword(passwordConfig, hash, password)
+	assert.RequireNoError(t, err)
+
+	if !match || needsRehash {
+		t.Errorf("%q isn't an up to date hash of %q", hash, password)
+	}
+}
+
+func assertSession(t testing.TB, jwtConfig crypto.JWTConfig, sessionRepo *StubSessionRepo, jwt string, wantUserID int) {
+	t.Helper()
+
+	claims, err := crypto.ParseJWT(jwtConfig, jwt)
+	assert.RequireNoError(t, err)
+
+	session, ok := sessionRepo.sessions[claims.SessionID]
+	if !ok {
+		t.Fatalf("didn't store session %q", claims.SessionID)
+	}
+
+	assert.Equal(t, session.UserID, wantUserID)
+	assert.Equal(t, session.UserAgent, dummyClient.UserAgent)
+	assert.Equal(t, session.IP, dummyClient.IP)
+}
+
+func TestLookupUsers(t *testing.T) {
+	godotenv.Load("../test.env")
+
+	jwtConfig, err := crypto.InitJWTConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	passwordConfig, err := crypto.InitPasswordConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	mfaConfig, err := crypto.InitMFAConfigFromEnv()
+	assert.RequireNoError(t, err)
+
+	repo := &StubUserRepo{
+		users: []domain.User{
+			{ID: 1, Email: "first@example.com"},
+			{ID: 2, Email: "second@example.com"},
+			{ID: 3, Email: "third@example.com"},
+		},
+	}
+	userService := service.NewUserService(jwtConfig, passwordConfig, mfaConfig, repo, NewStubSessionRepo(), NewStubRefreshTokenRepo(),
+		NewStubActionTokenRepo(), NewStubServiceAccountRepo(), &SpyMailer{}, dummyMailConfig,
+		service.NewLoginThrottle(service.DefaultThrottleConfig), &SpyAuditRecorder{})
+
+	t.Run("looks up user by ID", func(t *testing.T) {
+		user, err := userService.LookupUser(context.Background(), 2)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, user.Email, "second@example.com")
+	})
+
+	t.Run("returns ErrUserNotFound on unknown ID", func(t *testing.T) {
+		_, err := userService.LookupUser(context.Background(), 4)
+		assert.Equal(t, err, (error)(service.ErrUserNotFound))
+	})
+
+	t.Run("looks up users in order of IDs", func(t *testing.T) {
+		users, err := userService.LookupUsers(context.Background(), []int{3, 4, 1, 3})
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, len(users), 2)
+		assert.Equal(t, users[0].ID, 3)
+		assert.Equal(t, users[1].ID, 1)
+	})
+
+	t.Run("returns ErrTooManyUsers above limit", func(t *testing.T) {
+		ids := make([]int, service.MaxLookupUsers+1)
+		for i := range ids {
+			ids[i] = i
+		}
+
+		_, err := userService.LookupUsers(context.Background(), ids)
+		assert.Equal(t, err, (error)(service.ErrTooManyUsers))
+	})
+}
@@ -1,3 +1,12 @@
+DROP TABLE IF EXISTS audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only;
+DROP TABLE IF EXISTS authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS service_accounts;
+DROP TABLE IF EXISTS action_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS sessions;
 DROP TABLE IF EXISTS users;
 
 CREATE TABLE users (
@@ -5,6 +14,112 @@ CREATE TABLE users (
     first_name          varchar(20)          NOT NULL,
     last_name           varchar(20)          NOT NULL,
     email               varchar(60)          UNIQUE NOT NULL,
-    password            varchar(72)          NOT NULL,
-    jwts                varchar[]
-);
\ No newline at end of file
+    password            varchar(255)         NOT NULL,
+    email_verified      boolean              NOT NULL DEFAULT false,
+    roles               text[]               NOT NULL DEFAULT '{player}',
+    mfa_secret          varchar(255)         NOT NULL DEFAULT '',
+    mfa_enabled         boolean              NOT NULL DEFAULT false,
+    mfa_last_step       bigint               NOT NULL DEFAULT 0,
+    recovery_codes      text[]               NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE sessions (
+    id                  varchar(64)          PRIMARY KEY,
+    user_id             integer              NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at          timestamptz          NOT NULL,
+    last_seen_at        timestamptz          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    user_agent          varchar(255)         NOT NULL,
+    ip                  varchar(45)          NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
+
+CREATE TABLE refresh_tokens (
+    token_hash          char(64)             PRIMARY KEY,
+    user_id             integer              NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id           varchar(64)          NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    expires_at          timestamptz          NOT NULL,
+    used                boolean              NOT NULL DEFAULT false,
+    revoked             boolean              NOT NULL DEFAULT false
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+CREATE TABLE action_tokens (
+    id                  varchar(64)          PRIMARY KEY,
+    user_id             integer              NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose             varchar(32)          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    used                boolean              NOT NULL DEFAULT false
+);
+
+CREATE INDEX action_tokens_user_id_idx ON action_tokens (user_id);
+
+CREATE TABLE service_accounts (
+    id                  serial               PRIMARY KEY,
+    name                varchar(60)          NOT NULL,
+    created_at          timestamptz          NOT NULL
+);
+
+CREATE TABLE api_keys (
+    id                  varchar(64)          PRIMARY KEY,
+    service_account_id  integer              NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+    key_hash            char(64)             UNIQUE NOT NULL,
+    prefix              varchar(16)          NOT NULL,
+    scopes              text[]               NOT NULL DEFAULT '{}',
+    created_at          timestamptz          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    revoked             boolean              NOT NULL DEFAULT false
+);
+
+CREATE INDEX api_keys_service_account_id_idx ON api_keys (service_account_id);
+
+CREATE TABLE oauth_clients (
+    id                  varchar(64)          PRIMARY KEY,
+    name                varchar(60)          NOT NULL,
+    secret_hash         varchar(64)          NOT NULL DEFAULT '',
+    redirect_uris       text[]               NOT NULL,
+    created_at          timestamptz          NOT NULL
+);
+
+CREATE TABLE authorization_codes (
+    id                  char(64)             PRIMARY KEY,
+    client_id           varchar(64)          NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id             integer              NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri        text                 NOT NULL,
+    scope               varchar(255)         NOT NULL,
+    nonce               varchar(255)         NOT NULL DEFAULT '',
+    code_challenge      varchar(128)         NOT NULL,
+    auth_time           timestamptz          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    used                boolean              NOT NULL DEFAULT false
+);
+
+CREATE TABLE audit_events (
+    id                  bigserial            PRIMARY KEY,
+    type                varchar(32)          NOT NULL,
+    actor_id            integer              NOT NULL DEFAULT 0,
+    actor_service_account_id integer         NOT NULL DEFAULT 0,
+    email               varchar(60)          NOT NULL DEFAULT '',
+    target              varchar(100)         NOT NULL DEFAULT '',
+    ip                  varchar(45)          NOT NULL DEFAULT '',
+    user_agent          varchar(255)         NOT NULL DEFAULT '',
+    result              varchar(16)          NOT NULL,
+    created_at          timestamptz          NOT NULL
+);
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX audit_events_email_idx ON audit_events (email, id);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,23 @@
+-- Hashes passwords that were stored in plaintext before the service started
+-- hashing them. Postgres only runs the top level of sql-scripts on a fresh
+-- database, so this has to be applied by hand against existing ones:
+--
+--   psql -U $POSTGRES_USER -d $POSTGRES_DB -f 001_hash_passwords.sql
+--
+-- Rows are hashed with bcrypt, which the service verifies directly. It
+-- rehashes them with the configured algorithm and cost on the next login.
+-- Rows that are missed here are rejected, unless the service runs with
+-- PASSWORD_ALLOW_PLAINTEXT=true, which verifies them as plaintext and
+-- rehashes them on the next login as well. Leave it off once this has run.
+
+BEGIN;
+
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE users ALTER COLUMN password TYPE varchar(255);
+
+UPDATE users
+SET password = crypt(password, gen_salt('bf', 10))
+WHERE password !~ '^\$(2[abxy]|argon2id)\$';
+
+COMMIT;
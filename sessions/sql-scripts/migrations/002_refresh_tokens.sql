@@ -0,0 +1,12 @@
+-- Adds the table for refresh tokens to existing databases.
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash          char(64)             PRIMARY KEY,
+    user_id             integer              NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id           varchar(64)          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    used                boolean              NOT NULL DEFAULT false,
+    revoked             boolean              NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
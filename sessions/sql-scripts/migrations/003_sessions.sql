@@ -0,0 +1,28 @@
+-- Moves sessions out of the users.jwts array into their own table. JWTs
+-- issued before this migration have no session ID, so every user has to
+-- log in again, and refresh tokens issued before it are dropped with them.
+
+BEGIN;
+
+CREATE TABLE sessions (
+    id                  varchar(64)          PRIMARY KEY,
+    user_id             integer              NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at          timestamptz          NOT NULL,
+    last_seen_at        timestamptz          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    user_agent          varchar(255)         NOT NULL,
+    ip                  varchar(45)          NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
+
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT refresh_tokens_family_id_fkey
+    FOREIGN KEY (family_id) REFERENCES sessions(id) ON DELETE CASCADE;
+
+ALTER TABLE users DROP COLUMN jwts;
+
+COMMIT;
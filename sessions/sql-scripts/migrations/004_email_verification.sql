@@ -0,0 +1,19 @@
+-- Adds email verification and the table that makes mailed action tokens
+-- single-use. Users that signed up before this migration start out as
+-- unverified and have to request a verification email.
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN email_verified boolean NOT NULL DEFAULT false;
+
+CREATE TABLE action_tokens (
+    id                  varchar(64)          PRIMARY KEY,
+    user_id             integer              NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose             varchar(32)          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    used                boolean              NOT NULL DEFAULT false
+);
+
+CREATE INDEX action_tokens_user_id_idx ON action_tokens (user_id);
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Adds TOTP two-factor authentication. Recovery codes are stored as the
+-- sha256 hex of the normalized code.
+
+BEGIN;
+
+ALTER TABLE users
+    ADD COLUMN mfa_secret       varchar(255)         NOT NULL DEFAULT '',
+    ADD COLUMN mfa_enabled      boolean              NOT NULL DEFAULT false,
+    ADD COLUMN mfa_last_step    bigint               NOT NULL DEFAULT 0,
+    ADD COLUMN recovery_codes   text[]               NOT NULL DEFAULT '{}';
+
+COMMIT;
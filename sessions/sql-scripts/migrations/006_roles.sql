@@ -0,0 +1,9 @@
+-- Adds roles. Existing users become players, the first admin has to be
+-- granted by hand:
+--   UPDATE users SET roles = '{player,admin}' WHERE email = '...';
+
+BEGIN;
+
+ALTER TABLE users ADD COLUMN roles text[] NOT NULL DEFAULT '{player}';
+
+COMMIT;
@@ -0,0 +1,25 @@
+-- Adds service accounts and their API keys. Keys are stored as the sha256
+-- hex of the key.
+
+BEGIN;
+
+CREATE TABLE service_accounts (
+    id                  serial               PRIMARY KEY,
+    name                varchar(60)          NOT NULL,
+    created_at          timestamptz          NOT NULL
+);
+
+CREATE TABLE api_keys (
+    id                  varchar(64)          PRIMARY KEY,
+    service_account_id  integer              NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+    key_hash            char(64)             UNIQUE NOT NULL,
+    prefix              varchar(16)          NOT NULL,
+    scopes              text[]               NOT NULL DEFAULT '{}',
+    created_at          timestamptz          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    revoked             boolean              NOT NULL DEFAULT false
+);
+
+CREATE INDEX api_keys_service_account_id_idx ON api_keys (service_account_id);
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- Adds the clients and authorization codes of the OpenID Connect provider.
+-- Client secrets and codes are stored as the sha256 hex of the value.
+
+BEGIN;
+
+CREATE TABLE oauth_clients (
+    id                  varchar(64)          PRIMARY KEY,
+    name                varchar(60)          NOT NULL,
+    secret_hash         varchar(64)          NOT NULL DEFAULT '',
+    redirect_uris       text[]               NOT NULL,
+    created_at          timestamptz          NOT NULL
+);
+
+CREATE TABLE authorization_codes (
+    id                  char(64)             PRIMARY KEY,
+    client_id           varchar(64)          NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id             integer              NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri        text                 NOT NULL,
+    scope               varchar(255)         NOT NULL,
+    nonce               varchar(255)         NOT NULL DEFAULT '',
+    code_challenge      varchar(128)         NOT NULL,
+    auth_time           timestamptz          NOT NULL,
+    expires_at          timestamptz          NOT NULL,
+    used                boolean              NOT NULL DEFAULT false
+);
+
+COMMIT;
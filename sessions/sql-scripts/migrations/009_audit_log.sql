@@ -0,0 +1,33 @@
+-- Adds the audit log of security relevant account actions. actor_id has no
+-- foreign key so that events outlive the users they're about, and a
+-- trigger keeps the table append-only.
+
+BEGIN;
+
+CREATE TABLE audit_events (
+    id                  bigserial            PRIMARY KEY,
+    type                varchar(32)          NOT NULL,
+    actor_id            integer              NOT NULL DEFAULT 0,
+    email               varchar(60)          NOT NULL DEFAULT '',
+    target              varchar(100)         NOT NULL DEFAULT '',
+    ip                  varchar(45)          NOT NULL DEFAULT '',
+    user_agent          varchar(255)         NOT NULL DEFAULT '',
+    result              varchar(16)          NOT NULL,
+    created_at          timestamptz          NOT NULL
+);
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX audit_events_email_idx ON audit_events (email, id);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+COMMIT;
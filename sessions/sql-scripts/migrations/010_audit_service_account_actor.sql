@@ -0,0 +1,9 @@
+-- Records which service account another service called with when it acted
+-- on an account. Adding a column with a default doesn't fire the
+-- append-only trigger, which only guards updates, deletes and truncates.
+
+BEGIN;
+
+ALTER TABLE audit_events ADD COLUMN actor_service_account_id integer NOT NULL DEFAULT 0;
+
+COMMIT;
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/handler"
+	"github.com/VitoNaychev/elysium-challenge/wallet/payments"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/risk"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+const (
+	// jackpotPoolID is the progressive jackpot every lost stake feeds
+	jackpotPoolID           = 1
+	jackpotContributionRate = 0.01
+)
+
+func main() {
+	riskConfig, err := risk.LoadRiskConfig("../config/risk.yml")
+	if err != nil {
+		log.Fatal("LoadRiskConfig error: ", err)
+	}
+
+	riskRules, err := risk.NewRulesFromConfig(riskConfig)
+	if err != nil {
+		log.Fatal("NewRulesFromConfig error: ", err)
+	}
+
+	eventStore := repository.NewInMemoryEventStore()
+	riskEngine := risk.NewEngine(riskRules, risk.NewInMemoryDecisionLog())
+
+	walletService := service.NewWalletService(eventStore,
+		service.WithSingleWriter(service.DefaultMailboxConfig),
+		service.WithEventFeed(eventStore),
+		service.WithRiskEngine(riskEngine),
+		service.WithJackpotPool(jackpotPoolID))
+
+	err = walletService.CreatePool(jackpotPoolID, jackpotContributionRate)
+	if err != nil && !errors.Is(err, domain.ErrUnsupportedTransition) {
+		log.Fatal("CreatePool error: ", err)
+	}
+
+	paymentsSecret, ok := os.LookupEnv("PAYMENTS_SECRET")
+	if !ok {
+		log.Fatal("env variable PAYMENTS_SECRET not set")
+	}
+
+	paymentProvider := payments.NewSimulatedProvider([]byte(paymentsSecret))
+	paymentService := payments.NewPaymentService(paymentProvider, payments.NewInMemoryPaymentRepo(), walletService)
+
+	walletHTTPHandler := handler.NewWalletHTTPHandler(walletService)
+	paymentHTTPHandler := handler.NewPaymentHTTPHandler(paymentService)
+	gameHTTPHandler := handler.NewGameHTTPHandler(walletService)
+
+	mux := http.NewServeMux()
+	mux.Handle("/wallet/events", walletHTTPHandler)
+	mux.Handle("/wallet/ws", walletHTTPHandler)
+	mux.Handle("/wallet/deposits", paymentHTTPHandler)
+	mux.Handle("/wallet/payouts", paymentHTTPHandler)
+	mux.Handle("/wallet/payments", paymentHTTPHandler)
+	mux.Handle("/payments/", paymentHTTPHandler)
+	mux.Handle("/wallet/games/", gameHTTPHandler)
+
+	httpServer := &http.Server{
+		Addr:    ":8080",
+		Handler: apierror.WithRequestID(mux),
+	}
+
+	go listenAndServeHTTP(httpServer, ":8080")
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+
+	sig := <-sigCh
+	log.Printf("Received signal: %v. Shutting down...", sig)
+
+	shutdownHTTPServer(httpServer)
+	walletService.Close()
+}
+
+func listenAndServeHTTP(server *http.Server, port string) {
+	listener, err := net.Listen("tcp", port)
+	if err != nil {
+		log.Fatal("net.Listen error: ", err)
+	}
+
+	log.Printf("Starting HTTP server on port %v...", port)
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("HTTP server error: %v", err)
+	}
+}
+
+func shutdownHTTPServer(server *http.Server) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+}
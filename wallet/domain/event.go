@@ -12,6 +12,13 @@ func (w WalletWon) isEvent()        {}
 func (w WalletLost) isEvent()       {}
 func (w WalletReserved) isEvent()   {}
 func (w WalletReleased) isEvent()   {}
+func (w WalletRefunded) isEvent()   {}
+func (w WalletFlagged) isEvent()    {}
+
+func (p PoolCreated) isEvent()     {}
+func (p PoolSeeded) isEvent()      {}
+func (p PoolContributed) isEvent() {}
+func (p PoolPaidOut) isEvent()     {}
 
 type WalletCreated struct {
 	ID int
@@ -50,3 +57,41 @@ type WalletReleased struct {
 	ID     int
 	Amount float64
 }
+
+// WalletRefunded returns money withdrawn for a payout that the payment
+// provider failed.
+type WalletRefunded struct {
+	ID     int
+	Amount float64
+}
+
+// WalletFlagged marks a command that risk rules found suspicious but let
+// through, it follows the event of that command. It has no effect on the
+// balance.
+type WalletFlagged struct {
+	ID     int
+	Rule   string
+	Reason string
+}
+
+type PoolCreated struct {
+	ID               int
+	ContributionRate float64
+}
+
+type PoolSeeded struct {
+	ID     int
+	Amount float64
+}
+
+type PoolContributed struct {
+	ID       int
+	WalletID int
+	Amount   float64
+}
+
+type PoolPaidOut struct {
+	ID       int
+	WalletID int
+	Amount   float64
+}
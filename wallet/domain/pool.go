@@ -0,0 +1,146 @@
+package domain
+
+import "errors"
+
+var (
+	ErrInvalidContributionRate = errors.New("contribution rate must be between 0 and 1")
+	ErrPoolNotCreated          = errors.New("pool must be created before accepting events")
+	ErrPoolEmpty               = errors.New("pool has no funds to pay out")
+)
+
+// Pool is a progressive jackpot funded by a share of every lost stake.
+type Pool struct {
+	id               int
+	balance          float64
+	contributionRate float64
+	state            State
+
+	changes []Event
+	version int
+}
+
+func NewPool() Pool {
+	return Pool{
+		id:      0,
+		balance: 0,
+		state:   StateNew,
+	}
+}
+
+func NewPoolFromEvents(events []Event) Pool {
+	pool := NewPool()
+
+	for _, event := range events {
+		pool.On(event, false)
+	}
+
+	return pool
+}
+
+func (p *Pool) GetID() int {
+	return p.id
+}
+
+func (p *Pool) GetBalance() float64 {
+	return p.balance
+}
+
+func (p *Pool) GetContributionRate() float64 {
+	return p.contributionRate
+}
+
+func (p *Pool) GetState() State {
+	return p.state
+}
+
+func (p *Pool) Create(id int, contributionRate float64) error {
+	if p.state != StateNew {
+		return ErrUnsupportedTransition
+	}
+	if contributionRate <= 0 || contributionRate > 1 {
+		return ErrInvalidContributionRate
+	}
+
+	p.raise(&PoolCreated{
+		ID:               id,
+		ContributionRate: contributionRate,
+	})
+	return nil
+}
+
+func (p *Pool) Seed(amount float64) error {
+	if p.state != StateCreated {
+		return ErrPoolNotCreated
+	}
+
+	p.raise(&PoolSeeded{
+		ID:     p.id,
+		Amount: amount,
+	})
+	return nil
+}
+
+// Contribute adds the pool's share of a stake lost by the given wallet.
+func (p *Pool) Contribute(walletID int, stake float64) error {
+	if p.state != StateCreated {
+		return ErrPoolNotCreated
+	}
+
+	p.raise(&PoolContributed{
+		ID:       p.id,
+		WalletID: walletID,
+		Amount:   stake * p.contributionRate,
+	})
+	return nil
+}
+
+// Payout pays the whole pool to the given wallet and returns the amount.
+func (p *Pool) Payout(walletID int) (float64, error) {
+	if p.state != StateCreated {
+		return 0, ErrPoolNotCreated
+	}
+	if p.balance <= 0 {
+		return 0, ErrPoolEmpty
+	}
+
+	amount := p.balance
+	p.raise(&PoolPaidOut{
+		ID:       p.id,
+		WalletID: walletID,
+		Amount:   amount,
+	})
+	return amount, nil
+}
+
+func (p *Pool) On(event Event, new bool) {
+	switch e := event.(type) {
+	case *PoolCreated:
+		p.id = e.ID
+		p.balance = 0
+		p.contributionRate = e.ContributionRate
+		p.state = StateCreated
+	case *PoolSeeded:
+		p.balance += e.Amount
+	case *PoolContributed:
+		p.balance += e.Amount
+	case *PoolPaidOut:
+		p.balance -= e.Amount
+	}
+
+	if !new {
+		p.version++
+	}
+}
+
+func (p *Pool) Events() []Event {
+	return p.changes
+}
+
+func (p *Pool) Version() int {
+	return p.version
+}
+
+func (p *Pool) raise(event Event) {
+	p.changes = append(p.changes, event)
+	p.On(event, true)
+}
@@ -0,0 +1,117 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+)
+
+func TestPoolConstructors(t *testing.T) {
+	t.Run("reconstructs pool state from array of events", func(t *testing.T) {
+		events := []domain.Event{
+			&domain.PoolCreated{ID: 1, ContributionRate: 0.01},
+			&domain.PoolSeeded{ID: 1, Amount: 1000},
+			&domain.PoolContributed{ID: 1, WalletID: 12, Amount: 5},
+			&domain.PoolPaidOut{ID: 1, WalletID: 12, Amount: 1005},
+			&domain.PoolContributed{ID: 1, WalletID: 13, Amount: 2},
+		}
+
+		pool := domain.NewPoolFromEvents(events)
+		assert.Equal(t, pool.GetBalance(), float64(2))
+		assert.Equal(t, pool.GetContributionRate(), 0.01)
+		assert.Equal(t, pool.Version(), len(events))
+	})
+}
+
+func TestPoolCreate(t *testing.T) {
+	t.Run("saves create event and sets pool ID and contribution rate", func(t *testing.T) {
+		pool := domain.NewPool()
+
+		err := pool.Create(1, 0.02)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, pool.GetID(), 1)
+		assert.Equal(t, pool.GetContributionRate(), 0.02)
+		assert.Type[*domain.PoolCreated](t, pool.Events()[0])
+	})
+
+	t.Run("returns ErrInvalidContributionRate on rate outside of (0, 1]", func(t *testing.T) {
+		pool := domain.NewPool()
+
+		err := pool.Create(1, 1.5)
+		assert.Equal(t, err, domain.ErrInvalidContributionRate)
+	})
+
+	t.Run("returns ErrUnsupportedTransition on multiple Create calls", func(t *testing.T) {
+		pool := createPool(t, 1, 0.02)
+
+		err := pool.Create(1, 0.02)
+		assert.Equal(t, err, domain.ErrUnsupportedTransition)
+	})
+}
+
+func TestPoolSeedContribute(t *testing.T) {
+	t.Run("saves seed event and increases balance by set amount", func(t *testing.T) {
+		pool := createPool(t, 1, 0.02)
+
+		err := pool.Seed(1000)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, pool.GetBalance(), float64(1000))
+		assert.Type[*domain.PoolSeeded](t, pool.Events()[1])
+	})
+
+	t.Run("saves contribute event with the rate share of the stake", func(t *testing.T) {
+		walletID := 12
+		pool := createPool(t, 1, 0.02)
+
+		err := pool.Contribute(walletID, 50)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, pool.GetBalance(), float64(1))
+		assert.Equal(t, pool.Events()[1], (domain.Event)(&domain.PoolContributed{ID: 1, WalletID: walletID, Amount: 1}))
+	})
+
+	t.Run("returns ErrPoolNotCreated on contribute to new pool", func(t *testing.T) {
+		pool := domain.NewPool()
+
+		err := pool.Contribute(12, 50)
+		assert.Equal(t, err, domain.ErrPoolNotCreated)
+	})
+}
+
+func TestPoolPayout(t *testing.T) {
+	t.Run("pays out the whole balance", func(t *testing.T) {
+		walletID := 12
+		pool := createPool(t, 1, 0.02)
+
+		err := pool.Seed(1000)
+		assert.RequireNoError(t, err)
+
+		amount, err := pool.Payout(walletID)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, amount, float64(1000))
+		assert.Equal(t, pool.GetBalance(), float64(0))
+		assert.Type[*domain.PoolPaidOut](t, pool.Events()[2])
+	})
+
+	t.Run("returns ErrPoolEmpty on payout from empty pool", func(t *testing.T) {
+		pool := createPool(t, 1, 0.02)
+
+		_, err := pool.Payout(12)
+		assert.Equal(t, err, domain.ErrPoolEmpty)
+	})
+}
+
+func createPool(t testing.TB, poolID int, contributionRate float64) domain.Pool {
+	t.Helper()
+
+	pool := domain.NewPool()
+
+	err := pool.Create(poolID, contributionRate)
+	assert.RequireNoError(t, err)
+
+	return pool
+}
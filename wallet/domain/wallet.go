@@ -153,6 +153,31 @@ func (w *Wallet) Release(amount float64) error {
 	return nil
 }
 
+func (w *Wallet) Refund(amount float64) error {
+	if w.state == StateSpurious {
+		return ErrStateSpurious
+	}
+
+	w.raise(&WalletRefunded{
+		ID:     w.id,
+		Amount: amount,
+	})
+	return nil
+}
+
+func (w *Wallet) Flag(rule, reason string) error {
+	if w.state == StateNew {
+		return ErrUnsupportedTransition
+	}
+
+	w.raise(&WalletFlagged{
+		ID:     w.id,
+		Rule:   rule,
+		Reason: reason,
+	})
+	return nil
+}
+
 func (w *Wallet) On(event Event, new bool) {
 	switch e := event.(type) {
 	case *WalletCreated:
@@ -173,6 +198,8 @@ func (w *Wallet) On(event Event, new bool) {
 		w.balance -= e.Amount
 	case *WalletReleased:
 		w.balance += e.Amount
+	case *WalletRefunded:
+		w.balance += e.Amount
 	}
 
 	if !new {
@@ -330,6 +330,26 @@ func TestWalletReserveRelease(t *testing.T) {
 	})
 }
 
+func TestWalletRefund(t *testing.T) {
+	t.Run("saves refund event and increases balance by set amount", func(t *testing.T) {
+		userID := 12
+		depositAmount := float64(100.99)
+		withdrawAmount := float64(45.01)
+
+		wallet := createWalletAndDeposit(t, userID, depositAmount)
+
+		wallet.Withdraw(withdrawAmount)
+		wallet.Refund(withdrawAmount)
+		assert.Equal(t, wallet.GetBalance(), depositAmount)
+
+		gotEventsCount := len(wallet.Events())
+		wantEventsCount := 4
+
+		requireEventsCount(t, gotEventsCount, wantEventsCount)
+		assert.Type[*domain.WalletRefunded](t, wallet.Events()[gotEventsCount-1])
+	})
+}
+
 func requireEventsCount(t testing.TB, gotEventsCount, wantEventsCount int) {
 	t.Helper()
 
@@ -362,3 +382,30 @@ func createWalletAndDeposit(t testing.TB, userID int, amount float64) domain.Wal
 
 	return wallet
 }
+
+func TestWalletFlag(t *testing.T) {
+	t.Run("saves flagged event and leaves balance unchanged", func(t *testing.T) {
+		userID := 12
+		depositAmount := float64(100.99)
+
+		wallet := createWalletAndDeposit(t, userID, depositAmount)
+
+		err := wallet.Flag("small-deposits", "too many small deposits")
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, wallet.GetBalance(), depositAmount)
+
+		gotEventsCount := len(wallet.Events())
+		wantEventsCount := 3
+
+		requireEventsCount(t, gotEventsCount, wantEventsCount)
+		assert.Type[*domain.WalletFlagged](t, wallet.Events()[gotEventsCount-1])
+	})
+
+	t.Run("returns ErrUnsupportedTransition on flag of new wallet", func(t *testing.T) {
+		wallet := domain.NewWallet()
+
+		err := wallet.Flag("small-deposits", "too many small deposits")
+		assert.Equal(t, err, domain.ErrUnsupportedTransition)
+	})
+}
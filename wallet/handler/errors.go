@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/payments"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+const (
+	CodeMissingUserID     apierror.Code = "missing_user_id"
+	CodeInvalidFrom       apierror.Code = "invalid_from"
+	CodeEmptyBody         apierror.Code = "empty_body"
+	CodeMissingPaymentID  apierror.Code = "missing_payment_id"
+	CodeMissingWalletID   apierror.Code = "missing_wallet_id"
+	CodeNotServiceAccount apierror.Code = "not_service_account"
+
+	CodeWalletNotFound       apierror.Code = "wallet_not_found"
+	CodeInvalidAmount        apierror.Code = "invalid_amount"
+	CodeTooManyConflicts     apierror.Code = "too_many_conflicts"
+	CodeServiceClosed        apierror.Code = "service_closed"
+	CodeRejectedByRisk       apierror.Code = "rejected_by_risk"
+	CodePoolNotFound         apierror.Code = "pool_not_found"
+	CodeStreamingUnavailable apierror.Code = "streaming_unavailable"
+
+	CodeInsufficientFunds     apierror.Code = "insufficient_funds"
+	CodeUnsupportedTransition apierror.Code = "unsupported_transition"
+	CodeWalletSpurious        apierror.Code = "wallet_spurious"
+	CodePoolNotCreated        apierror.Code = "pool_not_created"
+	CodePoolEmpty             apierror.Code = "pool_empty"
+	CodeVersionConflict       apierror.Code = "version_conflict"
+
+	CodeInvalidSignature         apierror.Code = "invalid_signature"
+	CodeInvalidPaymentTransition apierror.Code = "invalid_payment_transition"
+	CodePaymentNotFound          apierror.Code = "payment_not_found"
+	CodeUnknownReference         apierror.Code = "unknown_reference"
+)
+
+// walletErrors is how errors are reported unless an endpoint decides on a
+// different status. Domain errors that the service passes through are
+// refusals of the command, not failures of the service.
+var walletErrors = apierror.Mapper{
+	{Err: ErrMissingUserID, Status: http.StatusBadRequest, Code: CodeMissingUserID},
+	{Err: ErrInvalidFrom, Status: http.StatusBadRequest, Code: CodeInvalidFrom},
+	{Err: ErrEmptyBody, Status: http.StatusBadRequest, Code: CodeEmptyBody},
+	{Err: ErrMissingPaymentID, Status: http.StatusBadRequest, Code: CodeMissingPaymentID},
+	{Err: ErrMissingWalletID, Status: http.StatusBadRequest, Code: CodeMissingWalletID},
+	{Err: ErrNotServiceAccount, Status: http.StatusForbidden, Code: CodeNotServiceAccount},
+	{Err: ErrMethodNotAllowed, Status: http.StatusMethodNotAllowed, Code: apierror.CodeMethodNotAllowed},
+
+	{Err: service.ErrWalletNotFound, Status: http.StatusNotFound, Code: CodeWalletNotFound},
+	{Err: service.ErrInvalidAmount, Status: http.StatusBadRequest, Code: CodeInvalidAmount},
+	{Err: service.ErrTooManyConflicts, Status: http.StatusConflict, Code: CodeTooManyConflicts},
+	{Err: service.ErrServiceClosed, Status: http.StatusServiceUnavailable, Code: CodeServiceClosed},
+	{Err: service.ErrRejectedByRisk, Status: http.StatusUnprocessableEntity, Code: CodeRejectedByRisk},
+	{Err: service.ErrPoolNotFound, Status: http.StatusNotFound, Code: CodePoolNotFound},
+	{Err: service.ErrStreamingUnavailable, Status: http.StatusServiceUnavailable, Code: CodeStreamingUnavailable},
+
+	{Err: domain.ErrInsufficientFunds, Status: http.StatusUnprocessableEntity, Code: CodeInsufficientFunds},
+	{Err: domain.ErrUnsupportedTransition, Status: http.StatusUnprocessableEntity, Code: CodeUnsupportedTransition},
+	{Err: domain.ErrStateSpurious, Status: http.StatusUnprocessableEntity, Code: CodeWalletSpurious},
+	{Err: domain.ErrPoolNotCreated, Status: http.StatusNotFound, Code: CodePoolNotCreated},
+	{Err: domain.ErrPoolEmpty, Status: http.StatusUnprocessableEntity, Code: CodePoolEmpty},
+	{Err: repository.ErrVersionConflict, Status: http.StatusConflict, Code: CodeVersionConflict},
+
+	{Err: payments.ErrInvalidSignature, Status: http.StatusUnauthorized, Code: CodeInvalidSignature},
+	{Err: payments.ErrInvalidTransition, Status: http.StatusConflict, Code: CodeInvalidPaymentTransition},
+	{Err: payments.ErrPaymentNotFound, Status: http.StatusNotFound, Code: CodePaymentNotFound},
+	{Err: payments.ErrUnknownReference, Status: http.StatusNotFound, Code: CodeUnknownReference},
+	{Err: payments.ErrInvalidAmount, Status: http.StatusBadRequest, Code: CodeInvalidAmount},
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var ErrMissingWalletID = errors.New("missing wallet ID in request")
+
+type GameService interface {
+	Lose(int, float64) error
+	Win(int, float64) error
+}
+
+// GameHTTPHandler is how game providers settle the rounds players play with
+// them. Providers call it with an API key, so the gateway passes on a
+// service account, and name the wallet in the request.
+type GameHTTPHandler struct {
+	gameService GameService
+
+	http.Handler
+}
+
+func NewGameHTTPHandler(gameService GameService) *GameHTTPHandler {
+	gameHandler := GameHTTPHandler{
+		gameService: gameService,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wallet/games/bets", gameHandler.Bet)
+	mux.HandleFunc("/wallet/games/wins", gameHandler.Win)
+
+	gameHandler.Handler = mux
+
+	return &gameHandler
+}
+
+// Bet charges a lost stake to the wallet.
+func (g *GameHTTPHandler) Bet(w http.ResponseWriter, r *http.Request) {
+	g.settle(w, r, g.gameService.Lose)
+}
+
+// Win credits a payout to the wallet.
+func (g *GameHTTPHandler) Win(w http.ResponseWriter, r *http.Request) {
+	g.settle(w, r, g.gameService.Win)
+}
+
+func (g *GameHTTPHandler) settle(w http.ResponseWriter, r *http.Request, settle func(int, float64) error) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	_, err := requestServiceAccountID(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if r.Body == nil {
+		writeServiceError(w, ErrEmptyBody)
+		return
+	}
+
+	var request GameRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.WalletID <= 0 {
+		writeServiceError(w, ErrMissingWalletID)
+		return
+	}
+
+	err = settle(request.WalletID, request.Amount)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+}
@@ -0,0 +1,124 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/handler"
+)
+
+type SpyGameService struct {
+	dummyErr error
+
+	spyCommand  string
+	spyWalletID int
+	spyAmount   float64
+}
+
+func (s *SpyGameService) Lose(walletID int, amount float64) error {
+	s.spyCommand = "lose"
+	s.spyWalletID = walletID
+	s.spyAmount = amount
+	return s.dummyErr
+}
+
+func (s *SpyGameService) Win(walletID int, amount float64) error {
+	s.spyCommand = "win"
+	s.spyWalletID = walletID
+	s.spyAmount = amount
+	return s.dummyErr
+}
+
+func TestGameHandler(t *testing.T) {
+	t.Run("charges bet of service account to wallet in request", func(t *testing.T) {
+		request := newGameRequest(t, "/wallet/games/bets", handler.GameRequest{WalletID: 12, Amount: 5})
+		response := httptest.NewRecorder()
+
+		gameService := &SpyGameService{}
+		gameHandler := handler.NewGameHTTPHandler(gameService)
+
+		gameHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, gameService.spyCommand, "lose")
+		assert.Equal(t, gameService.spyWalletID, 12)
+		assert.Equal(t, gameService.spyAmount, float64(5))
+	})
+
+	t.Run("credits win of service account to wallet in request", func(t *testing.T) {
+		request := newGameRequest(t, "/wallet/games/wins", handler.GameRequest{WalletID: 12, Amount: 40})
+		response := httptest.NewRecorder()
+
+		gameService := &SpyGameService{}
+		gameHandler := handler.NewGameHTTPHandler(gameService)
+
+		gameHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, gameService.spyCommand, "win")
+		assert.Equal(t, gameService.spyAmount, float64(40))
+	})
+
+	t.Run("returns Forbidden to user", func(t *testing.T) {
+		request := newGameRequest(t, "/wallet/games/wins", handler.GameRequest{WalletID: 12, Amount: 40})
+		request.Header.Del(handler.ServiceAccountIDHeader)
+		request.Header.Set(handler.UserIDHeader, "12")
+		response := httptest.NewRecorder()
+
+		gameService := &SpyGameService{}
+		gameHandler := handler.NewGameHTTPHandler(gameService)
+
+		gameHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusForbidden)
+		assert.Equal(t, gameService.spyCommand, "")
+	})
+
+	t.Run("returns Bad Request on missing wallet ID", func(t *testing.T) {
+		request := newGameRequest(t, "/wallet/games/bets", handler.GameRequest{Amount: 5})
+		response := httptest.NewRecorder()
+
+		gameHandler := handler.NewGameHTTPHandler(&SpyGameService{})
+
+		gameHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns Unprocessable Entity on insufficient funds", func(t *testing.T) {
+		request := newGameRequest(t, "/wallet/games/bets", handler.GameRequest{WalletID: 12, Amount: 500})
+		response := httptest.NewRecorder()
+
+		gameHandler := handler.NewGameHTTPHandler(&SpyGameService{dummyErr: domain.ErrInsufficientFunds})
+
+		gameHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("returns Method Not Allowed on GET", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/wallet/games/bets", nil)
+		request.Header.Set(handler.ServiceAccountIDHeader, "3")
+		response := httptest.NewRecorder()
+
+		gameHandler := handler.NewGameHTTPHandler(&SpyGameService{})
+
+		gameHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusMethodNotAllowed)
+	})
+}
+
+func newGameRequest(t testing.TB, path string, gameRequest handler.GameRequest) *http.Request {
+	t.Helper()
+
+	reqBody := bytes.NewBuffer([]byte{})
+	json.NewEncoder(reqBody).Encode(gameRequest)
+
+	request, err := http.NewRequest(http.MethodPost, path, reqBody)
+	assert.RequireNoError(t, err)
+	request.Header.Set(handler.ServiceAccountIDHeader, "3")
+
+	return request
+}
@@ -0,0 +1,6 @@
+package handler
+
+type GameRequest struct {
+	WalletID int     `json:"wallet_id"`
+	Amount   float64 `json:"amount"`
+}
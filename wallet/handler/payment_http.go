@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/payments"
+)
+
+// SignatureHeader carries the provider's signature of the callback body.
+const SignatureHeader = "Signature"
+
+var (
+	ErrEmptyBody        = errors.New("request body is empty")
+	ErrMissingPaymentID = errors.New("missing payment ID in request")
+)
+
+type PaymentService interface {
+	InitiateDeposit(int, float64) (payments.Payment, error)
+	InitiatePayout(int, float64) (payments.Payment, error)
+	HandleCallback([]byte, string) (payments.Payment, error)
+	GetPayment(string) (payments.Payment, error)
+}
+
+type PaymentHTTPHandler struct {
+	paymentService PaymentService
+
+	http.Handler
+}
+
+func NewPaymentHTTPHandler(paymentService PaymentService) *PaymentHTTPHandler {
+	paymentHandler := PaymentHTTPHandler{
+		paymentService: paymentService,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wallet/deposits", paymentHandler.Deposit)
+	mux.HandleFunc("/wallet/payouts", paymentHandler.Payout)
+	mux.HandleFunc("/wallet/payments", paymentHandler.GetPayment)
+	mux.HandleFunc("/payments/callback", paymentHandler.Callback)
+
+	paymentHandler.Handler = mux
+
+	return &paymentHandler
+}
+
+func (p *PaymentHTTPHandler) Deposit(w http.ResponseWriter, r *http.Request) {
+	p.initiate(w, r, p.paymentService.InitiateDeposit)
+}
+
+func (p *PaymentHTTPHandler) Payout(w http.ResponseWriter, r *http.Request) {
+	p.initiate(w, r, p.paymentService.InitiatePayout)
+}
+
+func (p *PaymentHTTPHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	walletID, err := requestUserID(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	paymentID := r.URL.Query().Get("id")
+	if paymentID == "" {
+		writeServiceError(w, ErrMissingPaymentID)
+		return
+	}
+
+	payment, err := p.paymentService.GetPayment(paymentID)
+	// other users' payments are reported as missing rather than forbidden
+	// so that payment IDs can't be probed
+	if errors.Is(err, payments.ErrPaymentNotFound) || (err == nil && payment.WalletID != walletID) {
+		writeServiceError(w, payments.ErrPaymentNotFound)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(paymentToResponse(payment))
+}
+
+func (p *PaymentHTTPHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	if r.Body == nil {
+		writeServiceError(w, ErrEmptyBody)
+		return
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = p.paymentService.HandleCallback(payload, r.Header.Get(SignatureHeader))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+}
+
+func (p *PaymentHTTPHandler) initiate(w http.ResponseWriter, r *http.Request, initiate func(int, float64) (payments.Payment, error)) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	walletID, err := requestUserID(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if r.Body == nil {
+		writeServiceError(w, ErrEmptyBody)
+		return
+	}
+
+	var request PaymentRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	payment, err := initiate(walletID, request.Amount)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(paymentToResponse(payment))
+}
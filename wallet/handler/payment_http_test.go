@@ -0,0 +1,176 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/handler"
+	"github.com/VitoNaychev/elysium-challenge/wallet/payments"
+)
+
+type StubPaymentService struct {
+	dummyPayment payments.Payment
+	dummyErr     error
+
+	spyWalletID  int
+	spyAmount    float64
+	spyPayload   []byte
+	spySignature string
+}
+
+func (s *StubPaymentService) InitiateDeposit(walletID int, amount float64) (payments.Payment, error) {
+	s.spyWalletID = walletID
+	s.spyAmount = amount
+	return s.dummyPayment, s.dummyErr
+}
+
+func (s *StubPaymentService) InitiatePayout(walletID int, amount float64) (payments.Payment, error) {
+	s.spyWalletID = walletID
+	s.spyAmount = amount
+	return s.dummyPayment, s.dummyErr
+}
+
+func (s *StubPaymentService) HandleCallback(payload []byte, signature string) (payments.Payment, error) {
+	s.spyPayload = payload
+	s.spySignature = signature
+	return s.dummyPayment, s.dummyErr
+}
+
+func (s *StubPaymentService) GetPayment(id string) (payments.Payment, error) {
+	return s.dummyPayment, s.dummyErr
+}
+
+func TestDepositHandler(t *testing.T) {
+	t.Run("initiates deposit for the authenticated user", func(t *testing.T) {
+		dummyPayment := payments.Payment{ID: "abc", WalletID: 12, Kind: payments.KindDeposit, Amount: 100, State: payments.StatePending}
+
+		request := newPaymentRequest(t, "/wallet/deposits", 100)
+		response := httptest.NewRecorder()
+
+		paymentService := &StubPaymentService{dummyPayment: dummyPayment}
+		paymentHandler := handler.NewPaymentHTTPHandler(paymentService)
+
+		paymentHandler.Deposit(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, paymentService.spyWalletID, 12)
+		assert.Equal(t, paymentService.spyAmount, float64(100))
+
+		var gotResponse handler.PaymentResponse
+		json.NewDecoder(response.Body).Decode(&gotResponse)
+
+		assert.Equal(t, gotResponse.ID, dummyPayment.ID)
+		assert.Equal(t, gotResponse.Kind, "deposit")
+		assert.Equal(t, gotResponse.State, "pending")
+	})
+
+	t.Run("returns Bad Request on missing user ID", func(t *testing.T) {
+		request := newPaymentRequest(t, "/wallet/deposits", 100)
+		request.Header.Del(handler.UserIDHeader)
+		response := httptest.NewRecorder()
+
+		paymentHandler := handler.NewPaymentHTTPHandler(&StubPaymentService{})
+
+		paymentHandler.Deposit(response, request)
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func TestPayoutHandler(t *testing.T) {
+	t.Run("returns Unprocessable Entity on insufficient funds", func(t *testing.T) {
+		request := newPaymentRequest(t, "/wallet/payouts", 100)
+		response := httptest.NewRecorder()
+
+		paymentService := &StubPaymentService{dummyErr: domain.ErrInsufficientFunds}
+		paymentHandler := handler.NewPaymentHTTPHandler(paymentService)
+
+		paymentHandler.Payout(response, request)
+		assert.Equal(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("returns Method Not Allowed on GET", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/wallet/payouts", nil)
+		request.Header.Set(handler.UserIDHeader, "12")
+		response := httptest.NewRecorder()
+
+		paymentService := &StubPaymentService{}
+		paymentHandler := handler.NewPaymentHTTPHandler(paymentService)
+
+		paymentHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusMethodNotAllowed)
+		assert.Equal(t, paymentService.spyWalletID, 0)
+	})
+}
+
+func TestGetPaymentHandler(t *testing.T) {
+	t.Run("returns Not Found on another user's payment", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/wallet/payments?id=abc", nil)
+		request.Header.Set(handler.UserIDHeader, "12")
+		response := httptest.NewRecorder()
+
+		paymentService := &StubPaymentService{dummyPayment: payments.Payment{ID: "abc", WalletID: 13}}
+		paymentHandler := handler.NewPaymentHTTPHandler(paymentService)
+
+		paymentHandler.GetPayment(response, request)
+		assert.Equal(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("returns Method Not Allowed on POST", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/wallet/payments?id=abc", nil)
+		request.Header.Set(handler.UserIDHeader, "12")
+		response := httptest.NewRecorder()
+
+		paymentHandler := handler.NewPaymentHTTPHandler(&StubPaymentService{})
+
+		paymentHandler.ServeHTTP(response, request)
+		assert.Equal(t, response.Code, http.StatusMethodNotAllowed)
+	})
+}
+
+func TestCallbackHandler(t *testing.T) {
+	t.Run("passes payload and signature to PaymentService", func(t *testing.T) {
+		payload := []byte(`{"payment_id":"abc"}`)
+
+		request, _ := http.NewRequest(http.MethodPost, "/payments/callback", bytes.NewReader(payload))
+		request.Header.Set(handler.SignatureHeader, "signature")
+		response := httptest.NewRecorder()
+
+		paymentService := &StubPaymentService{}
+		paymentHandler := handler.NewPaymentHTTPHandler(paymentService)
+
+		paymentHandler.Callback(response, request)
+		assert.Equal(t, response.Code, http.StatusOK)
+
+		assert.Equal(t, paymentService.spyPayload, payload)
+		assert.Equal(t, paymentService.spySignature, "signature")
+	})
+
+	t.Run("returns Unauthorized on ErrInvalidSignature", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/payments/callback", bytes.NewReader([]byte("{}")))
+		response := httptest.NewRecorder()
+
+		paymentService := &StubPaymentService{dummyErr: payments.ErrInvalidSignature}
+		paymentHandler := handler.NewPaymentHTTPHandler(paymentService)
+
+		paymentHandler.Callback(response, request)
+		assert.Equal(t, response.Code, http.StatusUnauthorized)
+	})
+}
+
+func newPaymentRequest(t testing.TB, path string, amount float64) *http.Request {
+	t.Helper()
+
+	reqBody := bytes.NewBuffer([]byte{})
+	json.NewEncoder(reqBody).Encode(handler.PaymentRequest{Amount: amount})
+
+	request, err := http.NewRequest(http.MethodPost, path, reqBody)
+	assert.RequireNoError(t, err)
+	request.Header.Set(handler.UserIDHeader, "12")
+
+	return request
+}
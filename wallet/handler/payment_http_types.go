@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/payments"
+)
+
+type PaymentRequest struct {
+	Amount float64 `json:"amount"`
+}
+
+type PaymentResponse struct {
+	ID        string    `json:"id"`
+	WalletID  int       `json:"wallet_id"`
+	Kind      string    `json:"kind"`
+	Amount    float64   `json:"amount"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func paymentToResponse(p payments.Payment) PaymentResponse {
+	return PaymentResponse{
+		ID:        p.ID,
+		WalletID:  p.WalletID,
+		Kind:      paymentKindNames[p.Kind],
+		Amount:    p.Amount,
+		State:     paymentStateNames[p.State],
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
+
+var paymentKindNames = map[payments.Kind]string{
+	payments.KindDeposit: "deposit",
+	payments.KindPayout:  "payout",
+}
+
+var paymentStateNames = map[payments.State]string{
+	payments.StateCreated:   "created",
+	payments.StatePending:   "pending",
+	payments.StateSucceeded: "succeeded",
+	payments.StateFailed:    "failed",
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/apierror"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+	"golang.org/x/net/websocket"
+)
+
+// UserIDHeader is set by the gateway to the ID of the authenticated user.
+// Wallets are keyed by the ID of the user that owns them. Requests made with
+// an API key carry ServiceAccountIDHeader instead.
+const (
+	UserIDHeader           = "User-ID"
+	ServiceAccountIDHeader = "Service-Account-ID"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+var (
+	ErrMissingUserID     = errors.New("missing user ID in request")
+	ErrNotServiceAccount = errors.New("only service accounts may call this endpoint")
+	ErrInvalidFrom       = errors.New("invalid last seen version in request")
+	ErrMethodNotAllowed  = errors.New("method not allowed")
+)
+
+type WalletService interface {
+	Subscribe(context.Context, int, int) (<-chan service.WalletUpdate, error)
+}
+
+type WalletHTTPHandler struct {
+	walletService WalletService
+
+	http.Handler
+}
+
+func NewWalletHTTPHandler(walletService WalletService) *WalletHTTPHandler {
+	walletHandler := WalletHTTPHandler{
+		walletService: walletService,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wallet/events", walletHandler.Events)
+	mux.Handle("/wallet/ws", websocket.Server{
+		// browsers can't attach the token header to a WebSocket handshake,
+		// so authentication happens in the gateway and origin checks
+		// wouldn't add anything here
+		Handler: walletHandler.WebSocket,
+	})
+
+	walletHandler.Handler = mux
+
+	return &walletHandler
+}
+
+// Events streams wallet updates as Server-Sent Events. Clients resume by
+// sending the standard Last-Event-ID header or a "from" query parameter.
+func (h *WalletHTTPHandler) Events(w http.ResponseWriter, r *http.Request) {
+	walletID, lastSeenVersion, err := parseSubscription(r, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorResponse(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+
+	updates, err := h.walletService.Subscribe(r.Context(), walletID, lastSeenVersion)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			data, _ := json.Marshal(walletUpdateToResponse(update))
+			fmt.Fprintf(w, "id: %d\nevent: wallet\ndata: %s\n\n", update.Version, data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// WebSocket streams wallet updates as JSON messages. Clients resume by
+// passing the last version they saw in the "from" query parameter.
+func (h *WalletHTTPHandler) WebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	walletID, lastSeenVersion, err := parseSubscription(ws.Request(), "")
+	if err != nil {
+		sendErrorMessage(ws, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	// the protocol is push only, so reading is just a way to notice that
+	// the client went away
+	go func() {
+		defer cancel()
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	updates, err := h.walletService.Subscribe(ctx, walletID, lastSeenVersion)
+	if err != nil {
+		sendErrorMessage(ws, err)
+		return
+	}
+
+	for update := range updates {
+		if err := websocket.JSON.Send(ws, walletUpdateToResponse(update)); err != nil {
+			return
+		}
+	}
+}
+
+func parseSubscription(r *http.Request, lastEventID string) (int, int, error) {
+	walletID, err := requestUserID(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		from = lastEventID
+	}
+	if from == "" {
+		return walletID, 0, nil
+	}
+
+	lastSeenVersion, err := strconv.Atoi(from)
+	if err != nil || lastSeenVersion < 0 {
+		return 0, 0, ErrInvalidFrom
+	}
+
+	return walletID, lastSeenVersion, nil
+}
+
+func requestUserID(r *http.Request) (int, error) {
+	userID, err := strconv.Atoi(r.Header.Get(UserIDHeader))
+	if err != nil {
+		return 0, ErrMissingUserID
+	}
+	return userID, nil
+}
+
+// requestServiceAccountID turns away users, the gateway sets
+// ServiceAccountIDHeader only on requests made with an API key.
+func requestServiceAccountID(r *http.Request) (int, error) {
+	serviceAccountID, err := strconv.Atoi(r.Header.Get(ServiceAccountIDHeader))
+	if err != nil {
+		return 0, ErrNotServiceAccount
+	}
+	return serviceAccountID, nil
+}
+
+// sendErrorMessage reports an error over a WebSocket in the same shape as
+// an error response. The handshake has already succeeded, so the status is
+// only informational.
+func sendErrorMessage(ws *websocket.Conn, err error) {
+	apiErr := *walletErrors.Map(err)
+	apiErr.RequestID = ws.Request().Header.Get(apierror.RequestIDHeader)
+
+	websocket.JSON.Send(ws, apiErr)
+}
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	apierror.Write(w, walletErrors.Map(err))
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, err error) {
+	apierror.Write(w, walletErrors.MapStatus(err, status))
+}
@@ -0,0 +1,152 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/handler"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+	"golang.org/x/net/websocket"
+)
+
+type StubWalletService struct {
+	dummyUpdates []service.WalletUpdate
+	dummyErr     error
+
+	spyWalletID        int
+	spyLastSeenVersion int
+}
+
+func (s *StubWalletService) Subscribe(ctx context.Context, id int, lastSeenVersion int) (<-chan service.WalletUpdate, error) {
+	s.spyWalletID = id
+	s.spyLastSeenVersion = lastSeenVersion
+
+	if s.dummyErr != nil {
+		return nil, s.dummyErr
+	}
+
+	updates := make(chan service.WalletUpdate, len(s.dummyUpdates))
+	for _, update := range s.dummyUpdates {
+		updates <- update
+	}
+	close(updates)
+
+	return updates, nil
+}
+
+var dummyUpdates = []service.WalletUpdate{
+	{WalletID: 12, Version: 3, Event: &domain.WalletDeposited{ID: 12, Amount: 50}, Balance: 150},
+	{WalletID: 12, Version: 4, Event: &domain.WalletLost{ID: 12, Amount: 20}, Balance: 130},
+}
+
+func TestEventsHandler(t *testing.T) {
+	t.Run("streams wallet updates as server-sent events", func(t *testing.T) {
+		walletService := &StubWalletService{dummyUpdates: dummyUpdates}
+		server := httptest.NewServer(handler.NewWalletHTTPHandler(walletService))
+		defer server.Close()
+
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/wallet/events", nil)
+		request.Header.Set(handler.UserIDHeader, "12")
+		request.Header.Set("Last-Event-ID", "2")
+
+		response, err := http.DefaultClient.Do(request)
+		assert.RequireNoError(t, err)
+		defer response.Body.Close()
+
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		assert.Equal(t, response.Header.Get("Content-Type"), "text/event-stream")
+
+		var (
+			gotIDs     []string
+			gotUpdates []handler.WalletUpdateResponse
+		)
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if id, ok := strings.CutPrefix(line, "id: "); ok {
+				gotIDs = append(gotIDs, id)
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var update handler.WalletUpdateResponse
+				json.Unmarshal([]byte(data), &update)
+				gotUpdates = append(gotUpdates, update)
+			}
+		}
+
+		assert.Equal(t, walletService.spyWalletID, 12)
+		assert.Equal(t, walletService.spyLastSeenVersion, 2)
+		assert.Equal(t, gotIDs, []string{"3", "4"})
+		assert.Equal(t, gotUpdates, []handler.WalletUpdateResponse{
+			{WalletID: 12, Version: 3, Type: "deposited", Amount: 50, Balance: 150},
+			{WalletID: 12, Version: 4, Type: "lost", Amount: 20, Balance: 130},
+		})
+	})
+
+	t.Run("returns Bad Request on missing user ID", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/wallet/events", nil)
+		response := httptest.NewRecorder()
+
+		walletHandler := handler.NewWalletHTTPHandler(&StubWalletService{})
+		walletHandler.Events(response, request)
+
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns Bad Request on invalid last seen version", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/wallet/events?from=abc", nil)
+		request.Header.Set(handler.UserIDHeader, "12")
+		response := httptest.NewRecorder()
+
+		walletHandler := handler.NewWalletHTTPHandler(&StubWalletService{})
+		walletHandler.Events(response, request)
+
+		assert.Equal(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("returns Not Found on ErrWalletNotFound", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/wallet/events", nil)
+		request.Header.Set(handler.UserIDHeader, "12")
+		response := httptest.NewRecorder()
+
+		walletHandler := handler.NewWalletHTTPHandler(&StubWalletService{dummyErr: service.ErrWalletNotFound})
+		walletHandler.Events(response, request)
+
+		assert.Equal(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	t.Run("streams wallet updates as JSON messages", func(t *testing.T) {
+		walletService := &StubWalletService{dummyUpdates: dummyUpdates}
+		server := httptest.NewServer(handler.NewWalletHTTPHandler(walletService))
+		defer server.Close()
+
+		config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/wallet/ws?from=2", server.URL)
+		assert.RequireNoError(t, err)
+		config.Header.Set(handler.UserIDHeader, "12")
+
+		ws, err := websocket.DialConfig(config)
+		assert.RequireNoError(t, err)
+		defer ws.Close()
+
+		var gotUpdates []handler.WalletUpdateResponse
+		for {
+			var update handler.WalletUpdateResponse
+			if websocket.JSON.Receive(ws, &update) != nil {
+				break
+			}
+			gotUpdates = append(gotUpdates, update)
+		}
+
+		assert.Equal(t, walletService.spyLastSeenVersion, 2)
+		assert.Equal(t, len(gotUpdates), 2)
+		assert.Equal(t, gotUpdates[1].Balance, float64(130))
+	})
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+type WalletUpdateResponse struct {
+	WalletID int     `json:"wallet_id"`
+	Version  int     `json:"version"`
+	Type     string  `json:"type"`
+	Amount   float64 `json:"amount,omitempty"`
+	Balance  float64 `json:"balance"`
+}
+
+func walletUpdateToResponse(u service.WalletUpdate) WalletUpdateResponse {
+	eventType, amount := describeEvent(u.Event)
+
+	return WalletUpdateResponse{
+		WalletID: u.WalletID,
+		Version:  u.Version,
+		Type:     eventType,
+		Amount:   amount,
+		Balance:  u.Balance,
+	}
+}
+
+func describeEvent(event domain.Event) (string, float64) {
+	switch e := event.(type) {
+	case *domain.WalletCreated:
+		return "created", 0
+	case *domain.WalletSpurious:
+		return "spurious", 0
+	case *domain.WalletDeposited:
+		return "deposited", e.Amount
+	case *domain.WalletWithdrawed:
+		return "withdrawed", e.Amount
+	case *domain.WalletWon:
+		return "won", e.Amount
+	case *domain.WalletLost:
+		return "lost", e.Amount
+	case *domain.WalletReserved:
+		return "reserved", e.Amount
+	case *domain.WalletReleased:
+		return "released", e.Amount
+	case *domain.WalletRefunded:
+		return "refunded", e.Amount
+	case *domain.WalletFlagged:
+		return "flagged", 0
+	}
+
+	return "unknown", 0
+}
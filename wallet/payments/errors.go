@@ -0,0 +1,11 @@
+package payments
+
+import "errors"
+
+var (
+	ErrInvalidSignature  = errors.New("callback signature is invalid")
+	ErrInvalidTransition = errors.New("unsupported payment state transition")
+	ErrPaymentNotFound   = errors.New("payment doesn't exist")
+	ErrUnknownReference  = errors.New("provider doesn't know payment reference")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+)
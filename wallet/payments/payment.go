@@ -0,0 +1,52 @@
+package payments
+
+import "time"
+
+type Kind byte
+
+const (
+	KindDeposit Kind = iota
+	KindPayout
+)
+
+type State byte
+
+const (
+	StateCreated State = iota
+	StatePending
+	StateSucceeded
+	StateFailed
+)
+
+var transitions = map[State][]State{
+	StateCreated: {StatePending, StateFailed},
+	StatePending: {StateSucceeded, StateFailed},
+}
+
+type Payment struct {
+	ID          string
+	WalletID    int
+	Kind        Kind
+	Amount      float64
+	Provider    string
+	ProviderRef string
+	State       State
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (p *Payment) IsFinal() bool {
+	return p.State == StateSucceeded || p.State == StateFailed
+}
+
+func (p *Payment) transition(to State) error {
+	for _, allowed := range transitions[p.State] {
+		if allowed == to {
+			p.State = to
+			p.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+
+	return ErrInvalidTransition
+}
@@ -0,0 +1,52 @@
+package payments
+
+import "sync"
+
+type PaymentRepo interface {
+	Create(*Payment) error
+	Update(*Payment) error
+	GetByID(string) (Payment, error)
+}
+
+type InMemoryPaymentRepo struct {
+	mu       sync.RWMutex
+	payments map[string]Payment
+}
+
+func NewInMemoryPaymentRepo() *InMemoryPaymentRepo {
+	return &InMemoryPaymentRepo{
+		payments: make(map[string]Payment),
+	}
+}
+
+func (i *InMemoryPaymentRepo) Create(payment *Payment) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.payments[payment.ID] = *payment
+	return nil
+}
+
+func (i *InMemoryPaymentRepo) Update(payment *Payment) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.payments[payment.ID]; !ok {
+		return ErrPaymentNotFound
+	}
+
+	i.payments[payment.ID] = *payment
+	return nil
+}
+
+func (i *InMemoryPaymentRepo) GetByID(id string) (Payment, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	payment, ok := i.payments[id]
+	if !ok {
+		return Payment{}, ErrPaymentNotFound
+	}
+
+	return payment, nil
+}
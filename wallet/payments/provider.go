@@ -0,0 +1,51 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+type InitiateRequest struct {
+	PaymentID string
+	WalletID  int
+	Kind      Kind
+	Amount    float64
+}
+
+type Callback struct {
+	PaymentID   string `json:"payment_id"`
+	ProviderRef string `json:"provider_ref"`
+	Succeeded   bool   `json:"succeeded"`
+}
+
+// Provider is a payment service provider that actually moves the money.
+// Results are reported asynchronously through signed callbacks, and Status
+// can be polled for payments whose callback never arrived.
+type Provider interface {
+	Name() string
+	Initiate(InitiateRequest) (string, error)
+	Status(providerRef string) (State, error)
+	// VerifyCallback checks the signature of a callback payload and only
+	// then decodes it.
+	VerifyCallback(payload []byte, signature string) (Callback, error)
+}
+
+// SignPayload returns the hex encoded HMAC-SHA256 of the payload, which is
+// the signature scheme most providers use for their callbacks.
+func SignPayload(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifySignature(secret, payload []byte, signature string) bool {
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
@@ -0,0 +1,235 @@
+package payments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const refundAttempts = 3
+
+type WalletService interface {
+	DepositSettled(int, float64) error
+	Withdraw(int, float64) error
+	Refund(int, float64) error
+	GetBalance(int) (float64, error)
+}
+
+// PaymentService tracks deposits and payouts while the provider moves the
+// money. Deposits credit the wallet only once the provider confirms them
+// through a verified callback, and since the money has moved by then risk
+// rules can't reject the credit. Payouts debit the wallet up front, so that
+// risk rules and the balance check run when the player asks for the money,
+// and refund it if the provider fails the payout.
+type PaymentService struct {
+	provider Provider
+	repo     PaymentRepo
+	wallets  WalletService
+
+	// settleMu keeps duplicate callbacks for the same payment from
+	// crediting or refunding the wallet twice.
+	settleMu sync.Mutex
+}
+
+func NewPaymentService(provider Provider, repo PaymentRepo, wallets WalletService) *PaymentService {
+	return &PaymentService{
+		provider: provider,
+		repo:     repo,
+		wallets:  wallets,
+	}
+}
+
+func (p *PaymentService) InitiateDeposit(walletID int, amount float64) (Payment, error) {
+	if amount <= 0 {
+		return Payment{}, ErrInvalidAmount
+	}
+
+	_, err := p.wallets.GetBalance(walletID)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	return p.initiate(walletID, KindDeposit, amount)
+}
+
+func (p *PaymentService) InitiatePayout(walletID int, amount float64) (Payment, error) {
+	if amount <= 0 {
+		return Payment{}, ErrInvalidAmount
+	}
+
+	err := p.wallets.Withdraw(walletID, amount)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	payment, err := p.initiate(walletID, KindPayout, amount)
+	if err != nil {
+		if refundErr := p.wallets.Refund(walletID, amount); refundErr != nil {
+			return Payment{}, fmt.Errorf("couldn't return funds of failed payout: %w", refundErr)
+		}
+		return Payment{}, err
+	}
+
+	return payment, nil
+}
+
+// HandleCallback settles the payment reported by a provider callback.
+// Callbacks for already settled payments are acknowledged without effect,
+// since providers retry their deliveries.
+func (p *PaymentService) HandleCallback(payload []byte, signature string) (Payment, error) {
+	callback, err := p.provider.VerifyCallback(payload, signature)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	return p.settle(callback.PaymentID, callback.ProviderRef, callback.Succeeded)
+}
+
+// Refresh polls the provider for a pending payment whose callback may have
+// been lost and settles it if the provider has.
+func (p *PaymentService) Refresh(paymentID string) (Payment, error) {
+	payment, err := p.repo.GetByID(paymentID)
+	if err != nil {
+		return Payment{}, err
+	}
+	if payment.State != StatePending {
+		return payment, nil
+	}
+
+	state, err := p.provider.Status(payment.ProviderRef)
+	if err != nil {
+		return Payment{}, fmt.Errorf("couldn't get payment status from provider: %w", err)
+	}
+	if state != StateSucceeded && state != StateFailed {
+		return payment, nil
+	}
+
+	return p.settle(payment.ID, payment.ProviderRef, state == StateSucceeded)
+}
+
+func (p *PaymentService) GetPayment(paymentID string) (Payment, error) {
+	return p.repo.GetByID(paymentID)
+}
+
+func (p *PaymentService) initiate(walletID int, kind Kind, amount float64) (Payment, error) {
+	id, err := newPaymentID()
+	if err != nil {
+		return Payment{}, err
+	}
+
+	now := time.Now()
+	payment := Payment{
+		ID:        id,
+		WalletID:  walletID,
+		Kind:      kind,
+		Amount:    amount,
+		Provider:  p.provider.Name(),
+		State:     StateCreated,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = p.repo.Create(&payment)
+	if err != nil {
+		return Payment{}, fmt.Errorf("couldn't create payment: %w", err)
+	}
+
+	ref, err := p.provider.Initiate(InitiateRequest{
+		PaymentID: payment.ID,
+		WalletID:  walletID,
+		Kind:      kind,
+		Amount:    amount,
+	})
+	if err != nil {
+		payment.transition(StateFailed)
+		p.repo.Update(&payment)
+
+		return Payment{}, fmt.Errorf("couldn't initiate payment with provider: %w", err)
+	}
+
+	payment.ProviderRef = ref
+	payment.transition(StatePending)
+
+	err = p.repo.Update(&payment)
+	if err != nil {
+		return Payment{}, fmt.Errorf("couldn't update payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+func (p *PaymentService) settle(paymentID, providerRef string, succeeded bool) (Payment, error) {
+	p.settleMu.Lock()
+	defer p.settleMu.Unlock()
+
+	payment, err := p.repo.GetByID(paymentID)
+	if err != nil {
+		return Payment{}, err
+	}
+	if payment.ProviderRef != providerRef {
+		return Payment{}, ErrUnknownReference
+	}
+	if payment.IsFinal() {
+		return payment, nil
+	}
+
+	target := StateFailed
+	if succeeded {
+		target = StateSucceeded
+	}
+
+	// the wallet is only touched once the transition is known to be valid,
+	// and a deposit stays pending if crediting it fails so that it can be
+	// retried
+	settled := payment
+	err = settled.transition(target)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	switch {
+	case succeeded && payment.Kind == KindDeposit:
+		err = p.wallets.DepositSettled(payment.WalletID, payment.Amount)
+	case !succeeded && payment.Kind == KindPayout:
+		err = p.refund(payment.WalletID, payment.Amount)
+		if err != nil {
+			// the provider has failed the payout for good, so it can't stay
+			// pending while the funds wait to be returned by hand
+			p.repo.Update(&settled)
+			return Payment{}, fmt.Errorf("couldn't return funds of failed payout: %w", err)
+		}
+	}
+	if err != nil {
+		return Payment{}, fmt.Errorf("couldn't settle payment in wallet: %w", err)
+	}
+
+	err = p.repo.Update(&settled)
+	if err != nil {
+		return Payment{}, fmt.Errorf("couldn't update payment: %w", err)
+	}
+
+	return settled, nil
+}
+
+// refund returns the funds of a failed payout, retrying a few times since the
+// provider won't report the payout again once it's settled.
+func (p *PaymentService) refund(walletID int, amount float64) error {
+	var err error
+	for attempt := 0; attempt < refundAttempts; attempt++ {
+		err = p.wallets.Refund(walletID, amount)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func newPaymentID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("couldn't generate payment ID: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
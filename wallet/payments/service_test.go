@@ -0,0 +1,258 @@
+package payments_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/payments"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/risk"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+var providerSecret = []byte("provider-secret")
+
+var errRefund = errors.New("wallet is busy")
+
+type StubRefundWallet struct {
+	*service.WalletService
+
+	dummyErr      error
+	dummyFailures int
+}
+
+func (s *StubRefundWallet) Refund(walletID int, amount float64) error {
+	if s.dummyFailures > 0 {
+		s.dummyFailures--
+		return s.dummyErr
+	}
+	return s.WalletService.Refund(walletID, amount)
+}
+
+func TestDeposit(t *testing.T) {
+	walletID := 12
+
+	t.Run("credits the wallet only after a successful callback", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 0)
+
+		payment, err := paymentService.InitiateDeposit(walletID, 100)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StatePending)
+
+		assertWalletBalance(t, walletService, walletID, 0)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, true)
+		assert.RequireNoError(t, err)
+
+		payment, err = paymentService.HandleCallback(payload, signature)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StateSucceeded)
+
+		assertWalletBalance(t, walletService, walletID, 100)
+	})
+
+	t.Run("credits a settled deposit that risk rules would reject", func(t *testing.T) {
+		rejectDeposits := &risk.SmallDepositsRule{Action: service.RiskReject, Window: time.Hour, MaxAmount: 1000, MaxCount: 0}
+		engine := risk.NewEngine([]risk.Rule{rejectDeposits}, risk.NewInMemoryDecisionLog())
+
+		walletService, paymentService, provider := setup(t, walletID, 0, service.WithRiskEngine(engine))
+
+		payment, err := paymentService.InitiateDeposit(walletID, 100)
+		assert.RequireNoError(t, err)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, true)
+		assert.RequireNoError(t, err)
+
+		payment, err = paymentService.HandleCallback(payload, signature)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StateSucceeded)
+
+		assertWalletBalance(t, walletService, walletID, 100)
+	})
+
+	t.Run("doesn't credit the wallet on failed callback", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 0)
+
+		payment, err := paymentService.InitiateDeposit(walletID, 100)
+		assert.RequireNoError(t, err)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, false)
+		assert.RequireNoError(t, err)
+
+		payment, err = paymentService.HandleCallback(payload, signature)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StateFailed)
+
+		assertWalletBalance(t, walletService, walletID, 0)
+	})
+
+	t.Run("returns ErrInvalidSignature on tampered callback", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 0)
+
+		payment, err := paymentService.InitiateDeposit(walletID, 100)
+		assert.RequireNoError(t, err)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, false)
+		assert.RequireNoError(t, err)
+
+		payload = []byte(`{"payment_id":"` + payment.ID + `","provider_ref":"` + payment.ProviderRef + `","succeeded":true}`)
+
+		_, err = paymentService.HandleCallback(payload, signature)
+		assert.Equal(t, err, payments.ErrInvalidSignature)
+
+		assertWalletBalance(t, walletService, walletID, 0)
+	})
+
+	t.Run("credits the wallet once on duplicate callbacks", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 0)
+
+		payment, err := paymentService.InitiateDeposit(walletID, 100)
+		assert.RequireNoError(t, err)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, true)
+		assert.RequireNoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			_, err = paymentService.HandleCallback(payload, signature)
+			assert.RequireNoError(t, err)
+		}
+
+		assertWalletBalance(t, walletService, walletID, 100)
+	})
+
+	t.Run("settles payment whose callback was lost on refresh", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 0)
+
+		payment, err := paymentService.InitiateDeposit(walletID, 100)
+		assert.RequireNoError(t, err)
+
+		_, _, err = provider.Settle(payment.ProviderRef, true)
+		assert.RequireNoError(t, err)
+
+		payment, err = paymentService.Refresh(payment.ID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StateSucceeded)
+
+		assertWalletBalance(t, walletService, walletID, 100)
+	})
+
+	t.Run("returns ErrWalletNotFound on missing wallet", func(t *testing.T) {
+		_, paymentService, _ := setup(t, walletID, 0)
+
+		_, err := paymentService.InitiateDeposit(walletID+1, 100)
+		assert.Equal(t, err, (error)(service.ErrWalletNotFound))
+	})
+}
+
+func TestPayout(t *testing.T) {
+	walletID := 12
+
+	t.Run("debits the wallet when the payout is initiated", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 100)
+
+		payment, err := paymentService.InitiatePayout(walletID, 40)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StatePending)
+
+		assertWalletBalance(t, walletService, walletID, 60)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, true)
+		assert.RequireNoError(t, err)
+
+		payment, err = paymentService.HandleCallback(payload, signature)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StateSucceeded)
+
+		assertWalletBalance(t, walletService, walletID, 60)
+	})
+
+	t.Run("returns funds to the wallet on failed payout", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 100)
+
+		payment, err := paymentService.InitiatePayout(walletID, 40)
+		assert.RequireNoError(t, err)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, false)
+		assert.RequireNoError(t, err)
+
+		_, err = paymentService.HandleCallback(payload, signature)
+		assert.RequireNoError(t, err)
+
+		assertWalletBalance(t, walletService, walletID, 100)
+	})
+
+	t.Run("retries refund of failed payout", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 100)
+		wallets := &StubRefundWallet{WalletService: walletService, dummyErr: errRefund, dummyFailures: 1}
+		paymentService = payments.NewPaymentService(provider, payments.NewInMemoryPaymentRepo(), wallets)
+
+		payment, err := paymentService.InitiatePayout(walletID, 40)
+		assert.RequireNoError(t, err)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, false)
+		assert.RequireNoError(t, err)
+
+		payment, err = paymentService.HandleCallback(payload, signature)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StateFailed)
+
+		assertWalletBalance(t, walletService, walletID, 100)
+	})
+
+	t.Run("fails payout whose funds couldn't be returned", func(t *testing.T) {
+		walletService, paymentService, provider := setup(t, walletID, 100)
+		wallets := &StubRefundWallet{WalletService: walletService, dummyErr: errRefund, dummyFailures: 10}
+		paymentService = payments.NewPaymentService(provider, payments.NewInMemoryPaymentRepo(), wallets)
+
+		payment, err := paymentService.InitiatePayout(walletID, 40)
+		assert.RequireNoError(t, err)
+
+		payload, signature, err := provider.Settle(payment.ProviderRef, false)
+		assert.RequireNoError(t, err)
+
+		_, err = paymentService.HandleCallback(payload, signature)
+		assert.Equal(t, errors.Is(err, errRefund), true)
+
+		payment, err = paymentService.GetPayment(payment.ID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, payment.State, payments.StateFailed)
+
+		assertWalletBalance(t, walletService, walletID, 60)
+	})
+
+	t.Run("returns ErrInsufficientFunds on payout above balance", func(t *testing.T) {
+		_, paymentService, _ := setup(t, walletID, 100)
+
+		_, err := paymentService.InitiatePayout(walletID, 400)
+		assert.Equal(t, err, domain.ErrInsufficientFunds)
+	})
+}
+
+func setup(t testing.TB, walletID int, balance float64, options ...service.Option) (*service.WalletService, *payments.PaymentService, *payments.SimulatedProvider) {
+	t.Helper()
+
+	walletService := service.NewWalletService(repository.NewInMemoryEventStore(), options...)
+
+	err := walletService.Create(walletID)
+	assert.RequireNoError(t, err)
+	if balance > 0 {
+		err = walletService.Deposit(walletID, balance)
+		assert.RequireNoError(t, err)
+	}
+
+	provider := payments.NewSimulatedProvider(providerSecret)
+	paymentService := payments.NewPaymentService(provider, payments.NewInMemoryPaymentRepo(), walletService)
+
+	return walletService, paymentService, provider
+}
+
+func assertWalletBalance(t testing.TB, walletService *service.WalletService, walletID int, want float64) {
+	t.Helper()
+
+	got, err := walletService.GetBalance(walletID)
+	assert.RequireNoError(t, err)
+	assert.Equal(t, got, want)
+}
@@ -0,0 +1,105 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// SimulatedProvider is a local stand-in for a real provider so that the
+// whole payment flow can run offline. Payments stay pending until Settle
+// is called, which produces the signed callback the real provider would
+// send.
+type SimulatedProvider struct {
+	secret []byte
+
+	mu       sync.Mutex
+	nextRef  int
+	payments map[string]simulatedPayment
+}
+
+type simulatedPayment struct {
+	paymentID string
+	state     State
+}
+
+func NewSimulatedProvider(secret []byte) *SimulatedProvider {
+	return &SimulatedProvider{
+		secret:   secret,
+		payments: make(map[string]simulatedPayment),
+	}
+}
+
+func (s *SimulatedProvider) Name() string {
+	return "simulator"
+}
+
+func (s *SimulatedProvider) Initiate(request InitiateRequest) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextRef++
+	ref := fmt.Sprintf("sim-%d", s.nextRef)
+
+	s.payments[ref] = simulatedPayment{
+		paymentID: request.PaymentID,
+		state:     StatePending,
+	}
+
+	return ref, nil
+}
+
+func (s *SimulatedProvider) Status(providerRef string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[providerRef]
+	if !ok {
+		return StateFailed, ErrUnknownReference
+	}
+
+	return payment.state, nil
+}
+
+func (s *SimulatedProvider) VerifyCallback(payload []byte, signature string) (Callback, error) {
+	if !VerifySignature(s.secret, payload, signature) {
+		return Callback{}, ErrInvalidSignature
+	}
+
+	var callback Callback
+	err := json.Unmarshal(payload, &callback)
+	if err != nil {
+		return Callback{}, err
+	}
+
+	return callback, nil
+}
+
+// Settle completes a pending payment and returns the signed callback
+// payload together with its signature.
+func (s *SimulatedProvider) Settle(providerRef string, succeeded bool) ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[providerRef]
+	if !ok {
+		return nil, "", ErrUnknownReference
+	}
+
+	payment.state = StateFailed
+	if succeeded {
+		payment.state = StateSucceeded
+	}
+	s.payments[providerRef] = payment
+
+	payload, err := json.Marshal(Callback{
+		PaymentID:   payment.paymentID,
+		ProviderRef: providerRef,
+		Succeeded:   succeeded,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return payload, SignPayload(s.secret, payload), nil
+}
@@ -0,0 +1,7 @@
+package repository
+
+import "errors"
+
+var (
+	ErrVersionConflict = errors.New("stream version doesn't match expected version")
+)
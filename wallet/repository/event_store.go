@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+)
+
+// EventStore persists the events of event-sourced aggregates in named
+// streams. Append must fail with ErrVersionConflict when the stream has
+// moved past expectedVersion, which is what optimistic concurrency relies on.
+type EventStore interface {
+	Load(stream string) ([]domain.Event, error)
+	LoadRecords(stream string) ([]Record, error)
+	Append(stream string, expectedVersion int, events []domain.Event) error
+	// AppendAll appends to several streams atomically: either every
+	// append goes through or none does.
+	AppendAll(appends ...StreamAppend) error
+}
+
+type StreamAppend struct {
+	Stream          string
+	ExpectedVersion int
+	Events          []domain.Event
+}
+
+// Record is an event as committed to a stream. Version is the version of
+// the stream right after the event was appended, starting from 1.
+type Record struct {
+	Stream     string
+	Version    int
+	Event      domain.Event
+	RecordedAt time.Time
+}
+
+// EventFeed notifies subscribers about events as they are committed.
+// Delivery is best effort: a subscriber that falls behind has its channel
+// closed and is expected to catch up from the EventStore and resubscribe.
+type EventFeed interface {
+	Subscribe(stream string) (<-chan Record, func())
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+)
+
+const subscriberBufferSize = 64
+
+type subscriber struct {
+	records chan Record
+}
+
+type InMemoryEventStore struct {
+	mu          sync.RWMutex
+	streams     map[string][]Record
+	subscribers map[string]map[*subscriber]struct{}
+}
+
+func NewInMemoryEventStore() *InMemoryEventStore {
+	return &InMemoryEventStore{
+		streams:     make(map[string][]Record),
+		subscribers: make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+func (i *InMemoryEventStore) Load(stream string) ([]domain.Event, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	events := make([]domain.Event, len(i.streams[stream]))
+	for j, record := range i.streams[stream] {
+		events[j] = record.Event
+	}
+
+	return events, nil
+}
+
+func (i *InMemoryEventStore) LoadRecords(stream string) ([]Record, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	records := make([]Record, len(i.streams[stream]))
+	copy(records, i.streams[stream])
+
+	return records, nil
+}
+
+func (i *InMemoryEventStore) Append(stream string, expectedVersion int, events []domain.Event) error {
+	return i.AppendAll(StreamAppend{
+		Stream:          stream,
+		ExpectedVersion: expectedVersion,
+		Events:          events,
+	})
+}
+
+func (i *InMemoryEventStore) AppendAll(appends ...StreamAppend) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, a := range appends {
+		if len(i.streams[a.Stream]) != a.ExpectedVersion {
+			return ErrVersionConflict
+		}
+	}
+
+	recordedAt := time.Now()
+	for _, a := range appends {
+		for j, event := range a.Events {
+			record := Record{
+				Stream:     a.Stream,
+				Version:    a.ExpectedVersion + j + 1,
+				Event:      event,
+				RecordedAt: recordedAt,
+			}
+
+			i.streams[a.Stream] = append(i.streams[a.Stream], record)
+			i.publish(record)
+		}
+	}
+
+	return nil
+}
+
+func (i *InMemoryEventStore) Subscribe(stream string) (<-chan Record, func()) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	sub := &subscriber{
+		records: make(chan Record, subscriberBufferSize),
+	}
+
+	if i.subscribers[stream] == nil {
+		i.subscribers[stream] = make(map[*subscriber]struct{})
+	}
+	i.subscribers[stream][sub] = struct{}{}
+
+	unsubscribe := func() {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		i.removeSubscriber(stream, sub)
+	}
+
+	return sub.records, unsubscribe
+}
+
+// publish must be called with i.mu held.
+func (i *InMemoryEventStore) publish(record Record) {
+	for sub := range i.subscribers[record.Stream] {
+		select {
+		case sub.records <- record:
+		default:
+			i.removeSubscriber(record.Stream, sub)
+		}
+	}
+}
+
+// removeSubscriber must be called with i.mu held.
+func (i *InMemoryEventStore) removeSubscriber(stream string, sub *subscriber) {
+	if _, ok := i.subscribers[stream][sub]; !ok {
+		return
+	}
+
+	delete(i.subscribers[stream], sub)
+	if len(i.subscribers[stream]) == 0 {
+		delete(i.subscribers, stream)
+	}
+	close(sub.records)
+}
@@ -0,0 +1,93 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+	"github.com/spf13/viper"
+)
+
+type RuleConfig struct {
+	Type   string        `mapstructure:"type"`
+	Action string        `mapstructure:"action"`
+	Window time.Duration `mapstructure:"window"`
+
+	MaxCycles    int     `mapstructure:"maxCycles,omitempty"`
+	MinWinAmount float64 `mapstructure:"minWinAmount,omitempty"`
+	MaxAmount    float64 `mapstructure:"maxAmount,omitempty"`
+	MaxCount     int     `mapstructure:"maxCount,omitempty"`
+}
+
+type RiskConfig struct {
+	Rules []RuleConfig `mapstructure:"rules"`
+}
+
+func LoadRiskConfig(path string) (RiskConfig, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigFile(path)
+
+	err := v.ReadInConfig()
+	if err != nil {
+		return RiskConfig{}, err
+	}
+
+	riskConfig := RiskConfig{}
+	err = v.UnmarshalKey("risk", &riskConfig)
+	if err != nil {
+		return RiskConfig{}, err
+	}
+
+	return riskConfig, nil
+}
+
+func NewRulesFromConfig(config RiskConfig) ([]Rule, error) {
+	rules := make([]Rule, 0, len(config.Rules))
+
+	for _, ruleConfig := range config.Rules {
+		action, err := parseAction(ruleConfig.Action)
+		if err != nil {
+			return nil, err
+		}
+
+		switch ruleConfig.Type {
+		case "rapid-cycling":
+			rules = append(rules, &RapidCyclingRule{
+				Action:    action,
+				Window:    ruleConfig.Window,
+				MaxCycles: ruleConfig.MaxCycles,
+			})
+		case "withdraw-after-win":
+			rules = append(rules, &WithdrawAfterWinRule{
+				Action:       action,
+				Window:       ruleConfig.Window,
+				MinWinAmount: ruleConfig.MinWinAmount,
+			})
+		case "small-deposits":
+			rules = append(rules, &SmallDepositsRule{
+				Action:    action,
+				Window:    ruleConfig.Window,
+				MaxAmount: ruleConfig.MaxAmount,
+				MaxCount:  ruleConfig.MaxCount,
+			})
+		default:
+			return nil, fmt.Errorf("unknown risk rule type %q", ruleConfig.Type)
+		}
+	}
+
+	return rules, nil
+}
+
+func parseAction(action string) (service.RiskAction, error) {
+	switch action {
+	case "allow":
+		return service.RiskAllow, nil
+	case "flag":
+		return service.RiskFlag, nil
+	case "reject":
+		return service.RiskReject, nil
+	}
+
+	return service.RiskAllow, fmt.Errorf("unknown risk action %q", action)
+}
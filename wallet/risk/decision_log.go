@@ -0,0 +1,53 @@
+package risk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+type DecisionEntry struct {
+	WalletID  int
+	Command   service.CommandType
+	Amount    float64
+	Action    service.RiskAction
+	Rule      string
+	Reason    string
+	DecidedAt time.Time
+}
+
+// DecisionLog keeps the flag and reject decisions for later review.
+type DecisionLog interface {
+	Record(DecisionEntry) error
+	List(walletID int) ([]DecisionEntry, error)
+}
+
+type InMemoryDecisionLog struct {
+	mu      sync.RWMutex
+	entries map[int][]DecisionEntry
+}
+
+func NewInMemoryDecisionLog() *InMemoryDecisionLog {
+	return &InMemoryDecisionLog{
+		entries: make(map[int][]DecisionEntry),
+	}
+}
+
+func (i *InMemoryDecisionLog) Record(entry DecisionEntry) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.entries[entry.WalletID] = append(i.entries[entry.WalletID], entry)
+	return nil
+}
+
+func (i *InMemoryDecisionLog) List(walletID int) ([]DecisionEntry, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	entries := make([]DecisionEntry, len(i.entries[walletID]))
+	copy(entries, i.entries[walletID])
+
+	return entries, nil
+}
@@ -0,0 +1,61 @@
+package risk
+
+import (
+	"log"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+// Engine runs every rule against a command and keeps the flag and reject
+// decisions in the decision log once the command's batch is committed. It
+// implements service.RiskEngine.
+type Engine struct {
+	rules       []Rule
+	decisionLog DecisionLog
+	now         func() time.Time
+}
+
+func NewEngine(rules []Rule, decisionLog DecisionLog) *Engine {
+	return &Engine{
+		rules:       rules,
+		decisionLog: decisionLog,
+		now:         time.Now,
+	}
+}
+
+// Evaluate has no side effects, a command is evaluated again each time its
+// batch is retried.
+func (e *Engine) Evaluate(cmd service.Command, history []repository.Record) []service.RiskDecision {
+	now := e.now()
+
+	var decisions []service.RiskDecision
+	for _, rule := range e.rules {
+		decision := rule.Evaluate(cmd, history, now)
+		if decision.Action != service.RiskAllow {
+			decisions = append(decisions, decision)
+		}
+	}
+
+	return decisions
+}
+
+func (e *Engine) Record(cmd service.Command, decisions []service.RiskDecision) {
+	now := e.now()
+
+	for _, decision := range decisions {
+		err := e.decisionLog.Record(DecisionEntry{
+			WalletID:  cmd.WalletID,
+			Command:   cmd.Type,
+			Amount:    cmd.Amount,
+			Action:    decision.Action,
+			Rule:      decision.Rule,
+			Reason:    decision.Reason,
+			DecidedAt: now,
+		})
+		if err != nil {
+			log.Printf("couldn't record risk decision: %v", err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package risk_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/risk"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+// FailingEventStore fails the next appends, as many as failures, with err.
+type FailingEventStore struct {
+	*repository.InMemoryEventStore
+
+	err      error
+	failures int
+}
+
+func (f *FailingEventStore) Append(stream string, expectedVersion int, events []domain.Event) error {
+	if f.failures > 0 {
+		f.failures--
+		return f.err
+	}
+	return f.InMemoryEventStore.Append(stream, expectedVersion, events)
+}
+
+func TestEngine(t *testing.T) {
+	walletID := 12
+
+	setup := func(t testing.TB, rules ...risk.Rule) (*service.WalletService, *repository.InMemoryEventStore, *risk.InMemoryDecisionLog) {
+		t.Helper()
+
+		store := repository.NewInMemoryEventStore()
+		walletService, decisionLog := setupWithStore(t, store, walletID, rules...)
+
+		return walletService, store, decisionLog
+	}
+
+	t.Run("rejects command and records the decision", func(t *testing.T) {
+		walletService, _, decisionLog := setup(t,
+			&risk.WithdrawAfterWinRule{Action: service.RiskReject, Window: time.Hour, MinWinAmount: 1000})
+
+		err := walletService.Win(walletID, 5000)
+		assert.RequireNoError(t, err)
+
+		err = walletService.Withdraw(walletID, 100)
+		if !errors.Is(err, service.ErrRejectedByRisk) {
+			t.Fatalf("got error %v want ErrRejectedByRisk", err)
+		}
+
+		assertWalletBalance(t, walletService, walletID, 5000)
+
+		entries, err := decisionLog.List(walletID)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Action, service.RiskReject)
+		assert.Equal(t, entries[0].Command, service.CommandWithdraw)
+	})
+
+	t.Run("flags command with an event and still applies it", func(t *testing.T) {
+		walletService, store, decisionLog := setup(t,
+			&risk.SmallDepositsRule{Action: service.RiskFlag, Window: time.Hour, MaxAmount: 10, MaxCount: 1})
+
+		err := walletService.Deposit(walletID, 5)
+		assert.RequireNoError(t, err)
+
+		err = walletService.Deposit(walletID, 5)
+		assert.RequireNoError(t, err)
+
+		assertWalletBalance(t, walletService, walletID, 10)
+
+		events, err := store.Load("wallet-12")
+		assert.RequireNoError(t, err)
+		assert.Type[*domain.WalletFlagged](t, events[len(events)-1])
+
+		entries, err := decisionLog.List(walletID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(entries), 1)
+	})
+
+	t.Run("neither flags nor records command that fails", func(t *testing.T) {
+		walletService, store, decisionLog := setup(t,
+			&risk.WithdrawAfterWinRule{Action: service.RiskFlag, Window: time.Hour, MinWinAmount: 1000})
+
+		err := walletService.Win(walletID, 5000)
+		assert.RequireNoError(t, err)
+
+		err = walletService.Withdraw(walletID, 10000)
+		if !errors.Is(err, domain.ErrInsufficientFunds) {
+			t.Fatalf("got error %v want ErrInsufficientFunds", err)
+		}
+
+		events, err := store.Load("wallet-12")
+		assert.RequireNoError(t, err)
+		for _, event := range events {
+			if _, ok := event.(*domain.WalletFlagged); ok {
+				t.Errorf("got WalletFlagged event for failed command")
+			}
+		}
+
+		entries, err := decisionLog.List(walletID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(entries), 0)
+	})
+
+	t.Run("settles on the most severe decision", func(t *testing.T) {
+		walletService, _, decisionLog := setup(t,
+			&risk.RapidCyclingRule{Action: service.RiskFlag, Window: time.Hour, MaxCycles: 1},
+			&risk.WithdrawAfterWinRule{Action: service.RiskReject, Window: time.Hour, MinWinAmount: 10})
+
+		err := walletService.Win(walletID, 50)
+		assert.RequireNoError(t, err)
+		err = walletService.Deposit(walletID, 50)
+		assert.RequireNoError(t, err)
+
+		err = walletService.Withdraw(walletID, 100)
+		if !errors.Is(err, service.ErrRejectedByRisk) {
+			t.Fatalf("got error %v want ErrRejectedByRisk", err)
+		}
+
+		entries, err := decisionLog.List(walletID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(entries), 2)
+	})
+
+	flagRule := &risk.SmallDepositsRule{Action: service.RiskFlag, Window: time.Hour, MaxAmount: 10, MaxCount: 0}
+
+	t.Run("records the decision once when the batch is retried", func(t *testing.T) {
+		store := &FailingEventStore{InMemoryEventStore: repository.NewInMemoryEventStore(), err: repository.ErrVersionConflict}
+		walletService, decisionLog := setupWithStore(t, store, walletID, flagRule)
+
+		store.failures = 2
+		err := walletService.Deposit(walletID, 5)
+		assert.RequireNoError(t, err)
+
+		entries, err := decisionLog.List(walletID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(entries), 1)
+	})
+
+	t.Run("doesn't record decisions of commands that aren't committed", func(t *testing.T) {
+		store := &FailingEventStore{InMemoryEventStore: repository.NewInMemoryEventStore(), err: errors.New("disk full")}
+		walletService, decisionLog := setupWithStore(t, store, walletID, flagRule)
+
+		store.failures = 1
+		err := walletService.Deposit(walletID, 5)
+		if err == nil {
+			t.Fatalf("expected error, got nil")
+		}
+
+		entries, err := decisionLog.List(walletID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, len(entries), 0)
+	})
+}
+
+func setupWithStore(t testing.TB, store repository.EventStore, walletID int, rules ...risk.Rule) (*service.WalletService, *risk.InMemoryDecisionLog) {
+	t.Helper()
+
+	decisionLog := risk.NewInMemoryDecisionLog()
+	engine := risk.NewEngine(rules, decisionLog)
+
+	walletService := service.NewWalletService(store, service.WithRiskEngine(engine))
+
+	err := walletService.Create(walletID)
+	assert.RequireNoError(t, err)
+
+	return walletService, decisionLog
+}
+
+func TestRulesFromConfig(t *testing.T) {
+	t.Run("builds rules declared in the config file", func(t *testing.T) {
+		riskConfig, err := risk.LoadRiskConfig("../config/risk.yml")
+		assert.RequireNoError(t, err)
+
+		rules, err := risk.NewRulesFromConfig(riskConfig)
+		assert.RequireNoError(t, err)
+
+		assert.Equal(t, len(rules), 3)
+		assert.Equal(t, rules[1], (risk.Rule)(&risk.WithdrawAfterWinRule{
+			Action:       service.RiskReject,
+			Window:       10 * time.Minute,
+			MinWinAmount: 1000,
+		}))
+	})
+
+	t.Run("returns error on unknown rule type", func(t *testing.T) {
+		riskConfig := risk.RiskConfig{Rules: []risk.RuleConfig{{Type: "unknown", Action: "flag"}}}
+
+		_, err := risk.NewRulesFromConfig(riskConfig)
+		if err == nil {
+			t.Errorf("did not get error but expected one")
+		}
+	})
+}
+
+func assertWalletBalance(t testing.TB, walletService *service.WalletService, walletID int, want float64) {
+	t.Helper()
+
+	got, err := walletService.GetBalance(walletID)
+	assert.RequireNoError(t, err)
+	assert.Equal(t, got, want)
+}
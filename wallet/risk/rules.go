@@ -0,0 +1,149 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+// Rule inspects a command against the wallet's recent history. Rules
+// return a decision with RiskAllow when they have nothing to say.
+type Rule interface {
+	Name() string
+	Evaluate(cmd service.Command, history []repository.Record, now time.Time) service.RiskDecision
+}
+
+// RapidCyclingRule catches money that is deposited and withdrawn again
+// repeatedly within a short window.
+type RapidCyclingRule struct {
+	Action    service.RiskAction
+	Window    time.Duration
+	MaxCycles int
+}
+
+func (r *RapidCyclingRule) Name() string {
+	return "rapid-cycling"
+}
+
+func (r *RapidCyclingRule) Evaluate(cmd service.Command, history []repository.Record, now time.Time) service.RiskDecision {
+	if cmd.Type != service.CommandWithdraw {
+		return allow()
+	}
+
+	cycles := 0
+	deposited := false
+	for _, record := range recent(history, now, r.Window) {
+		switch record.Event.(type) {
+		case *domain.WalletDeposited:
+			deposited = true
+		case *domain.WalletWithdrawed:
+			if deposited {
+				cycles++
+				deposited = false
+			}
+		}
+	}
+	if deposited {
+		// the command being evaluated closes another cycle
+		cycles++
+	}
+
+	if cycles < r.MaxCycles {
+		return allow()
+	}
+
+	return service.RiskDecision{
+		Action: r.Action,
+		Rule:   r.Name(),
+		Reason: fmt.Sprintf("%v deposit-withdraw cycles within %v", cycles, r.Window),
+	}
+}
+
+// WithdrawAfterWinRule catches withdrawals that follow a large win too
+// closely.
+type WithdrawAfterWinRule struct {
+	Action       service.RiskAction
+	Window       time.Duration
+	MinWinAmount float64
+}
+
+func (r *WithdrawAfterWinRule) Name() string {
+	return "withdraw-after-win"
+}
+
+func (r *WithdrawAfterWinRule) Evaluate(cmd service.Command, history []repository.Record, now time.Time) service.RiskDecision {
+	if cmd.Type != service.CommandWithdraw {
+		return allow()
+	}
+
+	for _, record := range recent(history, now, r.Window) {
+		won, ok := record.Event.(*domain.WalletWon)
+		if ok && won.Amount >= r.MinWinAmount {
+			return service.RiskDecision{
+				Action: r.Action,
+				Rule:   r.Name(),
+				Reason: fmt.Sprintf("withdrawal within %v of a win of %v", r.Window, won.Amount),
+			}
+		}
+	}
+
+	return allow()
+}
+
+// SmallDepositsRule catches many deposits below a threshold within a
+// window, a common way of staying under reporting limits.
+type SmallDepositsRule struct {
+	Action    service.RiskAction
+	Window    time.Duration
+	MaxAmount float64
+	MaxCount  int
+}
+
+func (r *SmallDepositsRule) Name() string {
+	return "small-deposits"
+}
+
+func (r *SmallDepositsRule) Evaluate(cmd service.Command, history []repository.Record, now time.Time) service.RiskDecision {
+	if cmd.Type != service.CommandDeposit || cmd.Amount > r.MaxAmount {
+		return allow()
+	}
+
+	// start from one to count the command being evaluated
+	count := 1
+	for _, record := range recent(history, now, r.Window) {
+		deposited, ok := record.Event.(*domain.WalletDeposited)
+		if ok && deposited.Amount <= r.MaxAmount {
+			count++
+		}
+	}
+
+	if count <= r.MaxCount {
+		return allow()
+	}
+
+	return service.RiskDecision{
+		Action: r.Action,
+		Rule:   r.Name(),
+		Reason: fmt.Sprintf("%v deposits of at most %v within %v", count, r.MaxAmount, r.Window),
+	}
+}
+
+func recent(history []repository.Record, now time.Time, window time.Duration) []repository.Record {
+	since := now.Add(-window)
+
+	// records are ordered by version and therefore by time
+	for i, record := range history {
+		if !record.RecordedAt.Before(since) {
+			return history[i:]
+		}
+	}
+
+	return nil
+}
+
+func allow() service.RiskDecision {
+	return service.RiskDecision{Action: service.RiskAllow}
+}
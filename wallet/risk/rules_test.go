@@ -0,0 +1,121 @@
+package risk_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/risk"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestRapidCyclingRule(t *testing.T) {
+	rule := &risk.RapidCyclingRule{Action: service.RiskFlag, Window: time.Hour, MaxCycles: 2}
+	withdraw := service.Command{Type: service.CommandWithdraw, WalletID: 12, Amount: 10}
+
+	t.Run("flags withdraw that completes too many cycles", func(t *testing.T) {
+		history := records(
+			at(-30*time.Minute, &domain.WalletDeposited{Amount: 10}),
+			at(-20*time.Minute, &domain.WalletWithdrawed{Amount: 10}),
+			at(-10*time.Minute, &domain.WalletDeposited{Amount: 10}),
+		)
+
+		decision := rule.Evaluate(withdraw, history, now)
+		assert.Equal(t, decision.Action, service.RiskFlag)
+		assert.Equal(t, decision.Rule, rule.Name())
+	})
+
+	t.Run("ignores cycles outside of the window", func(t *testing.T) {
+		history := records(
+			at(-3*time.Hour, &domain.WalletDeposited{Amount: 10}),
+			at(-2*time.Hour, &domain.WalletWithdrawed{Amount: 10}),
+			at(-10*time.Minute, &domain.WalletDeposited{Amount: 10}),
+		)
+
+		decision := rule.Evaluate(withdraw, history, now)
+		assert.Equal(t, decision.Action, service.RiskAllow)
+	})
+}
+
+func TestWithdrawAfterWinRule(t *testing.T) {
+	rule := &risk.WithdrawAfterWinRule{Action: service.RiskReject, Window: 10 * time.Minute, MinWinAmount: 1000}
+	withdraw := service.Command{Type: service.CommandWithdraw, WalletID: 12, Amount: 500}
+
+	t.Run("rejects withdraw right after a large win", func(t *testing.T) {
+		history := records(at(-time.Minute, &domain.WalletWon{Amount: 5000}))
+
+		decision := rule.Evaluate(withdraw, history, now)
+		assert.Equal(t, decision.Action, service.RiskReject)
+	})
+
+	t.Run("allows withdraw after a small win", func(t *testing.T) {
+		history := records(at(-time.Minute, &domain.WalletWon{Amount: 50}))
+
+		decision := rule.Evaluate(withdraw, history, now)
+		assert.Equal(t, decision.Action, service.RiskAllow)
+	})
+
+	t.Run("allows withdraw long after a large win", func(t *testing.T) {
+		history := records(at(-time.Hour, &domain.WalletWon{Amount: 5000}))
+
+		decision := rule.Evaluate(withdraw, history, now)
+		assert.Equal(t, decision.Action, service.RiskAllow)
+	})
+}
+
+func TestSmallDepositsRule(t *testing.T) {
+	rule := &risk.SmallDepositsRule{Action: service.RiskFlag, Window: time.Hour, MaxAmount: 10, MaxCount: 2}
+
+	t.Run("flags deposit exceeding the small deposits count", func(t *testing.T) {
+		history := records(
+			at(-20*time.Minute, &domain.WalletDeposited{Amount: 5}),
+			at(-10*time.Minute, &domain.WalletDeposited{Amount: 9}),
+		)
+		deposit := service.Command{Type: service.CommandDeposit, WalletID: 12, Amount: 5}
+
+		decision := rule.Evaluate(deposit, history, now)
+		assert.Equal(t, decision.Action, service.RiskFlag)
+	})
+
+	t.Run("ignores large deposits", func(t *testing.T) {
+		history := records(
+			at(-20*time.Minute, &domain.WalletDeposited{Amount: 500}),
+			at(-10*time.Minute, &domain.WalletDeposited{Amount: 9}),
+		)
+		deposit := service.Command{Type: service.CommandDeposit, WalletID: 12, Amount: 5}
+
+		decision := rule.Evaluate(deposit, history, now)
+		assert.Equal(t, decision.Action, service.RiskAllow)
+	})
+}
+
+type timedEvent struct {
+	offset time.Duration
+	event  domain.Event
+}
+
+func at(offset time.Duration, event domain.Event) timedEvent {
+	return timedEvent{offset: offset, event: event}
+}
+
+func records(events ...timedEvent) []repository.Record {
+	history := []repository.Record{{
+		Version:    1,
+		Event:      &domain.WalletCreated{ID: 12},
+		RecordedAt: now.Add(-24 * time.Hour),
+	}}
+
+	for i, e := range events {
+		history = append(history, repository.Record{
+			Version:    i + 2,
+			Event:      e.event,
+			RecordedAt: now.Add(e.offset),
+		})
+	}
+
+	return history
+}
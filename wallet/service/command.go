@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+)
+
+type CommandType byte
+
+const (
+	CommandCreate CommandType = iota
+	CommandDeposit
+	CommandWithdraw
+	CommandWin
+	CommandLose
+	CommandReserve
+	CommandRelease
+	CommandPayJackpot
+	CommandRefund
+)
+
+// Command is an operation on a single wallet. PoolID names the jackpot pool
+// a Lose contributes to and PayJackpot pays out of, 0 leaves pools out.
+// Settled marks money that already moved outside of the wallet, like a
+// deposit the payment provider confirmed, which risk rules may flag but not
+// reject.
+type Command struct {
+	Type     CommandType
+	WalletID int
+	Amount   float64
+	PoolID   int
+	Settled  bool
+
+	// paidOut receives the amount paid by a PayJackpot command
+	paidOut *float64
+}
+
+// apply runs the command against the wallet aggregate and, for commands
+// with a PoolID, the pool. A command may raise wallet events and still fail,
+// e.g. Lose marks the wallet spurious and returns ErrInsufficientFunds, so
+// callers must persist the raised events regardless of the returned error.
+// A failed command never raises pool events.
+func (c Command) apply(wallet *domain.Wallet, pool *domain.Pool) error {
+	if c.Type == CommandCreate {
+		return wallet.Create(c.WalletID)
+	}
+
+	if wallet.GetState() == domain.StateNew {
+		return ErrWalletNotFound
+	}
+	if pool != nil && pool.GetState() == domain.StateNew {
+		return ErrPoolNotFound
+	}
+
+	if c.Type == CommandPayJackpot {
+		return c.payJackpot(wallet, pool)
+	}
+	if c.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	switch c.Type {
+	case CommandDeposit:
+		return wallet.Deposit(c.Amount)
+	case CommandWithdraw:
+		return wallet.Withdraw(c.Amount)
+	case CommandWin:
+		return wallet.Win(c.Amount)
+	case CommandLose:
+		return c.lose(wallet, pool)
+	case CommandReserve:
+		return wallet.Reserve(c.Amount)
+	case CommandRelease:
+		return wallet.Release(c.Amount)
+	case CommandRefund:
+		return wallet.Refund(c.Amount)
+	}
+
+	return fmt.Errorf("unknown command type %v", c.Type)
+}
+
+// lose contributes to the pool only once the wallet covered the stake.
+func (c Command) lose(wallet *domain.Wallet, pool *domain.Pool) error {
+	err := wallet.Lose(c.Amount)
+	if err != nil || pool == nil {
+		return err
+	}
+
+	return pool.Contribute(c.WalletID, c.Amount)
+}
+
+// payJackpot pays the whole pool out to the wallet as a win. The win goes
+// first so that a wallet that can't take it leaves the pool untouched.
+func (c Command) payJackpot(wallet *domain.Wallet, pool *domain.Pool) error {
+	if pool == nil {
+		return ErrPoolNotFound
+	}
+
+	amount := pool.GetBalance()
+	if amount <= 0 {
+		return domain.ErrPoolEmpty
+	}
+
+	err := wallet.Win(amount)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Payout(c.WalletID)
+	if err == nil && c.paidOut != nil {
+		*c.paidOut = amount
+	}
+	return err
+}
+
+func walletStream(id int) string {
+	return fmt.Sprintf("wallet-%d", id)
+}
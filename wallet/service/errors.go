@@ -0,0 +1,34 @@
+package service
+
+type WalletServiceError struct {
+	msg string
+	err error
+}
+
+func NewWalletServiceError(msg string, err error) *WalletServiceError {
+	return &WalletServiceError{
+		msg: msg,
+		err: err,
+	}
+}
+
+func (w *WalletServiceError) Error() string {
+	return w.msg
+}
+
+func (w *WalletServiceError) Unwrap() error {
+	return w.err
+}
+
+var (
+	ErrWalletNotFound   = &WalletServiceError{msg: "wallet doesn't exist"}
+	ErrInvalidAmount    = &WalletServiceError{msg: "amount must be positive"}
+	ErrTooManyConflicts = &WalletServiceError{msg: "couldn't apply command due to concurrent modifications"}
+	ErrServiceClosed    = &WalletServiceError{msg: "wallet service is closed"}
+
+	ErrRejectedByRisk = &WalletServiceError{msg: "command rejected by risk rules"}
+
+	ErrPoolNotFound = &WalletServiceError{msg: "jackpot pool doesn't exist"}
+
+	ErrStreamingUnavailable = &WalletServiceError{msg: "wallet service has no event feed to stream from"}
+)
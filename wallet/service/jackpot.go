@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+)
+
+// WithJackpotPool makes every loss contribute the pool's share of the stake
+// to the given progressive jackpot pool.
+func WithJackpotPool(poolID int) Option {
+	return func(w *WalletService) {
+		w.jackpotPoolID = poolID
+	}
+}
+
+func (w *WalletService) CreatePool(poolID int, contributionRate float64) error {
+	return w.executePool(poolID, func(pool *domain.Pool) error {
+		return pool.Create(poolID, contributionRate)
+	})
+}
+
+func (w *WalletService) Seed(poolID int, amount float64) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	return w.executePool(poolID, func(pool *domain.Pool) error {
+		if pool.GetState() == domain.StateNew {
+			return ErrPoolNotFound
+		}
+		return pool.Seed(amount)
+	})
+}
+
+func (w *WalletService) GetPoolBalance(poolID int) (float64, error) {
+	pool, err := loadPool(w.store, poolID)
+	if err != nil {
+		return 0, err
+	}
+
+	if pool.GetState() == domain.StateNew {
+		return 0, ErrPoolNotFound
+	}
+
+	return pool.GetBalance(), nil
+}
+
+// PayJackpot pays the whole pool out to the wallet as a win and returns the
+// paid amount. Like every command on a wallet it goes through the wallet's
+// writer, the pool is appended in the same append.
+func (w *WalletService) PayJackpot(poolID, walletID int) (float64, error) {
+	var amount float64
+
+	err := w.Execute(Command{Type: CommandPayJackpot, WalletID: walletID, PoolID: poolID, paidOut: &amount})
+	if err != nil {
+		return 0, err
+	}
+
+	return amount, nil
+}
+
+// executePool runs commands that touch nothing but the pool. Pools are
+// written to by the writers of every wallet that plays into them, so they
+// rely on optimistic concurrency alone.
+func (w *WalletService) executePool(poolID int, cmd func(*domain.Pool) error) error {
+	for attempt := 0; attempt < defaultMaxRetries; attempt++ {
+		pool, err := loadPool(w.store, poolID)
+		if err != nil {
+			return err
+		}
+
+		cmdErr := cmd(&pool)
+		if len(pool.Events()) == 0 {
+			return cmdErr
+		}
+
+		err = w.store.Append(poolStream(poolID), pool.Version(), pool.Events())
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return NewWalletServiceError("couldn't append events", err)
+		}
+
+		return cmdErr
+	}
+
+	return ErrTooManyConflicts
+}
+
+func loadPool(store repository.EventStore, id int) (domain.Pool, error) {
+	events, err := store.Load(poolStream(id))
+	if err != nil {
+		return domain.Pool{}, NewWalletServiceError("couldn't load pool", err)
+	}
+
+	return domain.NewPoolFromEvents(events), nil
+}
+
+func poolStream(id int) string {
+	return fmt.Sprintf("pool-%d", id)
+}
@@ -0,0 +1,132 @@
+package service_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+func TestJackpot(t *testing.T) {
+	walletID := 12
+	poolID := 1
+
+	setup := func(t testing.TB, walletBalance float64, options ...service.Option) *service.WalletService {
+		t.Helper()
+
+		options = append(options, service.WithSingleWriter(service.DefaultMailboxConfig), service.WithJackpotPool(poolID))
+		walletService := service.NewWalletService(repository.NewInMemoryEventStore(), options...)
+		t.Cleanup(walletService.Close)
+
+		err := walletService.CreatePool(poolID, 0.1)
+		assert.RequireNoError(t, err)
+
+		createAndDeposit(t, walletService, walletID, walletBalance)
+
+		return walletService
+	}
+
+	t.Run("contributes a share of the lost stake to the pool", func(t *testing.T) {
+		walletService := setup(t, 100)
+
+		err := walletService.Lose(walletID, 50)
+		assert.RequireNoError(t, err)
+
+		assertWalletBalance(t, walletService, walletID, 50)
+		assertPoolBalance(t, walletService, poolID, 5)
+	})
+
+	t.Run("doesn't contribute when the wallet can't cover the stake", func(t *testing.T) {
+		walletService := setup(t, 10)
+
+		err := walletService.Lose(walletID, 50)
+		assert.Equal(t, err, domain.ErrInsufficientFunds)
+
+		// the wallet still turns spurious
+		err = walletService.Deposit(walletID, 10)
+		assert.Equal(t, err, domain.ErrStateSpurious)
+
+		assertPoolBalance(t, walletService, poolID, 0)
+	})
+
+	t.Run("contributes every loss of concurrent players", func(t *testing.T) {
+		walletService := setup(t, 100)
+
+		otherWalletID := walletID + 1
+		createAndDeposit(t, walletService, otherWalletID, 100)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			for _, id := range []int{walletID, otherWalletID} {
+				wg.Add(1)
+				go func(id int) {
+					defer wg.Done()
+					walletService.Lose(id, 10)
+				}(id)
+			}
+		}
+		wg.Wait()
+
+		assertWalletBalance(t, walletService, walletID, 0)
+		assertWalletBalance(t, walletService, otherWalletID, 0)
+		assertPoolBalance(t, walletService, poolID, 20)
+	})
+
+	t.Run("pays the jackpot out to the wallet as a win", func(t *testing.T) {
+		walletService := setup(t, 100)
+
+		err := walletService.Seed(poolID, 1000)
+		assert.RequireNoError(t, err)
+
+		amount, err := walletService.PayJackpot(poolID, walletID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, amount, float64(1000))
+
+		assertWalletBalance(t, walletService, walletID, 1100)
+		assertPoolBalance(t, walletService, poolID, 0)
+	})
+
+	t.Run("returns ErrPoolEmpty and leaves the wallet untouched on empty pool", func(t *testing.T) {
+		walletService := setup(t, 100)
+
+		_, err := walletService.PayJackpot(poolID, walletID)
+		assert.Equal(t, err, domain.ErrPoolEmpty)
+
+		assertWalletBalance(t, walletService, walletID, 100)
+	})
+
+	t.Run("returns ErrPoolNotFound on missing pool", func(t *testing.T) {
+		walletService := setup(t, 100)
+
+		_, err := walletService.PayJackpot(poolID+1, walletID)
+		assert.Equal(t, err, (error)(service.ErrPoolNotFound))
+
+		assertWalletBalance(t, walletService, walletID, 100)
+	})
+
+	t.Run("returns ErrWalletNotFound on missing wallet", func(t *testing.T) {
+		walletService := setup(t, 100)
+
+		err := walletService.Lose(walletID+1, 50)
+		assert.Equal(t, err, (error)(service.ErrWalletNotFound))
+	})
+}
+
+func assertWalletBalance(t testing.TB, walletService *service.WalletService, walletID int, want float64) {
+	t.Helper()
+
+	got, err := walletService.GetBalance(walletID)
+	assert.RequireNoError(t, err)
+	assert.Equal(t, got, want)
+}
+
+func assertPoolBalance(t testing.TB, walletService *service.WalletService, poolID int, want float64) {
+	t.Helper()
+
+	got, err := walletService.GetPoolBalance(poolID)
+	assert.RequireNoError(t, err)
+	assert.Equal(t, got, want)
+}
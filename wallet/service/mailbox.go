@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+)
+
+type MailboxConfig struct {
+	// MailboxSize is the number of commands that can be queued for a single
+	// wallet before senders start blocking.
+	MailboxSize int
+	// MaxBatchSize caps how many queued commands are folded into one append.
+	MaxBatchSize int
+	// IdleTimeout is how long a wallet's writer lives without receiving
+	// commands before it is torn down.
+	IdleTimeout time.Duration
+	// MaxRetries bounds how many times a batch is retried when another
+	// writer outside of the mailbox appended to the same stream.
+	MaxRetries int
+}
+
+var DefaultMailboxConfig = MailboxConfig{
+	MailboxSize:  256,
+	MaxBatchSize: 64,
+	IdleTimeout:  30 * time.Second,
+	MaxRetries:   defaultMaxRetries,
+}
+
+type envelope struct {
+	cmd    Command
+	result chan error
+}
+
+type walletActor struct {
+	walletID int
+	mailbox  chan envelope
+
+	// pending counts commands that were handed to this actor but not yet
+	// received from the mailbox. It is incremented under mailboxExecutor.mu
+	// so that an idle actor can safely decide to retire.
+	pending atomic.Int64
+}
+
+type mailboxExecutor struct {
+	runBatch batchRunner
+	config   MailboxConfig
+
+	mu     sync.Mutex
+	actors map[int]*walletActor
+	closed bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newMailboxExecutor(runBatch batchRunner, config MailboxConfig) *mailboxExecutor {
+	return &mailboxExecutor{
+		runBatch: runBatch,
+		config:   config,
+		actors:   make(map[int]*walletActor),
+		done:     make(chan struct{}),
+	}
+}
+
+func (m *mailboxExecutor) execute(cmd Command) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrServiceClosed
+	}
+
+	actor, ok := m.actors[cmd.WalletID]
+	if !ok {
+		actor = &walletActor{
+			walletID: cmd.WalletID,
+			mailbox:  make(chan envelope, m.config.MailboxSize),
+		}
+		m.actors[cmd.WalletID] = actor
+
+		m.wg.Add(1)
+		go m.run(actor)
+	}
+	actor.pending.Add(1)
+	m.mu.Unlock()
+
+	result := make(chan error, 1)
+	actor.mailbox <- envelope{cmd: cmd, result: result}
+
+	return <-result
+}
+
+func (m *mailboxExecutor) close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	close(m.done)
+	m.wg.Wait()
+}
+
+func (m *mailboxExecutor) run(actor *walletActor) {
+	defer m.wg.Done()
+
+	idle := time.NewTimer(m.config.IdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case env := <-actor.mailbox:
+			m.process(actor, env)
+			resetTimer(idle, m.config.IdleTimeout)
+		case <-idle.C:
+			if m.retire(actor) {
+				return
+			}
+			idle.Reset(m.config.IdleTimeout)
+		case <-m.done:
+			if m.retire(actor) {
+				return
+			}
+			m.process(actor, <-actor.mailbox)
+		}
+	}
+}
+
+// retire removes the actor once nobody is about to send to it.
+func (m *mailboxExecutor) retire(actor *walletActor) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if actor.pending.Load() != 0 {
+		return false
+	}
+
+	delete(m.actors, actor.walletID)
+	return true
+}
+
+func (m *mailboxExecutor) process(actor *walletActor, first envelope) {
+	actor.pending.Add(-1)
+	batch := []envelope{first}
+
+drain:
+	for len(batch) < m.config.MaxBatchSize {
+		select {
+		case env := <-actor.mailbox:
+			actor.pending.Add(-1)
+			batch = append(batch, env)
+		default:
+			break drain
+		}
+	}
+
+	results := m.applyBatch(actor.walletID, batch)
+	for i, env := range batch {
+		env.result <- results[i]
+	}
+}
+
+// applyBatch retries the whole batch when another writer outside of the
+// mailbox appended to the wallet's stream in the meantime.
+func (m *mailboxExecutor) applyBatch(walletID int, batch []envelope) []error {
+	cmds := make([]Command, len(batch))
+	for i, env := range batch {
+		cmds[i] = env.cmd
+	}
+
+	for attempt := 0; attempt < m.config.MaxRetries; attempt++ {
+		results, err := m.runBatch(walletID, cmds)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return repeatError(len(batch), err)
+		}
+
+		return results
+	}
+
+	return repeatError(len(batch), ErrTooManyConflicts)
+}
+
+func repeatError(n int, err error) []error {
+	results := make([]error, n)
+	for i := range results {
+		results[i] = err
+	}
+	return results
+}
+
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
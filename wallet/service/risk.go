@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+)
+
+type RiskAction byte
+
+const (
+	RiskAllow RiskAction = iota
+	RiskFlag
+	RiskReject
+)
+
+type RiskDecision struct {
+	Action RiskAction
+	Rule   string
+	Reason string
+}
+
+// RiskEngine is consulted before a command is applied to an existing
+// wallet. history holds the wallet's committed events followed by the ones
+// raised earlier in the same batch. Evaluate returns the flag and reject
+// decisions the command triggered, the most severe of them wins. Record is
+// called with them once per command, after its batch was committed.
+type RiskEngine interface {
+	Evaluate(cmd Command, history []repository.Record) []RiskDecision
+	Record(cmd Command, decisions []RiskDecision)
+}
+
+func WithRiskEngine(engine RiskEngine) Option {
+	return func(w *WalletService) {
+		w.risk = engine
+	}
+}
+
+// applyCommand returns the risk decisions taken on the command alongside
+// its result. A flag is only raised, and decisions only returned, once the
+// command applied, a command that fails anyway leaves nothing to flag.
+func (w *WalletService) applyCommand(cmd Command, wallet *domain.Wallet, pool *domain.Pool, history []repository.Record) ([]RiskDecision, error) {
+	if w.risk == nil || cmd.Type == CommandCreate || wallet.GetState() == domain.StateNew {
+		return nil, cmd.apply(wallet, pool)
+	}
+
+	decisions := w.risk.Evaluate(cmd, history)
+	if cmd.Settled {
+		for i := range decisions {
+			decisions[i].Action = min(decisions[i].Action, RiskFlag)
+		}
+	}
+
+	decision := mostSevere(decisions)
+	if decision.Action == RiskReject {
+		msg := fmt.Sprintf("command rejected by risk rule %v: %v", decision.Rule, decision.Reason)
+		return decisions, NewWalletServiceError(msg, ErrRejectedByRisk)
+	}
+
+	err := cmd.apply(wallet, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	if decision.Action == RiskFlag {
+		if err := wallet.Flag(decision.Rule, decision.Reason); err != nil {
+			return nil, err
+		}
+	}
+
+	return decisions, nil
+}
+
+func mostSevere(decisions []RiskDecision) RiskDecision {
+	final := RiskDecision{Action: RiskAllow}
+	for _, decision := range decisions {
+		if decision.Action > final.Action {
+			final = decision
+		}
+	}
+	return final
+}
+
+type riskDecisions struct {
+	cmd       Command
+	decisions []RiskDecision
+}
+
+func (w *WalletService) recordRiskDecisions(decided []riskDecisions) {
+	for _, d := range decided {
+		w.risk.Record(d.cmd, d.decisions)
+	}
+}
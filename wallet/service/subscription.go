@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+)
+
+type WalletUpdate struct {
+	WalletID int
+	Version  int
+	Event    domain.Event
+	Balance  float64
+}
+
+// WithEventFeed enables Subscribe by giving the service a feed of
+// committed events to follow.
+func WithEventFeed(feed repository.EventFeed) Option {
+	return func(w *WalletService) {
+		w.feed = feed
+	}
+}
+
+// Subscribe streams the wallet's events, each paired with the balance right
+// after it, starting with the first event newer than lastSeenVersion. The
+// returned channel is closed once ctx is done or the stream can't continue.
+func (w *WalletService) Subscribe(ctx context.Context, id int, lastSeenVersion int) (<-chan WalletUpdate, error) {
+	if w.feed == nil {
+		return nil, ErrStreamingUnavailable
+	}
+
+	records, unsubscribe := w.feed.Subscribe(walletStream(id))
+
+	events, err := w.store.Load(walletStream(id))
+	if err != nil {
+		unsubscribe()
+		return nil, NewWalletServiceError("couldn't load wallet", err)
+	}
+	if len(events) == 0 {
+		unsubscribe()
+		return nil, ErrWalletNotFound
+	}
+
+	streamer := &walletStreamer{
+		walletService:   w,
+		walletID:        id,
+		lastSeenVersion: lastSeenVersion,
+		wallet:          domain.NewWallet(),
+		updates:         make(chan WalletUpdate),
+	}
+	go streamer.run(ctx, events, records, unsubscribe)
+
+	return streamer.updates, nil
+}
+
+type walletStreamer struct {
+	walletService   *WalletService
+	walletID        int
+	lastSeenVersion int
+
+	wallet  domain.Wallet
+	version int
+	updates chan WalletUpdate
+}
+
+func (s *walletStreamer) run(ctx context.Context, events []domain.Event, records <-chan repository.Record, unsubscribe func()) {
+	defer close(s.updates)
+	defer func() { unsubscribe() }()
+
+	if !s.catchUp(ctx, events) {
+		return
+	}
+
+	stream := walletStream(s.walletID)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case record, ok := <-records:
+			if !ok || record.Version > s.version+1 {
+				// we fell behind the feed, so resubscribe if needed and
+				// fill the gap from the store
+				if !ok {
+					records, unsubscribe = s.walletService.feed.Subscribe(stream)
+				}
+
+				events, err := s.walletService.store.Load(stream)
+				if err != nil || !s.catchUp(ctx, events) {
+					return
+				}
+				continue
+			}
+			if record.Version <= s.version {
+				continue
+			}
+
+			if !s.apply(ctx, record.Event) {
+				return
+			}
+		}
+	}
+}
+
+// catchUp applies the events from the stream that weren't applied yet.
+func (s *walletStreamer) catchUp(ctx context.Context, events []domain.Event) bool {
+	for s.version < len(events) {
+		if !s.apply(ctx, events[s.version]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *walletStreamer) apply(ctx context.Context, event domain.Event) bool {
+	s.wallet.On(event, false)
+	s.version++
+
+	if s.version <= s.lastSeenVersion {
+		return true
+	}
+
+	update := WalletUpdate{
+		WalletID: s.walletID,
+		Version:  s.version,
+		Event:    event,
+		Balance:  s.wallet.GetBalance(),
+	}
+
+	select {
+	case s.updates <- update:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
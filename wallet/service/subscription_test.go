@@ -0,0 +1,165 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+func TestSubscribe(t *testing.T) {
+	t.Run("streams history followed by live updates with balances", func(t *testing.T) {
+		walletID := 12
+
+		walletService := newStreamingWalletService()
+		defer walletService.Close()
+
+		createAndDeposit(t, walletService, walletID, 100)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, err := walletService.Subscribe(ctx, walletID, 0)
+		assert.RequireNoError(t, err)
+
+		update := receiveUpdate(t, updates)
+		assert.Equal(t, update.Version, 1)
+		assert.Type[*domain.WalletCreated](t, update.Event)
+
+		update = receiveUpdate(t, updates)
+		assert.Equal(t, update.Version, 2)
+		assert.Equal(t, update.Balance, float64(100))
+
+		err = walletService.Withdraw(walletID, 40)
+		assert.RequireNoError(t, err)
+
+		update = receiveUpdate(t, updates)
+		assert.Equal(t, update.Version, 3)
+		assert.Type[*domain.WalletWithdrawed](t, update.Event)
+		assert.Equal(t, update.Balance, float64(60))
+	})
+
+	t.Run("resumes after the last seen version", func(t *testing.T) {
+		walletID := 12
+
+		walletService := newStreamingWalletService()
+		defer walletService.Close()
+
+		createAndDeposit(t, walletService, walletID, 100)
+		err := walletService.Win(walletID, 50)
+		assert.RequireNoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, err := walletService.Subscribe(ctx, walletID, 2)
+		assert.RequireNoError(t, err)
+
+		update := receiveUpdate(t, updates)
+		assert.Equal(t, update.Version, 3)
+		assert.Equal(t, update.Balance, float64(150))
+	})
+
+	t.Run("recovers events dropped while the subscriber lagged", func(t *testing.T) {
+		walletID := 12
+		depositsCount := 200
+
+		walletService := newStreamingWalletService()
+		defer walletService.Close()
+
+		createAndDeposit(t, walletService, walletID, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, err := walletService.Subscribe(ctx, walletID, 2)
+		assert.RequireNoError(t, err)
+
+		for i := 0; i < depositsCount; i++ {
+			err = walletService.Deposit(walletID, 1)
+			assert.RequireNoError(t, err)
+		}
+
+		var update service.WalletUpdate
+		for update.Version < depositsCount+2 {
+			update = receiveUpdate(t, updates)
+		}
+		assert.Equal(t, update.Balance, float64(depositsCount+1))
+	})
+
+	t.Run("closes the channel when the context is canceled", func(t *testing.T) {
+		walletID := 12
+
+		walletService := newStreamingWalletService()
+		defer walletService.Close()
+
+		createAndDeposit(t, walletService, walletID, 100)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		updates, err := walletService.Subscribe(ctx, walletID, 2)
+		assert.RequireNoError(t, err)
+
+		cancel()
+
+		select {
+		case _, ok := <-updates:
+			if ok {
+				t.Errorf("got update after cancel, want closed channel")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("channel wasn't closed after cancel")
+		}
+	})
+
+	t.Run("returns ErrWalletNotFound on missing wallet", func(t *testing.T) {
+		walletService := newStreamingWalletService()
+		defer walletService.Close()
+
+		_, err := walletService.Subscribe(context.Background(), 12, 0)
+		assert.Equal(t, err, (error)(service.ErrWalletNotFound))
+	})
+
+	t.Run("returns ErrStreamingUnavailable without an event feed", func(t *testing.T) {
+		walletService := service.NewWalletService(repository.NewInMemoryEventStore())
+		defer walletService.Close()
+
+		_, err := walletService.Subscribe(context.Background(), 12, 0)
+		assert.Equal(t, err, (error)(service.ErrStreamingUnavailable))
+	})
+}
+
+func newStreamingWalletService() *service.WalletService {
+	store := repository.NewInMemoryEventStore()
+	return service.NewWalletService(store, service.WithEventFeed(store))
+}
+
+func createAndDeposit(t testing.TB, walletService *service.WalletService, walletID int, amount float64) {
+	t.Helper()
+
+	err := walletService.Create(walletID)
+	assert.RequireNoError(t, err)
+
+	err = walletService.Deposit(walletID, amount)
+	assert.RequireNoError(t, err)
+}
+
+func receiveUpdate(t testing.TB, updates <-chan service.WalletUpdate) service.WalletUpdate {
+	t.Helper()
+
+	select {
+	case update, ok := <-updates:
+		if !ok {
+			t.Fatalf("updates channel closed unexpectedly")
+		}
+		return update
+	case <-time.After(time.Second):
+		t.Fatalf("didn't receive update in time")
+	}
+
+	return service.WalletUpdate{}
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+)
+
+const defaultMaxRetries = 10
+
+type executor interface {
+	execute(Command) error
+	close()
+}
+
+type Option func(*WalletService)
+
+// WithSingleWriter routes all commands for a wallet through a dedicated
+// mailbox so that they are applied by a single goroutine and batched into
+// one append instead of racing each other on the event stream.
+func WithSingleWriter(config MailboxConfig) Option {
+	return func(w *WalletService) {
+		w.mailboxConfig = &config
+	}
+}
+
+type WalletService struct {
+	store    repository.EventStore
+	feed     repository.EventFeed
+	risk     RiskEngine
+	executor executor
+
+	mailboxConfig *MailboxConfig
+	jackpotPoolID int
+}
+
+func NewWalletService(store repository.EventStore, options ...Option) *WalletService {
+	walletService := &WalletService{
+		store: store,
+	}
+
+	for _, option := range options {
+		option(walletService)
+	}
+
+	if walletService.mailboxConfig != nil {
+		walletService.executor = newMailboxExecutor(walletService.runBatch, *walletService.mailboxConfig)
+	} else {
+		walletService.executor = newOptimisticExecutor(walletService.runBatch, defaultMaxRetries)
+	}
+
+	return walletService
+}
+
+func (w *WalletService) Create(userID int) error {
+	return w.Execute(Command{Type: CommandCreate, WalletID: userID})
+}
+
+func (w *WalletService) Deposit(id int, amount float64) error {
+	return w.Execute(Command{Type: CommandDeposit, WalletID: id, Amount: amount})
+}
+
+// DepositSettled credits money the payment provider already took from the
+// player. Risk rules can only flag it, since refusing it would lose the
+// money.
+func (w *WalletService) DepositSettled(id int, amount float64) error {
+	return w.Execute(Command{Type: CommandDeposit, WalletID: id, Amount: amount, Settled: true})
+}
+
+func (w *WalletService) Withdraw(id int, amount float64) error {
+	return w.Execute(Command{Type: CommandWithdraw, WalletID: id, Amount: amount})
+}
+
+func (w *WalletService) Win(id int, amount float64) error {
+	return w.Execute(Command{Type: CommandWin, WalletID: id, Amount: amount})
+}
+
+// Lose charges the stake to the wallet and, with WithJackpotPool, feeds
+// the pool's share of it to the jackpot in the same append.
+func (w *WalletService) Lose(id int, amount float64) error {
+	return w.Execute(Command{Type: CommandLose, WalletID: id, Amount: amount, PoolID: w.jackpotPoolID})
+}
+
+func (w *WalletService) Reserve(id int, amount float64) error {
+	return w.Execute(Command{Type: CommandReserve, WalletID: id, Amount: amount})
+}
+
+func (w *WalletService) Release(id int, amount float64) error {
+	return w.Execute(Command{Type: CommandRelease, WalletID: id, Amount: amount})
+}
+
+// Refund returns the money of a withdrawal that didn't go through, like a
+// payout the provider failed.
+func (w *WalletService) Refund(id int, amount float64) error {
+	return w.Execute(Command{Type: CommandRefund, WalletID: id, Amount: amount, Settled: true})
+}
+
+func (w *WalletService) Execute(cmd Command) error {
+	return w.executor.execute(cmd)
+}
+
+func (w *WalletService) GetBalance(id int) (float64, error) {
+	wallet, err := loadWallet(w.store, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if wallet.GetState() == domain.StateNew {
+		return 0, ErrWalletNotFound
+	}
+
+	return wallet.GetBalance(), nil
+}
+
+// Close stops accepting commands and waits for in-flight ones to finish.
+func (w *WalletService) Close() {
+	w.executor.close()
+}
+
+// runBatch applies the commands in order to the same wallet and persists
+// all raised events with a single append, together with those of the pools
+// the commands touched. The returned slice holds each command's own result,
+// while the error reports a failure to load or append, including
+// repository.ErrVersionConflict.
+func (w *WalletService) runBatch(walletID int, cmds []Command) ([]error, error) {
+	wallet, history, err := w.loadWalletHistory(walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	pools := make(map[int]*domain.Pool)
+
+	var decided []riskDecisions
+	results := make([]error, len(cmds))
+	for i, cmd := range cmds {
+		var pool *domain.Pool
+		if cmd.PoolID != 0 {
+			pool, err = w.batchPool(pools, cmd.PoolID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		applied := len(wallet.Events())
+
+		var decisions []RiskDecision
+		decisions, results[i] = w.applyCommand(cmd, &wallet, pool, history)
+		if len(decisions) != 0 {
+			decided = append(decided, riskDecisions{cmd, decisions})
+		}
+
+		// later commands of the batch must see the events raised by the
+		// earlier ones as part of the history
+		for j, event := range wallet.Events()[applied:] {
+			history = append(history, repository.Record{
+				Stream:     walletStream(walletID),
+				Version:    wallet.Version() + applied + j + 1,
+				Event:      event,
+				RecordedAt: time.Now(),
+			})
+		}
+	}
+
+	err = w.appendBatch(walletID, &wallet, pools)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return results, err
+	}
+	if err != nil {
+		return nil, NewWalletServiceError("couldn't append events", err)
+	}
+
+	// a batch that gets retried is evaluated again, so decisions are only
+	// recorded once it is committed
+	w.recordRiskDecisions(decided)
+
+	return results, nil
+}
+
+// batchPool loads a pool the first time a command of the batch touches it.
+func (w *WalletService) batchPool(pools map[int]*domain.Pool, poolID int) (*domain.Pool, error) {
+	if pool, ok := pools[poolID]; ok {
+		return pool, nil
+	}
+
+	pool, err := loadPool(w.store, poolID)
+	if err != nil {
+		return nil, err
+	}
+
+	pools[poolID] = &pool
+	return &pool, nil
+}
+
+func (w *WalletService) appendBatch(walletID int, wallet *domain.Wallet, pools map[int]*domain.Pool) error {
+	var appends []repository.StreamAppend
+	if len(wallet.Events()) != 0 {
+		appends = append(appends, repository.StreamAppend{
+			Stream:          walletStream(walletID),
+			ExpectedVersion: wallet.Version(),
+			Events:          wallet.Events(),
+		})
+	}
+	for poolID, pool := range pools {
+		if len(pool.Events()) != 0 {
+			appends = append(appends, repository.StreamAppend{
+				Stream:          poolStream(poolID),
+				ExpectedVersion: pool.Version(),
+				Events:          pool.Events(),
+			})
+		}
+	}
+
+	switch len(appends) {
+	case 0:
+		return nil
+	case 1:
+		return w.store.Append(appends[0].Stream, appends[0].ExpectedVersion, appends[0].Events)
+	default:
+		return w.store.AppendAll(appends...)
+	}
+}
+
+func (w *WalletService) loadWalletHistory(id int) (domain.Wallet, []repository.Record, error) {
+	records, err := w.store.LoadRecords(walletStream(id))
+	if err != nil {
+		return domain.Wallet{}, nil, NewWalletServiceError("couldn't load wallet", err)
+	}
+
+	wallet := domain.NewWallet()
+	for _, record := range records {
+		wallet.On(record.Event, false)
+	}
+
+	return wallet, records, nil
+}
+
+func loadWallet(store repository.EventStore, id int) (domain.Wallet, error) {
+	events, err := store.Load(walletStream(id))
+	if err != nil {
+		return domain.Wallet{}, NewWalletServiceError("couldn't load wallet", err)
+	}
+
+	return domain.NewWalletFromEvents(events), nil
+}
+
+type batchRunner func(walletID int, cmds []Command) ([]error, error)
+
+type optimisticExecutor struct {
+	runBatch   batchRunner
+	maxRetries int
+}
+
+func newOptimisticExecutor(runBatch batchRunner, maxRetries int) *optimisticExecutor {
+	return &optimisticExecutor{
+		runBatch:   runBatch,
+		maxRetries: maxRetries,
+	}
+}
+
+func (o *optimisticExecutor) execute(cmd Command) error {
+	for attempt := 0; attempt < o.maxRetries; attempt++ {
+		results, err := o.runBatch(cmd.WalletID, []Command{cmd})
+		if errors.Is(err, repository.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		return results[0]
+	}
+
+	return ErrTooManyConflicts
+}
+
+func (o *optimisticExecutor) close() {}
@@ -0,0 +1,286 @@
+package service_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VitoNaychev/elysium-challenge/assert"
+	"github.com/VitoNaychev/elysium-challenge/wallet/domain"
+	"github.com/VitoNaychev/elysium-challenge/wallet/repository"
+	"github.com/VitoNaychev/elysium-challenge/wallet/service"
+)
+
+type SpyEventStore struct {
+	*repository.InMemoryEventStore
+
+	mu          sync.Mutex
+	appendCalls int
+	loadGate    chan struct{}
+}
+
+func NewSpyEventStore() *SpyEventStore {
+	return &SpyEventStore{
+		InMemoryEventStore: repository.NewInMemoryEventStore(),
+	}
+}
+
+func (s *SpyEventStore) LoadRecords(stream string) ([]repository.Record, error) {
+	if s.loadGate != nil {
+		<-s.loadGate
+	}
+	return s.InMemoryEventStore.LoadRecords(stream)
+}
+
+func (s *SpyEventStore) Append(stream string, expectedVersion int, events []domain.Event) error {
+	s.mu.Lock()
+	s.appendCalls++
+	s.mu.Unlock()
+
+	return s.InMemoryEventStore.Append(stream, expectedVersion, events)
+}
+
+// LatencyEventStore simulates the round trip to a real database, which is
+// what makes optimistic retries expensive under contention.
+type LatencyEventStore struct {
+	*repository.InMemoryEventStore
+
+	latency time.Duration
+}
+
+func (l *LatencyEventStore) LoadRecords(stream string) ([]repository.Record, error) {
+	time.Sleep(l.latency)
+	return l.InMemoryEventStore.LoadRecords(stream)
+}
+
+func (l *LatencyEventStore) Append(stream string, expectedVersion int, events []domain.Event) error {
+	time.Sleep(l.latency)
+	return l.InMemoryEventStore.Append(stream, expectedVersion, events)
+}
+
+func TestWalletService(t *testing.T) {
+	modes := map[string][]service.Option{
+		"optimistic":    nil,
+		"single writer": {service.WithSingleWriter(service.DefaultMailboxConfig)},
+	}
+
+	for name, options := range modes {
+		t.Run(name, func(t *testing.T) {
+			t.Run("creates wallet and applies deposit", func(t *testing.T) {
+				walletID := 12
+				depositAmount := float64(100.99)
+
+				walletService := service.NewWalletService(repository.NewInMemoryEventStore(), options...)
+				defer walletService.Close()
+
+				err := walletService.Create(walletID)
+				assert.RequireNoError(t, err)
+
+				err = walletService.Deposit(walletID, depositAmount)
+				assert.RequireNoError(t, err)
+
+				gotBalance, err := walletService.GetBalance(walletID)
+				assert.RequireNoError(t, err)
+				assert.Equal(t, gotBalance, depositAmount)
+			})
+
+			t.Run("returns ErrWalletNotFound on command for missing wallet", func(t *testing.T) {
+				walletService := service.NewWalletService(repository.NewInMemoryEventStore(), options...)
+				defer walletService.Close()
+
+				err := walletService.Deposit(12, 10)
+				assert.Equal(t, err, (error)(service.ErrWalletNotFound))
+			})
+
+			t.Run("returns ErrInvalidAmount on non-positive amount", func(t *testing.T) {
+				walletID := 12
+
+				walletService := service.NewWalletService(repository.NewInMemoryEventStore(), options...)
+				defer walletService.Close()
+
+				err := walletService.Create(walletID)
+				assert.RequireNoError(t, err)
+
+				err = walletService.Deposit(walletID, -10)
+				assert.Equal(t, err, (error)(service.ErrInvalidAmount))
+			})
+
+			t.Run("persists spurious event on lose with insufficient funds", func(t *testing.T) {
+				walletID := 12
+
+				walletService := service.NewWalletService(repository.NewInMemoryEventStore(), options...)
+				defer walletService.Close()
+
+				err := walletService.Create(walletID)
+				assert.RequireNoError(t, err)
+
+				err = walletService.Lose(walletID, 10)
+				assert.Equal(t, err, domain.ErrInsufficientFunds)
+
+				err = walletService.Deposit(walletID, 10)
+				assert.Equal(t, err, domain.ErrStateSpurious)
+			})
+
+			t.Run("applies every concurrent command to a hot wallet", func(t *testing.T) {
+				walletID := 12
+				commandsCount := 100
+
+				walletService := service.NewWalletService(repository.NewInMemoryEventStore(), options...)
+				defer walletService.Close()
+
+				err := walletService.Create(walletID)
+				assert.RequireNoError(t, err)
+
+				var wg sync.WaitGroup
+				for i := 0; i < commandsCount; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						// the optimistic path may legitimately give up
+						// under contention, retry until it goes through
+						for walletService.Deposit(walletID, 1) == service.ErrTooManyConflicts {
+						}
+					}()
+				}
+				wg.Wait()
+
+				gotBalance, err := walletService.GetBalance(walletID)
+				assert.RequireNoError(t, err)
+				assert.Equal(t, gotBalance, float64(commandsCount))
+			})
+		})
+	}
+}
+
+func TestSingleWriter(t *testing.T) {
+	t.Run("batches queued commands into a single append", func(t *testing.T) {
+		walletID := 12
+		commandsCount := 10
+
+		store := NewSpyEventStore()
+		walletService := service.NewWalletService(store, service.WithSingleWriter(service.DefaultMailboxConfig))
+		defer walletService.Close()
+
+		err := walletService.Create(walletID)
+		assert.RequireNoError(t, err)
+
+		// hold the writer on its first load so that the remaining commands
+		// pile up in the mailbox
+		store.loadGate = make(chan struct{})
+
+		var wg sync.WaitGroup
+		for i := 0; i < commandsCount; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				walletService.Deposit(walletID, 1)
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(store.loadGate)
+		wg.Wait()
+
+		// one append for Create, at most two for the deposits: the one the
+		// writer picked up first and the batch that queued behind it
+		if store.appendCalls > 3 {
+			t.Errorf("got %v appends want at most 3", store.appendCalls)
+		}
+
+		gotBalance, err := walletService.GetBalance(walletID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, gotBalance, float64(commandsCount))
+	})
+
+	t.Run("returns each command's own result within a batch", func(t *testing.T) {
+		walletID := 12
+
+		store := NewSpyEventStore()
+		walletService := service.NewWalletService(store, service.WithSingleWriter(service.DefaultMailboxConfig))
+		defer walletService.Close()
+
+		err := walletService.Create(walletID)
+		assert.RequireNoError(t, err)
+		err = walletService.Deposit(walletID, 50)
+		assert.RequireNoError(t, err)
+
+		store.loadGate = make(chan struct{})
+
+		var (
+			wg          sync.WaitGroup
+			withdrawErr error
+			depositErr  error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			withdrawErr = walletService.Withdraw(walletID, 100)
+		}()
+		go func() {
+			defer wg.Done()
+			depositErr = walletService.Deposit(walletID, 25)
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		close(store.loadGate)
+		wg.Wait()
+
+		assert.Equal(t, withdrawErr, domain.ErrInsufficientFunds)
+		assert.RequireNoError(t, depositErr)
+
+		gotBalance, err := walletService.GetBalance(walletID)
+		assert.RequireNoError(t, err)
+		assert.Equal(t, gotBalance, float64(75))
+	})
+
+	t.Run("returns ErrServiceClosed after Close", func(t *testing.T) {
+		walletService := service.NewWalletService(repository.NewInMemoryEventStore(),
+			service.WithSingleWriter(service.DefaultMailboxConfig))
+		walletService.Close()
+
+		err := walletService.Create(12)
+		assert.Equal(t, err, (error)(service.ErrServiceClosed))
+	})
+}
+
+func BenchmarkHotWallet(b *testing.B) {
+	modes := map[string][]service.Option{
+		"optimistic":    nil,
+		"single writer": {service.WithSingleWriter(service.DefaultMailboxConfig)},
+	}
+
+	for name, options := range modes {
+		b.Run(name, func(b *testing.B) {
+			walletID := 12
+
+			store := &LatencyEventStore{
+				InMemoryEventStore: repository.NewInMemoryEventStore(),
+				latency:            100 * time.Microsecond,
+			}
+			walletService := service.NewWalletService(store, options...)
+			defer walletService.Close()
+
+			err := walletService.Create(walletID)
+			assert.RequireNoError(b, err)
+
+			var (
+				mu       sync.Mutex
+				failures int
+			)
+
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if walletService.Deposit(walletID, 1) != nil {
+						mu.Lock()
+						failures++
+						mu.Unlock()
+					}
+				}
+			})
+
+			b.ReportMetric(float64(failures)/float64(b.N), "failures/op")
+		})
+	}
+}